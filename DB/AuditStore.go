@@ -0,0 +1,202 @@
+package DB
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditPromoteUser      = "user.promote"
+	AuditDemoteUser       = "user.demote"
+	AuditBanUser          = "user.ban"
+	AuditUnbanUser        = "user.unban"
+	AuditMuteUser         = "user.mute"
+	AuditUnmuteUser       = "user.unmute"
+	AuditApproveReport    = "report.approve"
+	AuditRejectReport     = "report.reject"
+	AuditHidePost         = "post.hide"
+	AuditDeletePost       = "post.delete"
+	AuditRestorePost      = "post.restore"
+	AuditLockPost         = "post.lock"
+	AuditUnlockPost       = "post.unlock"
+	AuditPinPost          = "post.pin"
+	AuditUnpinPost        = "post.unpin"
+	AuditDeleteComment    = "comment.delete"
+	AuditAddCategory      = "category.add"
+	AuditDeleteCategory   = "category.delete"
+	AuditAddFilterRule    = "filter.add"
+	AuditDeleteFilterRule = "filter.delete"
+	AuditApproveContent   = "content.approve"
+	AuditRejectContent    = "content.reject"
+)
+
+// AuditActions lists every action recorded in the audit log.
+var AuditActions = []string{
+	AuditPromoteUser, AuditDemoteUser, AuditBanUser, AuditUnbanUser, AuditMuteUser, AuditUnmuteUser,
+	AuditApproveReport, AuditRejectReport,
+	AuditHidePost, AuditDeletePost, AuditRestorePost, AuditLockPost, AuditUnlockPost,
+	AuditPinPost, AuditUnpinPost, AuditDeleteComment, AuditAddCategory, AuditDeleteCategory,
+	AuditAddFilterRule, AuditDeleteFilterRule, AuditApproveContent, AuditRejectContent,
+}
+
+// Things an audited action can be done to.
+const (
+	AuditTargetUser     = "user"
+	AuditTargetPost     = "post"
+	AuditTargetComment  = "comment"
+	AuditTargetReport   = "report"
+	AuditTargetCategory = "category"
+	AuditTargetFilter   = "filter_rule"
+)
+
+// auditPageSize is how many entries a page of the audit log holds.
+const auditPageSize = 50
+
+const (
+	insertAuditQuery = `INSERT INTO AuditLog (ActorID, Action, TargetType, TargetID, Details) VALUES (?, ?, ?, ?, ?)`
+	selectAuditQuery = `
+        SELECT a.AuditID, a.ActorID, COALESCE(u.username, ''), a.Action, a.TargetType, a.TargetID, a.Details, a.CreatedAt
+        FROM AuditLog a
+        LEFT JOIN User u ON u.UserID = a.ActorID
+    `
+)
+
+// AuditEntry is one privileged action: who did what to which target, and when. Actor is empty
+// once the acting user is gone.
+type AuditEntry struct {
+	AuditID    int       `json:"auditId"`
+	ActorID    int       `json:"actorId"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"targetType"`
+	TargetID   int       `json:"targetId"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// AuditFilter narrows down the audit log. Empty fields match every entry; From and To bound the
+// time of the entries, To excluded. Before continues a listing from the entry with that ID.
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   int
+	From       time.Time
+	To         time.Time
+	Before     int
+}
+
+// AuditPage is a page of the audit log, newest first. NextBefore is the Before of the next
+// page, or 0 on the last one.
+type AuditPage struct {
+	Entries    []AuditEntry `json:"entries"`
+	NextBefore int          `json:"nextBefore"`
+}
+
+// AuditStore reads the audit log. Entries are written with RecordAudit, as part of the action
+// they record.
+type AuditStore struct {
+	db *sql.DB
+}
+
+// NewAuditStore returns an AuditStore backed by db.
+func NewAuditStore(db *sql.DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+// ValidAuditAction reports whether action is one of the AuditActions.
+func ValidAuditAction(action string) bool {
+	for _, a := range AuditActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidAuditTarget reports whether targetType is something an audited action can be done to.
+func ValidAuditTarget(targetType string) bool {
+	switch targetType {
+	case AuditTargetUser, AuditTargetPost, AuditTargetComment, AuditTargetReport, AuditTargetCategory, AuditTargetFilter:
+		return true
+	}
+	return false
+}
+
+// RecordAudit adds an entry for action, done by actorID to the target, to the audit log within tx,
+// so that the entry is kept if and only if the action is.
+func RecordAudit(tx *sql.Tx, actorID int, action, targetType string, targetID int, details string) error {
+	if _, err := tx.Exec(insertAuditQuery, actorID, action, targetType, targetID, details); err != nil {
+		return fmt.Errorf("error recording audit entry: %v", err)
+	}
+	return nil
+}
+
+// List returns a page of the audit entries matching filter, newest first.
+func (s *AuditStore) List(filter AuditFilter) (AuditPage, error) {
+	var where []string
+	var args []interface{}
+	if filter.Actor != "" {
+		where = append(where, "u.username = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		where = append(where, "a.Action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		where = append(where, "a.TargetType = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID > 0 {
+		where = append(where, "a.TargetID = ?")
+		args = append(args, filter.TargetID)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "julianday(a.CreatedAt) >= julianday(?)")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "julianday(a.CreatedAt) < julianday(?)")
+		args = append(args, filter.To.UTC())
+	}
+	if filter.Before > 0 {
+		where = append(where, "a.AuditID < ?")
+		args = append(args, filter.Before)
+	}
+
+	query := selectAuditQuery
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// one entry more than a page tells whether there is a next page
+	query += " ORDER BY a.AuditID DESC LIMIT ?"
+	args = append(args, auditPageSize+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return AuditPage{}, fmt.Errorf("error querying audit log: %v", err)
+	}
+	defer rows.Close()
+
+	page := AuditPage{Entries: []AuditEntry{}}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.AuditID, &e.ActorID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &e.Details, &e.CreatedAt); err != nil {
+			return AuditPage{}, fmt.Errorf("error scanning audit entry: %v", err)
+		}
+		page.Entries = append(page.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return AuditPage{}, fmt.Errorf("error reading audit log: %v", err)
+	}
+
+	if len(page.Entries) > auditPageSize {
+		page.Entries = page.Entries[:auditPageSize]
+		page.NextBefore = page.Entries[auditPageSize-1].AuditID
+	}
+	return page, nil
+}
@@ -0,0 +1,123 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrCategoryExists is returned when adding a category with the title of an existing one.
+var ErrCategoryExists = errors.New("category already exists")
+
+const (
+	selectCategoriesQuery    = `SELECT CategoryID, title, description, UserID FROM Category ORDER BY title`
+	categoryTitleExistsQuery = `SELECT EXISTS(SELECT 1 FROM Category WHERE title = ?)`
+	insertCategoryQuery      = `INSERT INTO Category (title, description, UserID) VALUES (?, ?, ?)`
+	selectCategoryTitleQuery = `SELECT title FROM Category WHERE CategoryID = ?`
+	deleteCategoryPostsQuery = `DELETE FROM PostCategory WHERE CategoryID = ?`
+	deleteCategoryByIDQuery  = `DELETE FROM Category WHERE CategoryID = ?`
+)
+
+// Category is a topic posts are filed under. UserID is the admin who added it.
+type Category struct {
+	CategoryID  int    `json:"CategoryID"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	UserID      int    `json:"UserID"`
+}
+
+// CategoryStore reads and writes the categories posts are filed under.
+type CategoryStore struct {
+	db *sql.DB
+}
+
+// NewCategoryStore returns a CategoryStore backed by db.
+func NewCategoryStore(db *sql.DB) *CategoryStore {
+	return &CategoryStore{db: db}
+}
+
+// List returns every category, in alphabetical order.
+func (s *CategoryStore) List() ([]Category, error) {
+	rows, err := s.db.Query(selectCategoriesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error querying categories: %v", err)
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.CategoryID, &c.Title, &c.Description, &c.UserID); err != nil {
+			return nil, fmt.Errorf("error scanning category: %v", err)
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// Add creates a category on behalf of adminID and records it in the audit log, in one
+// transaction, and returns its ID. It returns ErrCategoryExists if the title is taken.
+func (s *CategoryStore) Add(title, description string, adminID int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(categoryTitleExistsQuery, title).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("error checking existing category: %v", err)
+	}
+	if exists {
+		return 0, ErrCategoryExists
+	}
+
+	result, err := tx.Exec(insertCategoryQuery, title, description, adminID)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting category: %v", err)
+	}
+	categoryID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting category ID: %v", err)
+	}
+	if err := RecordAudit(tx, adminID, AuditAddCategory, AuditTargetCategory, int(categoryID), title); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return int(categoryID), nil
+}
+
+// Delete removes categoryID, taking it off every post filed under it, on behalf of adminID and
+// records it in the audit log, in one transaction. It returns sql.ErrNoRows if the category does
+// not exist.
+func (s *CategoryStore) Delete(categoryID, adminID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// the title is kept for the audit log
+	var title string
+	if err := tx.QueryRow(selectCategoryTitleQuery, categoryID).Scan(&title); err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("error getting category: %v", err)
+	}
+	if _, err := tx.Exec(deleteCategoryPostsQuery, categoryID); err != nil {
+		return fmt.Errorf("error deleting post categories: %v", err)
+	}
+	if _, err := tx.Exec(deleteCategoryByIDQuery, categoryID); err != nil {
+		return fmt.Errorf("error deleting category: %v", err)
+	}
+	if err := RecordAudit(tx, adminID, AuditDeleteCategory, AuditTargetCategory, categoryID, title); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
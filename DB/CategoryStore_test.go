@@ -0,0 +1,63 @@
+package DB
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestCategoryAddAndDelete(t *testing.T) {
+	db, s := openTestStore(t)
+	admin := createTestUser(t, s, "admin1")
+
+	categoryID, err := s.Categories.Add("Gardening", "Plants and soil", admin)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := s.Categories.Add("Gardening", "Again", admin); err != ErrCategoryExists {
+		t.Errorf("adding a taken title: err = %v, want ErrCategoryExists", err)
+	}
+
+	categories, err := s.Categories.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var found *Category
+	for i := range categories {
+		if categories[i].CategoryID == categoryID {
+			found = &categories[i]
+		}
+		if i > 0 && categories[i-1].Title > categories[i].Title {
+			t.Errorf("categories not in title order: %q before %q", categories[i-1].Title, categories[i].Title)
+		}
+	}
+	if found == nil {
+		t.Fatalf("added category %d not listed", categoryID)
+	}
+	if found.Title != "Gardening" || found.Description != "Plants and soil" || found.UserID != admin {
+		t.Errorf("listed category = %+v", *found)
+	}
+
+	// a post filed under the category loses it rather than blocking the delete
+	postID := createTestPost(t, db, admin, "tomatoes")
+	if _, err := db.Exec(`INSERT INTO PostCategory (PostID, CategoryID) VALUES (?, ?)`, postID, categoryID); err != nil {
+		t.Fatalf("filing post: %v", err)
+	}
+	if err := s.Categories.Delete(categoryID, admin); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	var filed int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM PostCategory WHERE CategoryID = ?`, categoryID).Scan(&filed); err != nil || filed != 0 {
+		t.Errorf("%d posts still filed under the deleted category, err %v", filed, err)
+	}
+	if err := s.Categories.Delete(categoryID, admin); err != sql.ErrNoRows {
+		t.Errorf("deleting a missing category: err = %v, want sql.ErrNoRows", err)
+	}
+
+	page, err := s.Audit.List(AuditFilter{TargetType: AuditTargetCategory, TargetID: categoryID})
+	if err != nil {
+		t.Fatalf("listing audit log: %v", err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].Action != AuditDeleteCategory || page.Entries[1].Action != AuditAddCategory {
+		t.Errorf("audit entries = %+v, want a delete after an add", page.Entries)
+	}
+}
@@ -0,0 +1,379 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/markdown"
+)
+
+const (
+	// selectPostCommentsQuery walks the reply tree of a post depth first. Path is the chain of
+	// zero-padded comment IDs from the root, so ordering by it puts every reply right under its
+	// parent, and siblings (including top-level comments) in the order they were written.
+	// Comments held for review are left out, together with the replies to them.
+	selectPostCommentsQuery = `
+        WITH RECURSIVE thread(CommentID, Depth, Path) AS (
+            SELECT CommentID, 0, printf('%010d', CommentID)
+            FROM Comment
+            WHERE PostID = ? AND ParentCommentID IS NULL AND HeldForReview = 0
+            UNION ALL
+            SELECT c.CommentID, t.Depth + 1, t.Path || '/' || printf('%010d', c.CommentID)
+            FROM Comment c
+            JOIN thread t ON c.ParentCommentID = t.CommentID
+            WHERE c.HeldForReview = 0
+        )
+        SELECT
+            cm.CommentID,
+            cm.UserID,
+            cm.content,
+            COALESCE(cm.content_html, ''),
+            cm.CmtDate,
+            cm.EditedAt,
+            u.username,
+            COALESCE(cl.CommentLikes, 0) AS likes,
+            COALESCE(cd.CommentDislikes, 0) AS dislikes,
+            cm.ParentCommentID,
+            t.Depth
+        FROM
+            thread t
+        JOIN
+            Comment cm ON cm.CommentID = t.CommentID
+        JOIN
+            User u ON cm.UserID = u.UserID
+        LEFT JOIN (
+            SELECT CommentID, COUNT(*) AS CommentLikes FROM CommentLike GROUP BY CommentID
+        ) AS cl ON cm.CommentID = cl.CommentID
+        LEFT JOIN (
+            SELECT CommentID, COUNT(*) AS CommentDislikes FROM CommentDislike GROUP BY CommentID
+        ) AS cd ON cm.CommentID = cd.CommentID
+        ORDER BY
+            t.Path
+    `
+	// selectCommentVisibleQuery walks up from a comment to its top-level ancestor. The comment is
+	// shown to everyone if none of them is held for review and their post is visible.
+	selectCommentVisibleQuery = `
+        WITH RECURSIVE ancestors(CommentID, ParentCommentID, PostID, HeldForReview) AS (
+            SELECT CommentID, ParentCommentID, PostID, HeldForReview FROM Comment WHERE CommentID = ?
+            UNION ALL
+            SELECT c.CommentID, c.ParentCommentID, c.PostID, c.HeldForReview
+            FROM Comment c
+            JOIN ancestors a ON c.CommentID = a.ParentCommentID
+        )
+        SELECT COUNT(*), COALESCE(MIN(a.HeldForReview = 0 AND p.Visibility = 'visible'), 0)
+        FROM ancestors a
+        JOIN Post p ON p.PostID = a.PostID
+    `
+	// selectUserCommentsQuery lists the comments of a user with the post each one is on.
+	selectUserCommentsQuery = `
+        SELECT
+            c.CommentID,
+            c.PostID,
+            p.title,
+            pu.username,
+            c.content,
+            c.CmtDate,
+            COALESCE(cl.likes, 0),
+            COALESCE(cd.dislikes, 0)
+        FROM Comment c
+        JOIN Post p ON c.PostID = p.PostID
+        JOIN User pu ON p.UserID = pu.UserID
+        LEFT JOIN (
+            SELECT CommentID, COUNT(*) AS likes FROM CommentLike GROUP BY CommentID
+        ) cl ON c.CommentID = cl.CommentID
+        LEFT JOIN (
+            SELECT CommentID, COUNT(*) AS dislikes FROM CommentDislike GROUP BY CommentID
+        ) cd ON c.CommentID = cd.CommentID
+        WHERE c.UserID = ?
+        ORDER BY c.CmtDate DESC
+    `
+	selectCommentOwnerQuery  = `SELECT UserID FROM Comment WHERE CommentID = ?`
+	selectCommentSourceQuery = `SELECT content, UserID FROM Comment WHERE CommentID = ?`
+	countCommentsQuery       = `SELECT COUNT(*) FROM Comment`
+	selectCommentPostQuery   = `SELECT PostID FROM Comment WHERE CommentID = ?`
+	insertReplyQuery         = `INSERT INTO Comment (PostID, UserID, content, content_html, ParentCommentID) VALUES (?,?,?,?,?)`
+	postExistsQuery          = `SELECT EXISTS(SELECT 1 FROM Post WHERE PostID = ?)`
+	deleteCommentByIDQuery   = `DELETE FROM Comment WHERE CommentID = ?`
+	selectPostOpenQuery      = `SELECT Visibility = 'visible', Locked FROM Post WHERE PostID = ?`
+)
+
+// removeCommentQueries delete a comment and everything attached to it, children first.
+var removeCommentQueries = []string{
+	`DELETE FROM CommentLike WHERE CommentID = ?`,
+	`DELETE FROM CommentDislike WHERE CommentID = ?`,
+	`DELETE FROM Notification WHERE CommentID = ?`,
+	`DELETE FROM Comment WHERE CommentID = ?`,
+}
+
+// ErrPostLocked is returned when commenting on a post moderators have locked.
+var ErrPostLocked = errors.New("post is locked for comments")
+
+// UserComment is a comment as listed in the activity of its author, with the post it is on.
+type UserComment struct {
+	CommentID   int    `json:"comment_id"`
+	PostID      int    `json:"post_id"`
+	PostTitle   string `json:"post_title"`
+	PostAuthor  string `json:"post_author"`
+	Comment     string `json:"comment"`
+	CommentDate string `json:"comment_date"`
+	Likes       int    `json:"likes"`
+	Dislikes    int    `json:"dislikes"`
+}
+
+// CommentStore reads and writes comments.
+type CommentStore struct {
+	db *sql.DB
+}
+
+// NewCommentStore returns a CommentStore backed by db.
+func NewCommentStore(db *sql.DB) *CommentStore {
+	return &CommentStore{db: db}
+}
+
+// ListByPost returns the comments on postID as a depth-annotated flat list: every reply comes
+// right after its parent (and the parent's earlier replies), and siblings are in the order they were written.
+// It returns sql.ErrNoRows if the post does not exist.
+func (s *CommentStore) ListByPost(postID int) ([]Comment, error) {
+	var exists bool
+	if err := s.db.QueryRow(postExistsQuery, postID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("error checking post validity: %v", err)
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := s.db.Query(selectPostCommentsQuery, postID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying comments: %v", err)
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var cmt Comment
+		if err := rows.Scan(
+			&cmt.CmtID, &cmt.UserID, &cmt.Content, &cmt.ContentHTML, &cmt.CmtDate, &cmt.EditedAt, &cmt.Username,
+			&cmt.Likes, &cmt.Dislikes, &cmt.ParentID, &cmt.Depth,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning comments: %v", err)
+		}
+		comments = append(comments, cmt)
+	}
+	return comments, rows.Err()
+}
+
+// Create inserts a comment, held for review if held is not nil, and returns its ID. See
+// InsertComment. It returns sql.ErrNoRows if the post does not exist or is not visible and
+// ErrPostLocked if it is locked.
+func (s *CommentStore) Create(postID, userID int, content string, held *FilterMatch) (int64, error) {
+	if err := s.checkOpen(postID); err != nil {
+		return -1, err
+	}
+	return InsertComment(s.db, postID, userID, content, held)
+}
+
+// Reply inserts a reply to parentID on behalf of userID, held for review if held is not nil. It
+// returns the ID of the new comment and the ID of the post the thread belongs to, or
+// sql.ErrNoRows if the parent comment does not exist or is not shown to everyone (see Visible),
+// and ErrPostLocked if the post is locked. The parent is checked in the same transaction as the
+// reply is written, so a thread held or hidden in the meantime takes no new replies.
+func (s *CommentStore) Reply(parentID, userID int, content string, held *FilterMatch) (int64, int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return -1, 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var postID int
+	if err := tx.QueryRow(selectCommentPostQuery, parentID).Scan(&postID); err != nil {
+		return -1, 0, err
+	}
+	var count int
+	var visible bool
+	if err := tx.QueryRow(selectCommentVisibleQuery, parentID).Scan(&count, &visible); err != nil {
+		return -1, 0, fmt.Errorf("error checking comment visibility: %v", err)
+	}
+	if !visible {
+		return -1, 0, sql.ErrNoRows
+	}
+	if err := postOpen(tx.QueryRow(selectPostOpenQuery, postID)); err != nil {
+		return -1, 0, err
+	}
+
+	result, err := tx.Exec(insertReplyQuery, postID, userID, content, markdown.Render(content), parentID)
+	if err != nil {
+		return -1, 0, fmt.Errorf("error inserting reply: %v", err)
+	}
+	commentID, err := result.LastInsertId()
+	if err != nil {
+		return -1, 0, fmt.Errorf("error getting last insert ID: %v", err)
+	}
+
+	if held != nil {
+		if err := holdContent(tx, HeldComment, int(commentID), userID, held, false); err != nil {
+			return -1, 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return -1, 0, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return commentID, postID, nil
+}
+
+// Update replaces the content of commentID on behalf of editorID and records the change as a
+// revision. With held set, the comment is kept out of sight until the edit is reviewed. It returns
+// sql.ErrNoRows if the comment does not exist.
+func (s *CommentStore) Update(commentID, editorID int, content string, held *FilterMatch) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := editComment(tx, commentID, editorID, content, nil); err != nil {
+		return err
+	}
+	if held != nil {
+		if err := holdContent(tx, HeldComment, commentID, editorID, held, true); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Delete removes commentID together with its replies and reactions on behalf of moderatorID,
+// recording it in the audit log, or returns sql.ErrNoRows if the comment does not exist.
+func (s *CommentStore) Delete(commentID, moderatorID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(deleteCommentByIDQuery, commentID)
+	if err != nil {
+		return fmt.Errorf("error deleting comment: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking deleted comment: %v", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := RecordAudit(tx, moderatorID, AuditDeleteComment, AuditTargetComment, commentID, ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Remove deletes commentID for good, with its reactions and notifications, in one transaction.
+// It is how authors delete their own comments; moderators use Delete, which is audited.
+func (s *CommentStore) Remove(commentID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range removeCommentQueries {
+		if _, err := tx.Exec(query, commentID); err != nil {
+			return fmt.Errorf("error removing comment: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// ListByUser returns every comment userID wrote, newest first.
+func (s *CommentStore) ListByUser(userID int) ([]UserComment, error) {
+	rows, err := s.db.Query(selectUserCommentsQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying user comments: %v", err)
+	}
+	defer rows.Close()
+
+	comments := []UserComment{}
+	for rows.Next() {
+		var c UserComment
+		if err := rows.Scan(&c.CommentID, &c.PostID, &c.PostTitle, &c.PostAuthor,
+			&c.Comment, &c.CommentDate, &c.Likes, &c.Dislikes); err != nil {
+			return nil, fmt.Errorf("error scanning comment: %v", err)
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// Source returns the Markdown content of commentID as its author wrote it and the ID of the
+// author, or sql.ErrNoRows if the comment does not exist.
+func (s *CommentStore) Source(commentID int) (string, int, error) {
+	var content string
+	var userID int
+	err := s.db.QueryRow(selectCommentSourceQuery, commentID).Scan(&content, &userID)
+	return content, userID, err
+}
+
+// Count returns how many comments there are, held ones included.
+func (s *CommentStore) Count() (int, error) {
+	var count int
+	if err := s.db.QueryRow(countCommentsQuery).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting comments: %v", err)
+	}
+	return count, nil
+}
+
+// OwnerID returns the ID of the user who wrote commentID, or sql.ErrNoRows if the comment does not exist.
+func (s *CommentStore) OwnerID(commentID int) (int, error) {
+	var userID int
+	err := s.db.QueryRow(selectCommentOwnerQuery, commentID).Scan(&userID)
+	return userID, err
+}
+
+// Visible reports whether commentID is shown to everyone: neither it nor a comment it replies to
+// is held for review, and its post is visible. It returns sql.ErrNoRows if the comment does not exist.
+func (s *CommentStore) Visible(commentID int) (bool, error) {
+	var count int
+	var visible bool
+	if err := s.db.QueryRow(selectCommentVisibleQuery, commentID).Scan(&count, &visible); err != nil {
+		return false, fmt.Errorf("error checking comment visibility: %v", err)
+	}
+	if count == 0 {
+		return false, sql.ErrNoRows
+	}
+	return visible, nil
+}
+
+// checkOpen returns nil if postID takes new comments: sql.ErrNoRows if it does not exist or is
+// hidden or deleted, ErrPostLocked if it is locked.
+func (s *CommentStore) checkOpen(postID int) error {
+	return postOpen(s.db.QueryRow(selectPostOpenQuery, postID))
+}
+
+// postOpen reads the result of selectPostOpenQuery the way checkOpen describes.
+func postOpen(row *sql.Row) error {
+	var visible, locked bool
+	err := row.Scan(&visible, &locked)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error checking post state: %v", err)
+	}
+	if !visible {
+		return sql.ErrNoRows
+	}
+	if locked {
+		return ErrPostLocked
+	}
+	return nil
+}
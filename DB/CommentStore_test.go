@@ -0,0 +1,156 @@
+package DB
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestCommentVisible(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	postID := createTestPost(t, db, alice, "post")
+	commentID, err := s.Comments.Create(postID, alice, "comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+	replyID, _, err := s.Comments.Reply(int(commentID), alice, "reply", nil)
+	if err != nil {
+		t.Fatalf("creating reply: %v", err)
+	}
+
+	check := func(step string, want bool) {
+		t.Helper()
+		for _, id := range []int64{commentID, replyID} {
+			visible, err := s.Comments.Visible(int(id))
+			if err != nil {
+				t.Fatalf("%s: Visible(%d): %v", step, id, err)
+			}
+			if visible != want {
+				t.Errorf("%s: Visible(%d) = %v, want %v", step, id, visible, want)
+			}
+		}
+	}
+
+	check("published", true)
+
+	// Holding the comment hides the replies to it too.
+	if _, err := db.Exec(`UPDATE Comment SET HeldForReview = 1 WHERE CommentID = ?`, commentID); err != nil {
+		t.Fatalf("holding comment: %v", err)
+	}
+	check("held", false)
+	if _, err := db.Exec(`UPDATE Comment SET HeldForReview = 0 WHERE CommentID = ?`, commentID); err != nil {
+		t.Fatalf("releasing comment: %v", err)
+	}
+
+	if err := s.Posts.SetVisibility(postID, alice, PostHidden, "off topic"); err != nil {
+		t.Fatalf("hiding post: %v", err)
+	}
+	check("post hidden", false)
+
+	if _, err := s.Comments.Visible(int(replyID) + 1); err != sql.ErrNoRows {
+		t.Errorf("Visible of a missing comment returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestRemoveComment(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	postID := createTestPost(t, db, alice, "post")
+	commentID, err := s.Comments.Create(postID, bob, "comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+	if _, err := s.Reactions.ToggleCommentReaction(alice, int(commentID), false); err != nil {
+		t.Fatalf("disliking comment: %v", err)
+	}
+	if err := s.Notifications.NotifyCommentAuthor(alice, int(commentID), NotifyCommentDislike); err != nil {
+		t.Fatalf("notifying: %v", err)
+	}
+
+	content, ownerID, err := s.Comments.Source(int(commentID))
+	if err != nil || content != "comment" || ownerID != bob {
+		t.Errorf("Source = %q, %d, %v; want comment by bob", content, ownerID, err)
+	}
+	if comments, err := s.Comments.ListByUser(bob); err != nil || len(comments) != 1 || comments[0].PostTitle != "post" || comments[0].Dislikes != 1 {
+		t.Errorf("ListByUser = %+v, %v", comments, err)
+	}
+
+	if err := s.Comments.Remove(int(commentID)); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, _, err := s.Comments.Source(int(commentID)); err != sql.ErrNoRows {
+		t.Errorf("Source of a removed comment: err = %v, want sql.ErrNoRows", err)
+	}
+	if count, err := s.Notifications.UnreadCount(bob); err != nil || count != 0 {
+		t.Errorf("bob still has %d notifications, err %v", count, err)
+	}
+	if comments, err := s.Comments.ListByUser(bob); err != nil || len(comments) != 0 {
+		t.Errorf("ListByUser after Remove = %+v, %v", comments, err)
+	}
+}
+
+func TestReplyNeedsVisibleParent(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	postID := createTestPost(t, db, alice, "post")
+	commentID, err := s.Comments.Create(postID, alice, "comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+	replyID, replyPostID, err := s.Comments.Reply(int(commentID), bob, "reply", nil)
+	if err != nil {
+		t.Fatalf("replying: %v", err)
+	}
+	if replyPostID != postID {
+		t.Errorf("reply is on post %d, want %d", replyPostID, postID)
+	}
+
+	countComments := func() int {
+		t.Helper()
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM Comment`).Scan(&count); err != nil {
+			t.Fatalf("counting comments: %v", err)
+		}
+		return count
+	}
+	before := countComments()
+
+	// Holding the top-level comment closes the whole thread below it.
+	if _, err := db.Exec(`UPDATE Comment SET HeldForReview = 1 WHERE CommentID = ?`, commentID); err != nil {
+		t.Fatalf("holding comment: %v", err)
+	}
+	for _, parentID := range []int64{commentID, replyID} {
+		if _, _, err := s.Comments.Reply(int(parentID), bob, "more", nil); err != sql.ErrNoRows {
+			t.Errorf("replying under a held comment to %d: err = %v, want sql.ErrNoRows", parentID, err)
+		}
+	}
+	if _, err := db.Exec(`UPDATE Comment SET HeldForReview = 0 WHERE CommentID = ?`, commentID); err != nil {
+		t.Fatalf("releasing comment: %v", err)
+	}
+
+	if err := s.Posts.SetLocked(postID, alice, true); err != nil {
+		t.Fatalf("locking post: %v", err)
+	}
+	if _, _, err := s.Comments.Reply(int(replyID), bob, "more", nil); err != ErrPostLocked {
+		t.Errorf("replying on a locked post: err = %v, want ErrPostLocked", err)
+	}
+	if err := s.Posts.SetLocked(postID, alice, false); err != nil {
+		t.Fatalf("unlocking post: %v", err)
+	}
+
+	if err := s.Posts.SetVisibility(postID, alice, PostHidden, "off topic"); err != nil {
+		t.Fatalf("hiding post: %v", err)
+	}
+	if _, _, err := s.Comments.Reply(int(replyID), bob, "more", nil); err != sql.ErrNoRows {
+		t.Errorf("replying on a hidden post: err = %v, want sql.ErrNoRows", err)
+	}
+
+	if _, _, err := s.Comments.Reply(int(replyID)+100, bob, "more", nil); err != sql.ErrNoRows {
+		t.Errorf("replying to a missing comment: err = %v, want sql.ErrNoRows", err)
+	}
+	if after := countComments(); after != before {
+		t.Errorf("%d comments written by refused replies", after-before)
+	}
+}
@@ -0,0 +1,421 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/markdown"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Kinds of content filter rule. Terms match as whole words, whatever their case, and regular
+// expressions as written. Domain rules look at the links in the content: a link to a denied
+// domain matches, and once there are allowed domains so does a link to any other domain. A link
+// cap matches content with more than MaxLinks links from accounts younger than AccountAgeDays.
+const (
+	FilterTerm        = "term"
+	FilterRegex       = "regex"
+	FilterDenyDomain  = "deny_domain"
+	FilterAllowDomain = "allow_domain"
+	FilterLinkCap     = "link_cap"
+)
+
+// What happens to content matching a rule: it is refused outright, or held until a moderator
+// reviews it.
+const (
+	FilterReject = "reject"
+	FilterReview = "review"
+)
+
+// maxFilterPatternLength caps the pattern of a rule, in bytes.
+const maxFilterPatternLength = 200
+
+// ErrInvalidFilterRule is returned for a rule of unknown kind or action, or with a pattern or
+// link cap that does not suit its kind.
+var ErrInvalidFilterRule = errors.New("invalid filter rule")
+
+// linkPattern finds the links written out as plain text, with or without a scheme.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'()\[\]]+`)
+
+const (
+	insertFilterRuleQuery  = `INSERT INTO FilterRule (Kind, Pattern, MaxLinks, AccountAgeDays, Action, CreatedBy) VALUES (?, ?, ?, ?, ?, ?)`
+	selectFilterRuleQuery  = `SELECT Kind, Pattern, COALESCE(MaxLinks, 0), COALESCE(AccountAgeDays, 0), Action FROM FilterRule WHERE RuleID = ?`
+	deleteFilterRuleQuery  = `DELETE FROM FilterRule WHERE RuleID = ?`
+	selectFilterRulesQuery = `
+        SELECT r.RuleID, r.Kind, r.Pattern, COALESCE(r.MaxLinks, 0), COALESCE(r.AccountAgeDays, 0), r.Action,
+               COALESCE(u.username, ''), r.CreatedAt
+        FROM FilterRule r
+        LEFT JOIN User u ON u.UserID = r.CreatedBy
+        ORDER BY r.Kind, r.RuleID
+    `
+	// selectAccountAgeQuery gives the age of an account in days.
+	selectAccountAgeQuery = `SELECT COALESCE(julianday('now') - julianday(created_at), 0) FROM User WHERE UserID = ?`
+)
+
+// FilterRule is a rule of the content filter. Pattern is the term, regular expression or domain
+// the rule looks for; MaxLinks and AccountAgeDays are only used by link caps.
+type FilterRule struct {
+	RuleID         int       `json:"ruleId"`
+	Kind           string    `json:"kind"`
+	Pattern        string    `json:"pattern"`
+	MaxLinks       int       `json:"maxLinks"`
+	AccountAgeDays int       `json:"accountAgeDays"`
+	Action         string    `json:"action"`
+	Creator        string    `json:"creator"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// FilterMatch is the rule some content fell foul of. Reason tells why, in words fit for its
+// author, such as "contains the blocked term "spam"".
+type FilterMatch struct {
+	RuleID int
+	Action string
+	Reason string
+}
+
+// Rejected reports whether the content must be refused rather than held for review.
+func (m *FilterMatch) Rejected() bool {
+	return m != nil && m.Action == FilterReject
+}
+
+// FilterStore keeps the rules of the content filter and the queue of content held for review.
+type FilterStore struct {
+	db *sql.DB
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp // compiled term and regex rules, by kind and pattern
+}
+
+// NewFilterStore returns a FilterStore backed by db.
+func NewFilterStore(db *sql.DB) *FilterStore {
+	return &FilterStore{db: db, patterns: make(map[string]*regexp.Regexp)}
+}
+
+// Rules returns every rule of the content filter, grouped by kind.
+func (s *FilterStore) Rules() ([]FilterRule, error) {
+	rows, err := s.db.Query(selectFilterRulesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error querying filter rules: %v", err)
+	}
+	defer rows.Close()
+
+	rules := []FilterRule{}
+	for rows.Next() {
+		var rule FilterRule
+		if err := rows.Scan(
+			&rule.RuleID, &rule.Kind, &rule.Pattern, &rule.MaxLinks, &rule.AccountAgeDays, &rule.Action,
+			&rule.Creator, &rule.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning filter rule: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// AddRule adds rule to the content filter on behalf of adminID, recording it in the audit log,
+// and returns its ID. Domains are stored lower case, without scheme or path. It returns
+// ErrInvalidFilterRule if the rule does not hold together.
+func (s *FilterStore) AddRule(rule FilterRule, adminID int) (int, error) {
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	if rule.Kind == FilterDenyDomain || rule.Kind == FilterAllowDomain {
+		rule.Pattern = normalizeDomain(rule.Pattern)
+	}
+	if err := validateFilterRule(rule); err != nil {
+		return 0, err
+	}
+
+	var maxLinks, accountAgeDays interface{}
+	if rule.Kind == FilterLinkCap {
+		maxLinks, accountAgeDays = rule.MaxLinks, rule.AccountAgeDays
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(insertFilterRuleQuery, rule.Kind, rule.Pattern, maxLinks, accountAgeDays, rule.Action, adminID)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting filter rule: %v", err)
+	}
+	ruleID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting filter rule ID: %v", err)
+	}
+
+	if err := RecordAudit(tx, adminID, AuditAddFilterRule, AuditTargetFilter, int(ruleID), describeFilterRule(rule)); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return int(ruleID), nil
+}
+
+// DeleteRule removes ruleID from the content filter on behalf of adminID and records it in the
+// audit log. Content the rule held stays in the review queue. It returns sql.ErrNoRows if there
+// is no such rule.
+func (s *FilterStore) DeleteRule(ruleID, adminID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var rule FilterRule
+	err = tx.QueryRow(selectFilterRuleQuery, ruleID).Scan(&rule.Kind, &rule.Pattern, &rule.MaxLinks, &rule.AccountAgeDays, &rule.Action)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error getting filter rule: %v", err)
+	}
+
+	if _, err := tx.Exec(deleteFilterRuleQuery, ruleID); err != nil {
+		return fmt.Errorf("error deleting filter rule: %v", err)
+	}
+	if err := RecordAudit(tx, adminID, AuditDeleteFilterRule, AuditTargetFilter, ruleID, describeFilterRule(rule)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+
+	s.mu.Lock()
+	delete(s.patterns, patternKey(rule))
+	s.mu.Unlock()
+	return nil
+}
+
+// Check runs text, written by userID, through the content filter. It returns the rule the text
+// matches, preferring one that rejects it over one that holds it for review, or nil if the text
+// may be published.
+func (s *FilterStore) Check(userID int, text string) (*FilterMatch, error) {
+	rules, err := s.Rules()
+	if err != nil {
+		return nil, err
+	}
+	hosts := linkHosts(text)
+
+	var match *FilterMatch
+	consider := func(rule FilterRule, reason string) {
+		if match == nil || (rule.Action == FilterReject && match.Action != FilterReject) {
+			match = &FilterMatch{RuleID: rule.RuleID, Action: rule.Action, Reason: reason}
+		}
+	}
+
+	var allowed []FilterRule
+	accountAge := -1.0
+	for _, rule := range rules {
+		switch rule.Kind {
+		case FilterTerm:
+			if s.pattern(rule).MatchString(text) {
+				consider(rule, fmt.Sprintf("contains the blocked term %q", rule.Pattern))
+			}
+		case FilterRegex:
+			// patterns are checked when the rule is added
+			if re := s.pattern(rule); re != nil && re.MatchString(text) {
+				consider(rule, "matches a blocked pattern")
+			}
+		case FilterDenyDomain:
+			for _, host := range hosts {
+				if matchesDomain(host, rule.Pattern) {
+					consider(rule, "links to the blocked domain "+host)
+					break
+				}
+			}
+		case FilterAllowDomain:
+			allowed = append(allowed, rule)
+		case FilterLinkCap:
+			if len(hosts) <= rule.MaxLinks {
+				continue
+			}
+			if accountAge < 0 {
+				if err := s.db.QueryRow(selectAccountAgeQuery, userID).Scan(&accountAge); err != nil {
+					return nil, fmt.Errorf("error getting account age: %v", err)
+				}
+			}
+			if accountAge < float64(rule.AccountAgeDays) {
+				consider(rule, fmt.Sprintf("has %d links, while accounts younger than %d days may post at most %d",
+					len(hosts), rule.AccountAgeDays, rule.MaxLinks))
+			}
+		}
+	}
+
+	if len(allowed) > 0 {
+		for _, host := range hosts {
+			if !matchesAnyDomain(host, allowed) {
+				// the strictest of the allow rules decides what happens to other domains
+				rule := allowed[0]
+				for _, r := range allowed {
+					if r.Action == FilterReject {
+						rule = r
+						break
+					}
+				}
+				consider(rule, "links to "+host+", which is not an allowed domain")
+				break
+			}
+		}
+	}
+	return match, nil
+}
+
+// pattern returns the regular expression a term or regex rule matches with, or nil if a regex
+// rule does not compile. Rules are compiled the first time they are checked and kept until they
+// are deleted.
+func (s *FilterStore) pattern(rule FilterRule) *regexp.Regexp {
+	key := patternKey(rule)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	re, ok := s.patterns[key]
+	if !ok {
+		if rule.Kind == FilterTerm {
+			re = termPattern(rule.Pattern)
+		} else {
+			re, _ = regexp.Compile(rule.Pattern)
+		}
+		s.patterns[key] = re
+	}
+	return re
+}
+
+// patternKey is the key of the compiled pattern of rule in FilterStore.patterns.
+func patternKey(rule FilterRule) string {
+	return rule.Kind + ":" + rule.Pattern
+}
+
+// validateFilterRule returns ErrInvalidFilterRule unless rule holds together.
+func validateFilterRule(rule FilterRule) error {
+	if rule.Action != FilterReject && rule.Action != FilterReview {
+		return ErrInvalidFilterRule
+	}
+	if len(rule.Pattern) > maxFilterPatternLength {
+		return ErrInvalidFilterRule
+	}
+	switch rule.Kind {
+	case FilterTerm:
+		if rule.Pattern == "" {
+			return ErrInvalidFilterRule
+		}
+	case FilterRegex:
+		if rule.Pattern == "" {
+			return ErrInvalidFilterRule
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return ErrInvalidFilterRule
+		}
+	case FilterDenyDomain, FilterAllowDomain:
+		if rule.Pattern == "" || strings.ContainsAny(rule.Pattern, " \t/") || !strings.Contains(rule.Pattern, ".") {
+			return ErrInvalidFilterRule
+		}
+	case FilterLinkCap:
+		if rule.Pattern != "" || rule.MaxLinks < 0 || rule.AccountAgeDays <= 0 {
+			return ErrInvalidFilterRule
+		}
+	default:
+		return ErrInvalidFilterRule
+	}
+	return nil
+}
+
+// describeFilterRule sums rule up for the audit log.
+func describeFilterRule(rule FilterRule) string {
+	if rule.Kind == FilterLinkCap {
+		return fmt.Sprintf("%s: at most %d links for accounts under %d days (%s)",
+			rule.Kind, rule.MaxLinks, rule.AccountAgeDays, rule.Action)
+	}
+	return fmt.Sprintf("%s: %s (%s)", rule.Kind, rule.Pattern, rule.Action)
+}
+
+// termPattern matches term as a whole word, whatever its case.
+func termPattern(term string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|\W)` + regexp.QuoteMeta(term) + `(?:$|\W)`)
+}
+
+// linkHosts returns the lower case host of every link in text, in order. text is looked at as it
+// is rendered, so the links are the ones readers see: the href of every anchor, whether it came
+// from an inline link, a reference or an autolink, and however its URL was escaped, plus the
+// URLs written out as plain text outside anchors. Links to pages of the forum itself have no host
+// and are left out; scheme-relative ones such as //example.com are not.
+func linkHosts(text string) []string {
+	var hosts []string
+	add := func(link string) {
+		u, err := url.Parse(strings.TrimSpace(link))
+		if err != nil || u.Hostname() == "" {
+			return
+		}
+		hosts = append(hosts, strings.TrimSuffix(strings.ToLower(u.Hostname()), "."))
+	}
+
+	z := html.NewTokenizer(strings.NewReader(markdown.Render(text)))
+	inAnchor := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return hosts
+		case html.StartTagToken:
+			token := z.Token()
+			if token.Data != "a" {
+				continue
+			}
+			inAnchor++
+			for _, attr := range token.Attr {
+				if attr.Key == "href" {
+					add(attr.Val)
+				}
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "a" && inAnchor > 0 {
+				inAnchor--
+			}
+		case html.TextToken:
+			if inAnchor > 0 {
+				continue
+			}
+			for _, link := range linkPattern.FindAllString(string(z.Text()), -1) {
+				if !strings.Contains(link, "://") {
+					link = "http://" + link
+				}
+				add(link)
+			}
+		}
+	}
+}
+
+// normalizeDomain turns what an admin typed as a domain, such as "https://*.Example.com/", into
+// the domain alone.
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "https://")
+	domain = strings.TrimPrefix(domain, "http://")
+	if i := strings.Index(domain, "/"); i >= 0 {
+		domain = domain[:i]
+	}
+	domain = strings.TrimPrefix(domain, "*.")
+	return strings.Trim(domain, ".")
+}
+
+// matchesDomain reports whether host is domain or one of its subdomains.
+func matchesDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// matchesAnyDomain reports whether host matches the domain of any of rules.
+func matchesAnyDomain(host string, rules []FilterRule) bool {
+	for _, rule := range rules {
+		if matchesDomain(host, rule.Pattern) {
+			return true
+		}
+	}
+	return false
+}
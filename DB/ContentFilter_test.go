@@ -0,0 +1,165 @@
+package DB
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinkHosts(t *testing.T) {
+	tests := []struct {
+		name, text string
+		want       []string
+	}{
+		{"plain URL", "see https://Example.com./page", []string{"example.com"}},
+		{"without a scheme", "see www.example.com", []string{"www.example.com"}},
+		{"inline link", "[x](https://example.com/a)", []string{"example.com"}},
+		{"link text is not counted again", "[https://example.com](https://example.com)", []string{"example.com"}},
+		{"autolink", "<https://example.com>", []string{"example.com"}},
+		{"scheme-relative", "[x](//evil.com/a)", []string{"evil.com"}},
+		{"escaped colon", "[x](https&#58;//evil.com)", []string{"evil.com"}},
+		{"escaped colon in text", "https&#58;//evil.com", []string{"evil.com"}},
+		{"reference", "[x]: https&#x3a;//evil.com\n\n[click][x]", []string{"evil.com"}},
+		{"forum page", "[x](/post/12) and [y](#top)", nil},
+		{"email", "[mail](mailto:someone@example.com)", nil},
+		{"code is still text", "`https://example.com`", []string{"example.com"}},
+		{"in order", "https://a.example and [b](https://b.example)", []string{"a.example", "b.example"}},
+	}
+	for _, tt := range tests {
+		if got := linkHosts(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: linkHosts(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCheckDeniedDomainBehindMarkdown(t *testing.T) {
+	_, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	if _, err := s.Filter.AddRule(FilterRule{Kind: FilterDenyDomain, Pattern: "evil.com", Action: FilterReject}, alice); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+
+	for _, text := range []string{
+		"[x](//evil.com/a)",
+		"[x](https&#58;//evil.com)",
+		"[x]: https&#x3a;//evil.com\n\n[click][x]",
+	} {
+		match, err := s.Filter.Check(alice, text)
+		if err != nil {
+			t.Fatalf("Check(%q): %v", text, err)
+		}
+		if !match.Rejected() {
+			t.Errorf("Check(%q) = %+v, want it rejected", text, match)
+		}
+	}
+	if match, err := s.Filter.Check(alice, "[x](https://good.example)"); err != nil || match != nil {
+		t.Errorf("Check of a link elsewhere = %+v, %v; want no match", match, err)
+	}
+}
+
+func TestCheckTermsAndPatterns(t *testing.T) {
+	_, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	rules := []FilterRule{
+		{Kind: FilterTerm, Pattern: "spam", Action: FilterReview},
+		{Kind: FilterTerm, Pattern: "c++", Action: FilterReview},
+		{Kind: FilterRegex, Pattern: `\b\d{4}-\d{4}-\d{4}-\d{4}\b`, Action: FilterReject},
+		{Kind: FilterTerm, Pattern: "scam", Action: FilterReject},
+	}
+	for _, rule := range rules {
+		if _, err := s.Filter.AddRule(rule, alice); err != nil {
+			t.Fatalf("AddRule(%+v): %v", rule, err)
+		}
+	}
+
+	tests := []struct {
+		text   string
+		action string // empty for no match
+	}{
+		{"nothing to see here", ""},
+		{"buy SPAM now", FilterReview},
+		{"spam", FilterReview},
+		{"(spam)", FilterReview},
+		{"spammer and antispam are other words", ""},
+		{"I write C++ for a living", FilterReview},
+		{"card 1234-5678-9012-3456 please", FilterReject},
+		{"card 1234-5678 only", ""},
+		// rejecting wins over holding for review
+		{"spam and a scam", FilterReject},
+	}
+	for _, tt := range tests {
+		// checking twice goes through the compiled patterns kept from the first time
+		for i := 0; i < 2; i++ {
+			match, err := s.Filter.Check(alice, tt.text)
+			if err != nil {
+				t.Fatalf("Check(%q): %v", tt.text, err)
+			}
+			got := ""
+			if match != nil {
+				got = match.Action
+			}
+			if got != tt.action {
+				t.Errorf("Check(%q) = %+v, want action %q", tt.text, match, tt.action)
+			}
+		}
+	}
+}
+
+func TestDeletedRuleStopsMatching(t *testing.T) {
+	_, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	ruleID, err := s.Filter.AddRule(FilterRule{Kind: FilterRegex, Pattern: "fo+", Action: FilterReject}, alice)
+	if err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+	if match, err := s.Filter.Check(alice, "foo"); err != nil || !match.Rejected() {
+		t.Fatalf("Check = %+v, %v; want it rejected", match, err)
+	}
+
+	if err := s.Filter.DeleteRule(ruleID, alice); err != nil {
+		t.Fatalf("DeleteRule: %v", err)
+	}
+	if match, err := s.Filter.Check(alice, "foo"); err != nil || match != nil {
+		t.Errorf("Check after DeleteRule = %+v, %v; want no match", match, err)
+	}
+	s.Filter.mu.Lock()
+	cached := len(s.Filter.patterns)
+	s.Filter.mu.Unlock()
+	if cached != 0 {
+		t.Errorf("%d compiled patterns kept after the rule was deleted", cached)
+	}
+}
+
+func TestCheckLinkCap(t *testing.T) {
+	db, s := openTestStore(t)
+	young := createTestUser(t, s, "young")
+	old := createTestUser(t, s, "old")
+	if _, err := db.Exec(`UPDATE User SET created_at = datetime('now', '-30 days') WHERE UserID = ?`, old); err != nil {
+		t.Fatalf("ageing account: %v", err)
+	}
+	rule := FilterRule{Kind: FilterLinkCap, MaxLinks: 1, AccountAgeDays: 7, Action: FilterReview}
+	if _, err := s.Filter.AddRule(rule, old); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+
+	oneLink := "see https://a.example"
+	twoLinks := "see https://a.example and [this](https://b.example)"
+	tests := []struct {
+		userID int
+		text   string
+		held   bool
+	}{
+		{young, "no links at all", false},
+		{young, oneLink, false},
+		{young, twoLinks, true},
+		{old, twoLinks, false},
+	}
+	for _, tt := range tests {
+		match, err := s.Filter.Check(tt.userID, tt.text)
+		if err != nil {
+			t.Fatalf("Check(%q): %v", tt.text, err)
+		}
+		if held := match != nil && match.Action == FilterReview; held != tt.held {
+			t.Errorf("Check(%d, %q) = %+v, want held %v", tt.userID, tt.text, match, tt.held)
+		}
+	}
+}
@@ -160,9 +160,6 @@ const (
 	// TODO: to store the cookies in a map instead of storing them in the database.
 )
 
-// InitDB initializes the database connection, creates the necessary tables, and performs any initial table filling.
-// It opens a new SQLite database connection, checks the connection, and then calls the CreateTables function to create the required tables.
-// If any errors occur during the database initialization or table creation, it logs a fatal error.
 var predefinedCategories = []string{"Technology", "Education", "Entertainment", "Travel", "Cars", "Sports", "Lifestyle", "Science", "Business"}
 
 func InsertDefaultUsers(db *sql.DB) {
@@ -200,80 +197,25 @@ func InsertDefaultCategories(db *sql.DB) {
 	log.Println("Categorys Inserted successfully...")
 }
 
-func InitDB() {
-	db, err := sql.Open("sqlite3", "./meow.db")
-	if err != nil {
-		log.Fatalf("error creating database: %v", err)
+// InitDB prepares the shared database handle opened by OpenStore: it applies every pending schema migration and performs any initial table filling.
+// If any errors occur while migrating, it logs a fatal error.
+func InitDB(db *sql.DB) {
+	if _, err := MigrateUp(db, 0); err != nil {
+		log.Fatalf("error migrating the database: %v", err)
 	}
-	defer db.Close()
-
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("error connecting to the database: %v", err)
+	log.Println("Tables created successfully...")
+	if n, err := RenderMissingContent(db); err != nil {
+		log.Fatalf("error rendering post and comment content: %v", err)
+	} else if n > 0 {
+		log.Printf("rendered the content of %d posts and comments\n", n)
 	}
 
 	// * DONE
-	CreateTables(db)
 	InsertDefaultUsers(db)
-	InsertDefaultCategories(db)
-	// InitailTableFiller(db)
-}
-
-// CreateTables creates the necessary tables in the database.
-// It enables foreign key constraints, creates the user, post, category, post_category, comment, like, dislike, and notification tables.
-// If any errors occur during the table creation, it logs a fatal error.
-// Finally, it logs a success message indicating that the tables were created successfully.
-func CreateTables(db *sql.DB) {
-	if _, err := db.Exec(enforcementOfFKs); err != nil {
-		log.Fatalf("error enabling foreign keys: %v", err)
-	}
-	if _, err := db.Exec(CreateUserTableQuery); err != nil {
-		log.Fatalf("error creating the user table: %v", err)
-	}
-	if _, err := db.Exec(CreatePostTableQuery); err != nil {
-		log.Fatalf("error creating the post table: %v", err)
-	}
-	if _, err := db.Exec(CreateCategoryTableQuery); err != nil {
-		log.Fatalf("error creating the category table: %v", err)
-	}
-	if _, err := db.Exec(CreatePostCategoryTableQuery); err != nil {
-		log.Fatalf("error creating the post_category table: %v", err)
-	}
-	if _, err := db.Exec(CreateCommentTableQuery); err != nil {
-		log.Fatalf("error creating the comment table: %v", err)
-	}
-	if _, err := db.Exec(CreatePostLikeTableQuery); err != nil {
-		log.Fatalf("error creating the like table: %v", err)
-	}
-	if _, err := db.Exec(CreatePostDislikeTableQuery); err != nil {
-		log.Fatalf("error creating the dislike table: %v", err)
-	}
-	if _, err := db.Exec(CreateCommentLikeTableQuery); err != nil {
-		log.Fatalf("error creating the comment_like table: %v", err)
-	}
-	if _, err := db.Exec(CreateCommentDislikeTableQuery); err != nil {
-		log.Fatalf("error creating the comment_dislike table: %v", err)
-	}
-	// if _, err := db.Exec(CreatePostImageTableQuery); err != nil {
-	// 	log.Fatalf("error creating the post_image table: %v", err)
-	// }
-	if _, err := db.Exec(CreateNotificationTableQuery); err != nil {
-		log.Fatalf("error creating the Notification table: %v", err)
-	}
-	if _, err := db.Exec(sessionTableQuery); err != nil {
-		log.Fatalf("error creating the session table: %v", err)
-	}
-	if _, err := db.Exec(moderationRequestTableQuery); err != nil {
-		log.Fatalf("error creating the moderation request table: %v", err)
-	}
-	if _, err := db.Exec(postReportTableQuery); err != nil {
-		log.Fatalf("error creating the post report table: %v", err)
-	}
-
 	// Insert default categories if none exist
 	insertDefaultCategories(db)
-
-	log.Println("Tables created successfully...")
+	InsertDefaultCategories(db)
+	// InitailTableFiller(db)
 }
 
 // insertDefaultCategories adds default categories if the Category table is empty
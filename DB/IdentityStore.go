@@ -0,0 +1,129 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	selectIdentityOwnerQuery  = `SELECT UserID FROM ExternalIdentity WHERE Provider = ? AND Subject = ?`
+	selectUserProviderQuery   = `SELECT Subject FROM ExternalIdentity WHERE UserID = ? AND Provider = ?`
+	selectUserIdentitiesQuery = `SELECT Provider, Subject, Email, LinkedAt, LastUsedAt FROM ExternalIdentity WHERE UserID = ? ORDER BY Provider`
+	insertIdentityQuery       = `INSERT INTO ExternalIdentity (UserID, Provider, Subject, Email) VALUES (?,?,?,?)`
+	updateIdentityEmailQuery  = `UPDATE ExternalIdentity SET Email = ? WHERE Provider = ? AND Subject = ?`
+	touchIdentityQuery        = `UPDATE ExternalIdentity SET LastUsedAt = ?, Email = ? WHERE Provider = ? AND Subject = ?`
+	deleteUserIdentityQuery   = `DELETE FROM ExternalIdentity WHERE UserID = ? AND Provider = ?`
+)
+
+var (
+	// ErrIdentityTaken is returned when the external account is already linked to another user.
+	ErrIdentityTaken = errors.New("external account is linked to another user")
+	// ErrProviderLinked is returned when the user already has a different account of the same provider linked.
+	ErrProviderLinked = errors.New("user already has an account of this provider linked")
+)
+
+// ExternalIdentity links an account at an OAuth provider to a user. Subject is the provider's
+// permanent ID for the account; Email is the address the provider last reported for it.
+type ExternalIdentity struct {
+	Provider   string
+	Subject    string
+	Email      string
+	LinkedAt   time.Time
+	LastUsedAt time.Time
+}
+
+// IdentityStore reads and writes the links between users and their OAuth provider accounts.
+type IdentityStore struct {
+	db *sql.DB
+}
+
+// NewIdentityStore returns an IdentityStore backed by db.
+func NewIdentityStore(db *sql.DB) *IdentityStore {
+	return &IdentityStore{db: db}
+}
+
+// UserID returns the user the provider account subject is linked to, or sql.ErrNoRows.
+func (s *IdentityStore) UserID(provider, subject string) (int, error) {
+	var userID int
+	err := s.db.QueryRow(selectIdentityOwnerQuery, provider, subject).Scan(&userID)
+	return userID, err
+}
+
+// Link links the provider account subject to userID. Linking an account that is already linked to
+// userID only refreshes its email. It returns ErrIdentityTaken if the account belongs to another
+// user, and ErrProviderLinked if userID already has a different account of provider linked.
+func (s *IdentityStore) Link(userID int, provider, subject, email string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var owner int
+	err = tx.QueryRow(selectIdentityOwnerQuery, provider, subject).Scan(&owner)
+	switch {
+	case err == nil && owner != userID:
+		return ErrIdentityTaken
+	case err == nil:
+		if _, err := tx.Exec(updateIdentityEmailQuery, email, provider, subject); err != nil {
+			return fmt.Errorf("error updating external identity: %v", err)
+		}
+		return tx.Commit()
+	case err != sql.ErrNoRows:
+		return fmt.Errorf("error checking external identity: %v", err)
+	}
+
+	var linked string
+	err = tx.QueryRow(selectUserProviderQuery, userID, provider).Scan(&linked)
+	if err == nil {
+		return ErrProviderLinked
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("error checking linked accounts: %v", err)
+	}
+
+	if _, err := tx.Exec(insertIdentityQuery, userID, provider, subject, email); err != nil {
+		return fmt.Errorf("error inserting external identity: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Touch records that the provider account subject was just used to log in, reporting email.
+func (s *IdentityStore) Touch(provider, subject, email string) error {
+	_, err := s.db.Exec(touchIdentityQuery, time.Now().UTC(), email, provider, subject)
+	return err
+}
+
+// Unlink removes the account of provider linked to userID and reports whether there was one.
+func (s *IdentityStore) Unlink(userID int, provider string) (bool, error) {
+	result, err := s.db.Exec(deleteUserIdentityQuery, userID, provider)
+	if err != nil {
+		return false, fmt.Errorf("error unlinking external identity: %v", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ListForUser returns the provider accounts linked to userID, ordered by provider.
+func (s *IdentityStore) ListForUser(userID int) ([]ExternalIdentity, error) {
+	rows, err := s.db.Query(selectUserIdentitiesQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying external identities: %v", err)
+	}
+	defer rows.Close()
+
+	identities := []ExternalIdentity{}
+	for rows.Next() {
+		var id ExternalIdentity
+		if err := rows.Scan(&id.Provider, &id.Subject, &id.Email, &id.LinkedAt, &id.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("error scanning external identities: %v", err)
+		}
+		identities = append(identities, id)
+	}
+	return identities, rows.Err()
+}
@@ -3,13 +3,13 @@ package DB
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"forum/markdown"
 )
 
 const (
 	insertCommentQuery = `
-        INSERT INTO "Comment" (PostID, UserID, content)
-        VALUES (?,?,?)
+        INSERT INTO "Comment" (PostID, UserID, content, content_html)
+        VALUES (?,?,?,?)
     `
 	SelectUsernameQuery = `
 		SELECT username 
@@ -18,16 +18,17 @@ const (
 	`
 )
 
-func InsertComment(postID int, userID int, comment string) (int64, error) {
-
-	db, err := sql.Open("sqlite3", "meow.db")
+// InsertComment adds a top-level comment to postID and returns its ID. The comment is stored both
+// as written, in Markdown, and rendered to HTML. With held set, it is kept out of sight until a
+// moderator reviews it.
+func InsertComment(db *sql.DB, postID int, userID int, comment string, held *FilterMatch) (int64, error) {
+	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error getting user %v\n", err)
-		return -1, fmt.Errorf("error Opening database: %v", err)
+		return -1, fmt.Errorf("error starting transaction: %v", err)
 	}
-	defer db.Close()
+	defer tx.Rollback()
 
-	result, err := db.Exec(insertCommentQuery, postID, userID, comment)
+	result, err := tx.Exec(insertCommentQuery, postID, userID, comment, markdown.Render(comment))
 	if err != nil {
 		return -1, fmt.Errorf("error insert in the database: %v", err)
 	}
@@ -37,5 +38,14 @@ func InsertComment(postID int, userID int, comment string) (int64, error) {
 		return -1, fmt.Errorf("error getting last insert ID: %v", err)
 	}
 
+	if held != nil {
+		if err := holdContent(tx, HeldComment, int(commentID), userID, held, false); err != nil {
+			return -1, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("error committing transaction: %v", err)
+	}
+
 	return commentID, nil
 }
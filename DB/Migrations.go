@@ -0,0 +1,822 @@
+package DB
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	createSchemaMigrationsQuery = `CREATE TABLE IF NOT EXISTS schema_migrations(
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+	selectAppliedMigrationsQuery = `SELECT version, applied_at FROM schema_migrations ORDER BY version`
+	insertMigrationQuery         = `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?,?,?)`
+	deleteMigrationQuery         = `DELETE FROM schema_migrations WHERE version = ?`
+)
+
+// Migration is one numbered, reversible schema change.
+// Up and Down may hold several statements separated by semicolons.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// ErrNoFTS5 is returned by MigrateUp when SQLite was compiled without FTS5, which post and comment
+// search are built on.
+var ErrNoFTS5 = errors.New("SQLite was built without the FTS5 extension that search needs: build the server with -tags sqlite_fts5, e.g. go build -tags sqlite_fts5 -o forum .")
+
+// MigrationState reports whether a migration has been applied to the database and when.
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// commentSearchTriggers keep CommentSearch in sync with Comment.
+// They live outside the migrations because any migration that rebuilds Comment has to recreate them.
+const commentSearchTriggers = `
+	CREATE TRIGGER CommentSearchInsert AFTER INSERT ON Comment BEGIN
+		INSERT INTO CommentSearch (rowid, content) VALUES (new.CommentID, new.content);
+	END;
+	CREATE TRIGGER CommentSearchDelete AFTER DELETE ON Comment BEGIN
+		INSERT INTO CommentSearch (CommentSearch, rowid, content) VALUES ('delete', old.CommentID, old.content);
+	END;
+	CREATE TRIGGER CommentSearchUpdate AFTER UPDATE OF content ON Comment BEGIN
+		INSERT INTO CommentSearch (CommentSearch, rowid, content) VALUES ('delete', old.CommentID, old.content);
+		INSERT INTO CommentSearch (rowid, content) VALUES (new.CommentID, new.content);
+	END;
+`
+
+// migrations is the ordered list of every schema change the forum knows about.
+// ! never edit or reorder a migration that has shipped, add a new one at the end instead.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: CreateUserTableQuery + CreatePostTableQuery + CreateCategoryTableQuery + CreatePostCategoryTableQuery +
+			CreateCommentTableQuery + CreatePostLikeTableQuery + CreatePostDislikeTableQuery +
+			CreateCommentLikeTableQuery + CreateCommentDislikeTableQuery + CreateNotificationTableQuery +
+			sessionTableQuery + moderationRequestTableQuery + postReportTableQuery,
+		Down: `
+			DROP TABLE IF EXISTS PostReport;
+			DROP TABLE IF EXISTS ModerationRequest;
+			DROP TABLE IF EXISTS Session;
+			DROP TABLE IF EXISTS Notification;
+			DROP TABLE IF EXISTS CommentDislike;
+			DROP TABLE IF EXISTS CommentLike;
+			DROP TABLE IF EXISTS PostDislike;
+			DROP TABLE IF EXISTS PostLike;
+			DROP TABLE IF EXISTS Comment;
+			DROP TABLE IF EXISTS PostCategory;
+			DROP TABLE IF EXISTS Category;
+			DROP TABLE IF EXISTS Post;
+			DROP TABLE IF EXISTS User;
+		`,
+	},
+	{
+		// External-content FTS5 indexes over post titles/bodies and comments, kept in sync by triggers.
+		// Needs SQLite built with FTS5, i.e. the binary has to be built with -tags sqlite_fts5.
+		Version: 2,
+		Name:    "full_text_search",
+		Up: `
+			CREATE VIRTUAL TABLE PostSearch USING fts5(
+				title, content, content='Post', content_rowid='PostID', tokenize='porter unicode61'
+			);
+			CREATE VIRTUAL TABLE CommentSearch USING fts5(
+				content, content='Comment', content_rowid='CommentID', tokenize='porter unicode61'
+			);
+
+			CREATE TRIGGER PostSearchInsert AFTER INSERT ON Post BEGIN
+				INSERT INTO PostSearch (rowid, title, content) VALUES (new.PostID, new.title, new.content);
+			END;
+			CREATE TRIGGER PostSearchDelete AFTER DELETE ON Post BEGIN
+				INSERT INTO PostSearch (PostSearch, rowid, title, content) VALUES ('delete', old.PostID, old.title, old.content);
+			END;
+			CREATE TRIGGER PostSearchUpdate AFTER UPDATE OF title, content ON Post BEGIN
+				INSERT INTO PostSearch (PostSearch, rowid, title, content) VALUES ('delete', old.PostID, old.title, old.content);
+				INSERT INTO PostSearch (rowid, title, content) VALUES (new.PostID, new.title, new.content);
+			END;
+			` + commentSearchTriggers + `
+
+			INSERT INTO PostSearch (PostSearch) VALUES ('rebuild');
+			INSERT INTO CommentSearch (CommentSearch) VALUES ('rebuild');
+		`,
+		Down: `
+			DROP TRIGGER IF EXISTS CommentSearchUpdate;
+			DROP TRIGGER IF EXISTS CommentSearchDelete;
+			DROP TRIGGER IF EXISTS CommentSearchInsert;
+			DROP TRIGGER IF EXISTS PostSearchUpdate;
+			DROP TRIGGER IF EXISTS PostSearchDelete;
+			DROP TRIGGER IF EXISTS PostSearchInsert;
+			DROP TABLE IF EXISTS CommentSearch;
+			DROP TABLE IF EXISTS PostSearch;
+		`,
+	},
+	{
+		// Replies point at the comment they answer; top-level comments keep a NULL parent.
+		// Notification is rebuilt because SQLite cannot alter a CHECK constraint in place.
+		Version: 3,
+		Name:    "threaded_comments",
+		Up: `
+			ALTER TABLE Comment ADD COLUMN ParentCommentID INTEGER REFERENCES Comment(CommentID) ON DELETE CASCADE;
+			CREATE INDEX idx_comment_parent ON Comment(ParentCommentID);
+
+			CREATE TABLE Notification_new (
+				NotificationID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				UserToNotify INTEGER NOT NULL,
+				PostID INTEGER,
+				CommentID INTEGER,
+				NotificationType TEXT NOT NULL CHECK(NotificationType IN ('PostLike', 'PostDislike', 'Comment', 'CommentLike', 'CommentDislike', 'Reply')),
+				CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				IsRead BOOLEAN NOT NULL DEFAULT FALSE,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (UserToNotify) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (PostID) REFERENCES Post(PostID) ON DELETE SET NULL,
+				FOREIGN KEY (CommentID) REFERENCES Comment(CommentID) ON DELETE SET NULL
+			);
+			INSERT INTO Notification_new SELECT * FROM Notification;
+			DROP TABLE Notification;
+			ALTER TABLE Notification_new RENAME TO Notification;
+		`,
+		Down: `
+			DELETE FROM Notification WHERE NotificationType = 'Reply';
+			CREATE TABLE Notification_old (
+				NotificationID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				UserToNotify INTEGER NOT NULL,
+				PostID INTEGER,
+				CommentID INTEGER,
+				NotificationType TEXT NOT NULL CHECK(NotificationType IN ('PostLike', 'PostDislike', 'Comment', 'CommentLike', 'CommentDislike')),
+				CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				IsRead BOOLEAN NOT NULL DEFAULT FALSE,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (UserToNotify) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (PostID) REFERENCES Post(PostID) ON DELETE SET NULL,
+				FOREIGN KEY (CommentID) REFERENCES Comment(CommentID) ON DELETE SET NULL
+			);
+			INSERT INTO Notification_old SELECT * FROM Notification;
+			DROP TABLE Notification;
+			ALTER TABLE Notification_old RENAME TO Notification;
+
+			-- Replies are flattened into top-level comments rather than lost.
+			-- DROP COLUMN refuses columns with a foreign key, so Comment is rebuilt instead.
+			CREATE TABLE Comment_old (
+				CommentID INTEGER PRIMARY KEY AUTOINCREMENT,
+				PostID INTEGER NOT NULL,
+				UserID INTEGER NOT NULL,
+				content TEXT NOT NULL,
+				CmtDate TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (PostID) REFERENCES Post(PostID) ON DELETE CASCADE,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE
+			);
+			INSERT INTO Comment_old (CommentID, PostID, UserID, content, CmtDate)
+				SELECT CommentID, PostID, UserID, content, CmtDate FROM Comment;
+			DROP TABLE Comment;
+			ALTER TABLE Comment_old RENAME TO Comment;
+			` + commentSearchTriggers + `
+		`,
+	},
+	{
+		// Every session gets its own CSRF token. Sessions created before this migration get one
+		// the first time it is asked for, see SessionStore.CSRFToken.
+		Version: 4,
+		Name:    "session_csrf_token",
+		Up:      `ALTER TABLE Session ADD COLUMN csrf_token TEXT;`,
+		Down:    `ALTER TABLE Session DROP COLUMN csrf_token;`,
+	},
+	{
+		// Flags sessions whose ID must be replaced on their next request, e.g. after a privilege change.
+		Version: 5,
+		Name:    "session_rotation",
+		Up:      `ALTER TABLE Session ADD COLUMN rotate BOOLEAN NOT NULL DEFAULT FALSE;`,
+		Down:    `ALTER TABLE Session DROP COLUMN rotate;`,
+	},
+	{
+		// Records which browser a session belongs to and when it was last used, for the session list.
+		Version: 6,
+		Name:    "session_activity",
+		Up: `
+			ALTER TABLE Session ADD COLUMN user_agent TEXT;
+			ALTER TABLE Session ADD COLUMN last_seen TIMESTAMP;
+			UPDATE Session SET last_seen = created_at;
+		`,
+		Down: `
+			ALTER TABLE Session DROP COLUMN last_seen;
+			ALTER TABLE Session DROP COLUMN user_agent;
+		`,
+	},
+	{
+		// Single-use links for password resets and email verification. Only a SHA-256 digest of
+		// each token is stored, so a leaked database cannot be used to take accounts over.
+		Version: 7,
+		Name:    "account_tokens",
+		Up: `
+			ALTER TABLE User ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+			CREATE TABLE IF NOT EXISTS AccountToken(
+				TokenHash TEXT PRIMARY KEY,
+				UserID INTEGER NOT NULL,
+				Purpose TEXT NOT NULL CHECK(Purpose IN ('password_reset', 'email_verification')),
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				ExpiresAt TIMESTAMP NOT NULL,
+				UsedAt TIMESTAMP,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE
+			);
+			CREATE INDEX IF NOT EXISTS idx_account_token_user ON AccountToken(UserID, Purpose);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS AccountToken;
+			ALTER TABLE User DROP COLUMN email_verified;
+		`,
+	},
+	{
+		// TOTP two-factor authentication. A TwoFactor row with Enabled unset is an enrollment that
+		// has not been confirmed with a code yet. LastUsedStep is the time step of the last accepted
+		// code, so a code cannot be replayed. Recovery codes and login challenges are stored hashed.
+		Version: 8,
+		Name:    "two_factor",
+		Up: `
+			CREATE TABLE IF NOT EXISTS TwoFactor(
+				UserID INTEGER PRIMARY KEY,
+				Secret TEXT NOT NULL,
+				Enabled BOOLEAN NOT NULL DEFAULT FALSE,
+				LastUsedStep INTEGER NOT NULL DEFAULT 0,
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE
+			);
+
+			CREATE TABLE IF NOT EXISTS RecoveryCode(
+				CodeID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				CodeHash TEXT NOT NULL,
+				UsedAt TIMESTAMP,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE
+			);
+			CREATE INDEX IF NOT EXISTS idx_recovery_code_user ON RecoveryCode(UserID);
+
+			CREATE TABLE IF NOT EXISTS LoginChallenge(
+				ChallengeHash TEXT PRIMARY KEY,
+				UserID INTEGER NOT NULL,
+				ExpiresAt TIMESTAMP NOT NULL,
+				Attempts INTEGER NOT NULL DEFAULT 0,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS LoginChallenge;
+			DROP TABLE IF EXISTS RecoveryCode;
+			DROP TABLE IF EXISTS TwoFactor;
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "external_identity",
+		Up: `
+			CREATE TABLE IF NOT EXISTS ExternalIdentity(
+				IdentityID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				Provider TEXT NOT NULL,
+				Subject TEXT NOT NULL,
+				Email TEXT NOT NULL DEFAULT '',
+				LinkedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				LastUsedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (Provider, Subject),
+				UNIQUE (UserID, Provider),
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS ExternalIdentity;
+		`,
+	},
+	{
+		// Uploaded images get a thumbnail. Posts from before keep a NULL one and show the full image.
+		Version: 10,
+		Name:    "post_thumbnail",
+		Up:      `ALTER TABLE Post ADD COLUMN ThumbnailPath TEXT;`,
+		Down:    `ALTER TABLE Post DROP COLUMN ThumbnailPath;`,
+	},
+	{
+		// Posts carry an ordered gallery instead of a single image. Files are stored by name inside
+		// the upload directory; existing images move over as the first image of their post, with
+		// their type guessed from the file extension and their size unknown (0).
+		Version: 11,
+		Name:    "post_images",
+		Up: `
+			CREATE TABLE IF NOT EXISTS PostImage(
+				ImageID INTEGER PRIMARY KEY AUTOINCREMENT,
+				PostID INTEGER NOT NULL,
+				Position INTEGER NOT NULL,
+				image_filename TEXT NOT NULL,
+				thumbnail_filename TEXT NOT NULL,
+				image_mimetype TEXT NOT NULL,
+				image_width INTEGER NOT NULL DEFAULT 0,
+				image_height INTEGER NOT NULL DEFAULT 0,
+				alt_text TEXT NOT NULL DEFAULT '',
+				FOREIGN KEY (PostID) REFERENCES Post(PostID) ON DELETE CASCADE
+			);
+			CREATE INDEX IF NOT EXISTS idx_post_image_post ON PostImage(PostID, Position);
+			CREATE INDEX IF NOT EXISTS idx_post_image_file ON PostImage(image_filename);
+			CREATE INDEX IF NOT EXISTS idx_post_image_thumbnail ON PostImage(thumbnail_filename);
+
+			INSERT INTO PostImage (PostID, Position, image_filename, thumbnail_filename, image_mimetype)
+				SELECT
+					PostID,
+					0,
+					REPLACE(REPLACE(ImagePath, '../uploads/', ''), '/uploads/', ''),
+					REPLACE(REPLACE(COALESCE(NULLIF(ThumbnailPath, ''), ImagePath), '../uploads/', ''), '/uploads/', ''),
+					CASE
+						WHEN LOWER(ImagePath) LIKE '%.png' THEN 'image/png'
+						WHEN LOWER(ImagePath) LIKE '%.gif' THEN 'image/gif'
+						WHEN LOWER(ImagePath) LIKE '%.webp' THEN 'image/webp'
+						ELSE 'image/jpeg'
+					END
+				FROM Post
+				WHERE ImagePath IS NOT NULL AND ImagePath != '';
+
+			ALTER TABLE Post DROP COLUMN ThumbnailPath;
+			ALTER TABLE Post DROP COLUMN ImagePath;
+		`,
+		Down: `
+			ALTER TABLE Post ADD COLUMN ImagePath TEXT;
+			ALTER TABLE Post ADD COLUMN ThumbnailPath TEXT;
+			UPDATE Post SET
+				ImagePath = (SELECT '/uploads/' || image_filename FROM PostImage i WHERE i.PostID = Post.PostID ORDER BY Position LIMIT 1),
+				ThumbnailPath = (SELECT '/uploads/' || thumbnail_filename FROM PostImage i WHERE i.PostID = Post.PostID ORDER BY Position LIMIT 1);
+			DROP TABLE IF EXISTS PostImage;
+		`,
+	},
+	{
+		// Posts and comments are written in Markdown and stored rendered as well. Existing ones are
+		// left NULL here and rendered by InitDB, since rendering cannot be done in SQL.
+		Version: 12,
+		Name:    "rendered_content",
+		Up: `
+			ALTER TABLE Post ADD COLUMN content_html TEXT;
+			ALTER TABLE Comment ADD COLUMN content_html TEXT;
+		`,
+		Down: `
+			ALTER TABLE Comment DROP COLUMN content_html;
+			ALTER TABLE Post DROP COLUMN content_html;
+		`,
+	},
+	{
+		// Every edit of a post or comment is kept as a numbered revision, and posts and comments
+		// remember when they were last edited. Revision 1 is the original, written on the first edit.
+		Version: 13,
+		Name:    "revisions",
+		Up: `
+			ALTER TABLE Post ADD COLUMN EditedAt TIMESTAMP;
+			ALTER TABLE Comment ADD COLUMN EditedAt TIMESTAMP;
+			CREATE TABLE IF NOT EXISTS PostRevision(
+				RevisionID INTEGER PRIMARY KEY AUTOINCREMENT,
+				PostID INTEGER NOT NULL,
+				Number INTEGER NOT NULL,
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				EditorID INTEGER,
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				RestoredFrom INTEGER,
+				UNIQUE (PostID, Number),
+				FOREIGN KEY (PostID) REFERENCES Post(PostID) ON DELETE CASCADE,
+				FOREIGN KEY (EditorID) REFERENCES User(UserID) ON DELETE SET NULL
+			);
+			CREATE TABLE IF NOT EXISTS CommentRevision(
+				RevisionID INTEGER PRIMARY KEY AUTOINCREMENT,
+				CommentID INTEGER NOT NULL,
+				Number INTEGER NOT NULL,
+				content TEXT NOT NULL,
+				EditorID INTEGER,
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				RestoredFrom INTEGER,
+				UNIQUE (CommentID, Number),
+				FOREIGN KEY (CommentID) REFERENCES Comment(CommentID) ON DELETE CASCADE,
+				FOREIGN KEY (EditorID) REFERENCES User(UserID) ON DELETE SET NULL
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS CommentRevision;
+			DROP TABLE IF EXISTS PostRevision;
+			ALTER TABLE Comment DROP COLUMN EditedAt;
+			ALTER TABLE Post DROP COLUMN EditedAt;
+		`,
+	},
+	{
+		// Reports cover posts, comments and users and can be filed by anyone. A target has at most
+		// one pending Report; every user's reason and note for it is a ReportFiling. Post reports
+		// move over with the moderator's reason as the note, pending ones on the same post merged.
+		Version: 14,
+		Name:    "reports",
+		Up: `
+			CREATE TABLE IF NOT EXISTS Report(
+				ReportID INTEGER PRIMARY KEY AUTOINCREMENT,
+				TargetType TEXT NOT NULL CHECK(TargetType IN ('post', 'comment', 'user')),
+				TargetID INTEGER NOT NULL,
+				Status TEXT NOT NULL CHECK(Status IN ('pending', 'approved', 'rejected')) DEFAULT 'pending',
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				AdminResponse TEXT,
+				AdminID INTEGER,
+				ResponseDate TIMESTAMP,
+				FOREIGN KEY (AdminID) REFERENCES User(UserID) ON DELETE SET NULL
+			);
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_report_pending_target ON Report(TargetType, TargetID) WHERE Status = 'pending';
+			CREATE INDEX IF NOT EXISTS idx_report_status ON Report(Status, CreatedAt);
+			CREATE TABLE IF NOT EXISTS ReportFiling(
+				FilingID INTEGER PRIMARY KEY AUTOINCREMENT,
+				ReportID INTEGER NOT NULL,
+				ReporterID INTEGER NOT NULL,
+				Reason TEXT NOT NULL,
+				Note TEXT NOT NULL DEFAULT '',
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (ReportID, ReporterID),
+				FOREIGN KEY (ReportID) REFERENCES Report(ReportID) ON DELETE CASCADE,
+				FOREIGN KEY (ReporterID) REFERENCES User(UserID) ON DELETE CASCADE
+			);
+			CREATE INDEX IF NOT EXISTS idx_report_filing_reporter ON ReportFiling(ReporterID);
+
+			INSERT INTO Report (ReportID, TargetType, TargetID, Status, CreatedAt, AdminResponse, AdminID, ResponseDate)
+				SELECT ReportID, 'post', PostID, Status, COALESCE(ReportDate, CURRENT_TIMESTAMP), AdminResponse, AdminID, ResponseDate
+				FROM PostReport pr
+				WHERE Status != 'pending'
+					OR ReportID = (SELECT MIN(ReportID) FROM PostReport o WHERE o.PostID = pr.PostID AND o.Status = 'pending');
+			INSERT OR IGNORE INTO ReportFiling (ReportID, ReporterID, Reason, Note, CreatedAt)
+				SELECT
+					CASE WHEN Status = 'pending'
+						THEN (SELECT MIN(ReportID) FROM PostReport o WHERE o.PostID = pr.PostID AND o.Status = 'pending')
+						ELSE ReportID
+					END,
+					ModeratorID, 'other', Reason, COALESCE(ReportDate, CURRENT_TIMESTAMP)
+				FROM PostReport pr;
+			DROP TABLE IF EXISTS PostReport;
+		`,
+		Down: postReportTableQuery + `
+			INSERT INTO PostReport (PostID, ModeratorID, ReportDate, Reason, Status, AdminResponse, AdminID, ResponseDate)
+				SELECT r.TargetID, f.ReporterID, f.CreatedAt, CASE WHEN f.Note = '' THEN f.Reason ELSE f.Note END,
+					r.Status, r.AdminResponse, r.AdminID, r.ResponseDate
+				FROM Report r
+				JOIN ReportFiling f ON f.ReportID = r.ReportID
+				WHERE r.TargetType = 'post' AND r.TargetID IN (SELECT PostID FROM Post);
+			DROP TABLE IF EXISTS ReportFiling;
+			DROP TABLE IF EXISTS Report;
+		`,
+	},
+	{
+		// Moderators hide, lock, pin and soft-delete posts instead of deleting them. Visibility is
+		// visible, hidden or deleted; ModerationReason says why a post was hidden or deleted, and
+		// ModeratedBy and ModeratedAt who last changed its state and when. Rolling back shows every
+		// post again.
+		Version: 15,
+		Name:    "post_states",
+		Up: `
+			ALTER TABLE Post ADD COLUMN Visibility TEXT NOT NULL DEFAULT 'visible' CHECK(Visibility IN ('visible', 'hidden', 'deleted'));
+			ALTER TABLE Post ADD COLUMN Locked BOOLEAN NOT NULL DEFAULT 0;
+			ALTER TABLE Post ADD COLUMN PinnedAt TIMESTAMP;
+			ALTER TABLE Post ADD COLUMN ModerationReason TEXT;
+			ALTER TABLE Post ADD COLUMN ModeratedBy INTEGER;
+			ALTER TABLE Post ADD COLUMN ModeratedAt TIMESTAMP;
+			CREATE INDEX IF NOT EXISTS idx_post_visibility ON Post(Visibility, PinnedAt);
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_post_visibility;
+			ALTER TABLE Post DROP COLUMN ModeratedAt;
+			ALTER TABLE Post DROP COLUMN ModeratedBy;
+			ALTER TABLE Post DROP COLUMN ModerationReason;
+			ALTER TABLE Post DROP COLUMN PinnedAt;
+			ALTER TABLE Post DROP COLUMN Locked;
+			ALTER TABLE Post DROP COLUMN Visibility;
+		`,
+	},
+	{
+		// Every privileged action leaves an AuditLog entry, written in the same transaction as the
+		// action itself. The log is append-only: triggers refuse updates and deletes, and it has no
+		// foreign keys so entries outlive the users, posts and comments they name.
+		Version: 16,
+		Name:    "audit_log",
+		Up: `
+			CREATE TABLE IF NOT EXISTS AuditLog(
+				AuditID INTEGER PRIMARY KEY AUTOINCREMENT,
+				ActorID INTEGER NOT NULL,
+				Action TEXT NOT NULL,
+				TargetType TEXT NOT NULL,
+				TargetID INTEGER NOT NULL,
+				Details TEXT NOT NULL DEFAULT '',
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_audit_actor ON AuditLog(ActorID, AuditID);
+			CREATE INDEX IF NOT EXISTS idx_audit_action ON AuditLog(Action, AuditID);
+			CREATE INDEX IF NOT EXISTS idx_audit_target ON AuditLog(TargetType, TargetID);
+			CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON AuditLog
+			BEGIN
+				SELECT RAISE(ABORT, 'the audit log is append-only');
+			END;
+			CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON AuditLog
+			BEGIN
+				SELECT RAISE(ABORT, 'the audit log is append-only');
+			END;
+		`,
+		Down: `
+			DROP TRIGGER IF EXISTS audit_log_no_delete;
+			DROP TRIGGER IF EXISTS audit_log_no_update;
+			DROP TABLE IF EXISTS AuditLog;
+		`,
+	},
+	{
+		// Admins sanction abusive users: a ban refuses their logins, a mute their posts, comments
+		// and reactions. Bans may be permanent, with a NULL ExpiresAt; a sanction ends when it
+		// expires or is lifted. Notification is rebuilt to tell users about their sanctions.
+		Version: 17,
+		Name:    "sanctions",
+		Up: `
+			CREATE TABLE IF NOT EXISTS Sanction(
+				SanctionID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				Kind TEXT NOT NULL CHECK(Kind IN ('ban', 'mute')),
+				Reason TEXT NOT NULL,
+				IssuedBy INTEGER,
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				ExpiresAt TIMESTAMP,
+				LiftedAt TIMESTAMP,
+				LiftedBy INTEGER,
+				CHECK(Kind = 'ban' OR ExpiresAt IS NOT NULL),
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (IssuedBy) REFERENCES User(UserID) ON DELETE SET NULL,
+				FOREIGN KEY (LiftedBy) REFERENCES User(UserID) ON DELETE SET NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_sanction_user ON Sanction(UserID, Kind);
+
+			CREATE TABLE Notification_new (
+				NotificationID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				UserToNotify INTEGER NOT NULL,
+				PostID INTEGER,
+				CommentID INTEGER,
+				NotificationType TEXT NOT NULL CHECK(NotificationType IN ('PostLike', 'PostDislike', 'Comment', 'CommentLike', 'CommentDislike', 'Reply', 'Ban', 'Mute')),
+				CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				IsRead BOOLEAN NOT NULL DEFAULT FALSE,
+				SanctionID INTEGER,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (UserToNotify) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (PostID) REFERENCES Post(PostID) ON DELETE SET NULL,
+				FOREIGN KEY (CommentID) REFERENCES Comment(CommentID) ON DELETE SET NULL,
+				FOREIGN KEY (SanctionID) REFERENCES Sanction(SanctionID) ON DELETE CASCADE
+			);
+			INSERT INTO Notification_new (NotificationID, UserID, UserToNotify, PostID, CommentID, NotificationType, CreatedAt, IsRead)
+				SELECT NotificationID, UserID, UserToNotify, PostID, CommentID, NotificationType, CreatedAt, IsRead FROM Notification;
+			DROP TABLE Notification;
+			ALTER TABLE Notification_new RENAME TO Notification;
+		`,
+		Down: `
+			DELETE FROM Notification WHERE NotificationType IN ('Ban', 'Mute');
+			CREATE TABLE Notification_old (
+				NotificationID INTEGER PRIMARY KEY AUTOINCREMENT,
+				UserID INTEGER NOT NULL,
+				UserToNotify INTEGER NOT NULL,
+				PostID INTEGER,
+				CommentID INTEGER,
+				NotificationType TEXT NOT NULL CHECK(NotificationType IN ('PostLike', 'PostDislike', 'Comment', 'CommentLike', 'CommentDislike', 'Reply')),
+				CreatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				IsRead BOOLEAN NOT NULL DEFAULT FALSE,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (UserToNotify) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (PostID) REFERENCES Post(PostID) ON DELETE SET NULL,
+				FOREIGN KEY (CommentID) REFERENCES Comment(CommentID) ON DELETE SET NULL
+			);
+			INSERT INTO Notification_old
+				SELECT NotificationID, UserID, UserToNotify, PostID, CommentID, NotificationType, CreatedAt, IsRead FROM Notification;
+			DROP TABLE Notification;
+			ALTER TABLE Notification_old RENAME TO Notification;
+			DROP TABLE IF EXISTS Sanction;
+		`,
+	},
+	{
+		// New posts, comments and edits go through the content filter before they are published.
+		// Admins keep its rules in FilterRule; content a rule holds for review gets a pending
+		// FilterHold and stays out of sight, posts as hidden and comments through HeldForReview,
+		// until a moderator approves or rejects it. Edited marks holds of content that was already
+		// published before an edit was held. Rolling back publishes whatever is still held.
+		Version: 18,
+		Name:    "content_filter",
+		Up: `
+			CREATE TABLE IF NOT EXISTS FilterRule(
+				RuleID INTEGER PRIMARY KEY AUTOINCREMENT,
+				Kind TEXT NOT NULL CHECK(Kind IN ('term', 'regex', 'deny_domain', 'allow_domain', 'link_cap')),
+				Pattern TEXT NOT NULL DEFAULT '',
+				MaxLinks INTEGER,
+				AccountAgeDays INTEGER,
+				Action TEXT NOT NULL CHECK(Action IN ('reject', 'review')),
+				CreatedBy INTEGER,
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				CHECK(Kind != 'link_cap' OR (MaxLinks >= 0 AND AccountAgeDays > 0)),
+				FOREIGN KEY (CreatedBy) REFERENCES User(UserID) ON DELETE SET NULL
+			);
+
+			CREATE TABLE IF NOT EXISTS FilterHold(
+				HoldID INTEGER PRIMARY KEY AUTOINCREMENT,
+				TargetType TEXT NOT NULL CHECK(TargetType IN ('post', 'comment')),
+				TargetID INTEGER NOT NULL,
+				UserID INTEGER NOT NULL,
+				RuleID INTEGER,
+				Reason TEXT NOT NULL,
+				Edited BOOLEAN NOT NULL DEFAULT 0,
+				Status TEXT NOT NULL DEFAULT 'pending' CHECK(Status IN ('pending', 'approved', 'rejected')),
+				CreatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				ReviewedBy INTEGER,
+				ReviewedAt TIMESTAMP,
+				FOREIGN KEY (UserID) REFERENCES User(UserID) ON DELETE CASCADE,
+				FOREIGN KEY (RuleID) REFERENCES FilterRule(RuleID) ON DELETE SET NULL,
+				FOREIGN KEY (ReviewedBy) REFERENCES User(UserID) ON DELETE SET NULL
+			);
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_filter_hold_pending ON FilterHold(TargetType, TargetID) WHERE Status = 'pending';
+
+			ALTER TABLE Comment ADD COLUMN HeldForReview BOOLEAN NOT NULL DEFAULT 0;
+		`,
+		Down: `
+			UPDATE Post SET Visibility = 'visible', ModerationReason = NULL, ModeratedAt = NULL
+			WHERE Visibility = 'hidden' AND ModeratedBy IS NULL
+				AND PostID IN (SELECT TargetID FROM FilterHold WHERE TargetType = 'post' AND Status = 'pending');
+			ALTER TABLE Comment DROP COLUMN HeldForReview;
+			DROP INDEX IF EXISTS idx_filter_hold_pending;
+			DROP TABLE IF EXISTS FilterHold;
+			DROP TABLE IF EXISTS FilterRule;
+		`,
+	},
+}
+
+// MigrationStatus lists every known migration together with whether it has been applied.
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		states = append(states, MigrationState{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return states, nil
+}
+
+// MigrateUp applies up to steps pending migrations in version order.
+// A steps value of 0 or less applies every pending migration.
+// It returns the number of migrations that were applied.
+func MigrateUp(db *sql.DB, steps int) (int, error) {
+	if err := checkFTS5(db); err != nil {
+		return 0, err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if steps > 0 && count == steps {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := runMigration(db, m, true); err != nil {
+			return count, err
+		}
+		log.Printf("applied migration %d_%s\n", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown rolls back up to steps applied migrations, newest first.
+// A steps value of 0 or less is treated as 1, so a whole schema is never dropped by accident.
+// It returns the number of migrations that were rolled back.
+func MigrateDown(db *sql.DB, steps int) (int, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := runMigration(db, m, false); err != nil {
+			return count, err
+		}
+		log.Printf("rolled back migration %d_%s\n", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+// checkFTS5 returns ErrNoFTS5 unless the SQLite behind db was compiled with FTS5. Without it the
+// search migration cannot be applied, and once applied its triggers fail every post and comment.
+func checkFTS5(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return fmt.Errorf("error checking for FTS5: %v", err)
+	}
+	if !enabled {
+		return ErrNoFTS5
+	}
+	return nil
+}
+
+// appliedMigrations makes sure the schema_migrations table exists and returns the applied versions.
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	if _, err := db.Exec(createSchemaMigrationsQuery); err != nil {
+		return nil, fmt.Errorf("error creating the schema_migrations table: %v", err)
+	}
+
+	rows, err := db.Query(selectAppliedMigrationsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error querying applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error scanning applied migration: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration applies (up) or reverts (down) a single migration inside a transaction.
+// Foreign keys are switched off on the migration's connection while it runs so that tables
+// can be rebuilt, and the result is checked with PRAGMA foreign_key_check before committing.
+func runMigration(db *sql.DB, m Migration, up bool) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting a connection for migration %d: %v", m.Version, err)
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF;`); err != nil {
+		return fmt.Errorf("error disabling foreign keys: %v", err)
+	}
+	defer conn.ExecContext(ctx, enforcementOfFKs)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if up {
+		if _, err = tx.Exec(m.Up); err != nil {
+			return fmt.Errorf("error applying migration %d_%s: %v", m.Version, m.Name, err)
+		}
+		if _, err = tx.Exec(insertMigrationQuery, m.Version, m.Name, time.Now()); err != nil {
+			return fmt.Errorf("error recording migration %d: %v", m.Version, err)
+		}
+	} else {
+		if _, err = tx.Exec(m.Down); err != nil {
+			return fmt.Errorf("error rolling back migration %d_%s: %v", m.Version, m.Name, err)
+		}
+		if _, err = tx.Exec(deleteMigrationQuery, m.Version); err != nil {
+			return fmt.Errorf("error removing migration record %d: %v", m.Version, err)
+		}
+	}
+
+	rows, err := tx.Query(`PRAGMA foreign_key_check;`)
+	if err != nil {
+		return fmt.Errorf("error checking foreign keys: %v", err)
+	}
+	violations := rows.Next()
+	rows.Close()
+	if violations {
+		return fmt.Errorf("migration %d_%s leaves foreign key violations", m.Version, m.Name)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package DB
+
+import "time"
+
+// Post is a forum post together with its author, reaction counts, comment count, categories and
+// images. Content is the Markdown the author wrote and ContentHTML its sanitized rendering.
+// ImagePath is the first image of the gallery, shown in the feed; it is nil for posts without images.
+// EditedAt is when the title or content last changed, nil for posts never edited.
+// Locked posts take no new comments; pinned posts are listed above the others.
+type Post struct {
+	PostID      int         `json:"PostID"`
+	UserID      int         `json:"UserID"`
+	PostDate    string      `json:"PostDate"`
+	Title       string      `json:"title"`
+	Content     string      `json:"content"`
+	ContentHTML string      `json:"contentHtml"`
+	EditedAt    *time.Time  `json:"editedAt"`
+	ImagePath   *ImagePaths `json:"imagePath"`
+	Images      []PostImage `json:"images"`
+	Username    string      `json:"username"`
+	Likes       int         `json:"Likes"`
+	Dislikes    int         `json:"Dislikes"`
+	CmtCount    int         `json:"CmtCount"`
+	Categories  []string    `json:"Categories"`
+	Locked      bool        `json:"locked"`
+	Pinned      bool        `json:"pinned"`
+}
+
+// ImagePaths are the URLs of an image: the full image and a thumbnail for the feed.
+type ImagePaths struct {
+	Full      string `json:"full"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+// PostImage is one image of a post's gallery. Filename and ThumbnailFilename are the keys of the
+// files in the upload storage; ImagePath holds the URLs they are served from, which may be signed
+// and expire, so they are resolved every time the image is read.
+// Width and Height are 0 for images uploaded before they were recorded.
+type PostImage struct {
+	ImageID           int        `json:"imageId"`
+	Position          int        `json:"position"`
+	ImagePath         ImagePaths `json:"imagePath"`
+	AltText           string     `json:"altText"`
+	MIMEType          string     `json:"mimeType"`
+	Width             int        `json:"width"`
+	Height            int        `json:"height"`
+	Filename          string     `json:"-"`
+	ThumbnailFilename string     `json:"-"`
+}
+
+// ImageURLFunc turns the name of an uploaded file into the URL a browser loads it from.
+type ImageURLFunc func(name string) string
+
+// Comment is a comment on a post together with its author and reaction counts.
+// Content is the Markdown the author wrote and ContentHTML its sanitized rendering.
+// EditedAt is when the content last changed, nil for comments never edited.
+// ParentID is nil for top-level comments; Depth is 0 for them and grows by one per reply level.
+type Comment struct {
+	CmtID       int        `json:"CmtID"`
+	UserID      int        `json:"CmtUserID"`
+	Content     string     `json:"CmtContent"`
+	ContentHTML string     `json:"CmtContentHTML"`
+	CmtDate     string     `json:"CmtDate"`
+	EditedAt    *time.Time `json:"CmtEditedAt"`
+	Username    string     `json:"CmtUsername"`
+	Likes       int        `json:"CmtLikes"`
+	Dislikes    int        `json:"CmtDislikes"`
+	ParentID    *int       `json:"CmtParentID"`
+	Depth       int        `json:"CmtDepth"`
+}
+
+// CategoryPosts groups the posts that belong to a single category.
+type CategoryPosts struct {
+	CategoryName string `json:"CategoryName"`
+	Posts        []Post `json:"Posts"`
+}
+
+// PostPage is one page of the post feed. NextCursor is empty on the last page.
+// Pinned holds the pinned posts, which stay out of the feed, on the first page only.
+type PostPage struct {
+	Pinned     []Post `json:"pinned,omitempty"`
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"nextCursor"`
+}
+
+// SearchResult is a post matched by a search. It encodes like a Post with an extra snippet:
+// an HTML-escaped excerpt of the best matching title, body or comment with the matched terms
+// wrapped in <mark> tags.
+type SearchResult struct {
+	Post
+	Snippet string `json:"snippet"`
+}
+
+// Session is a login session as stored in the Session table.
+// Rotate is set when the session ID has to be replaced on the session's next request.
+type Session struct {
+	ID        string
+	UserID    int
+	CreatedAt time.Time
+	LastSeen  time.Time
+	Expiry    time.Time
+	IPAddress string
+	UserAgent string
+	Rotate    bool
+}
+
+// Handle identifies the session to its owner without revealing the session ID itself,
+// which is a bearer credential and must stay in the HttpOnly cookie.
+func (s Session) Handle() string {
+	return SessionHandle(s.ID)
+}
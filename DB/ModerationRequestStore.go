@@ -0,0 +1,143 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPendingModerationRequest is returned when a user who is still waiting for an answer asks
+// to become a moderator again.
+var ErrPendingModerationRequest = errors.New("moderation request already pending")
+
+// Statuses of a moderation request.
+const (
+	ModerationRequestPending  = "pending"
+	ModerationRequestApproved = "approved"
+	ModerationRequestRejected = "rejected"
+)
+
+const (
+	selectModerationRequestsQuery = `
+        SELECT mr.RequestID, mr.UserID, u.username, mr.RequestDate, mr.Status,
+               COALESCE(mr.AdminResponse, ''), COALESCE(mr.ResponseDate, '')
+        FROM ModerationRequest mr
+        JOIN User u ON mr.UserID = u.UserID
+        ORDER BY mr.RequestDate DESC
+    `
+	pendingModerationRequestQuery = `SELECT EXISTS(SELECT 1 FROM ModerationRequest WHERE UserID = ? AND Status = 'pending')`
+	insertModerationRequestQuery  = `INSERT INTO ModerationRequest (UserID) VALUES (?)`
+	answerModerationRequestQuery  = `UPDATE ModerationRequest SET Status = ?, AdminID = ?, ResponseDate = ? WHERE RequestID = ?`
+	selectRequestUserQuery        = `SELECT UserID FROM ModerationRequest WHERE RequestID = ?`
+	promoteToModeratorQuery       = `UPDATE User SET privilege = 2 WHERE UserID = ?`
+)
+
+// ModerationRequest is a user's request to become a moderator.
+type ModerationRequest struct {
+	RequestID     int    `json:"RequestID"`
+	UserID        int    `json:"UserID"`
+	Username      string `json:"Username"`
+	RequestDate   string `json:"RequestDate"`
+	Status        string `json:"Status"`
+	AdminResponse string `json:"AdminResponse,omitempty"`
+	ResponseDate  string `json:"ResponseDate,omitempty"`
+}
+
+// ModerationRequestStore reads and writes the requests of users to become moderators.
+type ModerationRequestStore struct {
+	db *sql.DB
+}
+
+// NewModerationRequestStore returns a ModerationRequestStore backed by db.
+func NewModerationRequestStore(db *sql.DB) *ModerationRequestStore {
+	return &ModerationRequestStore{db: db}
+}
+
+// List returns every moderation request, newest first.
+func (s *ModerationRequestStore) List() ([]ModerationRequest, error) {
+	rows, err := s.db.Query(selectModerationRequestsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error querying moderation requests: %v", err)
+	}
+	defer rows.Close()
+
+	requests := []ModerationRequest{}
+	for rows.Next() {
+		var req ModerationRequest
+		if err := rows.Scan(&req.RequestID, &req.UserID, &req.Username, &req.RequestDate,
+			&req.Status, &req.AdminResponse, &req.ResponseDate); err != nil {
+			return nil, fmt.Errorf("error scanning moderation request: %v", err)
+		}
+		requests = append(requests, req)
+	}
+	return requests, rows.Err()
+}
+
+// Create files a request of userID to become a moderator. It returns ErrPendingModerationRequest
+// if userID already has one waiting for an answer.
+func (s *ModerationRequestStore) Create(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var pending bool
+	if err := tx.QueryRow(pendingModerationRequestQuery, userID).Scan(&pending); err != nil {
+		return fmt.Errorf("error checking existing requests: %v", err)
+	}
+	if pending {
+		return ErrPendingModerationRequest
+	}
+	if _, err := tx.Exec(insertModerationRequestQuery, userID); err != nil {
+		return fmt.Errorf("error creating moderation request: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Respond answers requestID on behalf of adminID with ModerationRequestApproved or
+// ModerationRequestRejected. Approving it promotes the user who asked to moderator and records
+// the promotion in the audit log, in the same transaction, and returns their ID; otherwise the ID
+// is 0. It returns sql.ErrNoRows if the request does not exist.
+func (s *ModerationRequestStore) Respond(requestID, adminID int, status string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(answerModerationRequestQuery, status, adminID, time.Now().Format("2006-01-02 15:04:05"), requestID)
+	if err != nil {
+		return 0, fmt.Errorf("error updating moderation request: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking moderation request update: %v", err)
+	}
+	if n == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	var userID int
+	if status == ModerationRequestApproved {
+		if err := tx.QueryRow(selectRequestUserQuery, requestID).Scan(&userID); err != nil {
+			return 0, fmt.Errorf("error getting user of moderation request: %v", err)
+		}
+		if _, err := tx.Exec(promoteToModeratorQuery, userID); err != nil {
+			return 0, fmt.Errorf("error promoting user: %v", err)
+		}
+		details := fmt.Sprintf("moderation request #%d approved", requestID)
+		if err := RecordAudit(tx, adminID, AuditPromoteUser, AuditTargetUser, userID, details); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return userID, nil
+}
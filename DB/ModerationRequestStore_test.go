@@ -0,0 +1,75 @@
+package DB
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestModerationRequestRespond(t *testing.T) {
+	_, s := openTestStore(t)
+	admin := createTestUser(t, s, "admin1")
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+
+	for _, userID := range []int{alice, bob} {
+		if err := s.ModerationRequests.Create(userID); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := s.ModerationRequests.Create(alice); err != ErrPendingModerationRequest {
+		t.Errorf("second pending request: err = %v, want ErrPendingModerationRequest", err)
+	}
+
+	requests, err := s.ModerationRequests.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("%d requests listed, want 2", len(requests))
+	}
+	byUser := map[int]ModerationRequest{}
+	for _, req := range requests {
+		byUser[req.UserID] = req
+		if req.Status != ModerationRequestPending {
+			t.Errorf("new request has status %q", req.Status)
+		}
+	}
+
+	promoted, err := s.ModerationRequests.Respond(byUser[alice].RequestID, admin, ModerationRequestApproved)
+	if err != nil {
+		t.Fatalf("approving: %v", err)
+	}
+	if promoted != alice {
+		t.Errorf("approving promoted user %d, want %d", promoted, alice)
+	}
+	if privilege, err := s.Users.Privilege(alice); err != nil || privilege != 2 {
+		t.Errorf("alice has privilege %d, err %v; want 2", privilege, err)
+	}
+
+	promoted, err = s.ModerationRequests.Respond(byUser[bob].RequestID, admin, ModerationRequestRejected)
+	if err != nil {
+		t.Fatalf("rejecting: %v", err)
+	}
+	if promoted != 0 {
+		t.Errorf("rejecting promoted user %d", promoted)
+	}
+	if privilege, err := s.Users.Privilege(bob); err != nil || privilege != 1 {
+		t.Errorf("bob has privilege %d, err %v; want 1", privilege, err)
+	}
+	// an answered request no longer stops a new one
+	if err := s.ModerationRequests.Create(bob); err != nil {
+		t.Errorf("asking again after a rejection: %v", err)
+	}
+
+	if _, err := s.ModerationRequests.Respond(9999, admin, ModerationRequestApproved); err != sql.ErrNoRows {
+		t.Errorf("answering a missing request: err = %v, want sql.ErrNoRows", err)
+	}
+
+	page, err := s.Audit.List(AuditFilter{Action: AuditPromoteUser, TargetID: alice})
+	if err != nil {
+		t.Fatalf("listing audit log: %v", err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].ActorID != admin {
+		t.Errorf("promotion audit entries = %+v, want one by the admin", page.Entries)
+	}
+}
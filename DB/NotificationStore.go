@@ -0,0 +1,198 @@
+package DB
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Types of notification about reactions and comments. Sanctions have their own, see SanctionStore.
+const (
+	NotifyPostLike       = "PostLike"
+	NotifyPostDislike    = "PostDislike"
+	NotifyComment        = "Comment"
+	NotifyReply          = "Reply"
+	NotifyCommentLike    = "CommentLike"
+	NotifyCommentDislike = "CommentDislike"
+)
+
+const (
+	// insertPostNotificationQuery notifies the author of a post; the post supplies the recipient.
+	insertPostNotificationQuery = `
+        INSERT INTO Notification (UserID, UserToNotify, PostID, NotificationType)
+        SELECT ?, UserID, PostID, ? FROM Post WHERE PostID = ?
+    `
+	// insertCommentNotificationQuery notifies the author of a comment the same way.
+	insertCommentNotificationQuery = `
+        INSERT INTO Notification (UserID, UserToNotify, CommentID, NotificationType)
+        SELECT ?, UserID, CommentID, ? FROM Comment WHERE CommentID = ?
+    `
+	// insertNewCommentNotificationQuery tells the author of a post about a comment on it, unless
+	// they wrote it or it replies to a comment of theirs, which gets them a reply notification.
+	insertNewCommentNotificationQuery = `
+        INSERT INTO Notification (UserID, UserToNotify, PostID, NotificationType)
+        SELECT c.UserID, p.UserID, p.PostID, 'Comment'
+        FROM Comment c
+        JOIN Post p ON p.PostID = c.PostID
+        LEFT JOIN Comment parent ON parent.CommentID = c.ParentCommentID
+        WHERE c.CommentID = ? AND p.UserID != c.UserID AND (parent.UserID IS NULL OR parent.UserID != p.UserID)
+    `
+	// insertReplyNotificationQuery tells the author of a comment about a reply to it, unless they
+	// wrote the reply.
+	insertReplyNotificationQuery = `
+        INSERT INTO Notification (UserID, UserToNotify, PostID, CommentID, NotificationType)
+        SELECT c.UserID, parent.UserID, c.PostID, c.CommentID, 'Reply'
+        FROM Comment c
+        JOIN Comment parent ON parent.CommentID = c.ParentCommentID
+        WHERE c.CommentID = ? AND parent.UserID != c.UserID
+    `
+	selectNotificationsQuery = `
+        SELECT
+            n.NotificationID, n.UserID, n.UserToNotify, n.PostID, n.CommentID,
+            n.NotificationType, n.CreatedAt, n.IsRead,
+            u.username,
+            COALESCE(p.title, ''),
+            COALESCE(c.content, ''),
+            COALESCE(s.Reason, ''),
+            s.ExpiresAt
+        FROM Notification n
+        JOIN User u ON n.UserID = u.UserID
+        LEFT JOIN Post p ON n.PostID = p.PostID
+        LEFT JOIN Comment c ON n.CommentID = c.CommentID
+        LEFT JOIN Sanction s ON n.SanctionID = s.SanctionID
+        WHERE n.UserToNotify = ?
+        ORDER BY n.CreatedAt DESC
+        LIMIT ?
+    `
+	countUnreadNotificationsQuery = `SELECT COUNT(*) FROM Notification WHERE UserToNotify = ? AND IsRead = 0`
+	markNotificationReadQuery     = `UPDATE Notification SET IsRead = 1 WHERE NotificationID = ? AND UserToNotify = ?`
+)
+
+// NotificationListSize is how many of their latest notifications a user is shown.
+const NotificationListSize = 50
+
+// Notification tells a user that someone reacted to or commented on their content, or that they
+// were sanctioned. PostID and CommentID are nil when the notification is not about one; the
+// sanction fields are only set for sanctions.
+type Notification struct {
+	NotificationID   int    `json:"notification_id"`
+	UserID           int    `json:"user_id"`
+	UserToNotify     int    `json:"user_to_notify"`
+	PostID           *int   `json:"post_id"`
+	CommentID        *int   `json:"comment_id"`
+	NotificationType string `json:"notification_type"`
+	CreatedAt        string `json:"created_at"`
+	IsRead           bool   `json:"is_read"`
+	Username         string `json:"username"`
+	PostTitle        string `json:"post_title"`
+	CommentContent   string `json:"comment_content"`
+	SanctionReason   string `json:"sanction_reason"`
+	SanctionExpires  any    `json:"sanction_expires_at"`
+}
+
+// NotificationStore reads and writes the notifications users get about their content.
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// NewNotificationStore returns a NotificationStore backed by db.
+func NewNotificationStore(db *sql.DB) *NotificationStore {
+	return &NotificationStore{db: db}
+}
+
+// NotifyPostAuthor tells the author of postID that userID did kind to it, such as NotifyPostLike.
+// Nothing happens if the post does not exist.
+func (s *NotificationStore) NotifyPostAuthor(userID, postID int, kind string) error {
+	if _, err := s.db.Exec(insertPostNotificationQuery, userID, kind, postID); err != nil {
+		return fmt.Errorf("error inserting notification: %v", err)
+	}
+	return nil
+}
+
+// NotifyCommentAuthor tells the author of commentID that userID did kind to it, such as
+// NotifyCommentLike. Nothing happens if the comment does not exist.
+func (s *NotificationStore) NotifyCommentAuthor(userID, commentID int, kind string) error {
+	if _, err := s.db.Exec(insertCommentNotificationQuery, userID, kind, commentID); err != nil {
+		return fmt.Errorf("error inserting notification: %v", err)
+	}
+	return nil
+}
+
+// NotifyNewComment tells the author of the post commentID belongs to, and the author of the
+// comment it replies to, that it was published. See notifyNewComment for who gets what.
+func (s *NotificationStore) NotifyNewComment(commentID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := notifyNewComment(tx, commentID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// ListForUser returns the latest NotificationListSize notifications of userID, newest first.
+func (s *NotificationStore) ListForUser(userID int) ([]Notification, error) {
+	rows, err := s.db.Query(selectNotificationsQuery, userID, NotificationListSize)
+	if err != nil {
+		return nil, fmt.Errorf("error querying notifications: %v", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(
+			&n.NotificationID, &n.UserID, &n.UserToNotify, &n.PostID, &n.CommentID,
+			&n.NotificationType, &n.CreatedAt, &n.IsRead, &n.Username,
+			&n.PostTitle, &n.CommentContent, &n.SanctionReason, &n.SanctionExpires,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning notification: %v", err)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// UnreadCount returns how many notifications of userID are unread.
+func (s *NotificationStore) UnreadCount(userID int) (int, error) {
+	var count int
+	if err := s.db.QueryRow(countUnreadNotificationsQuery, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting notifications: %v", err)
+	}
+	return count, nil
+}
+
+// MarkRead marks notificationID of userID as read. It returns sql.ErrNoRows if userID has no
+// such notification.
+func (s *NotificationStore) MarkRead(notificationID, userID int) error {
+	result, err := s.db.Exec(markNotificationReadQuery, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("error updating notification: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking notification update: %v", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// notifyNewComment tells the people concerned that commentID was published, as part of tx: the
+// author of the comment it replies to gets a NotifyReply notification and the author of the post
+// a NotifyComment one, no one more than once and no one about their own comment.
+func notifyNewComment(tx *sql.Tx, commentID int) error {
+	if _, err := tx.Exec(insertReplyNotificationQuery, commentID); err != nil {
+		return fmt.Errorf("error inserting reply notification: %v", err)
+	}
+	if _, err := tx.Exec(insertNewCommentNotificationQuery, commentID); err != nil {
+		return fmt.Errorf("error inserting comment notification: %v", err)
+	}
+	return nil
+}
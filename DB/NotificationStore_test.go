@@ -0,0 +1,155 @@
+package DB
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestNotifyAuthors(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	postID := createTestPost(t, db, alice, "post")
+	commentID, err := s.Comments.Create(postID, alice, "comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+
+	if err := s.Notifications.NotifyPostAuthor(bob, postID, NotifyPostLike); err != nil {
+		t.Fatalf("NotifyPostAuthor: %v", err)
+	}
+	if err := s.Notifications.NotifyCommentAuthor(bob, int(commentID), NotifyCommentDislike); err != nil {
+		t.Fatalf("NotifyCommentAuthor: %v", err)
+	}
+	// content that does not exist has no author to notify
+	if err := s.Notifications.NotifyPostAuthor(bob, postID+100, NotifyPostLike); err != nil {
+		t.Fatalf("NotifyPostAuthor of a missing post: %v", err)
+	}
+
+	notifications, err := s.Notifications.ListForUser(alice)
+	if err != nil {
+		t.Fatalf("ListForUser: %v", err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("alice has %d notifications, want 2", len(notifications))
+	}
+	kinds := map[string]Notification{}
+	for _, n := range notifications {
+		kinds[n.NotificationType] = n
+		if n.UserID != bob || n.UserToNotify != alice || n.Username != "bob" || n.IsRead {
+			t.Errorf("notification = %+v", n)
+		}
+	}
+	if n := kinds[NotifyPostLike]; n.PostID == nil || *n.PostID != postID || n.PostTitle != "post" {
+		t.Errorf("post like notification = %+v", n)
+	}
+	if n := kinds[NotifyCommentDislike]; n.CommentID == nil || *n.CommentID != int(commentID) || n.CommentContent != "comment" {
+		t.Errorf("comment dislike notification = %+v", n)
+	}
+
+	if others, err := s.Notifications.ListForUser(bob); err != nil || len(others) != 0 {
+		t.Errorf("bob has %d notifications, err %v; want none", len(others), err)
+	}
+}
+
+func TestMarkNotificationRead(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	postID := createTestPost(t, db, alice, "post")
+	for _, kind := range []string{NotifyPostLike, NotifyPostDislike} {
+		if err := s.Notifications.NotifyPostAuthor(bob, postID, kind); err != nil {
+			t.Fatalf("NotifyPostAuthor: %v", err)
+		}
+	}
+
+	if count, err := s.Notifications.UnreadCount(alice); err != nil || count != 2 {
+		t.Fatalf("UnreadCount = %d, %v; want 2", count, err)
+	}
+	notifications, err := s.Notifications.ListForUser(alice)
+	if err != nil {
+		t.Fatalf("ListForUser: %v", err)
+	}
+	notificationID := notifications[0].NotificationID
+
+	// only the user notified can mark it
+	if err := s.Notifications.MarkRead(notificationID, bob); err != sql.ErrNoRows {
+		t.Errorf("marking another user's notification: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := s.Notifications.MarkRead(notificationID, alice); err != nil {
+		t.Fatalf("MarkRead: %v", err)
+	}
+	if count, err := s.Notifications.UnreadCount(alice); err != nil || count != 1 {
+		t.Errorf("UnreadCount after MarkRead = %d, %v; want 1", count, err)
+	}
+}
+
+func TestNotifyNewComment(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	carol := createTestUser(t, s, "carol")
+	postID := createTestPost(t, db, alice, "post")
+
+	kinds := func(userID int) map[string]int {
+		t.Helper()
+		list, err := s.Notifications.ListForUser(userID)
+		if err != nil {
+			t.Fatalf("ListForUser: %v", err)
+		}
+		kinds := map[string]int{}
+		for _, n := range list {
+			kinds[n.NotificationType]++
+		}
+		return kinds
+	}
+	publish := func(commentID int64) {
+		t.Helper()
+		if err := s.Notifications.NotifyNewComment(int(commentID)); err != nil {
+			t.Fatalf("NotifyNewComment: %v", err)
+		}
+	}
+
+	own, err := s.Comments.Create(postID, alice, "own comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+	publish(own)
+	if n := kinds(alice); len(n) != 0 {
+		t.Errorf("alice notified of her own comment: %v", n)
+	}
+
+	comment, err := s.Comments.Create(postID, bob, "comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+	publish(comment)
+	// a reply to bob tells bob, and alice as the post owner
+	reply, _, err := s.Comments.Reply(int(comment), carol, "reply", nil)
+	if err != nil {
+		t.Fatalf("creating reply: %v", err)
+	}
+	publish(reply)
+	// a reply to alice's own comment tells her once, as a reply
+	replyToOwner, _, err := s.Comments.Reply(int(own), carol, "reply to owner", nil)
+	if err != nil {
+		t.Fatalf("creating reply: %v", err)
+	}
+	publish(replyToOwner)
+	// bob replying to himself tells only alice
+	selfReply, _, err := s.Comments.Reply(int(comment), bob, "self reply", nil)
+	if err != nil {
+		t.Fatalf("creating reply: %v", err)
+	}
+	publish(selfReply)
+
+	if n := kinds(alice); n[NotifyComment] != 3 || n[NotifyReply] != 1 || len(n) != 2 {
+		t.Errorf("alice has notifications %v, want 3 comment and 1 reply", n)
+	}
+	if n := kinds(bob); n[NotifyReply] != 1 || len(n) != 1 {
+		t.Errorf("bob has notifications %v, want 1 reply", n)
+	}
+	if n := kinds(carol); len(n) != 0 {
+		t.Errorf("carol has notifications %v, want none", n)
+	}
+}
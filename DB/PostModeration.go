@@ -0,0 +1,216 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Visibilities of a post. Hidden posts are taken out of the forum until a moderator shows them
+// again; deleted posts are soft-deleted, kept with their comments for the record.
+const (
+	PostVisible = "visible"
+	PostHidden  = "hidden"
+	PostDeleted = "deleted"
+)
+
+// ErrInvalidVisibility is returned for a visibility that is not one of the Post visibilities.
+var ErrInvalidVisibility = errors.New("invalid post visibility")
+
+const (
+	selectPostStateQuery = `
+        SELECT p.Visibility, p.Locked, p.PinnedAt IS NOT NULL, COALESCE(p.ModerationReason, ''),
+               p.ModeratedBy, COALESCE(u.username, ''), p.ModeratedAt
+        FROM Post p
+        LEFT JOIN User u ON u.UserID = p.ModeratedBy
+        WHERE p.PostID = ?
+    `
+	setPostVisibilityQuery = `
+        UPDATE Post SET Visibility = ?, ModerationReason = ?, ModeratedBy = ?, ModeratedAt = ?
+        WHERE PostID = ?
+    `
+	setPostLockedQuery = `UPDATE Post SET Locked = ?, ModeratedBy = ?, ModeratedAt = ? WHERE PostID = ?`
+	// setPostPinnedQuery keeps the time a post was pinned when it is pinned again.
+	setPostPinnedQuery = `
+        UPDATE Post SET PinnedAt = CASE WHEN ? THEN COALESCE(PinnedAt, ?) END, ModeratedBy = ?, ModeratedAt = ?
+        WHERE PostID = ?
+    `
+	selectModeratedPostsQuery = `
+        SELECT p.PostID, p.UserID, p.PostDate, p.title, p.content, COALESCE(p.content_html, ''), p.EditedAt,
+               u.username, p.Visibility, p.Locked, p.PinnedAt IS NOT NULL, COALESCE(p.ModerationReason, ''),
+               p.ModeratedBy, COALESCE(m.username, ''), p.ModeratedAt
+        FROM Post p
+        JOIN User u ON u.UserID = p.UserID
+        LEFT JOIN User m ON m.UserID = p.ModeratedBy
+        WHERE p.Visibility != 'visible'
+        ORDER BY p.ModeratedAt DESC, p.PostID DESC
+    `
+)
+
+// PostState is how moderators have dealt with a post. Reason says why it was hidden or deleted;
+// Moderator and ModeratedAt tell who changed its state last and when, and are empty for posts
+// no moderator has touched.
+type PostState struct {
+	Visibility  string     `json:"visibility"`
+	Locked      bool       `json:"locked"`
+	Pinned      bool       `json:"pinned"`
+	Reason      string     `json:"reason"`
+	ModeratorID *int       `json:"moderatorId"`
+	Moderator   string     `json:"moderator"`
+	ModeratedAt *time.Time `json:"moderatedAt"`
+}
+
+// ModeratedPost is a hidden or deleted post with its state, as moderators see it.
+type ModeratedPost struct {
+	PostID      int        `json:"PostID"`
+	UserID      int        `json:"UserID"`
+	PostDate    string     `json:"PostDate"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	ContentHTML string     `json:"contentHtml"`
+	EditedAt    *time.Time `json:"editedAt"`
+	Username    string     `json:"username"`
+	State       PostState  `json:"state"`
+}
+
+// ValidVisibility reports whether visibility is one of the Post visibilities.
+func ValidVisibility(visibility string) bool {
+	return visibility == PostVisible || visibility == PostHidden || visibility == PostDeleted
+}
+
+// State returns the moderation state of postID, or sql.ErrNoRows if the post does not exist.
+func (s *PostStore) State(postID int) (PostState, error) {
+	var state PostState
+	err := s.db.QueryRow(selectPostStateQuery, postID).Scan(
+		&state.Visibility, &state.Locked, &state.Pinned, &state.Reason,
+		&state.ModeratorID, &state.Moderator, &state.ModeratedAt,
+	)
+	if err == sql.ErrNoRows {
+		return PostState{}, err
+	}
+	if err != nil {
+		return PostState{}, fmt.Errorf("error getting post state: %v", err)
+	}
+	return state, nil
+}
+
+// SetVisibility shows, hides or soft-deletes postID on behalf of moderatorID, giving reason.
+// Showing a post again clears the reason and approves the post if the content filter holds it for
+// review. It returns ErrInvalidVisibility for an unknown
+// visibility and sql.ErrNoRows if the post does not exist.
+func (s *PostStore) SetVisibility(postID, moderatorID int, visibility, reason string) error {
+	var action string
+	var storedReason interface{}
+	switch visibility {
+	case PostVisible:
+		action = AuditRestorePost
+	case PostHidden:
+		action, storedReason = AuditHidePost, reason
+	case PostDeleted:
+		action, storedReason = AuditDeletePost, reason
+	default:
+		return ErrInvalidVisibility
+	}
+
+	return s.moderate(postID, moderatorID, action, reason,
+		setPostVisibilityQuery, visibility, storedReason, moderatorID, moderationTime(), postID)
+}
+
+// Delete soft-deletes postID on behalf of moderatorID, giving reason. The post stays in the
+// database with its comments, reactions and images, out of sight of everyone but moderators.
+// It returns sql.ErrNoRows if the post does not exist.
+func (s *PostStore) Delete(postID, moderatorID int, reason string) error {
+	return s.SetVisibility(postID, moderatorID, PostDeleted, reason)
+}
+
+// SetLocked locks postID against new comments, or unlocks it, on behalf of moderatorID.
+// It returns sql.ErrNoRows if the post does not exist.
+func (s *PostStore) SetLocked(postID, moderatorID int, locked bool) error {
+	action := AuditUnlockPost
+	if locked {
+		action = AuditLockPost
+	}
+	return s.moderate(postID, moderatorID, action, "", setPostLockedQuery, locked, moderatorID, moderationTime(), postID)
+}
+
+// SetPinned pins postID above the other posts, or unpins it, on behalf of moderatorID.
+// It returns sql.ErrNoRows if the post does not exist.
+func (s *PostStore) SetPinned(postID, moderatorID int, pinned bool) error {
+	action := AuditUnpinPost
+	if pinned {
+		action = AuditPinPost
+	}
+	now := moderationTime()
+	return s.moderate(postID, moderatorID, action, "", setPostPinnedQuery, pinned, now, moderatorID, now, postID)
+}
+
+// ListPinned returns the visible pinned posts, most recently pinned first.
+func (s *PostStore) ListPinned() ([]Post, error) {
+	return s.query(selectPostsQuery + ` WHERE p.Visibility = 'visible' AND p.PinnedAt IS NOT NULL ORDER BY p.PinnedAt DESC, p.PostID DESC`)
+}
+
+// ListModerated returns the hidden and deleted posts, most recently moderated first.
+func (s *PostStore) ListModerated() ([]ModeratedPost, error) {
+	rows, err := s.db.Query(selectModeratedPostsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error querying moderated posts: %v", err)
+	}
+	defer rows.Close()
+
+	posts := []ModeratedPost{}
+	for rows.Next() {
+		var p ModeratedPost
+		if err := rows.Scan(
+			&p.PostID, &p.UserID, &p.PostDate, &p.Title, &p.Content, &p.ContentHTML, &p.EditedAt, &p.Username,
+			&p.State.Visibility, &p.State.Locked, &p.State.Pinned, &p.State.Reason,
+			&p.State.ModeratorID, &p.State.Moderator, &p.State.ModeratedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning moderated post: %v", err)
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// moderate runs a moderation update of postID and records it in the audit log as action by
+// moderatorID, in one transaction. Restoring a post also approves its pending hold, so that it
+// does not stay in the review queue once it is public. It returns sql.ErrNoRows if the update
+// changed nothing.
+func (s *PostStore) moderate(postID, moderatorID int, action, details string, query string, args ...interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("error updating post state: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking post state update: %v", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	if action == AuditRestorePost {
+		if _, err := tx.Exec(approvePostHoldQuery, moderatorID, moderationTime(), postID); err != nil {
+			return fmt.Errorf("error approving held post: %v", err)
+		}
+	}
+
+	if err := RecordAudit(tx, moderatorID, action, AuditTargetPost, postID, details); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// moderationTime is the time recorded for a moderation action.
+func moderationTime() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
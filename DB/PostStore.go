@@ -0,0 +1,721 @@
+package DB
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// selectPostsQuery is the shared projection every post listing is built from.
+	// Callers append their own JOIN/WHERE/ORDER BY clauses, and only list visible posts.
+	selectPostsQuery = `
+        SELECT
+            p.PostID,
+            p.UserID,
+            p.PostDate,
+            p.title,
+            p.content,
+            COALESCE(p.content_html, '') AS content_html,
+            p.EditedAt,
+            u.username,
+            COALESCE(pl.likes, 0) AS likes,
+            COALESCE(pdl.dislike, 0) AS dislikes,
+            COALESCE(cmt.comments, 0) AS comments,
+            p.Locked AS locked,
+            p.PinnedAt IS NOT NULL AS pinned
+        FROM
+            Post p
+        JOIN
+            User u ON p.UserID = u.UserID
+        LEFT JOIN (
+            SELECT PostID, COUNT(*) AS likes FROM PostLike GROUP BY PostID
+        ) AS pl ON p.PostID = pl.PostID
+        LEFT JOIN (
+            SELECT PostID, COUNT(*) AS dislike FROM PostDislike GROUP BY PostID
+        ) AS pdl ON p.PostID = pdl.PostID
+        LEFT JOIN (
+            SELECT PostID, COUNT(*) AS comments FROM Comment WHERE HeldForReview = 0 GROUP BY PostID
+        ) AS cmt ON p.PostID = cmt.PostID
+    `
+	// postCategoriesQuery is completed with one placeholder per post ID.
+	postCategoriesQuery = `
+        SELECT pc.PostID, c.title
+        FROM Category c
+        JOIN PostCategory pc ON c.CategoryID = pc.CategoryID
+        WHERE pc.PostID IN (%s)
+    `
+	selectCategorizedPostsQuery = `
+        SELECT
+            p.PostID,
+            p.UserID,
+            p.PostDate,
+            p.title,
+            p.content,
+            COALESCE(p.content_html, '') AS content_html,
+            p.EditedAt,
+            u.username,
+            COALESCE(pl.likes, 0) AS likes,
+            COALESCE(pdl.dislike, 0) AS dislikes,
+            COALESCE(cmt.comments, 0) AS comments,
+            p.Locked AS locked,
+            p.PinnedAt IS NOT NULL AS pinned,
+            c.title AS category
+        FROM
+            Post p
+        JOIN
+            User u ON p.UserID = u.UserID
+        JOIN
+            PostCategory pc ON p.PostID = pc.PostID
+        JOIN
+            Category c ON pc.CategoryID = c.CategoryID
+        LEFT JOIN (
+            SELECT PostID, COUNT(*) AS likes FROM PostLike GROUP BY PostID
+        ) AS pl ON p.PostID = pl.PostID
+        LEFT JOIN (
+            SELECT PostID, COUNT(*) AS dislike FROM PostDislike GROUP BY PostID
+        ) AS pdl ON p.PostID = pdl.PostID
+        LEFT JOIN (
+            SELECT PostID, COUNT(*) AS comments FROM Comment WHERE HeldForReview = 0 GROUP BY PostID
+        ) AS cmt ON p.PostID = cmt.PostID
+        WHERE
+            p.Visibility = 'visible'
+        ORDER BY
+            p.PostDate DESC
+    `
+	// selectPostPageQuery wraps selectPostsQuery so a sort key can be computed from the counts.
+	// Pinned posts are left out; they are listed above the feed instead.
+	// The three %s verbs are the sort key expression, the cursor condition and the sort key again.
+	selectPostPageQuery = `
+        SELECT PostID, UserID, PostDate, title, content, content_html, EditedAt, username, likes, dislikes, comments, locked, pinned, %s AS sortKey
+        FROM (` + selectPostsQuery + ` WHERE p.Visibility = 'visible' AND p.PinnedAt IS NULL)
+        %s
+        ORDER BY %s DESC, PostID DESC
+        LIMIT ?
+    `
+	selectPostOwnerQuery  = `SELECT UserID FROM Post WHERE PostID = ?`
+	selectPostSourceQuery = `SELECT title, content, UserID FROM Post WHERE PostID = ?`
+	countPostsQuery       = `SELECT COUNT(*) FROM Post`
+	userTitleTakenQuery   = `SELECT EXISTS(SELECT 1 FROM Post WHERE UserID = ? AND title = ?)`
+	// postImagesQuery is completed with one placeholder per post ID.
+	postImagesQuery = `
+        SELECT ImageID, PostID, Position, image_filename, thumbnail_filename, image_mimetype, image_width, image_height, alt_text
+        FROM PostImage
+        WHERE PostID IN (%s)
+        ORDER BY PostID, Position
+    `
+	insertPostImageQuery = `
+        INSERT INTO PostImage (PostID, Position, image_filename, thumbnail_filename, image_mimetype, image_width, image_height, alt_text)
+        VALUES (?,?,?,?,?,?,?,?)
+    `
+	updatePostImageQuery     = `UPDATE PostImage SET Position = ?, alt_text = ? WHERE ImageID = ? AND PostID = ?`
+	deletePostImageByIDQuery = `DELETE FROM PostImage WHERE ImageID = ? AND PostID = ?`
+	// imageFilesInUseQuery is completed with one placeholder per file name, twice.
+	imageFilesInUseQuery = `
+        SELECT image_filename FROM PostImage WHERE image_filename IN (%[1]s)
+        UNION
+        SELECT thumbnail_filename FROM PostImage WHERE thumbnail_filename IN (%[1]s)
+    `
+)
+
+// removePostQueries delete a post and everything attached to it, children first.
+var removePostQueries = []string{
+	`DELETE FROM CommentLike WHERE CommentID IN (SELECT CommentID FROM Comment WHERE PostID = ?)`,
+	`DELETE FROM CommentDislike WHERE CommentID IN (SELECT CommentID FROM Comment WHERE PostID = ?)`,
+	`DELETE FROM Comment WHERE PostID = ?`,
+	`DELETE FROM PostLike WHERE PostID = ?`,
+	`DELETE FROM PostDislike WHERE PostID = ?`,
+	`DELETE FROM PostCategory WHERE PostID = ?`,
+	`DELETE FROM Notification WHERE PostID = ?`,
+	`DELETE FROM PostImage WHERE PostID = ?`,
+	`DELETE FROM Post WHERE PostID = ?`,
+}
+
+// Feed sort orders accepted by PostStore.ListPage.
+const (
+	SortNew           = "new"
+	SortTop           = "top"
+	SortControversial = "controversial"
+	SortMostCommented = "most-commented"
+)
+
+// sortKeys maps every feed sort order to the integer expression it ranks posts by, highest first.
+// Ties are always broken by PostID, newest first, so every post has a single place in the feed.
+//   - new:            the creation time in Unix seconds.
+//   - top:            likes minus dislikes.
+//   - controversial:  the votes on the losing side, so only posts that split opinion rank high.
+//   - most-commented: the number of comments.
+var sortKeys = map[string]string{
+	SortNew:           `CAST(strftime('%s', PostDate) AS INTEGER)`,
+	SortTop:           `(likes - dislikes)`,
+	SortControversial: `MIN(likes, dislikes)`,
+	SortMostCommented: `comments`,
+}
+
+// Page sizes used by ListPage when the caller asks for no limit or too large a one.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Errors returned by ListPage for a bad sort order or a cursor it did not issue.
+var (
+	ErrInvalidSort   = errors.New("invalid sort order")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// ValidSort reports whether sortBy is one of the feed sort orders.
+func ValidSort(sortBy string) bool {
+	_, ok := sortKeys[sortBy]
+	return ok
+}
+
+// PostStore reads and writes posts.
+// imageURL resolves the files of post images; until SetImageURL is called they are given their
+// file name as URL.
+type PostStore struct {
+	db       *sql.DB
+	imageURL ImageURLFunc
+}
+
+// NewPostStore returns a PostStore backed by db.
+func NewPostStore(db *sql.DB) *PostStore {
+	return &PostStore{db: db, imageURL: fileNameURL}
+}
+
+// SetImageURL sets how the files of post images are turned into URLs.
+func (s *PostStore) SetImageURL(imageURL ImageURLFunc) {
+	s.imageURL = imageURL
+}
+
+// ListPage returns one page of the feed ordered by sortBy, which must be one of the Sort constants.
+// An empty cursor starts at the top of the feed; otherwise it must be a cursor returned by an
+// earlier call with the same sort order. The returned cursor points past the last post of the
+// page and is empty once the feed is exhausted.
+// Keyset pagination is used instead of OFFSET, so posts created while a user is scrolling
+// do not shift the pages they have not seen yet.
+func (s *PostStore) ListPage(sortBy, cursor string, limit int) ([]Post, string, error) {
+	key, ok := sortKeys[sortBy]
+	if !ok {
+		return nil, "", ErrInvalidSort
+	}
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	where := ""
+	args := []interface{}{}
+	if cursor != "" {
+		afterKey, afterID, err := decodeCursor(sortBy, cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		where = fmt.Sprintf(`WHERE %[1]s < ? OR (%[1]s = ? AND PostID < ?)`, key)
+		args = append(args, afterKey, afterKey, afterID)
+	}
+	// One extra row tells us whether there is a next page without a separate COUNT query.
+	args = append(args, limit+1)
+
+	rows, err := s.db.Query(fmt.Sprintf(selectPostPageQuery, key, where, key), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("error querying posts: %v", err)
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	sortValues := []int64{}
+	for rows.Next() {
+		var post Post
+		var sortValue int64
+		if err := rows.Scan(
+			&post.PostID, &post.UserID, &post.PostDate, &post.Title, &post.Content, &post.ContentHTML, &post.EditedAt, &post.Username,
+			&post.Likes, &post.Dislikes, &post.CmtCount, &post.Locked, &post.Pinned, &sortValue,
+		); err != nil {
+			return nil, "", fmt.Errorf("error scanning post details: %v", err)
+		}
+		posts = append(posts, post)
+		sortValues = append(sortValues, sortValue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error iterating posts: %v", err)
+	}
+	rows.Close()
+
+	nextCursor := ""
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		nextCursor = encodeCursor(sortBy, sortValues[limit-1], last.PostID)
+	}
+
+	if err := s.attachCategories(posts); err != nil {
+		return nil, "", err
+	}
+	if err := s.attachImages(posts); err != nil {
+		return nil, "", err
+	}
+	return posts, nextCursor, nil
+}
+
+// ListByUser returns the posts created by userID, newest first.
+func (s *PostStore) ListByUser(userID int) ([]Post, error) {
+	return s.query(selectPostsQuery+` WHERE p.UserID = ? AND p.Visibility = 'visible' ORDER BY p.PostDate DESC`, userID)
+}
+
+// ListLikedBy returns the posts liked by userID, newest first.
+func (s *PostStore) ListLikedBy(userID int) ([]Post, error) {
+	return s.query(selectPostsQuery+` JOIN PostLike l ON p.PostID = l.PostID WHERE l.UserID = ? AND p.Visibility = 'visible' ORDER BY p.PostDate DESC`, userID)
+}
+
+// ListDislikedBy returns the posts disliked by userID, newest first.
+func (s *PostStore) ListDislikedBy(userID int) ([]Post, error) {
+	return s.query(selectPostsQuery+` JOIN PostDislike d ON p.PostID = d.PostID WHERE d.UserID = ? AND p.Visibility = 'visible' ORDER BY p.PostDate DESC`, userID)
+}
+
+// ListByCategory groups every visible post under each of its categories.
+// Categories are sorted by name and the posts inside each one pinned first, then newest first.
+func (s *PostStore) ListByCategory() ([]CategoryPosts, error) {
+	rows, err := s.db.Query(selectCategorizedPostsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error querying posts: %v", err)
+	}
+	defer rows.Close()
+
+	categoriesMap := make(map[string]map[int]Post)
+	postCategoriesMap := make(map[int][]string)
+
+	for rows.Next() {
+		var post Post
+		var category string
+		if err := rows.Scan(
+			&post.PostID, &post.UserID, &post.PostDate, &post.Title, &post.Content, &post.ContentHTML, &post.EditedAt, &post.Username,
+			&post.Likes, &post.Dislikes, &post.CmtCount, &post.Locked, &post.Pinned, &category,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning post: %v", err)
+		}
+
+		postCategoriesMap[post.PostID] = appendUnique(postCategoriesMap[post.PostID], category)
+
+		if categoriesMap[category] == nil {
+			categoriesMap[category] = make(map[int]Post)
+		}
+		categoriesMap[category][post.PostID] = post
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating posts: %v", err)
+	}
+
+	postIDs := make([]int, 0, len(postCategoriesMap))
+	for postID := range postCategoriesMap {
+		postIDs = append(postIDs, postID)
+	}
+	images, err := postImages(s.db, postIDs, s.imageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []CategoryPosts
+	for categoryName, posts := range categoriesMap {
+		var categoryPosts []Post
+		for postID, post := range posts {
+			post.Categories = postCategoriesMap[postID]
+			post.setImages(images[postID])
+			categoryPosts = append(categoryPosts, post)
+		}
+
+		sort.Slice(categoryPosts, func(i, j int) bool {
+			if categoryPosts[i].Pinned != categoryPosts[j].Pinned {
+				return categoryPosts[i].Pinned
+			}
+			return categoryPosts[i].PostDate > categoryPosts[j].PostDate
+		})
+
+		groups = append(groups, CategoryPosts{CategoryName: categoryName, Posts: categoryPosts})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].CategoryName < groups[j].CategoryName
+	})
+
+	return groups, nil
+}
+
+// Create inserts a new post with its images and categories, held for review if held is not nil.
+// See InsertPost.
+func (s *PostStore) Create(title, content string, images []PostImage, categories []string, userID int, held *FilterMatch) error {
+	return InsertPost(s.db, title, content, images, categories, userID, held)
+}
+
+// Images returns the gallery of postID in order.
+func (s *PostStore) Images(postID int) ([]PostImage, error) {
+	images, err := postImages(s.db, []int{postID}, s.imageURL)
+	if err != nil {
+		return nil, err
+	}
+	return images[postID], nil
+}
+
+// Update changes the title and content of postID on behalf of editorID, recording the change as a
+// revision, and replaces its gallery with images, in that order. Images with an ImageID must already belong to the post and only get their position and
+// alt text updated; images without one are added. Images of the post missing from the list are
+// removed. With held set, the post is hidden until the edit is reviewed. It returns the removed
+// images, whose files may now be unused, see FilesInUse.
+func (s *PostStore) Update(postID, editorID int, title, content string, images []PostImage, held *FilterMatch) ([]PostImage, error) {
+	current, err := s.Images(postID)
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[int]bool)
+	for _, image := range images {
+		if image.ImageID != 0 {
+			kept[image.ImageID] = true
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := editPost(tx, postID, editorID, title, content, nil); err != nil {
+		return nil, err
+	}
+
+	var removed []PostImage
+	for _, image := range current {
+		if kept[image.ImageID] {
+			continue
+		}
+		if _, err := tx.Exec(deletePostImageByIDQuery, image.ImageID, postID); err != nil {
+			return nil, fmt.Errorf("error removing post image: %v", err)
+		}
+		removed = append(removed, image)
+	}
+
+	for position, image := range images {
+		if image.ImageID == 0 {
+			if err := insertPostImage(tx, int64(postID), position, image); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		result, err := tx.Exec(updatePostImageQuery, position, image.AltText, image.ImageID, postID)
+		if err != nil {
+			return nil, fmt.Errorf("error updating post image: %v", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil, fmt.Errorf("image %d does not belong to post %d", image.ImageID, postID)
+		}
+	}
+
+	if held != nil {
+		if err := holdContent(tx, HeldPost, postID, editorID, held, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return removed, nil
+}
+
+// FilesInUse reports which of the upload file names are still used by an image of some post.
+// Identical uploads share their files, so a file may only be removed once no image uses it.
+func (s *PostStore) FilesInUse(names []string) (map[string]bool, error) {
+	inUse := make(map[string]bool)
+	if len(names) == 0 {
+		return inUse, nil
+	}
+
+	args := make([]interface{}, 0, 2*len(names))
+	for _, name := range names {
+		args = append(args, name)
+	}
+	args = append(args, args...)
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")
+	rows, err := s.db.Query(fmt.Sprintf(imageFilesInUseQuery, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying image files: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning image file: %v", err)
+		}
+		inUse[name] = true
+	}
+	return inUse, rows.Err()
+}
+
+// OwnerID returns the ID of the user who created postID, or sql.ErrNoRows if the post does not exist.
+func (s *PostStore) OwnerID(postID int) (int, error) {
+	var userID int
+	err := s.db.QueryRow(selectPostOwnerQuery, postID).Scan(&userID)
+	return userID, err
+}
+
+// Source returns the title and Markdown content of postID as its author wrote them, and the ID
+// of the author, or sql.ErrNoRows if the post does not exist.
+func (s *PostStore) Source(postID int) (string, string, int, error) {
+	var title, content string
+	var userID int
+	err := s.db.QueryRow(selectPostSourceQuery, postID).Scan(&title, &content, &userID)
+	return title, content, userID, err
+}
+
+// UniqueTitle returns title if userID has no post with that title yet, or else title followed by
+// the lowest number that makes it one userID has not used.
+func (s *PostStore) UniqueTitle(userID int, title string) (string, error) {
+	unique := title
+	for i := 1; ; i++ {
+		var taken bool
+		if err := s.db.QueryRow(userTitleTakenQuery, userID, unique).Scan(&taken); err != nil {
+			return "", fmt.Errorf("error checking for duplicate titles: %v", err)
+		}
+		if !taken {
+			return unique, nil
+		}
+		unique = fmt.Sprintf("%s %d", title, i)
+	}
+}
+
+// Remove deletes postID for good, with its comments, reactions, categories, images and
+// notifications, in one transaction. It is how authors delete their own posts; moderators hide
+// them with Delete instead. The image files are left for the caller to remove.
+func (s *PostStore) Remove(postID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range removePostQueries {
+		if _, err := tx.Exec(query, postID); err != nil {
+			return fmt.Errorf("error removing post: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Count returns how many posts there are, hidden and held ones included.
+func (s *PostStore) Count() (int, error) {
+	var count int
+	if err := s.db.QueryRow(countPostsQuery).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting posts: %v", err)
+	}
+	return count, nil
+}
+
+// query runs a post listing query and fills in the categories of every post it returns.
+func (s *PostStore) query(query string, args ...interface{}) ([]Post, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying posts: %v", err)
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var post Post
+		if err := rows.Scan(
+			&post.PostID, &post.UserID, &post.PostDate, &post.Title, &post.Content, &post.ContentHTML, &post.EditedAt, &post.Username,
+			&post.Likes, &post.Dislikes, &post.CmtCount, &post.Locked, &post.Pinned,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning post details: %v", err)
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating posts: %v", err)
+	}
+	rows.Close()
+
+	if err := s.attachCategories(posts); err != nil {
+		return nil, err
+	}
+	if err := s.attachImages(posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// attachCategories fills in the category titles of posts with a single query.
+func (s *PostStore) attachCategories(posts []Post) error {
+	postIDs := make([]int, len(posts))
+	for i := range posts {
+		postIDs[i] = posts[i].PostID
+	}
+
+	categories, err := postCategories(s.db, postIDs)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Categories = categories[posts[i].PostID]
+	}
+	return nil
+}
+
+// attachImages fills in the galleries of posts with a single query.
+func (s *PostStore) attachImages(posts []Post) error {
+	postIDs := make([]int, len(posts))
+	for i := range posts {
+		postIDs[i] = posts[i].PostID
+	}
+
+	images, err := postImages(s.db, postIDs, s.imageURL)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].setImages(images[posts[i].PostID])
+	}
+	return nil
+}
+
+// setImages sets the gallery of p and makes its first image the one shown in the feed.
+func (p *Post) setImages(images []PostImage) {
+	if images == nil {
+		images = []PostImage{}
+	}
+	p.Images = images
+	p.ImagePath = nil
+	if len(images) > 0 {
+		cover := images[0].ImagePath
+		p.ImagePath = &cover
+	}
+}
+
+// postImages returns the galleries of every post in postIDs, keyed by post ID and in order, with
+// the URLs of their files resolved by imageURL.
+func postImages(db *sql.DB, postIDs []int, imageURL ImageURLFunc) (map[int][]PostImage, error) {
+	images := make(map[int][]PostImage, len(postIDs))
+	if len(postIDs) == 0 {
+		return images, nil
+	}
+
+	args := make([]interface{}, len(postIDs))
+	for i, postID := range postIDs {
+		args[i] = postID
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(postIDs)), ",")
+	rows, err := db.Query(fmt.Sprintf(postImagesQuery, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying post images: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var image PostImage
+		var postID int
+		if err := rows.Scan(
+			&image.ImageID, &postID, &image.Position, &image.Filename, &image.ThumbnailFilename,
+			&image.MIMEType, &image.Width, &image.Height, &image.AltText,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning post image: %v", err)
+		}
+		image.ImagePath = ImagePaths{Full: imageURL(image.Filename), Thumbnail: imageURL(image.ThumbnailFilename)}
+		images[postID] = append(images[postID], image)
+	}
+	return images, rows.Err()
+}
+
+// fileNameURL is the ImageURLFunc used until a real one is set: it leaves the file name as it is.
+func fileNameURL(name string) string {
+	return name
+}
+
+// insertPostImage adds image to the gallery of postID at position.
+func insertPostImage(tx *sql.Tx, postID int64, position int, image PostImage) error {
+	_, err := tx.Exec(insertPostImageQuery, postID, position, image.Filename, image.ThumbnailFilename,
+		image.MIMEType, image.Width, image.Height, image.AltText)
+	if err != nil {
+		return fmt.Errorf("error inserting post image: %v", err)
+	}
+	return nil
+}
+
+// postCategories returns the category titles of every post in postIDs, keyed by post ID.
+// Every requested post gets a non-nil slice so it encodes as [] rather than null.
+func postCategories(db *sql.DB, postIDs []int) (map[int][]string, error) {
+	categories := make(map[int][]string, len(postIDs))
+	if len(postIDs) == 0 {
+		return categories, nil
+	}
+
+	args := make([]interface{}, len(postIDs))
+	for i, postID := range postIDs {
+		categories[postID] = []string{}
+		args[i] = postID
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(postIDs)), ",")
+	rows, err := db.Query(fmt.Sprintf(postCategoriesQuery, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying categories: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var category string
+		if err := rows.Scan(&postID, &category); err != nil {
+			return nil, fmt.Errorf("error scanning category: %v", err)
+		}
+		categories[postID] = append(categories[postID], category)
+	}
+	return categories, rows.Err()
+}
+
+// encodeCursor packs the position of a post in a feed into an opaque, URL-safe string.
+func encodeCursor(sortBy string, sortValue int64, postID int) string {
+	raw := fmt.Sprintf("%s:%d:%d", sortBy, sortValue, postID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor unpacks a cursor made by encodeCursor, checking it belongs to the sortBy feed.
+func decodeCursor(sortBy, cursor string) (int64, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[0] != sortBy {
+		return 0, 0, ErrInvalidCursor
+	}
+	sortValue, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	postID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	return sortValue, postID, nil
+}
+
+// appendUnique appends value to list unless it is already there.
+func appendUnique(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
@@ -0,0 +1,178 @@
+package DB
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestListPageCursorRoundTrip(t *testing.T) {
+	db, s := openTestStore(t)
+	userID := createTestUser(t, s, "alice")
+
+	// The posts are created within the same second, so the feed has to fall back on PostID to
+	// order them and the cursors have to carry it.
+	var want []int
+	for _, title := range []string{"one", "two", "three", "four", "five"} {
+		want = append([]int{createTestPost(t, db, userID, title)}, want...)
+	}
+
+	var got []int
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("feed did not end after %d pages", pages)
+		}
+		posts, next, err := s.Posts.ListPage(SortNew, cursor, 2)
+		if err != nil {
+			t.Fatalf("ListPage(%q): %v", cursor, err)
+		}
+		if len(posts) > 2 {
+			t.Fatalf("page has %d posts, want at most 2", len(posts))
+		}
+		for _, post := range posts {
+			got = append(got, post.PostID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("feed lists posts %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("feed lists posts %v, want %v", got, want)
+		}
+	}
+}
+
+func TestListPageSortsByScore(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+
+	liked := createTestPost(t, db, alice, "liked")
+	plain := createTestPost(t, db, alice, "plain")
+	disliked := createTestPost(t, db, alice, "disliked")
+	for _, r := range []struct {
+		userID, postID int
+		like           bool
+	}{{alice, liked, true}, {bob, liked, true}, {bob, disliked, false}} {
+		if _, err := s.Reactions.TogglePostReaction(r.userID, r.postID, r.like); err != nil {
+			t.Fatalf("reacting: %v", err)
+		}
+	}
+
+	first, cursor, err := s.Posts.ListPage(SortTop, "", 1)
+	if err != nil {
+		t.Fatalf("ListPage: %v", err)
+	}
+	rest, next, err := s.Posts.ListPage(SortTop, cursor, 10)
+	if err != nil {
+		t.Fatalf("ListPage(%q): %v", cursor, err)
+	}
+	if next != "" {
+		t.Errorf("last page returned cursor %q", next)
+	}
+
+	got := []int{}
+	for _, post := range append(first, rest...) {
+		got = append(got, post.PostID)
+	}
+	want := []int{liked, plain, disliked}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("top feed lists posts %v, want %v", got, want)
+	}
+}
+
+func TestListPageRejectsBadCursors(t *testing.T) {
+	db, s := openTestStore(t)
+	userID := createTestUser(t, s, "alice")
+	createTestPost(t, db, userID, "one")
+	createTestPost(t, db, userID, "two")
+
+	_, cursor, err := s.Posts.ListPage(SortNew, "", 1)
+	if err != nil || cursor == "" {
+		t.Fatalf("ListPage returned cursor %q, err %v", cursor, err)
+	}
+
+	for _, c := range []struct{ sortBy, cursor string }{
+		{SortTop, cursor},
+		{SortNew, "not a cursor"},
+		{SortNew, encodeCursor(SortNew, 1, 1)[1:]},
+	} {
+		if _, _, err := s.Posts.ListPage(c.sortBy, c.cursor, 1); err != ErrInvalidCursor {
+			t.Errorf("ListPage(%q, %q) returned %v, want ErrInvalidCursor", c.sortBy, c.cursor, err)
+		}
+	}
+	if _, _, err := s.Posts.ListPage("oldest", "", 1); err != ErrInvalidSort {
+		t.Errorf("ListPage with an unknown sort returned %v, want ErrInvalidSort", err)
+	}
+}
+
+func TestUniqueTitle(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	createTestPost(t, db, alice, "hello")
+	createTestPost(t, db, alice, "hello 1")
+
+	steps := []struct {
+		userID int
+		title  string
+		want   string
+	}{
+		{alice, "new", "new"},
+		{alice, "hello", "hello 2"},
+		{bob, "hello", "hello"},
+	}
+	for _, step := range steps {
+		got, err := s.Posts.UniqueTitle(step.userID, step.title)
+		if err != nil {
+			t.Fatalf("UniqueTitle(%q): %v", step.title, err)
+		}
+		if got != step.want {
+			t.Errorf("UniqueTitle(%d, %q) = %q, want %q", step.userID, step.title, got, step.want)
+		}
+	}
+}
+
+func TestRemovePost(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	postID := createTestPost(t, db, alice, "post")
+	commentID, err := s.Comments.Create(postID, bob, "comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+	if _, err := s.Reactions.ToggleCommentReaction(alice, int(commentID), true); err != nil {
+		t.Fatalf("liking comment: %v", err)
+	}
+	if _, err := s.Reactions.TogglePostReaction(bob, postID, true); err != nil {
+		t.Fatalf("liking post: %v", err)
+	}
+	if err := s.Notifications.NotifyPostAuthor(bob, postID, NotifyPostLike); err != nil {
+		t.Fatalf("notifying: %v", err)
+	}
+
+	title, content, ownerID, err := s.Posts.Source(postID)
+	if err != nil || title != "post" || content != "Content of post" || ownerID != alice {
+		t.Errorf("Source = %q, %q, %d, %v", title, content, ownerID, err)
+	}
+
+	if err := s.Posts.Remove(postID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, _, _, err := s.Posts.Source(postID); err != sql.ErrNoRows {
+		t.Errorf("Source of a removed post: err = %v, want sql.ErrNoRows", err)
+	}
+	for _, table := range []string{"Comment", "CommentLike", "PostLike", "Notification"} {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count); err != nil || count != 0 {
+			t.Errorf("%d rows left in %s, err %v", count, table, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package DB
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// selectPostVisibleQuery counts the posts with an ID, and whether that post is visible, the same
+// way selectCommentVisibleQuery does for comments.
+const selectPostVisibleQuery = `SELECT COUNT(*), COALESCE(MIN(Visibility = 'visible'), 0) FROM Post WHERE PostID = ?`
+
+// reactionTables names the like and dislike tables of one kind of content and their ID column,
+// and the query telling whether an item exists and is visible.
+type reactionTables struct {
+	like, dislike, idColumn, visibleQuery string
+}
+
+var (
+	postReactions = reactionTables{
+		like: "PostLike", dislike: "PostDislike", idColumn: "PostID", visibleQuery: selectPostVisibleQuery,
+	}
+	commentReactions = reactionTables{
+		like: "CommentLike", dislike: "CommentDislike", idColumn: "CommentID", visibleQuery: selectCommentVisibleQuery,
+	}
+)
+
+// ReactionStore records likes and dislikes on posts and comments.
+// A user holds at most one reaction per post or comment: reacting the same way twice removes the
+// reaction, and reacting the other way replaces it.
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// NewReactionStore returns a ReactionStore backed by db.
+func NewReactionStore(db *sql.DB) *ReactionStore {
+	return &ReactionStore{db: db}
+}
+
+// TogglePostReaction likes (like true) or dislikes (like false) postID on behalf of userID.
+// It reports whether a reaction was added, as opposed to removed. It returns sql.ErrNoRows if the
+// post does not exist or is hidden or deleted.
+func (s *ReactionStore) TogglePostReaction(userID, postID int, like bool) (bool, error) {
+	return s.toggle(postReactions, userID, postID, like)
+}
+
+// ToggleCommentReaction likes (like true) or dislikes (like false) commentID on behalf of userID.
+// It reports whether a reaction was added, as opposed to removed. It returns sql.ErrNoRows if the
+// comment does not exist or is out of sight, see CommentStore.Visible.
+func (s *ReactionStore) ToggleCommentReaction(userID, commentID int, like bool) (bool, error) {
+	return s.toggle(commentReactions, userID, commentID, like)
+}
+
+// PostCounts returns the number of likes and dislikes on postID.
+func (s *ReactionStore) PostCounts(postID int) (int, int, error) {
+	return s.counts(postReactions, postID)
+}
+
+// CommentCounts returns the number of likes and dislikes on commentID.
+func (s *ReactionStore) CommentCounts(commentID int) (int, int, error) {
+	return s.counts(commentReactions, commentID)
+}
+
+func (s *ReactionStore) toggle(t reactionTables, userID, targetID int, like bool) (bool, error) {
+	same, opposite := t.like, t.dislike
+	if !like {
+		same, opposite = t.dislike, t.like
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	var visible bool
+	if err := tx.QueryRow(t.visibleQuery, targetID).Scan(&count, &visible); err != nil {
+		return false, fmt.Errorf("error checking %s visibility: %v", t.idColumn, err)
+	}
+	if !visible {
+		return false, sql.ErrNoRows
+	}
+
+	result, err := tx.Exec(`DELETE FROM `+same+` WHERE UserID = ? AND `+t.idColumn+` = ?`, userID, targetID)
+	if err != nil {
+		return false, fmt.Errorf("error deleting from %s: %v", same, err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %v", err)
+	}
+
+	added := removed == 0
+	if added {
+		if _, err = tx.Exec(`DELETE FROM `+opposite+` WHERE UserID = ? AND `+t.idColumn+` = ?`, userID, targetID); err != nil {
+			return false, fmt.Errorf("error deleting from %s: %v", opposite, err)
+		}
+		if _, err = tx.Exec(`INSERT INTO `+same+` (UserID, `+t.idColumn+`) VALUES (?,?)`, userID, targetID); err != nil {
+			return false, fmt.Errorf("error inserting into %s: %v", same, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return added, nil
+}
+
+func (s *ReactionStore) counts(t reactionTables, targetID int) (int, int, error) {
+	var likes, dislikes int
+	err := s.db.QueryRow(
+		`SELECT (SELECT COUNT(*) FROM `+t.like+` WHERE `+t.idColumn+` = ?), (SELECT COUNT(*) FROM `+t.dislike+` WHERE `+t.idColumn+` = ?)`,
+		targetID, targetID,
+	).Scan(&likes, &dislikes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting reaction counts: %v", err)
+	}
+	return likes, dislikes, nil
+}
@@ -0,0 +1,116 @@
+package DB
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestTogglePostReaction(t *testing.T) {
+	db, s := openTestStore(t)
+	userID := createTestUser(t, s, "alice")
+	postID := createTestPost(t, db, userID, "post")
+
+	steps := []struct {
+		name            string
+		like            bool
+		added           bool
+		likes, dislikes int
+	}{
+		{"like", true, true, 1, 0},
+		{"like again removes it", true, false, 0, 0},
+		{"dislike", false, true, 0, 1},
+		{"like replaces the dislike", true, true, 1, 0},
+		{"dislike replaces the like", false, true, 0, 1},
+		{"dislike again removes it", false, false, 0, 0},
+	}
+	for _, step := range steps {
+		added, err := s.Reactions.TogglePostReaction(userID, postID, step.like)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if added != step.added {
+			t.Errorf("%s: added = %v, want %v", step.name, added, step.added)
+		}
+		likes, dislikes, err := s.Reactions.PostCounts(postID)
+		if err != nil {
+			t.Fatalf("%s: PostCounts: %v", step.name, err)
+		}
+		if likes != step.likes || dislikes != step.dislikes {
+			t.Errorf("%s: %d likes and %d dislikes, want %d and %d", step.name, likes, dislikes, step.likes, step.dislikes)
+		}
+	}
+}
+
+func TestToggleReactionsAreKeptApart(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	postID := createTestPost(t, db, alice, "post")
+	if _, err := s.Comments.Create(postID, alice, "comment", nil); err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+	var commentID int
+	if err := db.QueryRow(`SELECT CommentID FROM Comment WHERE PostID = ?`, postID).Scan(&commentID); err != nil {
+		t.Fatalf("getting comment ID: %v", err)
+	}
+
+	// One user's reaction never replaces another's, and reacting to a comment leaves its post alone.
+	for _, userID := range []int{alice, bob} {
+		if _, err := s.Reactions.TogglePostReaction(userID, postID, true); err != nil {
+			t.Fatalf("liking post: %v", err)
+		}
+	}
+	if _, err := s.Reactions.ToggleCommentReaction(bob, commentID, false); err != nil {
+		t.Fatalf("disliking comment: %v", err)
+	}
+
+	if likes, dislikes, err := s.Reactions.PostCounts(postID); err != nil || likes != 2 || dislikes != 0 {
+		t.Errorf("post has %d likes and %d dislikes, err %v; want 2 and 0", likes, dislikes, err)
+	}
+	if likes, dislikes, err := s.Reactions.CommentCounts(commentID); err != nil || likes != 0 || dislikes != 1 {
+		t.Errorf("comment has %d likes and %d dislikes, err %v; want 0 and 1", likes, dislikes, err)
+	}
+}
+
+func TestToggleRefusesContentOutOfSight(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	postID := createTestPost(t, db, alice, "post")
+	commentID, err := s.Comments.Create(postID, alice, "comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+
+	if _, err := db.Exec(`UPDATE Comment SET HeldForReview = 1 WHERE CommentID = ?`, commentID); err != nil {
+		t.Fatalf("holding comment: %v", err)
+	}
+	if _, err := s.Reactions.ToggleCommentReaction(alice, int(commentID), true); err != sql.ErrNoRows {
+		t.Errorf("reacting to a held comment returned %v, want sql.ErrNoRows", err)
+	}
+	if _, err := db.Exec(`UPDATE Comment SET HeldForReview = 0 WHERE CommentID = ?`, commentID); err != nil {
+		t.Fatalf("releasing comment: %v", err)
+	}
+
+	for _, visibility := range []string{PostHidden, PostDeleted} {
+		if err := s.Posts.SetVisibility(postID, alice, visibility, "reason"); err != nil {
+			t.Fatalf("setting visibility %s: %v", visibility, err)
+		}
+		if _, err := s.Reactions.TogglePostReaction(alice, postID, true); err != sql.ErrNoRows {
+			t.Errorf("reacting to a %s post returned %v, want sql.ErrNoRows", visibility, err)
+		}
+		if _, err := s.Reactions.ToggleCommentReaction(alice, int(commentID), true); err != sql.ErrNoRows {
+			t.Errorf("reacting to a comment on a %s post returned %v, want sql.ErrNoRows", visibility, err)
+		}
+	}
+	if _, err := s.Reactions.TogglePostReaction(alice, postID+1, true); err != sql.ErrNoRows {
+		t.Errorf("reacting to a missing post returned %v, want sql.ErrNoRows", err)
+	}
+
+	likes, dislikes, err := s.Reactions.PostCounts(postID)
+	if err != nil {
+		t.Fatalf("PostCounts: %v", err)
+	}
+	if likes != 0 || dislikes != 0 {
+		t.Errorf("refused reactions were counted: %d likes and %d dislikes", likes, dislikes)
+	}
+}
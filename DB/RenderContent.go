@@ -0,0 +1,68 @@
+package DB
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/markdown"
+)
+
+// renderContentTables are the tables whose content is stored rendered, with their key column.
+var renderContentTables = []struct {
+	table, key string
+}{
+	{"Post", "PostID"},
+	{"Comment", "CommentID"},
+}
+
+// RenderMissingContent renders the Markdown of every post and comment that has no HTML yet, which
+// are the ones written before the content_html columns existed. It returns how many it rendered.
+func RenderMissingContent(db *sql.DB) (int, error) {
+	count := 0
+	for _, t := range renderContentTables {
+		n, err := renderMissing(db, t.table, t.key)
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// renderMissing renders the rows of table whose content_html is NULL, in one transaction.
+func renderMissing(db *sql.DB, table, key string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(fmt.Sprintf(`SELECT %s, content FROM "%s" WHERE content_html IS NULL`, key, table))
+	if err != nil {
+		return 0, fmt.Errorf("error querying unrendered %s rows: %v", table, err)
+	}
+	rendered := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning unrendered %s row: %v", table, err)
+		}
+		rendered[id] = markdown.Render(content)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error querying unrendered %s rows: %v", table, err)
+	}
+
+	update := fmt.Sprintf(`UPDATE "%s" SET content_html = ? WHERE %s = ?`, table, key)
+	for id, html := range rendered {
+		if _, err := tx.Exec(update, html, id); err != nil {
+			return 0, fmt.Errorf("error storing rendered %s content: %v", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return len(rendered), nil
+}
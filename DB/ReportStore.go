@@ -0,0 +1,423 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Things a report can be about.
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser    = "user"
+)
+
+// States of a report. Approved reports were acted upon; rejected ones were dismissed.
+const (
+	ReportPending  = "pending"
+	ReportApproved = "approved"
+	ReportRejected = "rejected"
+)
+
+// ReportReason is a category a report is filed under.
+type ReportReason struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+// ReportReasons are the categories users choose from, in the order they are offered.
+var ReportReasons = []ReportReason{
+	{"spam", "Spam or advertising"},
+	{"harassment", "Harassment or bullying"},
+	{"hate", "Hate speech"},
+	{"violence", "Violence or threats"},
+	{"explicit", "Sexual or explicit content"},
+	{"misinformation", "Misinformation"},
+	{"other", "Something else"},
+}
+
+// Errors returned by ReportStore.
+var (
+	ErrInvalidReport   = errors.New("invalid report target or reason")
+	ErrSelfReport      = errors.New("users cannot report themselves or their own content")
+	ErrAlreadyReported = errors.New("user already reported this")
+	ErrReportResolved  = errors.New("report was already resolved")
+)
+
+const (
+	selectUserIDQuery        = `SELECT UserID FROM User WHERE UserID = ?`
+	selectReportedPostQuery  = `SELECT UserID FROM Post WHERE PostID = ? AND Visibility != 'deleted'`
+	insertPendingReportQuery = `INSERT OR IGNORE INTO Report (TargetType, TargetID) VALUES (?, ?)`
+	selectPendingReportQuery = `SELECT ReportID FROM Report WHERE TargetType = ? AND TargetID = ? AND Status = 'pending'`
+	insertReportFilingQuery  = `INSERT OR IGNORE INTO ReportFiling (ReportID, ReporterID, Reason, Note) VALUES (?, ?, ?, ?)`
+	resolveReportQuery       = `
+        UPDATE Report SET Status = ?, AdminResponse = ?, AdminID = ?, ResponseDate = ?
+        WHERE ReportID = ? AND Status = 'pending'
+    `
+	reportExistsQuery = `SELECT EXISTS(SELECT 1 FROM Report WHERE ReportID = ?)`
+	// selectReportsQuery reads reports together with what they are about. Author is the writer of
+	// a reported post or comment, or the reported user; Title is that of the post a comment is on.
+	selectReportsQuery = `
+        SELECT
+            r.ReportID, r.TargetType, r.TargetID, r.Status, r.CreatedAt,
+            COALESCE(r.AdminResponse, ''), r.AdminID, COALESCE(a.username, ''), r.ResponseDate,
+            (SELECT COUNT(*) FROM ReportFiling f WHERE f.ReportID = r.ReportID) AS ReporterCount,
+            CASE r.TargetType
+                WHEN 'post' THEN p.PostID IS NOT NULL AND p.Visibility != 'deleted'
+                WHEN 'comment' THEN c.CommentID IS NOT NULL
+                ELSE au.UserID IS NOT NULL
+            END,
+            COALESCE(CASE r.TargetType WHEN 'post' THEN p.PostID WHEN 'comment' THEN c.PostID END, 0),
+            COALESCE(CASE r.TargetType WHEN 'post' THEN p.title WHEN 'comment' THEN cp.title END, ''),
+            COALESCE(CASE r.TargetType WHEN 'post' THEN p.content WHEN 'comment' THEN c.content END, ''),
+            au.UserID, COALESCE(au.username, '')
+        FROM Report r
+        LEFT JOIN Post p ON r.TargetType = 'post' AND p.PostID = r.TargetID
+        LEFT JOIN Comment c ON r.TargetType = 'comment' AND c.CommentID = r.TargetID
+        LEFT JOIN Post cp ON cp.PostID = c.PostID
+        LEFT JOIN User au ON au.UserID = CASE r.TargetType
+            WHEN 'post' THEN p.UserID
+            WHEN 'comment' THEN c.UserID
+            ELSE r.TargetID
+        END
+        LEFT JOIN User a ON a.UserID = r.AdminID
+    `
+	selectReportFilingsQuery = `
+        SELECT f.ReportID, f.ReporterID, u.username, f.Reason, f.Note, f.CreatedAt
+        FROM ReportFiling f
+        JOIN User u ON u.UserID = f.ReporterID
+        WHERE f.ReportID IN (%s)
+    `
+)
+
+const (
+	// reportPageSize is how many reports a page of the moderation queue holds.
+	reportPageSize = 50
+	// reportFilingBatch is how many reports attachFilings looks up the filings of per query,
+	// well below the number of variables SQLite allows in one statement.
+	reportFilingBatch = 500
+)
+
+// reportTargetOwnerQueries find who a report target belongs to; a user belongs to themselves.
+var reportTargetOwnerQueries = map[string]string{
+	ReportTargetPost:    selectReportedPostQuery,
+	ReportTargetComment: selectCommentOwnerQuery,
+	ReportTargetUser:    selectUserIDQuery,
+}
+
+// Report collects every user's complaint about one post, comment or user. While it is pending,
+// further reports of the same target are added to it as filings instead of opening another one.
+type Report struct {
+	ReportID      int            `json:"ReportID"`
+	TargetType    string         `json:"TargetType"`
+	TargetID      int            `json:"TargetID"`
+	Target        ReportTarget   `json:"Target"`
+	Status        string         `json:"Status"`
+	CreatedAt     time.Time      `json:"CreatedAt"`
+	ReporterCount int            `json:"ReporterCount"`
+	Filings       []ReportFiling `json:"Filings"`
+	AdminResponse string         `json:"AdminResponse"`
+	AdminID       *int           `json:"AdminID"`
+	AdminName     string         `json:"AdminName"`
+	ResponseDate  *time.Time     `json:"ResponseDate"`
+}
+
+// ReportPage is a page of the moderation queue. NextOffset is the offset of the next page, or 0
+// on the last one.
+type ReportPage struct {
+	Reports    []Report `json:"reports"`
+	NextOffset int      `json:"nextOffset"`
+}
+
+// ReportTarget describes what a report is about as it is now. Exists is false once it has been
+// deleted, soft-deleted posts included. PostID is the reported post or the post a reported comment is on, 0 for users.
+type ReportTarget struct {
+	Exists   bool   `json:"Exists"`
+	PostID   int    `json:"PostID"`
+	Title    string `json:"Title"`
+	Content  string `json:"Content"`
+	AuthorID *int   `json:"AuthorID"`
+	Author   string `json:"Author"`
+}
+
+// ReportFiling is one user's reason and note for reporting a target.
+type ReportFiling struct {
+	ReporterID int       `json:"ReporterID"`
+	Reporter   string    `json:"Reporter"`
+	Reason     string    `json:"Reason"`
+	Note       string    `json:"Note"`
+	CreatedAt  time.Time `json:"CreatedAt"`
+}
+
+// ReportStore files reports and keeps the moderation queue.
+type ReportStore struct {
+	db *sql.DB
+}
+
+// NewReportStore returns a ReportStore backed by db.
+func NewReportStore(db *sql.DB) *ReportStore {
+	return &ReportStore{db: db}
+}
+
+// ValidReportTarget reports whether targetType is something that can be reported.
+func ValidReportTarget(targetType string) bool {
+	_, ok := reportTargetOwnerQueries[targetType]
+	return ok
+}
+
+// ValidReportReason reports whether reason is the ID of one of the ReportReasons.
+func ValidReportReason(reason string) bool {
+	for _, r := range ReportReasons {
+		if r.ID == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// File records that reporterID reports the target for reason, with an optional note, and returns
+// the ID of the pending report it was added to. It returns ErrInvalidReport for unknown target
+// types and reasons, sql.ErrNoRows if the target does not exist, ErrSelfReport for reports of
+// the reporter or their own content and ErrAlreadyReported if the reporter already filed the
+// pending report of the target.
+func (s *ReportStore) File(reporterID int, targetType string, targetID int, reason, note string) (int, error) {
+	if !ValidReportTarget(targetType) || !ValidReportReason(reason) {
+		return 0, ErrInvalidReport
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	err = tx.QueryRow(reportTargetOwnerQueries[targetType], targetID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error getting report target: %v", err)
+	}
+	if ownerID == reporterID {
+		return 0, ErrSelfReport
+	}
+
+	if _, err := tx.Exec(insertPendingReportQuery, targetType, targetID); err != nil {
+		return 0, fmt.Errorf("error inserting report: %v", err)
+	}
+	var reportID int
+	if err := tx.QueryRow(selectPendingReportQuery, targetType, targetID).Scan(&reportID); err != nil {
+		return 0, fmt.Errorf("error getting pending report: %v", err)
+	}
+
+	result, err := tx.Exec(insertReportFilingQuery, reportID, reporterID, reason, note)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting report filing: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("error checking report filing: %v", err)
+	} else if n == 0 {
+		return 0, ErrAlreadyReported
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return reportID, nil
+}
+
+// Queue returns the page of the moderation queue starting offset reports in: reports with the
+// given status and target type, either of which may be empty to match all. Pending reports come
+// first, those filed by the most users ahead, then the rest newest first. Every report carries
+// all of its filings.
+func (s *ReportStore) Queue(status, targetType string, offset int) (ReportPage, error) {
+	if offset < 0 {
+		offset = 0
+	}
+
+	var where []string
+	var args []interface{}
+	if status != "" {
+		where = append(where, "r.Status = ?")
+		args = append(args, status)
+	}
+	if targetType != "" {
+		where = append(where, "r.TargetType = ?")
+		args = append(args, targetType)
+	}
+
+	query := selectReportsQuery
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// one report more than a page tells whether there is a next page
+	query += ` ORDER BY r.Status = 'pending' DESC,
+        CASE WHEN r.Status = 'pending' THEN ReporterCount ELSE 0 END DESC, r.ReportID DESC
+        LIMIT ? OFFSET ?`
+	args = append(args, reportPageSize+1, offset)
+
+	reports, err := s.query(query, args...)
+	if err != nil {
+		return ReportPage{}, err
+	}
+	page := ReportPage{Reports: reports}
+	if len(reports) > reportPageSize {
+		page.Reports = reports[:reportPageSize]
+		page.NextOffset = offset + reportPageSize
+	}
+	return page, s.attachFilings(page.Reports, 0)
+}
+
+// FiledBy returns the reports userID has filed, newest first. Each carries only the user's own
+// filing, and who handled it is left out.
+func (s *ReportStore) FiledBy(userID int) ([]Report, error) {
+	reports, err := s.query(selectReportsQuery+`
+        WHERE r.ReportID IN (SELECT ReportID FROM ReportFiling WHERE ReporterID = ?)
+        ORDER BY r.ReportID DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range reports {
+		reports[i].AdminID = nil
+		reports[i].AdminName = ""
+	}
+	return reports, s.attachFilings(reports, userID)
+}
+
+// Get returns reportID with its filings, or sql.ErrNoRows if there is no such report.
+func (s *ReportStore) Get(reportID int) (Report, error) {
+	reports, err := s.query(selectReportsQuery+` WHERE r.ReportID = ?`, reportID)
+	if err != nil {
+		return Report{}, err
+	}
+	if len(reports) == 0 {
+		return Report{}, sql.ErrNoRows
+	}
+	if err := s.attachFilings(reports, 0); err != nil {
+		return Report{}, err
+	}
+	return reports[0], nil
+}
+
+// Resolve closes the pending report reportID with status approved or rejected, on behalf of
+// adminID, and records the decision in the audit log. It returns sql.ErrNoRows if there is no
+// such report and ErrReportResolved if it is not pending anymore. Acting on the target is up to
+// the caller.
+func (s *ReportStore) Resolve(reportID, adminID int, status, response string) error {
+	action := AuditApproveReport
+	switch status {
+	case ReportApproved:
+	case ReportRejected:
+		action = AuditRejectReport
+	default:
+		return ErrInvalidReport
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(resolveReportQuery, status, response, adminID, time.Now().UTC().Truncate(time.Second), reportID)
+	if err != nil {
+		return fmt.Errorf("error resolving report: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking resolved report: %v", err)
+	}
+	if n == 0 {
+		var exists bool
+		if err := tx.QueryRow(reportExistsQuery, reportID).Scan(&exists); err != nil {
+			return fmt.Errorf("error checking report: %v", err)
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+		return ErrReportResolved
+	}
+
+	if err := RecordAudit(tx, adminID, action, AuditTargetReport, reportID, response); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// query runs a reports query.
+func (s *ReportStore) query(query string, args ...interface{}) ([]Report, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reports: %v", err)
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var r Report
+		err := rows.Scan(
+			&r.ReportID, &r.TargetType, &r.TargetID, &r.Status, &r.CreatedAt,
+			&r.AdminResponse, &r.AdminID, &r.AdminName, &r.ResponseDate, &r.ReporterCount,
+			&r.Target.Exists, &r.Target.PostID, &r.Target.Title, &r.Target.Content,
+			&r.Target.AuthorID, &r.Target.Author,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning report: %v", err)
+		}
+		r.Filings = []ReportFiling{}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// attachFilings fills in the filings of reports, oldest first, only those of reporterID unless
+// it is 0. The filings are looked up reportFilingBatch reports at a time.
+func (s *ReportStore) attachFilings(reports []Report, reporterID int) error {
+	for start := 0; start < len(reports); start += reportFilingBatch {
+		end := min(start+reportFilingBatch, len(reports))
+		if err := s.attachFilingBatch(reports[start:end], reporterID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachFilingBatch fills in the filings of a batch of reports for attachFilings.
+func (s *ReportStore) attachFilingBatch(reports []Report, reporterID int) error {
+	byID := make(map[int]*Report, len(reports))
+	args := make([]interface{}, 0, len(reports)+1)
+	for i := range reports {
+		byID[reports[i].ReportID] = &reports[i]
+		args = append(args, reports[i].ReportID)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(reports)), ",")
+	query := fmt.Sprintf(selectReportFilingsQuery, placeholders)
+	if reporterID != 0 {
+		query += ` AND f.ReporterID = ?`
+		args = append(args, reporterID)
+	}
+	rows, err := s.db.Query(query+` ORDER BY f.FilingID`, args...)
+	if err != nil {
+		return fmt.Errorf("error querying report filings: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reportID int
+		var f ReportFiling
+		if err := rows.Scan(&reportID, &f.ReporterID, &f.Reporter, &f.Reason, &f.Note, &f.CreatedAt); err != nil {
+			return fmt.Errorf("error scanning report filing: %v", err)
+		}
+		report := byID[reportID]
+		report.Filings = append(report.Filings, f)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,191 @@
+package DB
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+func TestFileCollapsesReports(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	carol := createTestUser(t, s, "carol")
+	postID := createTestPost(t, db, alice, "post")
+
+	first, err := s.Reports.File(bob, ReportTargetPost, postID, "spam", "ads")
+	if err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	second, err := s.Reports.File(carol, ReportTargetPost, postID, "hate", "")
+	if err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	if second != first {
+		t.Errorf("second report of the post opened report %d, want it added to %d", second, first)
+	}
+
+	report, err := s.Reports.Get(first)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if report.ReporterCount != 2 || len(report.Filings) != 2 {
+		t.Fatalf("report has %d reporters and %d filings, want 2", report.ReporterCount, len(report.Filings))
+	}
+	if f := report.Filings[0]; f.ReporterID != bob || f.Reporter != "bob" || f.Reason != "spam" || f.Note != "ads" {
+		t.Errorf("first filing = %+v", f)
+	}
+	if f := report.Filings[1]; f.ReporterID != carol || f.Reason != "hate" {
+		t.Errorf("second filing = %+v", f)
+	}
+	if !report.Target.Exists || report.Target.Title != "post" || report.Target.Author != "alice" {
+		t.Errorf("report target = %+v", report.Target)
+	}
+
+	// once the report is resolved, the next one opens a new report
+	if err := s.Reports.Resolve(first, alice, ReportRejected, "fine"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if err := s.Reports.Resolve(first, alice, ReportApproved, ""); err != ErrReportResolved {
+		t.Errorf("second Resolve: err = %v, want ErrReportResolved", err)
+	}
+	reopened, err := s.Reports.File(bob, ReportTargetPost, postID, "spam", "")
+	if err != nil {
+		t.Fatalf("File after resolving: %v", err)
+	}
+	if reopened == first {
+		t.Error("report of a resolved target was added to the resolved report")
+	}
+}
+
+func TestFileRefusals(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	postID := createTestPost(t, db, alice, "post")
+	commentID, err := s.Comments.Create(postID, alice, "comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+
+	if _, err := s.Reports.File(bob, ReportTargetComment, int(commentID), "spam", ""); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		reporterID int
+		targetType string
+		targetID   int
+		reason     string
+		want       error
+	}{
+		{"own post", alice, ReportTargetPost, postID, "spam", ErrSelfReport},
+		{"own comment", alice, ReportTargetComment, int(commentID), "spam", ErrSelfReport},
+		{"themselves", alice, ReportTargetUser, alice, "spam", ErrSelfReport},
+		{"same comment twice", bob, ReportTargetComment, int(commentID), "hate", ErrAlreadyReported},
+		{"unknown reason", bob, ReportTargetPost, postID, "boring", ErrInvalidReport},
+		{"unknown target type", bob, "category", 1, "spam", ErrInvalidReport},
+		{"missing post", bob, ReportTargetPost, postID + 100, "spam", sql.ErrNoRows},
+		{"missing user", bob, ReportTargetUser, bob + 100, "spam", sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		if _, err := s.Reports.File(tt.reporterID, tt.targetType, tt.targetID, tt.reason, ""); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// the refused reports left nothing behind
+	page, err := s.Reports.Queue("", "", 0)
+	if err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	if len(page.Reports) != 1 || page.Reports[0].ReporterCount != 1 {
+		t.Errorf("queue = %+v, want the one report of the comment", page.Reports)
+	}
+}
+
+// TestQueuePages files more reports than fit in a page or in one filings lookup, so both the
+// queue pages and attachFilings batches are exercised.
+func TestQueuePages(t *testing.T) {
+	db, s := openTestStore(t)
+	reporter := createTestUser(t, s, "reporter")
+
+	const total = 2*reportFilingBatch + 10
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("starting transaction: %v", err)
+	}
+	for i := 0; i < total; i++ {
+		name := fmt.Sprintf("user%d", i)
+		if _, err := tx.Exec(insertUserQuery, name, name, "Test", name+"@example.com", "not a hash", "F"); err != nil {
+			t.Fatalf("creating user %s: %v", name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("committing users: %v", err)
+	}
+	rows, err := db.Query(`SELECT UserID FROM User WHERE username LIKE 'user%'`)
+	if err != nil {
+		t.Fatalf("listing users: %v", err)
+	}
+	var users []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			t.Fatalf("scanning user: %v", err)
+		}
+		users = append(users, userID)
+	}
+	rows.Close()
+	for _, userID := range users {
+		if _, err := s.Reports.File(reporter, ReportTargetUser, userID, "spam", ""); err != nil {
+			t.Fatalf("File: %v", err)
+		}
+	}
+
+	seen := map[int]bool{}
+	offset, pages := 0, 0
+	for {
+		page, err := s.Reports.Queue(ReportPending, ReportTargetUser, offset)
+		if err != nil {
+			t.Fatalf("Queue(%d): %v", offset, err)
+		}
+		pages++
+		if len(page.Reports) > reportPageSize {
+			t.Fatalf("page of %d reports, want at most %d", len(page.Reports), reportPageSize)
+		}
+		for _, r := range page.Reports {
+			if seen[r.ReportID] {
+				t.Errorf("report %d listed twice", r.ReportID)
+			}
+			seen[r.ReportID] = true
+			if len(r.Filings) != 1 {
+				t.Errorf("report %d has %d filings, want 1", r.ReportID, len(r.Filings))
+			}
+		}
+		if page.NextOffset == 0 {
+			break
+		}
+		if page.NextOffset != offset+reportPageSize {
+			t.Fatalf("NextOffset = %d, want %d", page.NextOffset, offset+reportPageSize)
+		}
+		offset = page.NextOffset
+	}
+	if len(seen) != total || pages != (total+reportPageSize-1)/reportPageSize {
+		t.Errorf("queue listed %d reports on %d pages, want %d", len(seen), pages, total)
+	}
+
+	filed, err := s.Reports.FiledBy(reporter)
+	if err != nil {
+		t.Fatalf("FiledBy: %v", err)
+	}
+	if len(filed) != total {
+		t.Fatalf("FiledBy returned %d reports, want %d", len(filed), total)
+	}
+	for _, r := range filed {
+		if len(r.Filings) != 1 || r.Filings[0].ReporterID != reporter {
+			t.Fatalf("report %d has filings %+v, want the reporter's one", r.ReportID, r.Filings)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package DB
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// What the content filter can hold for review.
+const (
+	HeldPost    = "post"
+	HeldComment = "comment"
+)
+
+// Statuses of a hold. Approved content is published; rejected posts are soft-deleted and
+// rejected comments deleted.
+const (
+	HoldPending  = "pending"
+	HoldApproved = "approved"
+	HoldRejected = "rejected"
+)
+
+const (
+	// insertHoldQuery holds content again when it is edited while still waiting for review. The
+	// hold keeps whether it was for an edit: content held since it was written stays unpublished.
+	insertHoldQuery = `
+        INSERT INTO FilterHold (TargetType, TargetID, UserID, RuleID, Reason, Edited) VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT(TargetType, TargetID) WHERE Status = 'pending'
+        DO UPDATE SET RuleID = excluded.RuleID, Reason = excluded.Reason, CreatedAt = CURRENT_TIMESTAMP
+    `
+	// holdPostQuery hides a post until it is reviewed; posts moderators already took down stay as
+	// they are.
+	holdPostQuery = `
+        UPDATE Post SET Visibility = 'hidden', ModerationReason = ?, ModeratedBy = NULL, ModeratedAt = ?
+        WHERE PostID = ? AND Visibility = 'visible'
+    `
+	holdCommentQuery    = `UPDATE Comment SET HeldForReview = 1 WHERE CommentID = ?`
+	releaseCommentQuery = `UPDATE Comment SET HeldForReview = 0 WHERE CommentID = ?`
+	// releasePostQuery shows a held post again, unless a moderator has hidden it since.
+	releasePostQuery = `
+        UPDATE Post SET Visibility = 'visible', ModerationReason = NULL, ModeratedBy = ?, ModeratedAt = ?
+        WHERE PostID = ? AND Visibility = 'hidden' AND ModeratedBy IS NULL
+    `
+	selectPendingHoldQuery = `SELECT TargetType, TargetID, Reason, Edited FROM FilterHold WHERE HoldID = ? AND Status = 'pending'`
+	reviewHoldQuery        = `UPDATE FilterHold SET Status = ?, ReviewedBy = ?, ReviewedAt = ? WHERE HoldID = ?`
+	// approvePostHoldQuery settles the pending hold of a post a moderator shows again without
+	// going through the review queue.
+	approvePostHoldQuery = `
+        UPDATE FilterHold SET Status = 'approved', ReviewedBy = ?, ReviewedAt = ?
+        WHERE TargetType = 'post' AND TargetID = ? AND Status = 'pending'
+    `
+	// selectHeldContentQuery lists the pending holds whose content still exists, oldest first.
+	selectHeldContentQuery = `
+        SELECT h.HoldID, h.TargetType, h.TargetID, COALESCE(p.PostID, c.PostID), h.UserID, u.username,
+               h.RuleID, h.Reason, h.CreatedAt, COALESCE(p.title, cp.title, ''), COALESCE(p.content, c.content, '')
+        FROM FilterHold h
+        JOIN User u ON u.UserID = h.UserID
+        LEFT JOIN Post p ON h.TargetType = 'post' AND p.PostID = h.TargetID AND p.Visibility != 'deleted'
+        LEFT JOIN Comment c ON h.TargetType = 'comment' AND c.CommentID = h.TargetID
+        LEFT JOIN Post cp ON cp.PostID = c.PostID
+        WHERE h.Status = 'pending' AND (p.PostID IS NOT NULL OR c.CommentID IS NOT NULL)
+        ORDER BY h.HoldID
+    `
+)
+
+// HeldContent is a post or comment the content filter holds for review, as it is now. PostID is
+// the held post or the post a held comment is on; Title is the title of that post.
+type HeldContent struct {
+	HoldID     int       `json:"holdId"`
+	TargetType string    `json:"targetType"`
+	TargetID   int       `json:"targetId"`
+	PostID     int       `json:"postId"`
+	UserID     int       `json:"userId"`
+	Username   string    `json:"username"`
+	RuleID     *int      `json:"ruleId"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+}
+
+// holdContent keeps the post or comment targetID of userID out of sight until a moderator
+// reviews it, for the reason given by match, within tx. edited tells whether it is an edit of
+// content that was already published rather than new content.
+func holdContent(tx *sql.Tx, targetType string, targetID, userID int, match *FilterMatch, edited bool) error {
+	var err error
+	if targetType == HeldPost {
+		_, err = tx.Exec(holdPostQuery, "Awaiting review: it "+match.Reason, moderationTime(), targetID)
+	} else {
+		_, err = tx.Exec(holdCommentQuery, targetID)
+	}
+	if err != nil {
+		return fmt.Errorf("error holding %s for review: %v", targetType, err)
+	}
+
+	if _, err := tx.Exec(insertHoldQuery, targetType, targetID, userID, match.RuleID, match.Reason, edited); err != nil {
+		return fmt.Errorf("error adding %s to the review queue: %v", targetType, err)
+	}
+	return nil
+}
+
+// Queue returns the posts and comments waiting for review, oldest first.
+func (s *FilterStore) Queue() ([]HeldContent, error) {
+	rows, err := s.db.Query(selectHeldContentQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error querying review queue: %v", err)
+	}
+	defer rows.Close()
+
+	held := []HeldContent{}
+	for rows.Next() {
+		var h HeldContent
+		if err := rows.Scan(
+			&h.HoldID, &h.TargetType, &h.TargetID, &h.PostID, &h.UserID, &h.Username,
+			&h.RuleID, &h.Reason, &h.CreatedAt, &h.Title, &h.Content,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning held content: %v", err)
+		}
+		held = append(held, h)
+	}
+	return held, rows.Err()
+}
+
+// Review approves or rejects the content of holdID on behalf of moderatorID and records the
+// decision in the audit log. Approved content is published, and the notifications held back
+// with a new comment are sent once it is approved, if it is now shown; a rejected post is soft-deleted and a
+// rejected comment deleted with its replies. It returns sql.ErrNoRows if there is no such hold
+// waiting for review.
+func (s *FilterStore) Review(holdID, moderatorID int, approve bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var targetType, reason string
+	var targetID int
+	var edited bool
+	err = tx.QueryRow(selectPendingHoldQuery, holdID).Scan(&targetType, &targetID, &reason, &edited)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error getting hold: %v", err)
+	}
+
+	now := moderationTime()
+	status, action := HoldApproved, AuditApproveContent
+	switch {
+	case approve && targetType == HeldPost:
+		_, err = tx.Exec(releasePostQuery, moderatorID, now, targetID)
+	case approve:
+		_, err = tx.Exec(releaseCommentQuery, targetID)
+	case targetType == HeldPost:
+		status, action = HoldRejected, AuditRejectContent
+		_, err = tx.Exec(setPostVisibilityQuery, PostDeleted, "Rejected in review: it "+reason, moderatorID, now, targetID)
+	default:
+		status, action = HoldRejected, AuditRejectContent
+		_, err = tx.Exec(deleteCommentByIDQuery, targetID)
+	}
+	if err != nil {
+		return fmt.Errorf("error reviewing %s: %v", targetType, err)
+	}
+
+	// the notifications of a new comment were held back with it; an edit was notified of already
+	if approve && targetType == HeldComment && !edited {
+		var count int
+		var visible bool
+		if err := tx.QueryRow(selectCommentVisibleQuery, targetID).Scan(&count, &visible); err != nil {
+			return fmt.Errorf("error checking comment visibility: %v", err)
+		}
+		if visible {
+			if err := notifyNewComment(tx, targetID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(reviewHoldQuery, status, moderatorID, now, holdID); err != nil {
+		return fmt.Errorf("error updating hold: %v", err)
+	}
+	if err := RecordAudit(tx, moderatorID, action, targetType, targetID, reason); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package DB
+
+import "testing"
+
+func TestRestoringHeldPostSettlesHold(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	if _, err := s.Filter.AddRule(FilterRule{Kind: FilterTerm, Pattern: "casino", Action: FilterReview}, alice); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+	match, err := s.Filter.Check(alice, "the best casino in town")
+	if err != nil || match == nil {
+		t.Fatalf("Check returned %v, %v; want a match", match, err)
+	}
+	if err := InsertPost(db, "casino", "the best casino in town", nil, nil, alice, match); err != nil {
+		t.Fatalf("creating held post: %v", err)
+	}
+	var postID int
+	if err := db.QueryRow(`SELECT MAX(PostID) FROM Post`).Scan(&postID); err != nil {
+		t.Fatalf("getting post ID: %v", err)
+	}
+
+	queue, err := s.Filter.Queue()
+	if err != nil || len(queue) != 1 {
+		t.Fatalf("Queue returned %d holds, err %v; want 1", len(queue), err)
+	}
+
+	if err := s.Posts.SetVisibility(postID, alice, PostVisible, ""); err != nil {
+		t.Fatalf("SetVisibility: %v", err)
+	}
+	if queue, err := s.Filter.Queue(); err != nil || len(queue) != 0 {
+		t.Errorf("Queue returned %d holds, err %v, after the post was shown; want none", len(queue), err)
+	}
+	var status string
+	if err := db.QueryRow(`SELECT Status FROM FilterHold WHERE TargetID = ?`, postID).Scan(&status); err != nil {
+		t.Fatalf("getting hold status: %v", err)
+	}
+	if status != HoldApproved {
+		t.Errorf("hold status = %q, want %q", status, HoldApproved)
+	}
+
+	// A later review of the settled hold finds nothing to do, so the post is not deleted.
+	if err := s.Filter.Review(queue[0].HoldID, alice, false); err == nil {
+		t.Error("Review of a settled hold succeeded")
+	}
+	if state, err := s.Posts.State(postID); err != nil || state.Visibility != PostVisible {
+		t.Errorf("post is %q, err %v; want it visible", state.Visibility, err)
+	}
+}
+
+func TestApprovingHeldCommentNotifies(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	carol := createTestUser(t, s, "carol")
+	postID := createTestPost(t, db, alice, "post")
+	if _, err := s.Filter.AddRule(FilterRule{Kind: FilterTerm, Pattern: "casino", Action: FilterReview}, alice); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+	held, err := s.Filter.Check(bob, "casino")
+	if err != nil || held == nil {
+		t.Fatalf("Check returned %v, %v; want a match", held, err)
+	}
+
+	commentID, err := s.Comments.Create(postID, bob, "casino comment", held)
+	if err != nil {
+		t.Fatalf("creating held comment: %v", err)
+	}
+	parentID, err := s.Comments.Create(postID, bob, "published comment", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+	replyID, _, err := s.Comments.Reply(int(parentID), carol, "casino reply", held)
+	if err != nil {
+		t.Fatalf("creating held reply: %v", err)
+	}
+
+	notifications := func(userID int) map[string]int {
+		t.Helper()
+		list, err := s.Notifications.ListForUser(userID)
+		if err != nil {
+			t.Fatalf("ListForUser: %v", err)
+		}
+		kinds := map[string]int{}
+		for _, n := range list {
+			kinds[n.NotificationType]++
+		}
+		return kinds
+	}
+	if n := notifications(alice); len(n) != 0 {
+		t.Fatalf("alice notified of held comments: %v", n)
+	}
+
+	review := func(targetID int64) {
+		t.Helper()
+		queue, err := s.Filter.Queue()
+		if err != nil {
+			t.Fatalf("Queue: %v", err)
+		}
+		for _, h := range queue {
+			if h.TargetID == int(targetID) {
+				if err := s.Filter.Review(h.HoldID, alice, true); err != nil {
+					t.Fatalf("Review: %v", err)
+				}
+				return
+			}
+		}
+		t.Fatalf("comment %d not in the review queue", targetID)
+	}
+
+	review(commentID)
+	review(replyID)
+	if n := notifications(alice); n[NotifyComment] != 2 || len(n) != 1 {
+		t.Errorf("alice has notifications %v, want 2 comment ones", n)
+	}
+	if n := notifications(bob); n[NotifyReply] != 1 || len(n) != 1 {
+		t.Errorf("bob has notifications %v, want 1 reply one", n)
+	}
+
+	// An edit held for review was notified of when the comment was first published.
+	if err := s.Comments.Update(int(commentID), bob, "casino edit", held); err != nil {
+		t.Fatalf("editing comment: %v", err)
+	}
+	review(commentID)
+	if n := notifications(alice); n[NotifyComment] != 2 {
+		t.Errorf("approving an edit notified alice again: %v", n)
+	}
+}
@@ -0,0 +1,228 @@
+package DB
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/markdown"
+	"time"
+)
+
+const (
+	selectPostVersionQuery = `SELECT title, content FROM Post WHERE PostID = ?`
+	editPostQuery          = `UPDATE Post SET title = ?, content = ?, content_html = ?, EditedAt = ? WHERE PostID = ?`
+	// insertOriginalPostRevisionQuery keeps a post as first written as revision 1 when it is edited
+	// for the first time, unless its history has been started already.
+	insertOriginalPostRevisionQuery = `
+        INSERT INTO PostRevision (PostID, Number, title, content, EditorID, CreatedAt)
+        SELECT PostID, 1, title, content, UserID, PostDate FROM Post
+        WHERE PostID = ? AND NOT EXISTS (SELECT 1 FROM PostRevision WHERE PostID = ?)
+    `
+	insertPostRevisionQuery = `
+        INSERT INTO PostRevision (PostID, Number, title, content, EditorID, CreatedAt, RestoredFrom)
+        SELECT ?, COALESCE(MAX(Number), 0) + 1, ?, ?, ?, ?, ? FROM PostRevision WHERE PostID = ?
+    `
+	selectPostRevisionsQuery = `
+        SELECT r.Number, r.title, r.content, r.EditorID, COALESCE(u.username, ''), r.CreatedAt, r.RestoredFrom
+        FROM PostRevision r
+        LEFT JOIN User u ON u.UserID = r.EditorID
+        WHERE r.PostID = ?
+    `
+
+	selectCommentVersionQuery = `SELECT content FROM Comment WHERE CommentID = ?`
+	editCommentQuery          = `UPDATE Comment SET content = ?, content_html = ?, EditedAt = ? WHERE CommentID = ?`
+	// insertOriginalCommentRevisionQuery is insertOriginalPostRevisionQuery for comments.
+	insertOriginalCommentRevisionQuery = `
+        INSERT INTO CommentRevision (CommentID, Number, content, EditorID, CreatedAt)
+        SELECT CommentID, 1, content, UserID, CmtDate FROM Comment
+        WHERE CommentID = ? AND NOT EXISTS (SELECT 1 FROM CommentRevision WHERE CommentID = ?)
+    `
+	insertCommentRevisionQuery = `
+        INSERT INTO CommentRevision (CommentID, Number, content, EditorID, CreatedAt, RestoredFrom)
+        SELECT ?, COALESCE(MAX(Number), 0) + 1, ?, ?, ?, ? FROM CommentRevision WHERE CommentID = ?
+    `
+	selectCommentRevisionsQuery = `
+        SELECT r.Number, '', r.content, r.EditorID, COALESCE(u.username, ''), r.CreatedAt, r.RestoredFrom
+        FROM CommentRevision r
+        LEFT JOIN User u ON u.UserID = r.EditorID
+        WHERE r.CommentID = ?
+    `
+	commentExistsQuery = `SELECT EXISTS(SELECT 1 FROM Comment WHERE CommentID = ?)`
+)
+
+// Revision is one version of a post or comment. Number counts the versions from 1, the original
+// as first written; the highest number is the current version. Title is empty for comments.
+// Editor is empty once the editor's account is gone. RestoredFrom is the revision an admin
+// brought back, nil for ordinary edits.
+// Posts and comments that were never edited have no revisions.
+type Revision struct {
+	Number       int       `json:"number"`
+	Title        string    `json:"title,omitempty"`
+	Content      string    `json:"content"`
+	EditorID     *int      `json:"editorId"`
+	Editor       string    `json:"editor"`
+	CreatedAt    time.Time `json:"createdAt"`
+	RestoredFrom *int      `json:"restoredFrom"`
+}
+
+// Revisions returns every revision of postID, oldest first, or sql.ErrNoRows if the post does not exist.
+func (s *PostStore) Revisions(postID int) ([]Revision, error) {
+	return listRevisions(s.db, postExistsQuery, selectPostRevisionsQuery, postID)
+}
+
+// Revision returns revision number of postID, or sql.ErrNoRows if there is no such revision.
+func (s *PostStore) Revision(postID, number int) (Revision, error) {
+	return findRevision(s.db, selectPostRevisionsQuery, postID, number)
+}
+
+// RestoreRevision makes revision number of postID its current title and content again, on behalf
+// of editorID. The restore is recorded as a new revision; the gallery is left as it is.
+// It returns sql.ErrNoRows if the post has no such revision.
+func (s *PostStore) RestoreRevision(postID, number, editorID int) error {
+	revision, err := s.Revision(postID, number)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := editPost(tx, postID, editorID, revision.Title, revision.Content, &number); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Revisions returns every revision of commentID, oldest first, or sql.ErrNoRows if the comment
+// does not exist.
+func (s *CommentStore) Revisions(commentID int) ([]Revision, error) {
+	return listRevisions(s.db, commentExistsQuery, selectCommentRevisionsQuery, commentID)
+}
+
+// Revision returns revision number of commentID, or sql.ErrNoRows if there is no such revision.
+func (s *CommentStore) Revision(commentID, number int) (Revision, error) {
+	return findRevision(s.db, selectCommentRevisionsQuery, commentID, number)
+}
+
+// RestoreRevision makes revision number of commentID its current content again, on behalf of
+// editorID. The restore is recorded as a new revision.
+// It returns sql.ErrNoRows if the comment has no such revision.
+func (s *CommentStore) RestoreRevision(commentID, number, editorID int) error {
+	revision, err := s.Revision(commentID, number)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := editComment(tx, commentID, editorID, revision.Content, &number); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// editPost changes the title and content of postID on behalf of editorID and records the change
+// as a new revision, keeping the version it replaces as revision 1 if the post had no history yet.
+// Edits that change neither title nor content record nothing. It returns sql.ErrNoRows if the post
+// does not exist.
+func editPost(tx *sql.Tx, postID, editorID int, title, content string, restoredFrom *int) error {
+	var oldTitle, oldContent string
+	if err := tx.QueryRow(selectPostVersionQuery, postID).Scan(&oldTitle, &oldContent); err != nil {
+		return err
+	}
+	if title == oldTitle && content == oldContent {
+		return nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := tx.Exec(insertOriginalPostRevisionQuery, postID, postID); err != nil {
+		return fmt.Errorf("error saving original post revision: %v", err)
+	}
+	if _, err := tx.Exec(editPostQuery, title, content, markdown.Render(content), now, postID); err != nil {
+		return fmt.Errorf("error updating post: %v", err)
+	}
+	if _, err := tx.Exec(insertPostRevisionQuery, postID, title, content, editorID, now, restoredFrom, postID); err != nil {
+		return fmt.Errorf("error saving post revision: %v", err)
+	}
+	return nil
+}
+
+// editComment is editPost for comments.
+func editComment(tx *sql.Tx, commentID, editorID int, content string, restoredFrom *int) error {
+	var oldContent string
+	if err := tx.QueryRow(selectCommentVersionQuery, commentID).Scan(&oldContent); err != nil {
+		return err
+	}
+	if content == oldContent {
+		return nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := tx.Exec(insertOriginalCommentRevisionQuery, commentID, commentID); err != nil {
+		return fmt.Errorf("error saving original comment revision: %v", err)
+	}
+	if _, err := tx.Exec(editCommentQuery, content, markdown.Render(content), now, commentID); err != nil {
+		return fmt.Errorf("error updating comment: %v", err)
+	}
+	if _, err := tx.Exec(insertCommentRevisionQuery, commentID, content, editorID, now, restoredFrom, commentID); err != nil {
+		return fmt.Errorf("error saving comment revision: %v", err)
+	}
+	return nil
+}
+
+// listRevisions runs a revisions query for id after checking with existsQuery that id exists.
+func listRevisions(db *sql.DB, existsQuery, revisionsQuery string, id int) ([]Revision, error) {
+	var exists bool
+	if err := db.QueryRow(existsQuery, id).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("error checking revision owner: %v", err)
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := db.Query(revisionsQuery+` ORDER BY r.Number`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error querying revisions: %v", err)
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// findRevision runs a revisions query for one revision of id.
+func findRevision(db *sql.DB, revisionsQuery string, id, number int) (Revision, error) {
+	return scanRevision(db.QueryRow(revisionsQuery+` AND r.Number = ?`, id, number))
+}
+
+// scanRevision reads a row of a revisions query.
+func scanRevision(row interface{ Scan(...interface{}) error }) (Revision, error) {
+	var r Revision
+	err := row.Scan(&r.Number, &r.Title, &r.Content, &r.EditorID, &r.Editor, &r.CreatedAt, &r.RestoredFrom)
+	if err == sql.ErrNoRows {
+		return Revision{}, err
+	}
+	if err != nil {
+		return Revision{}, fmt.Errorf("error scanning revision: %v", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,243 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Kinds of sanction. A ban keeps a user from logging in; a mute keeps them from posting,
+// commenting and reacting.
+const (
+	SanctionBan  = "ban"
+	SanctionMute = "mute"
+)
+
+// ErrInvalidSanction is returned for an unknown kind of sanction, a mute without an expiry or an
+// expiry that has already passed.
+var ErrInvalidSanction = errors.New("invalid sanction")
+
+const (
+	insertSanctionQuery = `INSERT INTO Sanction (UserID, Kind, Reason, IssuedBy, ExpiresAt) VALUES (?, ?, ?, ?, ?)`
+	// insertSanctionNotificationQuery tells the user about a sanction; the notification type is
+	// the capitalized kind.
+	insertSanctionNotificationQuery = `
+        INSERT INTO Notification (UserID, UserToNotify, NotificationType, SanctionID)
+        VALUES (?, ?, CASE ? WHEN 'ban' THEN 'Ban' ELSE 'Mute' END, ?)
+    `
+	selectSanctionKindQuery = `SELECT UserID, Kind FROM Sanction WHERE SanctionID = ?`
+	liftSanctionQuery       = `UPDATE Sanction SET LiftedAt = ?, LiftedBy = ? WHERE SanctionID = ? AND LiftedAt IS NULL`
+	// sanctionActiveCondition holds for sanctions that are neither lifted nor expired.
+	sanctionActiveCondition = `s.LiftedAt IS NULL AND (s.ExpiresAt IS NULL OR julianday(s.ExpiresAt) > julianday('now'))`
+	selectSanctionsQuery    = `
+        SELECT s.SanctionID, s.UserID, u.username, s.Kind, s.Reason, s.IssuedBy, COALESCE(i.username, ''),
+               s.CreatedAt, s.ExpiresAt, s.LiftedAt, s.LiftedBy, ` + sanctionActiveCondition + `
+        FROM Sanction s
+        JOIN User u ON u.UserID = s.UserID
+        LEFT JOIN User i ON i.UserID = s.IssuedBy
+    `
+)
+
+// Sanction is a ban or mute of a user. ExpiresAt is nil for permanent bans; LiftedAt and LiftedBy
+// are set once an admin ends the sanction early. Active tells whether it is still in force.
+type Sanction struct {
+	SanctionID int        `json:"sanctionId"`
+	UserID     int        `json:"userId"`
+	Username   string     `json:"username"`
+	Kind       string     `json:"kind"`
+	Reason     string     `json:"reason"`
+	IssuedBy   *int       `json:"issuedBy"`
+	Issuer     string     `json:"issuer"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LiftedAt   *time.Time `json:"liftedAt"`
+	LiftedBy   *int       `json:"liftedBy"`
+	Active     bool       `json:"active"`
+}
+
+// Until describes how long the sanction lasts, such as "until 2024-05-01 14:00 UTC".
+func (s Sanction) Until() string {
+	if s.ExpiresAt == nil {
+		return "permanently"
+	}
+	return "until " + s.ExpiresAt.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// SanctionStore reads and writes the bans and mutes of users.
+type SanctionStore struct {
+	db *sql.DB
+}
+
+// NewSanctionStore returns a SanctionStore backed by db.
+func NewSanctionStore(db *sql.DB) *SanctionStore {
+	return &SanctionStore{db: db}
+}
+
+// Issue bans or mutes userID on behalf of issuerID, giving reason, until expiresAt or, for bans
+// only, permanently when expiresAt is nil. A ban signs the user out everywhere. The user is
+// notified and the sanction recorded in the audit log, all in one transaction.
+// It returns ErrInvalidSanction for an invalid kind or expiry and sql.ErrNoRows if the user does
+// not exist.
+func (s *SanctionStore) Issue(userID, issuerID int, kind, reason string, expiresAt *time.Time) (int, error) {
+	var action string
+	switch {
+	case kind == SanctionBan:
+		action = AuditBanUser
+	case kind == SanctionMute && expiresAt != nil:
+		action = AuditMuteUser
+	default:
+		return 0, ErrInvalidSanction
+	}
+	var expiry interface{}
+	if expiresAt != nil {
+		if !expiresAt.After(time.Now()) {
+			return 0, ErrInvalidSanction
+		}
+		expiry = expiresAt.UTC().Truncate(time.Second)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(selectUserIDQuery, userID).Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, err
+		}
+		return 0, fmt.Errorf("error checking sanctioned user: %v", err)
+	}
+
+	result, err := tx.Exec(insertSanctionQuery, userID, kind, reason, issuerID, expiry)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting sanction: %v", err)
+	}
+	sanctionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting sanction ID: %v", err)
+	}
+
+	if kind == SanctionBan {
+		if _, err := tx.Exec(deleteUserSessionsQuery, userID); err != nil {
+			return 0, fmt.Errorf("error revoking sessions: %v", err)
+		}
+	}
+	if _, err := tx.Exec(insertSanctionNotificationQuery, issuerID, userID, kind, sanctionID); err != nil {
+		return 0, fmt.Errorf("error notifying sanctioned user: %v", err)
+	}
+
+	sanction := Sanction{ExpiresAt: expiresAt}
+	details := fmt.Sprintf("%s: %s", sanction.Until(), reason)
+	if err := RecordAudit(tx, issuerID, action, AuditTargetUser, userID, details); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return int(sanctionID), nil
+}
+
+// Lift ends sanctionID early on behalf of adminID and records it in the audit log. It returns
+// sql.ErrNoRows if there is no such sanction or it was lifted already.
+func (s *SanctionStore) Lift(sanctionID, adminID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var kind string
+	err = tx.QueryRow(selectSanctionKindQuery, sanctionID).Scan(&userID, &kind)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error getting sanction: %v", err)
+	}
+
+	result, err := tx.Exec(liftSanctionQuery, time.Now().UTC().Truncate(time.Second), adminID, sanctionID)
+	if err != nil {
+		return fmt.Errorf("error lifting sanction: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking lifted sanction: %v", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	action := AuditUnmuteUser
+	if kind == SanctionBan {
+		action = AuditUnbanUser
+	}
+	if err := RecordAudit(tx, adminID, action, AuditTargetUser, userID, fmt.Sprintf("sanction #%d", sanctionID)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// ActiveBan returns the ban keeping userID from logging in, the longest one if there are
+// several, or sql.ErrNoRows if the user is not banned.
+func (s *SanctionStore) ActiveBan(userID int) (Sanction, error) {
+	return s.active(userID, `s.Kind = 'ban'`)
+}
+
+// ActiveMute returns the sanction keeping userID from posting, the longest one if there are
+// several, or sql.ErrNoRows if the user may post. Banned users are muted as well.
+func (s *SanctionStore) ActiveMute(userID int) (Sanction, error) {
+	return s.active(userID, `s.Kind IN ('ban', 'mute')`)
+}
+
+// List returns the sanctions of userID, or of every user if userID is 0, newest first. With
+// activeOnly set, only sanctions still in force are returned.
+func (s *SanctionStore) List(userID int, activeOnly bool) ([]Sanction, error) {
+	query := selectSanctionsQuery + ` WHERE (? = 0 OR s.UserID = ?)`
+	if activeOnly {
+		query += ` AND ` + sanctionActiveCondition
+	}
+	return s.query(query+` ORDER BY s.SanctionID DESC`, userID, userID)
+}
+
+// active returns the longest active sanction of userID matching condition, or sql.ErrNoRows.
+func (s *SanctionStore) active(userID int, condition string) (Sanction, error) {
+	sanctions, err := s.query(selectSanctionsQuery+`
+        WHERE s.UserID = ? AND `+condition+` AND `+sanctionActiveCondition+`
+        ORDER BY s.ExpiresAt IS NULL DESC, julianday(s.ExpiresAt) DESC
+        LIMIT 1`, userID)
+	if err != nil {
+		return Sanction{}, err
+	}
+	if len(sanctions) == 0 {
+		return Sanction{}, sql.ErrNoRows
+	}
+	return sanctions[0], nil
+}
+
+// query runs a sanctions query.
+func (s *SanctionStore) query(query string, args ...interface{}) ([]Sanction, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sanctions: %v", err)
+	}
+	defer rows.Close()
+
+	sanctions := []Sanction{}
+	for rows.Next() {
+		var sc Sanction
+		if err := rows.Scan(
+			&sc.SanctionID, &sc.UserID, &sc.Username, &sc.Kind, &sc.Reason, &sc.IssuedBy, &sc.Issuer,
+			&sc.CreatedAt, &sc.ExpiresAt, &sc.LiftedAt, &sc.LiftedBy, &sc.Active,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning sanction: %v", err)
+		}
+		sanctions = append(sanctions, sc)
+	}
+	return sanctions, rows.Err()
+}
@@ -0,0 +1,189 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+const (
+	// searchPostsQuery ranks posts by their best match, either in the post itself or in one of
+	// its comments. Title hits weigh ten times a body hit and comment hits count half as much as
+	// body hits. bm25 scores are negative, so lower is better. Comments held for review are
+	// not searched.
+	// Matched terms are wrapped in the \x02 and \x03 control characters, which are turned into
+	// <mark> tags once the snippet has been HTML-escaped.
+	// The %s verb is replaced with the AND-ed filter conditions.
+	searchPostsQuery = `
+        WITH matches AS (
+            SELECT rowid AS PostID,
+                   bm25(PostSearch, 10.0, 1.0) AS rank,
+                   snippet(PostSearch, -1, char(2), char(3), '…', 16) AS snippet
+            FROM PostSearch
+            WHERE PostSearch MATCH ?
+            UNION ALL
+            SELECT c.PostID,
+                   bm25(CommentSearch) / 2 AS rank,
+                   snippet(CommentSearch, 0, char(2), char(3), '…', 16) AS snippet
+            FROM CommentSearch
+            JOIN Comment c ON c.CommentID = CommentSearch.rowid
+            WHERE CommentSearch MATCH ? AND c.HeldForReview = 0
+        ), best AS (
+            SELECT PostID, MIN(rank) AS rank, snippet FROM matches GROUP BY PostID
+        )
+        SELECT
+            posts.PostID, posts.UserID, posts.PostDate, posts.title, posts.content,
+            posts.content_html, posts.EditedAt, posts.username, posts.likes, posts.dislikes,
+            posts.comments, posts.locked, posts.pinned, best.snippet
+        FROM (` + selectPostsQuery + ` WHERE p.Visibility = 'visible') AS posts
+        JOIN best ON best.PostID = posts.PostID
+        WHERE 1 = 1 %s
+        ORDER BY best.rank, posts.PostID DESC
+        LIMIT ? OFFSET ?
+    `
+	searchCategoryFilter = ` AND posts.PostID IN (
+            SELECT pc.PostID FROM PostCategory pc JOIN Category c ON c.CategoryID = pc.CategoryID WHERE c.title = ?
+        )`
+	searchAuthorFilter = ` AND posts.username = ?`
+	searchFromFilter   = ` AND posts.PostDate >= ?`
+	searchToFilter     = ` AND posts.PostDate < ?`
+
+	// searchDateLayout matches the CURRENT_TIMESTAMP format PostDate is stored in.
+	searchDateLayout = "2006-01-02 15:04:05"
+)
+
+// ErrEmptySearch is returned when a search query holds no terms.
+var ErrEmptySearch = errors.New("empty search query")
+
+// SearchFilter describes a full-text search and the filters applied to its results.
+// Empty or zero fields are not filtered on. From is inclusive and To exclusive.
+type SearchFilter struct {
+	Query    string
+	Category string
+	Author   string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+// SearchStore runs full-text searches over posts and comments.
+type SearchStore struct {
+	db       *sql.DB
+	imageURL ImageURLFunc
+}
+
+// NewSearchStore returns a SearchStore backed by db.
+func NewSearchStore(db *sql.DB) *SearchStore {
+	return &SearchStore{db: db, imageURL: fileNameURL}
+}
+
+// SetImageURL sets how the files of post images in search results are turned into URLs.
+func (s *SearchStore) SetImageURL(imageURL ImageURLFunc) {
+	s.imageURL = imageURL
+}
+
+// Posts returns the posts matching f, best match first, together with their categories.
+// A post matches if its title, its body or any of its comments contains every term of the query;
+// the last term also matches as a prefix so results show up while the user is still typing.
+func (s *SearchStore) Posts(f SearchFilter) ([]SearchResult, error) {
+	match := matchExpression(f.Query)
+	if match == "" {
+		return nil, ErrEmptySearch
+	}
+	if f.Limit <= 0 {
+		f.Limit = DefaultPageSize
+	}
+	if f.Limit > MaxPageSize {
+		f.Limit = MaxPageSize
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+
+	filters := ""
+	args := []interface{}{match, match}
+	if f.Category != "" {
+		filters += searchCategoryFilter
+		args = append(args, f.Category)
+	}
+	if f.Author != "" {
+		filters += searchAuthorFilter
+		args = append(args, f.Author)
+	}
+	if !f.From.IsZero() {
+		filters += searchFromFilter
+		args = append(args, f.From.UTC().Format(searchDateLayout))
+	}
+	if !f.To.IsZero() {
+		filters += searchToFilter
+		args = append(args, f.To.UTC().Format(searchDateLayout))
+	}
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := s.db.Query(fmt.Sprintf(searchPostsQuery, filters), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching posts: %v", err)
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		if err := rows.Scan(
+			&result.PostID, &result.UserID, &result.PostDate, &result.Title, &result.Content,
+			&result.ContentHTML, &result.EditedAt, &result.Username, &result.Likes, &result.Dislikes,
+			&result.CmtCount, &result.Locked, &result.Pinned, &result.Snippet,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning search result: %v", err)
+		}
+		result.Snippet = highlight(result.Snippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating search results: %v", err)
+	}
+	rows.Close()
+
+	postIDs := make([]int, len(results))
+	for i := range results {
+		postIDs[i] = results[i].PostID
+	}
+	categories, err := postCategories(s.db, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	images, err := postImages(s.db, postIDs, s.imageURL)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Categories = categories[results[i].PostID]
+		results[i].setImages(images[results[i].PostID])
+	}
+	return results, nil
+}
+
+// matchExpression turns free text typed by a user into an FTS5 query.
+// Every term is quoted, so characters such as '-', ':' or '*' are searched for literally instead
+// of being parsed as FTS5 operators, and the last term is made a prefix match.
+func matchExpression(query string) string {
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	if len(terms) > 0 {
+		terms[len(terms)-1] += "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// highlight HTML-escapes a snippet and replaces the match markers with <mark> tags.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, "\x02", "<mark>")
+	return strings.ReplaceAll(snippet, "\x03", "</mark>")
+}
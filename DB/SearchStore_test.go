@@ -0,0 +1,29 @@
+package DB
+
+import "testing"
+
+func TestSearchSkipsHeldComments(t *testing.T) {
+	db, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+	postID := createTestPost(t, db, alice, "post")
+	commentID, err := s.Comments.Create(postID, alice, "a comment about zeppelins", nil)
+	if err != nil {
+		t.Fatalf("creating comment: %v", err)
+	}
+
+	for _, step := range []struct {
+		held bool
+		want int
+	}{{false, 1}, {true, 0}} {
+		if _, err := db.Exec(`UPDATE Comment SET HeldForReview = ? WHERE CommentID = ?`, step.held, commentID); err != nil {
+			t.Fatalf("setting HeldForReview: %v", err)
+		}
+		results, err := s.Search.Posts(SearchFilter{Query: "zeppelins"})
+		if err != nil {
+			t.Fatalf("Posts: %v", err)
+		}
+		if len(results) != step.want {
+			t.Errorf("held = %v: %d results, want %d", step.held, len(results), step.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package DB
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	insertSessionQuery       = `INSERT INTO Session (session_id, user_id, created_at, last_seen, expiry_date, ip_address, user_agent, csrf_token) VALUES (?,?,?,?,?,?,?,?)`
+	selectCSRFTokenQuery     = `SELECT csrf_token, expiry_date FROM Session WHERE session_id = ?`
+	updateCSRFTokenQuery     = `UPDATE Session SET csrf_token = ? WHERE session_id = ? AND csrf_token IS NULL`
+	selectSessionQuery       = `SELECT user_id, expiry_date FROM Session WHERE session_id = ?`
+	sessionColumns           = `session_id, user_id, created_at, last_seen, expiry_date, COALESCE(ip_address, ''), COALESCE(user_agent, ''), rotate`
+	selectFullSessionQuery   = `SELECT ` + sessionColumns + ` FROM Session WHERE session_id = ?`
+	selectUserSessionsQuery  = `SELECT ` + sessionColumns + ` FROM Session WHERE user_id = ? ORDER BY last_seen DESC`
+	selectSessionOriginQuery = `SELECT user_id, ip_address, user_agent, csrf_token FROM Session WHERE session_id = ?`
+	deleteSessionQuery       = `DELETE FROM Session WHERE session_id = ?`
+	deleteUserSessionsQuery  = `DELETE FROM Session WHERE user_id = ?`
+	deleteOtherSessionsQuery = `DELETE FROM Session WHERE user_id = ? AND session_id != ?`
+	renewSessionQuery        = `UPDATE Session SET expiry_date = ?, last_seen = ? WHERE session_id = ?`
+	touchSessionQuery        = `UPDATE Session SET last_seen = ? WHERE session_id = ?`
+	markRotationQuery        = `UPDATE Session SET rotate = TRUE WHERE user_id = ?`
+	purgeSessionsQuery       = `DELETE FROM Session WHERE julianday(expiry_date) < julianday('now')`
+)
+
+// SessionStore reads and writes login sessions.
+type SessionStore struct {
+	db *sql.DB
+}
+
+// NewSessionStore returns a SessionStore backed by db.
+func NewSessionStore(db *sql.DB) *SessionStore {
+	return &SessionStore{db: db}
+}
+
+// Create stores a new session for userID that expires at expiry, together with a fresh CSRF token.
+// ipAddr and userAgent describe the client that logged in and are shown in the session list.
+func (s *SessionStore) Create(sessionID string, userID int, expiry time.Time, ipAddr, userAgent string) error {
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	_, err = s.db.Exec(insertSessionQuery, sessionID, userID, now, now, expiry.UTC(), ipAddr, userAgent, csrfToken)
+	return err
+}
+
+// Get returns the whole session row, or sql.ErrNoRows if it does not exist. It does not check the expiry.
+func (s *SessionStore) Get(sessionID string) (Session, error) {
+	return scanSession(s.db.QueryRow(selectFullSessionQuery, sessionID))
+}
+
+// ListForUser returns the unexpired sessions of userID, most recently used first.
+func (s *SessionStore) ListForUser(userID int) ([]Session, error) {
+	rows, err := s.db.Query(selectUserSessionsQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sessions: %v", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := []Session{}
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning sessions: %v", err)
+		}
+		if now.After(sess.Expiry) {
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteByHandle removes the session of userID identified by handle (see Session.Handle).
+// It returns the ID of the removed session, or sql.ErrNoRows if userID has no such session.
+func (s *SessionStore) DeleteByHandle(userID int, handle string) (string, error) {
+	sessions, err := s.ListForUser(userID)
+	if err != nil {
+		return "", err
+	}
+	for _, sess := range sessions {
+		if subtle.ConstantTimeCompare([]byte(sess.Handle()), []byte(handle)) == 1 {
+			return sess.ID, s.Delete(sess.ID)
+		}
+	}
+	return "", sql.ErrNoRows
+}
+
+// DeleteOthers removes every session of userID except keepSessionID and returns how many were removed.
+func (s *SessionStore) DeleteOthers(userID int, keepSessionID string) (int64, error) {
+	result, err := s.db.Exec(deleteOtherSessionsQuery, userID, keepSessionID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting sessions: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// Rotate replaces sessionID with a new random ID that expires at expiry and returns the new ID.
+// The old ID stops working immediately. The CSRF token carries over, so pages that are already
+// open keep working; logging in always starts a brand new session with a token of its own.
+func (s *SessionStore) Rotate(sessionID string, expiry time.Time) (string, error) {
+	newID, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var ipAddr, userAgent, csrfToken sql.NullString
+	if err := tx.QueryRow(selectSessionOriginQuery, sessionID).Scan(&userID, &ipAddr, &userAgent, &csrfToken); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	if _, err := tx.Exec(insertSessionQuery, newID, userID, now, now, expiry.UTC(), ipAddr, userAgent, csrfToken); err != nil {
+		return "", fmt.Errorf("error inserting rotated session: %v", err)
+	}
+	if _, err := tx.Exec(deleteSessionQuery, sessionID); err != nil {
+		return "", fmt.Errorf("error deleting old session: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("error committing transaction: %v", err)
+	}
+	return newID, nil
+}
+
+// Renew moves the expiry of sessionID to expiry and marks it as seen now.
+func (s *SessionStore) Renew(sessionID string, expiry time.Time) error {
+	_, err := s.db.Exec(renewSessionQuery, expiry.UTC(), time.Now().UTC(), sessionID)
+	return err
+}
+
+// Touch marks sessionID as seen now.
+func (s *SessionStore) Touch(sessionID string) error {
+	_, err := s.db.Exec(touchSessionQuery, time.Now().UTC(), sessionID)
+	return err
+}
+
+// MarkForRotation flags every session of userID so its ID is replaced on its next request.
+// It is used when the user's privilege changes.
+func (s *SessionStore) MarkForRotation(userID int) error {
+	_, err := s.db.Exec(markRotationQuery, userID)
+	return err
+}
+
+// PurgeExpired deletes every expired session and returns how many were removed.
+func (s *SessionStore) PurgeExpired() (int64, error) {
+	result, err := s.db.Exec(purgeSessionsQuery)
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired sessions: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// CSRFToken returns the CSRF token of an unexpired session, or sql.ErrNoRows if there is none.
+// Sessions that predate CSRF tokens are given one on the spot.
+func (s *SessionStore) CSRFToken(sessionID string) (string, error) {
+	var token sql.NullString
+	var expiry time.Time
+	if err := s.db.QueryRow(selectCSRFTokenQuery, sessionID).Scan(&token, &expiry); err != nil {
+		return "", err
+	}
+	if time.Now().After(expiry) {
+		return "", sql.ErrNoRows
+	}
+	if token.Valid {
+		return token.String, nil
+	}
+
+	newToken, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.db.Exec(updateCSRFTokenQuery, newToken, sessionID); err != nil {
+		return "", fmt.Errorf("error storing CSRF token: %v", err)
+	}
+	// Read it back in case a concurrent request stored a different token first.
+	if err := s.db.QueryRow(selectCSRFTokenQuery, sessionID).Scan(&token, &expiry); err != nil {
+		return "", err
+	}
+	return token.String, nil
+}
+
+// Lookup returns the user of an unexpired session, or sql.ErrNoRows if there is none.
+func (s *SessionStore) Lookup(sessionID string) (int, error) {
+	var userID int
+	var expiry time.Time
+	if err := s.db.QueryRow(selectSessionQuery, sessionID).Scan(&userID, &expiry); err != nil {
+		return 0, err
+	}
+	if time.Now().After(expiry) {
+		return 0, sql.ErrNoRows
+	}
+	return userID, nil
+}
+
+// Delete removes a single session.
+func (s *SessionStore) Delete(sessionID string) error {
+	_, err := s.db.Exec(deleteSessionQuery, sessionID)
+	return err
+}
+
+// DeleteForUser removes every session belonging to userID.
+func (s *SessionStore) DeleteForUser(userID int) error {
+	_, err := s.db.Exec(deleteUserSessionsQuery, userID)
+	return err
+}
+
+// newCSRFToken returns 32 random bytes encoded for use in a header.
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating CSRF token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// newSessionID returns a random UUID, the same format utils.GenerateSessionToken uses.
+func newSessionID() (string, error) {
+	u, err := uuid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("error generating session ID: %v", err)
+	}
+	return u.String(), nil
+}
+
+// SessionHandle derives the public handle of a session from its ID: a truncated SHA-256 digest,
+// stable for the life of the session and useless for logging in.
+func SessionHandle(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// scanSession reads one row selected with sessionColumns.
+func scanSession(row interface{ Scan(...any) error }) (Session, error) {
+	var sess Session
+	err := row.Scan(
+		&sess.ID, &sess.UserID, &sess.CreatedAt, &sess.LastSeen, &sess.Expiry, &sess.IPAddress, &sess.UserAgent, &sess.Rotate,
+	)
+	return sess, err
+}
@@ -0,0 +1,78 @@
+package DB
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSessionRotate(t *testing.T) {
+	_, s := openTestStore(t)
+	userID := createTestUser(t, s, "alice")
+
+	if err := s.Sessions.Create("old-session", userID, time.Now().Add(time.Hour), "192.0.2.1", "test agent"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	token, err := s.Sessions.CSRFToken("old-session")
+	if err != nil {
+		t.Fatalf("CSRFToken: %v", err)
+	}
+
+	expiry := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	newID, err := s.Sessions.Rotate("old-session", expiry)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if newID == "" || newID == "old-session" {
+		t.Fatalf("Rotate returned ID %q", newID)
+	}
+
+	if _, err := s.Sessions.Get("old-session"); err != sql.ErrNoRows {
+		t.Errorf("old session still there after rotation, err %v", err)
+	}
+	sess, err := s.Sessions.Get(newID)
+	if err != nil {
+		t.Fatalf("Get(new session): %v", err)
+	}
+	if sess.UserID != userID || sess.IPAddress != "192.0.2.1" || sess.UserAgent != "test agent" {
+		t.Errorf("rotated session is %+v, want user %d from 192.0.2.1 with test agent", sess, userID)
+	}
+	if !sess.Expiry.Equal(expiry) {
+		t.Errorf("rotated session expires at %v, want %v", sess.Expiry, expiry)
+	}
+	if got, err := s.Sessions.CSRFToken(newID); err != nil || got != token {
+		t.Errorf("rotated session has CSRF token %q, err %v; want %q", got, err, token)
+	}
+}
+
+func TestSessionRotateUnknown(t *testing.T) {
+	_, s := openTestStore(t)
+
+	if _, err := s.Sessions.Rotate("no-such-session", time.Now().Add(time.Hour)); err != sql.ErrNoRows {
+		t.Errorf("Rotate of an unknown session returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestSessionLookupRefusesExpired(t *testing.T) {
+	_, s := openTestStore(t)
+	userID := createTestUser(t, s, "alice")
+
+	if err := s.Sessions.Create("live", userID, time.Now().Add(time.Hour), "", ""); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := s.Sessions.Create("expired", userID, time.Now().Add(-time.Minute), "", ""); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if got, err := s.Sessions.Lookup("live"); err != nil || got != userID {
+		t.Errorf("Lookup(live) = %d, %v; want %d", got, err, userID)
+	}
+	for _, id := range []string{"expired", "unknown"} {
+		if _, err := s.Sessions.Lookup(id); err != sql.ErrNoRows {
+			t.Errorf("Lookup(%s) returned %v, want sql.ErrNoRows", id, err)
+		}
+		if _, err := s.Sessions.CSRFToken(id); err != sql.ErrNoRows {
+			t.Errorf("CSRFToken(%s) returned %v, want sql.ErrNoRows", id, err)
+		}
+	}
+}
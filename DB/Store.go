@@ -0,0 +1,76 @@
+package DB
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// StoreConfig holds the settings used to open the shared database handle.
+type StoreConfig struct {
+	Path            string
+	BusyTimeout     time.Duration
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultStoreConfig returns the settings the forum runs with when nothing is overridden.
+func DefaultStoreConfig() StoreConfig {
+	return StoreConfig{
+		Path:            "./meow.db",
+		BusyTimeout:     5 * time.Second,
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: time.Hour,
+	}
+}
+
+// memoryStores counts the in-memory databases opened so far, so each one gets a name of its own.
+var memoryStores atomic.Int64
+
+// OpenStore opens the long-lived, pooled SQLite handle shared by the whole server.
+// Every connection in the pool is opened in WAL mode with foreign keys enforced and
+// a busy timeout, so concurrent writers wait instead of failing with "database is locked".
+// The caller owns the returned handle and is responsible for closing it on shutdown.
+func OpenStore(cfg StoreConfig) (*sql.DB, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("database path is empty")
+	}
+
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_foreign_keys", "on")
+	params.Set("_busy_timeout", fmt.Sprint(cfg.BusyTimeout.Milliseconds()))
+	params.Set("_txlock", "immediate")
+
+	// ":memory:" gives every pooled connection of the handle the same private in-memory database,
+	// which is handy for exercising the stores without touching meow.db. Each handle gets a fresh
+	// database, which lives as long as one of its connections stays open, so keep MaxIdleConns above 0.
+	path := cfg.Path
+	if path == ":memory:" {
+		path = fmt.Sprintf("forum-%d", memoryStores.Add(1))
+		params.Set("mode", "memory")
+		params.Set("cache", "shared")
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to the database: %v", err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,85 @@
+package DB
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Every test migrates a database of its own; the progress lines only bury the failures.
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// openTestStore opens a fresh, fully migrated in-memory database that is closed when the test
+// ends. Search needs FTS5, so the test is skipped unless it is built with -tags sqlite_fts5.
+func openTestStore(t *testing.T) (*sql.DB, *Stores) {
+	t.Helper()
+
+	cfg := DefaultStoreConfig()
+	cfg.Path = ":memory:"
+	db, err := OpenStore(cfg)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := MigrateUp(db, 0); err == ErrNoFTS5 {
+		t.Skip("SQLite lacks FTS5; run the tests with -tags sqlite_fts5")
+	} else if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	return db, NewStores(db)
+}
+
+// createTestUser registers a user called username and returns their ID.
+func createTestUser(t *testing.T, s *Stores, username string) int {
+	t.Helper()
+
+	userID, err := s.Users.Create(NewUser{
+		Username:     username,
+		FirstName:    username,
+		LastName:     "Test",
+		Email:        username + "@example.com",
+		PasswordHash: "not a hash",
+		Gender:       "F",
+	})
+	if err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return userID
+}
+
+// createTestPost publishes a post of userID and returns its ID.
+func createTestPost(t *testing.T, db *sql.DB, userID int, title string) int {
+	t.Helper()
+
+	if err := InsertPost(db, title, "Content of "+title, nil, nil, userID, nil); err != nil {
+		t.Fatalf("creating post %q: %v", title, err)
+	}
+	var postID int
+	if err := db.QueryRow(`SELECT MAX(PostID) FROM Post`).Scan(&postID); err != nil {
+		t.Fatalf("getting post ID: %v", err)
+	}
+	return postID
+}
+
+func TestOpenStoreMemoryIsPrivate(t *testing.T) {
+	db, s := openTestStore(t)
+	createTestUser(t, s, "alice")
+
+	other, _ := openTestStore(t)
+	var count int
+	if err := other.QueryRow(`SELECT COUNT(*) FROM User WHERE username = 'alice'`).Scan(&count); err != nil {
+		t.Fatalf("counting users: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("second in-memory store sees %d users of the first", count)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM User WHERE username = 'alice'`).Scan(&count); err != nil || count != 1 {
+		t.Errorf("first store has %d users called alice, err %v; want 1", count, err)
+	}
+}
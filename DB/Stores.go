@@ -0,0 +1,85 @@
+package DB
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Stores bundles the typed repositories built on top of the shared database handle.
+// Handlers go through these instead of writing SQL themselves.
+type Stores struct {
+	Posts              *PostStore
+	Comments           *CommentStore
+	Reactions          *ReactionStore
+	Users              *UserStore
+	Sessions           *SessionStore
+	Search             *SearchStore
+	Tokens             *TokenStore
+	TwoFactor          *TwoFactorStore
+	Identities         *IdentityStore
+	Reports            *ReportStore
+	Audit              *AuditStore
+	Sanctions          *SanctionStore
+	Filter             *FilterStore
+	Categories         *CategoryStore
+	Notifications      *NotificationStore
+	ModerationRequests *ModerationRequestStore
+}
+
+// NewStores builds every repository around the same database handle.
+func NewStores(db *sql.DB) *Stores {
+	return &Stores{
+		Posts:              NewPostStore(db),
+		Comments:           NewCommentStore(db),
+		Reactions:          NewReactionStore(db),
+		Users:              NewUserStore(db),
+		Sessions:           NewSessionStore(db),
+		Search:             NewSearchStore(db),
+		Tokens:             NewTokenStore(db),
+		TwoFactor:          NewTwoFactorStore(db),
+		Identities:         NewIdentityStore(db),
+		Reports:            NewReportStore(db),
+		Audit:              NewAuditStore(db),
+		Sanctions:          NewSanctionStore(db),
+		Filter:             NewFilterStore(db),
+		Categories:         NewCategoryStore(db),
+		Notifications:      NewNotificationStore(db),
+		ModerationRequests: NewModerationRequestStore(db),
+	}
+}
+
+// SetImageURL sets how every store turns the files of post images into URLs.
+func (s *Stores) SetImageURL(imageURL ImageURLFunc) {
+	s.Posts.SetImageURL(imageURL)
+	s.Search.SetImageURL(imageURL)
+}
+
+// RunJanitor purges expired sessions, spent account tokens and stale login challenges every interval.
+// It never returns, so run it in its own goroutine.
+func (s *Stores) RunJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	jobs := []struct {
+		name  string
+		purge func() (int64, error)
+	}{
+		{"session(s)", s.Sessions.PurgeExpired},
+		{"account token(s)", s.Tokens.PurgeExpired},
+		{"login challenge(s)", s.TwoFactor.PurgeExpired},
+	}
+
+	for range ticker.C {
+		for _, job := range jobs {
+			purged, err := job.purge()
+			if err != nil {
+				log.Printf("janitor: %v\n", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("janitor: purged %d expired %s\n", purged, job.name)
+			}
+		}
+	}
+}
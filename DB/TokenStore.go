@@ -0,0 +1,131 @@
+package DB
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Purposes an account token can be issued for.
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+const (
+	deleteUserTokensQuery = `DELETE FROM AccountToken WHERE UserID = ? AND Purpose = ? AND UsedAt IS NULL`
+	insertTokenQuery      = `INSERT INTO AccountToken (TokenHash, UserID, Purpose, ExpiresAt) VALUES (?,?,?,?)`
+	// consumeTokenQuery marks a token as used and returns its user in one statement, so two
+	// requests racing with the same token cannot both succeed.
+	consumeTokenQuery = `
+        UPDATE AccountToken
+        SET UsedAt = ?
+        WHERE TokenHash = ? AND Purpose = ? AND UsedAt IS NULL AND julianday(ExpiresAt) > julianday('now')
+        RETURNING UserID
+    `
+	purgeTokensQuery = `DELETE FROM AccountToken WHERE UsedAt IS NOT NULL OR julianday(ExpiresAt) < julianday('now')`
+)
+
+// ErrInvalidToken is returned when a token does not exist, has expired, has already been used,
+// or was issued for a different purpose.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// TokenStore issues and redeems the single-use tokens emailed for password resets and email verification.
+type TokenStore struct {
+	db *sql.DB
+}
+
+// NewTokenStore returns a TokenStore backed by db.
+func NewTokenStore(db *sql.DB) *TokenStore {
+	return &TokenStore{db: db}
+}
+
+// Issue creates a token for purpose that userID can redeem within ttl and returns it.
+// Any earlier unused token of userID for the same purpose stops working, so only the latest
+// email a user received is valid.
+func (s *TokenStore) Issue(userID int, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(deleteUserTokensQuery, userID, purpose); err != nil {
+		return "", fmt.Errorf("error deleting previous tokens: %v", err)
+	}
+	if _, err := tx.Exec(insertTokenQuery, hashToken(token), userID, purpose, time.Now().Add(ttl).UTC()); err != nil {
+		return "", fmt.Errorf("error inserting token: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("error committing transaction: %v", err)
+	}
+	return token, nil
+}
+
+// Consume redeems token for purpose and returns the user it was issued to.
+// A token can only be consumed once; it returns ErrInvalidToken for anything but a live token.
+func (s *TokenStore) Consume(token, purpose string) (int, error) {
+	return consumedUser(s.db.QueryRow(consumeTokenQuery, time.Now().UTC(), hashToken(token), purpose))
+}
+
+// ResetPassword redeems a TokenPasswordReset token and sets the bcrypt password hash of the user
+// it was issued to, in one transaction, and returns the user. The token stays live if the
+// password cannot be changed. It returns ErrInvalidToken for anything but a live token.
+func (s *TokenStore) ResetPassword(token, passwordHash string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	userID, err := consumedUser(tx.QueryRow(consumeTokenQuery, time.Now().UTC(), hashToken(token), TokenPasswordReset))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(updatePasswordQuery, passwordHash, userID); err != nil {
+		return 0, fmt.Errorf("error updating password: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return userID, nil
+}
+
+// consumedUser reads the user returned by consumeTokenQuery.
+func consumedUser(row *sql.Row) (int, error) {
+	var userID int
+	err := row.Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	} else if err != nil {
+		return 0, fmt.Errorf("error consuming token: %v", err)
+	}
+	return userID, nil
+}
+
+// PurgeExpired deletes used and expired tokens and returns how many were removed.
+func (s *TokenStore) PurgeExpired() (int64, error) {
+	result, err := s.db.Exec(purgeTokensQuery)
+	if err != nil {
+		return 0, fmt.Errorf("error purging tokens: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// hashToken returns the digest a token is stored under.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
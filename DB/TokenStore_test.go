@@ -0,0 +1,98 @@
+package DB
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenSingleUse(t *testing.T) {
+	_, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+
+	token, err := s.Tokens.Issue(alice, TokenEmailVerification, time.Hour)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	// a token only works for the purpose it was issued for
+	if _, err := s.Tokens.Consume(token, TokenPasswordReset); err != ErrInvalidToken {
+		t.Errorf("Consume for another purpose: err = %v, want ErrInvalidToken", err)
+	}
+	if userID, err := s.Tokens.Consume(token, TokenEmailVerification); err != nil || userID != alice {
+		t.Fatalf("Consume = %d, %v; want %d", userID, err, alice)
+	}
+	if _, err := s.Tokens.Consume(token, TokenEmailVerification); err != ErrInvalidToken {
+		t.Errorf("second Consume: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := s.Tokens.Consume("made up", TokenEmailVerification); err != ErrInvalidToken {
+		t.Errorf("Consume of an unknown token: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestTokenExpiryAndReissue(t *testing.T) {
+	_, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+
+	expired, err := s.Tokens.Issue(alice, TokenPasswordReset, -time.Minute)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := s.Tokens.Consume(expired, TokenPasswordReset); err != ErrInvalidToken {
+		t.Errorf("Consume of an expired token: err = %v, want ErrInvalidToken", err)
+	}
+
+	// only the latest token issued for a purpose works
+	first, err := s.Tokens.Issue(alice, TokenPasswordReset, time.Hour)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	second, err := s.Tokens.Issue(alice, TokenPasswordReset, time.Hour)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := s.Tokens.Consume(first, TokenPasswordReset); err != ErrInvalidToken {
+		t.Errorf("Consume of a replaced token: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := s.Tokens.Consume(second, TokenPasswordReset); err != nil {
+		t.Errorf("Consume of the latest token: %v", err)
+	}
+
+	// the used token is purged, and so is an expired one
+	if _, err := s.Tokens.Issue(alice, TokenEmailVerification, -time.Minute); err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if purged, err := s.Tokens.PurgeExpired(); err != nil || purged != 2 {
+		t.Errorf("PurgeExpired = %d, %v; want 2", purged, err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	_, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+
+	token, err := s.Tokens.Issue(alice, TokenPasswordReset, time.Hour)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if userID, err := s.Tokens.ResetPassword(token, "new hash"); err != nil || userID != alice {
+		t.Fatalf("ResetPassword = %d, %v; want %d", userID, err, alice)
+	}
+	if hash, err := s.Users.PasswordHash(alice); err != nil || hash != "new hash" {
+		t.Errorf("PasswordHash = %q, %v; want the new hash", hash, err)
+	}
+
+	if _, err := s.Tokens.ResetPassword(token, "other hash"); err != ErrInvalidToken {
+		t.Errorf("second ResetPassword: err = %v, want ErrInvalidToken", err)
+	}
+	if hash, _ := s.Users.PasswordHash(alice); hash != "new hash" {
+		t.Errorf("a spent token changed the password to %q", hash)
+	}
+
+	// a verification token cannot reset a password
+	verification, err := s.Tokens.Issue(alice, TokenEmailVerification, time.Hour)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := s.Tokens.ResetPassword(verification, "other hash"); err != ErrInvalidToken {
+		t.Errorf("ResetPassword with a verification token: err = %v, want ErrInvalidToken", err)
+	}
+}
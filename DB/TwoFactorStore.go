@@ -0,0 +1,256 @@
+package DB
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxChallengeAttempts is how many wrong codes a login challenge accepts before it is thrown away
+// and the user has to enter their password again.
+const MaxChallengeAttempts = 5
+
+const (
+	selectTwoFactorQuery = `SELECT UserID, Secret, Enabled, LastUsedStep FROM TwoFactor WHERE UserID = ?`
+	// upsertPendingSecretQuery starts (or restarts) an enrollment, but never touches a confirmed one.
+	upsertPendingSecretQuery = `
+        INSERT INTO TwoFactor (UserID, Secret, Enabled, LastUsedStep) VALUES (?, ?, FALSE, 0)
+        ON CONFLICT(UserID) DO UPDATE SET Secret = excluded.Secret, LastUsedStep = 0 WHERE Enabled = FALSE
+    `
+	enableTwoFactorQuery      = `UPDATE TwoFactor SET Enabled = TRUE, LastUsedStep = ? WHERE UserID = ? AND Enabled = FALSE`
+	useStepQuery              = `UPDATE TwoFactor SET LastUsedStep = ? WHERE UserID = ? AND LastUsedStep < ?`
+	deleteTwoFactorQuery      = `DELETE FROM TwoFactor WHERE UserID = ?`
+	deleteRecoveryQuery       = `DELETE FROM RecoveryCode WHERE UserID = ?`
+	insertRecoveryQuery       = `INSERT INTO RecoveryCode (UserID, CodeHash) VALUES (?, ?)`
+	useRecoveryQuery          = `UPDATE RecoveryCode SET UsedAt = ? WHERE UserID = ? AND CodeHash = ? AND UsedAt IS NULL`
+	countRecoveryQuery        = `SELECT COUNT(*) FROM RecoveryCode WHERE UserID = ? AND UsedAt IS NULL`
+	insertChallengeQuery      = `INSERT INTO LoginChallenge (ChallengeHash, UserID, ExpiresAt) VALUES (?,?,?)`
+	selectChallengeQuery      = `SELECT UserID, ExpiresAt, Attempts FROM LoginChallenge WHERE ChallengeHash = ?`
+	failChallengeQuery        = `UPDATE LoginChallenge SET Attempts = Attempts + 1 WHERE ChallengeHash = ?`
+	deleteChallengeQuery      = `DELETE FROM LoginChallenge WHERE ChallengeHash = ?`
+	purgeChallengesQuery      = `DELETE FROM LoginChallenge WHERE julianday(ExpiresAt) < julianday('now') OR Attempts >= ?`
+	deleteUserChallengesQuery = `DELETE FROM LoginChallenge WHERE UserID = ?`
+)
+
+// ErrInvalidChallenge is returned for a login challenge that does not exist, has expired, or has
+// run out of attempts.
+var ErrInvalidChallenge = errors.New("invalid or expired login challenge")
+
+// TwoFactor is a user's TOTP enrollment. Secret is base32 encoded.
+// Enabled is false while the enrollment waits to be confirmed with a first code.
+type TwoFactor struct {
+	UserID       int
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+// TwoFactorStore reads and writes TOTP enrollments, recovery codes and pending login challenges.
+type TwoFactorStore struct {
+	db *sql.DB
+}
+
+// NewTwoFactorStore returns a TwoFactorStore backed by db.
+func NewTwoFactorStore(db *sql.DB) *TwoFactorStore {
+	return &TwoFactorStore{db: db}
+}
+
+// Get returns the enrollment of userID, or sql.ErrNoRows if the user never started one.
+func (s *TwoFactorStore) Get(userID int) (TwoFactor, error) {
+	var tf TwoFactor
+	err := s.db.QueryRow(selectTwoFactorQuery, userID).Scan(&tf.UserID, &tf.Secret, &tf.Enabled, &tf.LastUsedStep)
+	return tf, err
+}
+
+// Enabled reports whether userID has confirmed a TOTP enrollment.
+func (s *TwoFactorStore) Enabled(userID int) (bool, error) {
+	tf, err := s.Get(userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return tf.Enabled, nil
+}
+
+// SetPendingSecret starts an enrollment for userID with secret, replacing any unconfirmed one.
+// A confirmed enrollment is left alone.
+func (s *TwoFactorStore) SetPendingSecret(userID int, secret string) error {
+	if _, err := s.db.Exec(upsertPendingSecretQuery, userID, secret); err != nil {
+		return fmt.Errorf("error storing two-factor secret: %v", err)
+	}
+	return nil
+}
+
+// Enable confirms the pending enrollment of userID with the code of time step step, and stores
+// the hashes of its recovery codes. It returns sql.ErrNoRows if there is no pending enrollment.
+func (s *TwoFactorStore) Enable(userID int, step int64, recoveryHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(enableTwoFactorQuery, step, userID)
+	if err != nil {
+		return fmt.Errorf("error enabling two-factor authentication: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error checking rows affected: %v", err)
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := replaceRecoveryCodes(tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// UseStep records that userID logged in with the code of time step step. It reports false if a
+// code of that step or a later one was already used, which makes every code single-use.
+func (s *TwoFactorStore) UseStep(userID int, step int64) (bool, error) {
+	result, err := s.db.Exec(useStepQuery, step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error recording two-factor code: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %v", err)
+	}
+	return n == 1, nil
+}
+
+// UseRecoveryCode spends the unused recovery code of userID with hash codeHash.
+// It reports false if there is no such unused code.
+func (s *TwoFactorStore) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	result, err := s.db.Exec(useRecoveryQuery, time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking rows affected: %v", err)
+	}
+	return n == 1, nil
+}
+
+// ReplaceRecoveryCodes throws away every recovery code of userID and stores the given hashes instead.
+func (s *TwoFactorStore) ReplaceRecoveryCodes(userID int, recoveryHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes userID has.
+func (s *TwoFactorStore) RecoveryCodesLeft(userID int) (int, error) {
+	var n int
+	err := s.db.QueryRow(countRecoveryQuery, userID).Scan(&n)
+	return n, err
+}
+
+// Disable removes the enrollment and recovery codes of userID.
+func (s *TwoFactorStore) Disable(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(deleteRecoveryQuery, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %v", err)
+	}
+	if _, err := tx.Exec(deleteTwoFactorQuery, userID); err != nil {
+		return fmt.Errorf("error disabling two-factor authentication: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// CreateChallenge records that userID passed the first login step and returns the token that lets
+// them finish the second one within ttl. Earlier challenges of the user are dropped.
+func (s *TwoFactorStore) CreateChallenge(userID int, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating login challenge: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if _, err := s.db.Exec(deleteUserChallengesQuery, userID); err != nil {
+		return "", fmt.Errorf("error deleting previous login challenges: %v", err)
+	}
+	if _, err := s.db.Exec(insertChallengeQuery, hashToken(token), userID, time.Now().Add(ttl).UTC()); err != nil {
+		return "", fmt.Errorf("error inserting login challenge: %v", err)
+	}
+	return token, nil
+}
+
+// Challenge returns the user a live login challenge belongs to, or ErrInvalidChallenge.
+func (s *TwoFactorStore) Challenge(token string) (int, error) {
+	var userID, attempts int
+	var expiry time.Time
+	err := s.db.QueryRow(selectChallengeQuery, hashToken(token)).Scan(&userID, &expiry, &attempts)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidChallenge
+	} else if err != nil {
+		return 0, fmt.Errorf("error querying login challenge: %v", err)
+	}
+	if time.Now().After(expiry) || attempts >= MaxChallengeAttempts {
+		return 0, ErrInvalidChallenge
+	}
+	return userID, nil
+}
+
+// FailChallenge counts a wrong code against a login challenge.
+func (s *TwoFactorStore) FailChallenge(token string) error {
+	_, err := s.db.Exec(failChallengeQuery, hashToken(token))
+	return err
+}
+
+// DeleteChallenge removes a login challenge once it has been completed.
+func (s *TwoFactorStore) DeleteChallenge(token string) error {
+	_, err := s.db.Exec(deleteChallengeQuery, hashToken(token))
+	return err
+}
+
+// PurgeExpired deletes expired and exhausted login challenges and returns how many were removed.
+func (s *TwoFactorStore) PurgeExpired() (int64, error) {
+	result, err := s.db.Exec(purgeChallengesQuery, MaxChallengeAttempts)
+	if err != nil {
+		return 0, fmt.Errorf("error purging login challenges: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// replaceRecoveryCodes swaps the recovery codes of userID inside tx.
+func replaceRecoveryCodes(tx *sql.Tx, userID int, recoveryHashes []string) error {
+	if _, err := tx.Exec(deleteRecoveryQuery, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %v", err)
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.Exec(insertRecoveryQuery, userID, hash); err != nil {
+			return fmt.Errorf("error inserting recovery code: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package DB
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChallengeLockout(t *testing.T) {
+	_, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+
+	token, err := s.TwoFactor.CreateChallenge(alice, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	for i := 1; i < MaxChallengeAttempts; i++ {
+		if err := s.TwoFactor.FailChallenge(token); err != nil {
+			t.Fatalf("FailChallenge: %v", err)
+		}
+		if userID, err := s.TwoFactor.Challenge(token); err != nil || userID != alice {
+			t.Fatalf("Challenge after %d wrong codes = %d, %v; want %d", i, userID, err, alice)
+		}
+	}
+	if err := s.TwoFactor.FailChallenge(token); err != nil {
+		t.Fatalf("FailChallenge: %v", err)
+	}
+	if _, err := s.TwoFactor.Challenge(token); err != ErrInvalidChallenge {
+		t.Errorf("Challenge after %d wrong codes: err = %v, want ErrInvalidChallenge", MaxChallengeAttempts, err)
+	}
+
+	// the exhausted challenge is purged, a live one of another user is not
+	bob := createTestUser(t, s, "bob")
+	live, err := s.TwoFactor.CreateChallenge(bob, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	if n, err := s.TwoFactor.PurgeExpired(); err != nil || n != 1 {
+		t.Errorf("PurgeExpired = %d, %v; want 1", n, err)
+	}
+	if _, err := s.TwoFactor.Challenge(live); err != nil {
+		t.Errorf("Challenge of a live challenge after purge: %v", err)
+	}
+}
+
+func TestChallengeExpiryAndReplacement(t *testing.T) {
+	_, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+
+	expired, err := s.TwoFactor.CreateChallenge(alice, -time.Minute)
+	if err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	if _, err := s.TwoFactor.Challenge(expired); err != ErrInvalidChallenge {
+		t.Errorf("Challenge of an expired challenge: err = %v, want ErrInvalidChallenge", err)
+	}
+
+	// a new login drops the earlier challenge, and a completed one is gone
+	first, err := s.TwoFactor.CreateChallenge(alice, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	second, err := s.TwoFactor.CreateChallenge(alice, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateChallenge: %v", err)
+	}
+	if _, err := s.TwoFactor.Challenge(first); err != ErrInvalidChallenge {
+		t.Errorf("Challenge of a replaced challenge: err = %v, want ErrInvalidChallenge", err)
+	}
+	if err := s.TwoFactor.DeleteChallenge(second); err != nil {
+		t.Fatalf("DeleteChallenge: %v", err)
+	}
+	if _, err := s.TwoFactor.Challenge(second); err != ErrInvalidChallenge {
+		t.Errorf("Challenge of a completed challenge: err = %v, want ErrInvalidChallenge", err)
+	}
+}
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	_, s := openTestStore(t)
+	alice := createTestUser(t, s, "alice")
+
+	if err := s.TwoFactor.SetPendingSecret(alice, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"); err != nil {
+		t.Fatalf("SetPendingSecret: %v", err)
+	}
+	if err := s.TwoFactor.Enable(alice, 1, []string{"hash-a", "hash-b"}); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	if ok, err := s.TwoFactor.UseRecoveryCode(alice, "hash-a"); err != nil || !ok {
+		t.Fatalf("UseRecoveryCode = %v, %v; want true", ok, err)
+	}
+	if ok, _ := s.TwoFactor.UseRecoveryCode(alice, "hash-a"); ok {
+		t.Error("a recovery code was accepted twice")
+	}
+	if n, err := s.TwoFactor.RecoveryCodesLeft(alice); err != nil || n != 1 {
+		t.Errorf("RecoveryCodesLeft = %d, %v; want 1", n, err)
+	}
+
+	// codes of the same step, or earlier ones, are not accepted again
+	if ok, _ := s.TwoFactor.UseStep(alice, 1); ok {
+		t.Error("UseStep accepted the step the enrollment was confirmed with")
+	}
+	if ok, err := s.TwoFactor.UseStep(alice, 2); err != nil || !ok {
+		t.Errorf("UseStep of a later step = %v, %v; want true", ok, err)
+	}
+}
@@ -0,0 +1,227 @@
+package DB
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrLastAdmin is returned when a change of privilege would leave the forum without an admin.
+var ErrLastAdmin = errors.New("cannot demote the last admin")
+
+const (
+	selectCredentialsQuery = `SELECT UserID, password FROM User WHERE username = ? OR email = ?`
+	selectPrivilegeQuery   = `SELECT privilege FROM User WHERE UserID = ?`
+	updatePrivilegeQuery   = `UPDATE User SET privilege = ? WHERE UserID = ?`
+	selectUserByNameQuery  = `SELECT UserID FROM User WHERE username = ?`
+	selectUserByEmailQuery = `SELECT UserID FROM User WHERE email = ?`
+	selectPasswordQuery    = `SELECT password FROM User WHERE UserID = ?`
+	updatePasswordQuery    = `UPDATE User SET password = ? WHERE UserID = ?`
+	selectEmailQuery       = `SELECT email, email_verified FROM User WHERE UserID = ?`
+	verifyEmailQuery       = `UPDATE User SET email_verified = TRUE WHERE UserID = ?`
+	insertUserQuery        = `INSERT INTO User (username, firstname, lastname, email, password, gender) VALUES (?,?,?,?,?,?)`
+	countByPrivilegeQuery  = `SELECT COUNT(*) FROM User WHERE privilege = ?`
+	selectUsersQuery       = `SELECT UserID, username, email, privilege, created_at FROM User ORDER BY privilege DESC, username`
+	searchUsersQuery       = `
+        SELECT UserID, username, email, privilege, created_at FROM User
+        WHERE username LIKE ? OR email LIKE ?
+        ORDER BY privilege DESC, username
+    `
+)
+
+// NewUser holds the fields needed to register an account.
+type NewUser struct {
+	Username     string
+	FirstName    string
+	LastName     string
+	Email        string
+	PasswordHash string
+	Gender       string
+}
+
+// UserSummary is an account as listed to admins.
+type UserSummary struct {
+	UserID    int    `json:"UserID"`
+	Username  string `json:"Username"`
+	Email     string `json:"Email"`
+	Privilege int    `json:"Privilege"`
+	CreatedAt string `json:"CreatedAt"`
+}
+
+// UserStore reads and writes user accounts.
+type UserStore struct {
+	db *sql.DB
+}
+
+// NewUserStore returns a UserStore backed by db.
+func NewUserStore(db *sql.DB) *UserStore {
+	return &UserStore{db: db}
+}
+
+// Credentials looks a user up by username or email and returns their ID and bcrypt password hash.
+// It returns sql.ErrNoRows if no such user exists.
+func (s *UserStore) Credentials(login string) (int, string, error) {
+	var userID int
+	var hash string
+	err := s.db.QueryRow(selectCredentialsQuery, login, login).Scan(&userID, &hash)
+	return userID, hash, err
+}
+
+// PasswordHash returns the bcrypt password hash of userID, or sql.ErrNoRows if the user does not exist.
+func (s *UserStore) PasswordHash(userID int) (string, error) {
+	var hash string
+	err := s.db.QueryRow(selectPasswordQuery, userID).Scan(&hash)
+	return hash, err
+}
+
+// SetPasswordHash replaces the bcrypt password hash of userID.
+func (s *UserStore) SetPasswordHash(userID int, hash string) error {
+	_, err := s.db.Exec(updatePasswordQuery, hash, userID)
+	if err != nil {
+		return fmt.Errorf("error updating password: %v", err)
+	}
+	return nil
+}
+
+// Email returns the email address of userID and whether it has been verified.
+func (s *UserStore) Email(userID int) (string, bool, error) {
+	var email string
+	var verified bool
+	err := s.db.QueryRow(selectEmailQuery, userID).Scan(&email, &verified)
+	return email, verified, err
+}
+
+// MarkEmailVerified records that userID has proven they own their email address.
+func (s *UserStore) MarkEmailVerified(userID int) error {
+	_, err := s.db.Exec(verifyEmailQuery, userID)
+	if err != nil {
+		return fmt.Errorf("error verifying email: %v", err)
+	}
+	return nil
+}
+
+// Username returns the username of userID.
+func (s *UserStore) Username(userID int) (string, error) {
+	var username string
+	err := s.db.QueryRow(SelectUsernameQuery, userID).Scan(&username)
+	return username, err
+}
+
+// Privilege returns the privilege level of userID (1 user, 2 moderator, 3 admin).
+func (s *UserStore) Privilege(userID int) (int, error) {
+	var privilege int
+	err := s.db.QueryRow(selectPrivilegeQuery, userID).Scan(&privilege)
+	return privilege, err
+}
+
+// CountByPrivilege returns how many users have the given privilege level.
+func (s *UserStore) CountByPrivilege(privilege int) (int, error) {
+	var count int
+	if err := s.db.QueryRow(countByPrivilegeQuery, privilege).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting users: %v", err)
+	}
+	return count, nil
+}
+
+// List returns every user whose username or email contains search, or every user if search is
+// empty, with the highest privileges first and then by username.
+func (s *UserStore) List(search string) ([]UserSummary, error) {
+	var rows *sql.Rows
+	var err error
+	if search == "" {
+		rows, err = s.db.Query(selectUsersQuery)
+	} else {
+		pattern := "%" + search + "%"
+		rows, err = s.db.Query(searchUsersQuery, pattern, pattern)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %v", err)
+	}
+	defer rows.Close()
+
+	users := []UserSummary{}
+	for rows.Next() {
+		var u UserSummary
+		if err := rows.Scan(&u.UserID, &u.Username, &u.Email, &u.Privilege, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning user: %v", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetPrivilege changes the privilege level of userID on behalf of adminID and records the
+// promotion or demotion in the audit log, in one transaction. Setting the level a user already
+// has changes nothing. It returns sql.ErrNoRows if the user does not exist, and ErrLastAdmin if
+// they are the only admin and privilege is lower; admins are counted in the same transaction, so
+// two admins demoting each other at once cannot both succeed.
+func (s *UserStore) SetPrivilege(userID, adminID, privilege int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var current int
+	if err := tx.QueryRow(selectPrivilegeQuery, userID).Scan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("error getting user privilege: %v", err)
+	}
+	if current == privilege {
+		return nil
+	}
+	if current == 3 && privilege < 3 {
+		var admins int
+		if err := tx.QueryRow(countByPrivilegeQuery, 3).Scan(&admins); err != nil {
+			return fmt.Errorf("error counting admins: %v", err)
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	if _, err := tx.Exec(updatePrivilegeQuery, privilege, userID); err != nil {
+		return fmt.Errorf("error updating user privilege: %v", err)
+	}
+	action := AuditPromoteUser
+	if privilege < current {
+		action = AuditDemoteUser
+	}
+	details := fmt.Sprintf("privilege %d to %d", current, privilege)
+	if err := RecordAudit(tx, adminID, action, AuditTargetUser, userID, details); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// IDByUsername returns the ID of the user called username, or sql.ErrNoRows.
+func (s *UserStore) IDByUsername(username string) (int, error) {
+	var userID int
+	err := s.db.QueryRow(selectUserByNameQuery, username).Scan(&userID)
+	return userID, err
+}
+
+// IDByEmail returns the ID of the user registered with email, or sql.ErrNoRows.
+func (s *UserStore) IDByEmail(email string) (int, error) {
+	var userID int
+	err := s.db.QueryRow(selectUserByEmailQuery, email).Scan(&userID)
+	return userID, err
+}
+
+// Create registers a new user and returns their ID.
+func (s *UserStore) Create(u NewUser) (int, error) {
+	result, err := s.db.Exec(insertUserQuery, u.Username, u.FirstName, u.LastName, u.Email, u.PasswordHash, u.Gender)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting user: %v", err)
+	}
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting last insert ID: %v", err)
+	}
+	return int(userID), nil
+}
@@ -0,0 +1,83 @@
+package DB
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestUserCountAndList(t *testing.T) {
+	_, s := openTestStore(t)
+	before, err := s.Users.CountByPrivilege(3)
+	if err != nil {
+		t.Fatalf("CountByPrivilege: %v", err)
+	}
+
+	admin := createTestUser(t, s, "zed")
+	createTestUser(t, s, "yvonne")
+	if err := s.Users.SetPrivilege(admin, admin, 3); err != nil {
+		t.Fatalf("SetPrivilege: %v", err)
+	}
+	if after, err := s.Users.CountByPrivilege(3); err != nil || after != before+1 {
+		t.Errorf("CountByPrivilege(3) = %d, %v; want %d", after, err, before+1)
+	}
+
+	users, err := s.Users.List("")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	for i := 1; i < len(users); i++ {
+		prev, cur := users[i-1], users[i]
+		if prev.Privilege < cur.Privilege || prev.Privilege == cur.Privilege && prev.Username > cur.Username {
+			t.Errorf("%s (%d) listed before %s (%d)", prev.Username, prev.Privilege, cur.Username, cur.Privilege)
+		}
+	}
+
+	// the search matches usernames and emails
+	for _, search := range []string{"yvon", "yvonne@example"} {
+		found, err := s.Users.List(search)
+		if err != nil {
+			t.Fatalf("List(%q): %v", search, err)
+		}
+		if len(found) != 1 || found[0].Username != "yvonne" || found[0].Email != "yvonne@example.com" {
+			t.Errorf("List(%q) = %+v, want yvonne", search, found)
+		}
+	}
+	if found, err := s.Users.List("nobody"); err != nil || len(found) != 0 {
+		t.Errorf("List(nobody) = %+v, %v; want none", found, err)
+	}
+}
+
+func TestSetPrivilegeKeepsAnAdmin(t *testing.T) {
+	db, s := openTestStore(t)
+	// start from no admins at all, whatever the migrations seeded
+	if _, err := db.Exec(`UPDATE User SET privilege = 1 WHERE privilege = 3`); err != nil {
+		t.Fatalf("clearing admins: %v", err)
+	}
+	alice := createTestUser(t, s, "alice")
+	bob := createTestUser(t, s, "bob")
+	if err := s.Users.SetPrivilege(alice, alice, 3); err != nil {
+		t.Fatalf("SetPrivilege: %v", err)
+	}
+	if err := s.Users.SetPrivilege(bob, alice, 3); err != nil {
+		t.Fatalf("SetPrivilege: %v", err)
+	}
+
+	if err := s.Users.SetPrivilege(bob, alice, 2); err != nil {
+		t.Fatalf("demoting one of two admins: %v", err)
+	}
+	for _, privilege := range []int{2, 1} {
+		if err := s.Users.SetPrivilege(alice, bob, privilege); err != ErrLastAdmin {
+			t.Errorf("demoting the last admin to %d: err = %v, want ErrLastAdmin", privilege, err)
+		}
+	}
+	if privilege, err := s.Users.Privilege(alice); err != nil || privilege != 3 {
+		t.Errorf("Privilege of the last admin = %d, %v; want 3", privilege, err)
+	}
+	// keeping the last admin an admin is no change at all
+	if err := s.Users.SetPrivilege(alice, alice, 3); err != nil {
+		t.Errorf("SetPrivilege to the same level: %v", err)
+	}
+	if err := s.Users.SetPrivilege(1<<30, alice, 1); err != sql.ErrNoRows {
+		t.Errorf("SetPrivilege of a missing user: err = %v, want sql.ErrNoRows", err)
+	}
+}
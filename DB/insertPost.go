@@ -3,32 +3,35 @@ package DB
 import (
 	"database/sql"
 	"fmt"
+	"forum/markdown"
 )
 
-// InsertPost inserts a new post into the database, including the associated categories.
+// InsertPost inserts a new post into the database, including the associated images and categories.
+// The content is stored both as written, in Markdown, and rendered to HTML.
 // It takes the following parameters:
 // - db: a pointer to an *sql.DB instance representing the database connection
 // - title: the title of the post
 // - content: the content of the post
-// - imagePath: the path to the image associated with the post
+// - images: the gallery of the post, in order; only the file, type, size and alt text fields are used
 // - categories: a slice of strings representing the categories associated with the post
 // - usrID: the ID of the user who created the post
+// - held: the content filter match holding the post for review, or nil to publish it
 // It returns an error if any part of the operation fails.
-func InsertPost(db *sql.DB, title, content, imagePath string, categories []string, usrID int) error {
+func InsertPost(db *sql.DB, title, content string, images []PostImage, categories []string, usrID int, held *FilterMatch) error {
 	tx, err := db.Begin()
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("error starting transaction: %v", err)
 	}
 
-	stmtPost, err := tx.Prepare("INSERT INTO Post (UserID, title, content, ImagePath) VALUES (?,?,?,?)")
+	stmtPost, err := tx.Prepare("INSERT INTO Post (UserID, title, content, content_html) VALUES (?,?,?,?)")
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("error preparing statement: %v", err)
 	}
 	defer stmtPost.Close()
 
-	result, err := stmtPost.Exec(usrID, title, content, imagePath)
+	result, err := stmtPost.Exec(usrID, title, content, markdown.Render(content))
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("error inserting post: %v", err)
@@ -40,6 +43,13 @@ func InsertPost(db *sql.DB, title, content, imagePath string, categories []strin
 		return fmt.Errorf("error getting last insert ID: %v", err)
 	}
 
+	for position, image := range images {
+		if err := insertPostImage(tx, postID, position, image); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	stmtPostCategory, err := tx.Prepare("INSERT INTO PostCategory (PostID, CategoryID) VALUES (?,?)")
 	if err != nil {
 		tx.Rollback()
@@ -62,6 +72,13 @@ func InsertPost(db *sql.DB, title, content, imagePath string, categories []strin
 		}
 	}
 
+	if held != nil {
+		if err := holdContent(tx, HeldPost, int(postID), usrID, held, false); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return fmt.Errorf("error committing transaction: %v", err)
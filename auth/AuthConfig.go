@@ -1,10 +0,0 @@
-package auth
-
-const (
-	GoogleClientID     = "22288271640-nhp6rm7770cmpjts6ltgq3vvq6vmkcgf.apps.googleusercontent.com"
-	GoogleClientSecret = "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"
-	GitHubClientID     = "Ov23liurGs3djD26l9yu"
-	GitHubClientSecret = "1b4e42e6e47da415bdcd79bfe37c3bb1278f9150"
-	GoogleRedirectURL  = "https://localhost/auth/google/callback"
-	GitHubRedirectURL  = "https://localhost/auth/github/callback"
-)
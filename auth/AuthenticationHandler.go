@@ -1,250 +1,369 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"forum/DB"
+	"forum/config"
+	"forum/utils"
 
 	// hndls "forum/handlers"
-	"forum/utils"
-	"io"
+	"log"
+	"net"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 )
 
-const (
-	googleAuthURL  = "https://accounts.google.com/o/oauth2/v2/auth"
-	googleTokenURL = "https://oauth2.googleapis.com/token"
-	githubAuthURL  = "https://github.com/login/oauth/authorize"
-	githubTokenURL = "https://github.com/login/oauth/access_token"
-)
-const (
-	InsertSessionQuery = `INSERT INTO Session (session_id, user_id, created_at, expiry_date, ip_address) VALUES (?,?,?,?,?)`
-)
+// Authenticator logs users in, with their password or through an external provider, and runs
+// the OAuth handlers.
+type Authenticator struct {
+	// stores are the repositories built on the shared database handle.
+	stores *DB.Stores
+	// cfg holds the session and two-factor settings the server was started with.
+	cfg config.Config
+	// providers are the enabled external login providers.
+	providers *Registry
+	// stateKey signs the OAuth cookies.
+	stateKey []byte
+	// trustedProxies are the reverse proxies whose forwarded headers are believed.
+	trustedProxies []*net.IPNet
+}
 
-// HandleGoogleLogin initiates the OAuth2 flow for Google authentication.
-// It constructs a URL to the Google OAuth2 authorization endpoint with the required parameters.
-// After the user authorizes the application, Google will redirect the user back to the specified redirect URI.
-// The function then redirects the user's browser to the constructed authorization URL.
+// NewAuthenticator returns an Authenticator working on stores, configured by c, that offers the
+// login providers of reg.
+func NewAuthenticator(stores *DB.Stores, c config.Config, reg *Registry) *Authenticator {
+	return &Authenticator{
+		stores:    stores,
+		cfg:       c,
+		providers: reg,
+		stateKey:  newStateKey(c.Server.SecretKey),
+
+		trustedProxies: c.Server.TrustedProxyNets(),
+	}
+}
+
+// HandleOAuthProviders lists the enabled login providers, so the login page can show a button for each.
 //
 // Parameters:
-// - w: http.ResponseWriter to write the response.
-// - r: *http.Request containing the HTTP request data.
-func HandleGoogleLogin(w http.ResponseWriter, r *http.Request) {
-	params := url.Values{}
-	params.Add("client_id", GoogleClientID)
-	params.Add("redirect_uri", GoogleRedirectURL)
-	params.Add("response_type", "code")
-	params.Add("scope", "https://www.googleapis.com/auth/userinfo.email https://www.googleapis.com/auth/userinfo.profile")
-
-	authURL := googleAuthURL + "?" + params.Encode()
-	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+//   - w: http.ResponseWriter to write the JSON list of providers to.
+//   - r: *http.Request containing the HTTP request data.
+func (a *Authenticator) HandleOAuthProviders(w http.ResponseWriter, r *http.Request) {
+	type providerInfo struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+		LoginURL    string `json:"loginUrl"`
+	}
+	list := []providerInfo{}
+	for _, p := range a.providers.List() {
+		list = append(list, providerInfo{Name: p.Name(), DisplayName: p.DisplayName(), LoginURL: "/auth/" + p.Name() + "/login"})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// HandleOAuthLogin initiates the OAuth2 flow for the provider named in the URL path.
+// It generates a random state and PKCE code verifier, remembers them in a signed cookie, and
+// redirects the user's browser to the provider's authorization endpoint. After the user authorizes
+// the application, the provider redirects the user back to the provider's callback, see HandleOAuthCallback.
+//
+// Parameters:
+//   - w: http.ResponseWriter to write the HTTP response.
+//   - r: *http.Request containing the HTTP request data, with the provider name as the "provider" path value.
+func (a *Authenticator) HandleOAuthLogin(w http.ResponseWriter, r *http.Request) {
+	a.startOAuthFlow(w, r, 0)
 }
 
-// HandleGitHubLogin initiates the OAuth2 flow for GitHub authentication.
-// It constructs a URL to the GitHub OAuth2 authorization endpoint with the required parameters.
-// After the user authorizes the application, GitHub will redirect the user back to the specified redirect URI.
-// The function then redirects the user's browser to the constructed authorization URL.
+// HandleOAuthLink initiates the OAuth2 flow for the provider named in the URL path on behalf of the
+// logged in user, to link their account at the provider to their forum account.
+// The flow is the same as for HandleOAuthLogin; the callback links instead of logging in.
 //
 // Parameters:
-// - w: http.ResponseWriter to write the HTTP response.
-// - r: *http.Request containing the HTTP request data.
-func HandleGitHubLogin(w http.ResponseWriter, r *http.Request) {
-	params := url.Values{}
-	params.Add("client_id", GitHubClientID)
-	params.Add("redirect_uri", GitHubRedirectURL)
-	params.Add("scope", "user:email")
-
-	authURL := githubAuthURL + "?" + params.Encode()
+//   - w: http.ResponseWriter to write the HTTP response.
+//   - r: *http.Request containing the HTTP request data, with the provider name as the "provider" path value.
+func (a *Authenticator) HandleOAuthLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.sessionUserID(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	a.startOAuthFlow(w, r, userID)
+}
+
+// startOAuthFlow sends the browser to the provider named in the URL path, to log in or, if
+// linkUserID is not 0, to link the provider account to linkUserID.
+func (a *Authenticator) startOAuthFlow(w http.ResponseWriter, r *http.Request, linkUserID int) {
+	provider, ok := a.providers.Get(r.PathValue("provider"))
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		log.Printf("error generating OAuth state: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		log.Printf("error generating PKCE verifier: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, pkceChallenge(verifier))
+	if err != nil {
+		log.Printf("error starting %s login: %v\n", provider.Name(), err)
+		http.Error(w, "Login provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	expiry := time.Now().Add(oauthStateLifetime)
+	cookie, err := a.signValue(purposeOAuthState, oauthState{
+		Provider:   provider.Name(),
+		State:      state,
+		Verifier:   verifier,
+		LinkUserID: linkUserID,
+	}, expiry)
+	if err != nil {
+		log.Printf("error signing OAuth state: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	utils.SetOAuthCookie(w, utils.OAuthStateCookieName, cookie, expiry)
 	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
 }
 
-// HandleOAuthCallback processes the callback from OAuth providers (Google or GitHub).
-// It exchanges the authorization code for an access token, retrieves user information,
-// and either logs in an existing user or redirects to registration for a new user.
+// HandleOAuthCallback processes the callback from the OAuth provider named in the URL path.
+// It checks the state against the signed cookie set by HandleOAuthLogin or HandleOAuthLink, so only
+// the browser that started the flow can finish it, exchanges the authorization code and PKCE
+// verifier for an access token, and retrieves user information.
 //
 // Parameters:
 //   - w: http.ResponseWriter to write the HTTP response.
-//   - r: *http.Request containing the HTTP request data, including the OAuth code and provider.
+//   - r: *http.Request containing the HTTP request data, including the OAuth code and state and the
+//     provider name as the "provider" path value.
 //
 // The function doesn't return any value, but it writes to the ResponseWriter:
 //   - In case of errors, it sends appropriate HTTP error responses.
-//   - For existing users, it sets a session cookie and redirects to the home page.
-//   - For new users, it redirects to the registration page with pre-filled user information.
-func HandleOAuthCallback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	provider := r.URL.Query().Get("provider")
-
-	var userInfo map[string]interface{}
-	var err error
-
-	switch provider {
-	case "google":
-		token, err := exchangeGoogleToken(code)
-		if err != nil {
-			http.Error(w, "Failed to exchange token", http.StatusInternalServerError)
-			return
-		}
-		userInfo, err = getGoogleUserInfo(token)
-	case "github":
-		token, err := exchangeGitHubToken(code)
-		if err != nil {
-			http.Error(w, "Failed to exchange token", http.StatusInternalServerError)
+//   - If the user declined at the provider, it redirects back to where the flow started.
+//   - When linking, it links the provider account and redirects to the profile page.
+//   - For provider accounts linked to a user, and for existing users whose email address the provider
+//     has verified (the account is linked on the way), it logs the user in and redirects to the home page.
+//   - For new users, it remembers the provider account in a signed cookie and redirects to the
+//     registration page, see HandlePendingSignup.
+func (a *Authenticator) HandleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := a.providers.Get(r.PathValue("provider"))
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	var state oauthState
+	cookie, err := r.Cookie(utils.OAuthStateCookieName)
+	if err == nil {
+		err = a.openValue(purposeOAuthState, cookie.Value, &state)
+	}
+	utils.ClearOAuthCookie(w, utils.OAuthStateCookieName)
+	query := r.URL.Query()
+	if err != nil || state.Provider != provider.Name() ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		http.Error(w, "Your login attempt expired or did not start here, please try again", http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("error") != "" {
+		if state.LinkUserID != 0 {
+			http.Redirect(w, r, "/profile", http.StatusSeeOther)
 			return
 		}
-		userInfo, err = getGitHubUserInfo(token)
-		// Add email fetch for GitHub
-		if userInfo["email"] == nil {
-			// Fetch email separately for GitHub
-			email, err := getGitHubEmail(token)
-			if err != nil {
-				http.Error(w, "Failed to get email", http.StatusInternalServerError)
-				return
-			}
-			userInfo["email"] = email
-		}
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		http.Error(w, "Missing authorization code", http.StatusBadRequest)
+		return
 	}
 
+	token, err := provider.Exchange(r.Context(), code, state.Verifier)
 	if err != nil {
+		log.Printf("error exchanging token: %v\n", err)
+		http.Error(w, "Failed to exchange token", http.StatusInternalServerError)
+		return
+	}
+	user, err := provider.UserInfo(r.Context(), token)
+	if err != nil {
+		log.Printf("error getting user info: %v\n", err)
 		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
 		return
 	}
 
-	email := userInfo["email"].(string)
-	exists, err := checkEmailExists(email)
+	if state.LinkUserID != 0 {
+		a.linkIdentity(w, r, provider, user, state.LinkUserID)
+		return
+	}
+	a.loginWithIdentity(w, r, provider, user)
+}
+
+// linkIdentity links the provider account user to userID, who started the link from their profile.
+func (a *Authenticator) linkIdentity(w http.ResponseWriter, r *http.Request, provider Provider, user ExternalUser, userID int) {
+	if current, ok := a.sessionUserID(r); !ok || current != userID {
+		http.Error(w, "Log in again to link your "+provider.DisplayName()+" account", http.StatusForbidden)
+		return
+	}
 
-	if exists {
-		handleExistingUser(w, r, email)
-	} else {
-		redirectToRegistration(w, r, userInfo)
+	err := a.stores.Identities.Link(userID, provider.Name(), user.Subject, user.Email)
+	switch err {
+	case nil:
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+	case DB.ErrIdentityTaken:
+		http.Error(w, "This "+provider.DisplayName()+" account is already linked to another user", http.StatusConflict)
+	case DB.ErrProviderLinked:
+		http.Error(w, "Unlink your current "+provider.DisplayName()+" account first", http.StatusConflict)
+	default:
+		log.Printf("error linking identity: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
-// exchangeGoogleToken exchanges an authorization code for a Google OAuth2 access token.
-// It sends a POST request to Google's token endpoint with the necessary parameters.
-//
-// Parameters:
-//   - code: A string representing the authorization code received from Google's OAuth2 flow.
-//
-// Returns:
-//   - string: The access token obtained from Google, which can be used to access Google APIs.
-//   - error: An error if the token exchange fails, or nil if successful.
-func exchangeGoogleToken(code string) (string, error) {
-	data := url.Values{}
-	data.Set("code", code)
-	data.Set("client_id", GoogleClientID)
-	data.Set("client_secret", GoogleClientSecret)
-	data.Set("redirect_uri", GoogleRedirectURL)
-	data.Set("grant_type", "authorization_code")
-
-	resp, err := http.PostForm(googleTokenURL, data)
-	if err != nil {
-		return "", err
+// loginWithIdentity logs in the user the provider account user belongs to, or sends the user to the
+// registration page if there is none.
+func (a *Authenticator) loginWithIdentity(w http.ResponseWriter, r *http.Request, provider Provider, user ExternalUser) {
+	userID, err := a.stores.Identities.UserID(provider.Name(), user.Subject)
+	if err == nil {
+		if err := a.stores.Identities.Touch(provider.Name(), user.Subject, user.Email); err != nil {
+			log.Printf("error updating identity: %v\n", err)
+		}
+		a.handleExistingUser(w, r, userID)
+		return
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("error looking up identity: %v\n", err)
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		AccessToken string `json:"access_token"`
+	exists := false
+	if user.Email != "" {
+		exists, err = a.checkEmailExists(user.Email)
+		if err != nil {
+			log.Printf("error checking email: %v\n", err)
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if !exists {
+		a.redirectToRegistration(w, r, provider, user)
+		return
 	}
-	return result.AccessToken, nil
-}
 
-// exchangeGitHubToken exchanges an authorization code for a GitHub OAuth2 access token.
-// It sends a POST request to GitHub's token endpoint with the necessary parameters.
-//
-// Parameters:
-//   - code: A string representing the authorization code received from GitHub's OAuth2 flow.
-//
-// Returns:
-//   - string: The access token obtained from GitHub, which can be used to access GitHub APIs.
-//   - error: An error if the token exchange fails, or nil if successful.
-func exchangeGitHubToken(code string) (string, error) {
-	data := url.Values{}
-	data.Set("code", code)
-	data.Set("client_id", GitHubClientID)
-	data.Set("client_secret", GitHubClientSecret)
-	data.Set("redirect_uri", GitHubRedirectURL)
-
-	req, _ := http.NewRequest("POST", githubTokenURL, strings.NewReader(data.Encode()))
-	req.Header.Set("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// An account with this email exists but has never used this provider account. Only link them
+	// if the provider vouches for the address; anyone can type an address into their profile.
+	if !user.EmailVerified {
+		http.Error(w, "Your "+provider.DisplayName()+" email address is not verified", http.StatusForbidden)
+		return
+	}
+	userID, err = a.stores.Users.IDByEmail(user.Email)
 	if err != nil {
-		return "", err
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		AccessToken string `json:"access_token"`
+	err = a.stores.Identities.Link(userID, provider.Name(), user.Subject, user.Email)
+	if err == DB.ErrProviderLinked {
+		http.Error(w, "Your account is linked to a different "+provider.DisplayName()+" account", http.StatusConflict)
+		return
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if err != nil {
+		log.Printf("error linking identity: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
-	return result.AccessToken, nil
+	a.handleExistingUser(w, r, userID)
 }
 
-// ! helper functions
-
-// getGoogleUserInfo retrieves user information from Google's API using the provided access token.
+// HandlePendingSignup returns the provider account a new OAuth user is registering with, so the
+// registration form can be filled in. It answers 204 No Content if there is none.
 //
 // Parameters:
-//   - accessToken: A string representing the OAuth2 access token obtained from Google.
-//
-// Returns:
-//   - map[string]interface{}: A map containing the user's information retrieved from Google.
-//     The keys in this map correspond to the fields in Google's user info response.
-//   - error: An error if the API request fails or if there's an issue decoding the response.
-//     Returns nil if the operation is successful.
-func getGoogleUserInfo(accessToken string) (map[string]interface{}, error) {
-	req, _ := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	client := &http.Client{}
-	response, err := client.Do(req)
-	if err != nil {
-		return nil, err
+//   - w: http.ResponseWriter to write the JSON response to.
+//   - r: *http.Request carrying the signed signup cookie set by HandleOAuthCallback.
+func (a *Authenticator) HandlePendingSignup(w http.ResponseWriter, r *http.Request) {
+	pending, ok := a.readPendingSignup(r)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
-	defer response.Body.Close()
 
-	var userInfo map[string]interface{}
-	if err := json.NewDecoder(response.Body).Decode(&userInfo); err != nil {
-		return nil, err
+	displayName := pending.Provider
+	if p, ok := a.providers.Get(pending.Provider); ok {
+		displayName = p.DisplayName()
 	}
-	return userInfo, nil
+	firstName, lastName := splitName(pending.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"provider":    pending.Provider,
+		"displayName": displayName,
+		"email":       pending.Email,
+		"firstname":   firstName,
+		"lastname":    lastName,
+	})
 }
 
-// getGitHubUserInfo retrieves user information from GitHub's API using the provided access token.
+// ClaimPendingSignup links the provider account a new OAuth user registered with, if any, to the
+// account just created for them, and drops the signup cookie.
 //
 // Parameters:
-//   - accessToken: A string representing the OAuth2 access token obtained from GitHub.
+//   - w: The http.ResponseWriter the cookie is cleared on.
+//   - r: The registration request.
+//   - userID: The newly registered user.
+//   - email: The email address they registered with.
 //
 // Returns:
-//   - map[string]interface{}: A map containing the user's information retrieved from GitHub.
-//     The keys in this map correspond to the fields in GitHub's user info response.
-//   - error: An error if the API request fails or if there's an issue decoding the response.
-//     Returns nil if the operation is successful.
-func getGitHubUserInfo(accessToken string) (map[string]interface{}, error) {
-	req, _ := http.NewRequest("GET", "https://api.github.com/user", nil)
-	req.Header.Set("Authorization", "token "+accessToken)
-
-	client := &http.Client{}
-	response, err := client.Do(req)
+//   - bool: true if the provider verified that same email address, which the caller can then mark as verified.
+//   - error: An error if the account could not be linked.
+func (a *Authenticator) ClaimPendingSignup(w http.ResponseWriter, r *http.Request, userID int, email string) (bool, error) {
+	pending, ok := a.readPendingSignup(r)
+	if !ok {
+		return false, nil
+	}
+	utils.ClearOAuthCookie(w, utils.OAuthSignupCookieName)
+
+	if err := a.stores.Identities.Link(userID, pending.Provider, pending.Subject, pending.Email); err != nil {
+		return false, err
+	}
+	return pending.EmailVerified && strings.EqualFold(pending.Email, email), nil
+}
+
+// readPendingSignup returns the provider account in the request's signup cookie, if it is valid.
+func (a *Authenticator) readPendingSignup(r *http.Request) (pendingSignup, bool) {
+	var pending pendingSignup
+	cookie, err := r.Cookie(utils.OAuthSignupCookieName)
 	if err != nil {
-		return nil, err
+		return pending, false
+	}
+	if err := a.openValue(purposeOAuthSignup, cookie.Value, &pending); err != nil {
+		return pending, false
 	}
-	defer response.Body.Close()
+	return pending, true
+}
 
-	var userInfo map[string]interface{}
-	if err := json.NewDecoder(response.Body).Decode(&userInfo); err != nil {
-		return nil, err
+// sessionUserID returns the user logged in with the request's session cookie.
+func (a *Authenticator) sessionUserID(r *http.Request) (int, bool) {
+	cookie, err := r.Cookie(utils.SessionCookieName)
+	if err != nil {
+		return 0, false
 	}
-	return userInfo, nil
+	userID, err := a.stores.Sessions.Lookup(cookie.Value)
+	if err != nil {
+		return 0, false
+	}
+	return userID, true
 }
 
 // checkEmailExists queries the database to determine if a user with the given email exists.
@@ -255,150 +374,80 @@ func getGitHubUserInfo(accessToken string) (map[string]interface{}, error) {
 // Returns:
 //   - bool: true if a user with the given email exists, false otherwise.
 //   - error: An error if the database query fails, or nil if the operation is successful.
-func checkEmailExists(email string) (bool, error) {
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		return false, err
+func (a *Authenticator) checkEmailExists(email string) (bool, error) {
+	_, err := a.stores.Users.IDByEmail(email)
+	if err == sql.ErrNoRows {
+		return false, nil
 	}
-	defer db.Close()
-
-	var exists bool
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM User WHERE email = ?)", email).Scan(&exists)
-	return exists, err
+	return err == nil, err
 }
 
-// redirectToRegistration redirects the user to the registration page with pre-filled user information.
-// This function is typically used after OAuth authentication when a new user needs to complete registration.
+// redirectToRegistration remembers the provider account in a signed cookie and redirects the user to
+// the registration page, which fills itself in from HandlePendingSignup. Registering then links the
+// provider account to the new user, see ClaimPendingSignup.
 //
 // Parameters:
 //   - w: http.ResponseWriter to write the HTTP response for the redirection.
 //   - r: *http.Request containing the original HTTP request data.
-//   - userInfo: map[string]interface{} containing user information obtained from the OAuth provider.
-//     Expected to contain at least an "email" key, and optionally a "name" key.
-//
-// The function doesn't return any value, but it performs an HTTP redirection to the registration page,
-// appending user information (email, firstname, lastname) as URL query parameters.
-func redirectToRegistration(w http.ResponseWriter, r *http.Request, userInfo map[string]interface{}) {
-	data := url.Values{}
-	data.Set("email", userInfo["email"].(string))
-
-	// Handle different field names for GitHub vs Google
-	firstName := ""
-	lastName := ""
-	if name, ok := userInfo["name"].(string); ok {
-		names := strings.Split(name, " ")
-		if len(names) > 0 {
-			firstName = names[0]
-			if len(names) > 1 {
-				lastName = strings.Join(names[1:], " ")
-			}
-		}
+//   - provider: The provider the user signed in with.
+//   - user: ExternalUser obtained from the OAuth provider.
+func (a *Authenticator) redirectToRegistration(w http.ResponseWriter, r *http.Request, provider Provider, user ExternalUser) {
+	expiry := time.Now().Add(oauthSignupLifetime)
+	cookie, err := a.signValue(purposeOAuthSignup, pendingSignup{
+		Provider:      provider.Name(),
+		Subject:       user.Subject,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Name:          user.Name,
+	}, expiry)
+	if err != nil {
+		log.Printf("error signing pending signup: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
+	utils.SetOAuthCookie(w, utils.OAuthSignupCookieName, cookie, expiry)
+	http.Redirect(w, r, "/register", http.StatusSeeOther)
+}
 
-	data.Set("firstname", firstName)
-	data.Set("lastname", lastName)
-
-	http.Redirect(w, r, "/register?"+data.Encode(), http.StatusTemporaryRedirect)
+// splitName splits a full name into a first name and the rest.
+func splitName(name string) (string, string) {
+	names := strings.Fields(name)
+	if len(names) == 0 {
+		return "", ""
+	}
+	return names[0], strings.Join(names[1:], " ")
 }
 
 // handleExistingUser processes authentication for an existing user.
-// It retrieves the user's ID from the database, generates a new session token,
-// creates a session in the database, sets a session cookie, and redirects to the home page.
+// It completes the login: if the account uses two-factor authentication the user is sent to the
+// second login step, otherwise a session is created, its cookie set, and the user redirected to the
+// home page.
 //
 // Parameters:
 //   - w: http.ResponseWriter to write the HTTP response.
 //   - r: *http.Request containing the HTTP request data.
-//   - email: string representing the user's email address.
+//   - userID: int, the ID of the user to log in.
 //
 // The function doesn't return any value, but it performs the following actions:
-//   - Sets a session cookie for the authenticated user.
-//   - Redirects the user to the home page upon successful authentication.
+//   - Sets a session cookie (or a login challenge cookie) for the authenticated user.
+//   - Redirects the user to the home page (or the two-factor page) upon successful authentication.
 //   - Writes HTTP error responses to w in case of any errors during the process.
-func handleExistingUser(w http.ResponseWriter, r *http.Request, email string) {
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		http.Error(w, "Database connection error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
-	var userID string
-	err = db.QueryRow("SELECT UserID FROM User WHERE email = ?", email).Scan(&userID)
-	if err != nil {
-		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+func (a *Authenticator) handleExistingUser(w http.ResponseWriter, r *http.Request, userID int) {
+	needsSecondFactor, err := a.CompleteLogin(w, r, userID)
+	var banErr *BanError
+	if errors.As(err, &banErr) {
+		http.Error(w, banErr.Error(), http.StatusForbidden)
 		return
 	}
-
-	sessionToken, err := utils.GenerateSessionToken()
-	if err != nil {
-		http.Error(w, "Error generating session", http.StatusInternalServerError)
-		return
-	}
-
-	expiryDate := time.Now().Add(72 * time.Hour)
-	ipAddr := utils.GetIP(r)
-
-	_, err = db.Exec(InsertSessionQuery, sessionToken, userID, time.Now(), expiryDate, ipAddr)
 	if err != nil {
+		log.Printf("error completing login: %v\n", err)
 		http.Error(w, "Error creating session", http.StatusInternalServerError)
 		return
 	}
-
-	cookie := &http.Cookie{
-		Name:     "sessionID",
-		Value:    sessionToken,
-		Expires:  expiryDate,
-		Path:     "/",
-		Secure:   true,
-		HttpOnly: true,
-		SameSite: http.SameSiteNoneMode,
+	if needsSecondFactor {
+		http.Redirect(w, r, TwoFactorPath, http.StatusTemporaryRedirect)
+		return
 	}
 
-	http.SetCookie(w, cookie)
 	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 }
-
-// getGitHubEmail retrieves the primary email address associated with the authenticated GitHub user.
-// It sends a GET request to the GitHub API endpoint for user emails, including the access token
-// to authenticate the request. The function then parses the JSON response, extracts the primary email,
-// and returns it along with any encountered errors.
-//
-// Parameters:
-//   - accessToken string: The OAuth2 access token obtained from GitHub during the OAuth2 flow.
-//     This token is used to authenticate the API request and authorize access to the user's email.
-//
-// Return:
-//   - string: The primary email address associated with the authenticated GitHub user.
-//   - error: An error if the API request fails, the JSON response cannot be parsed, or no primary email is found.
-//     Returns nil if the operation is successful.
-func getGitHubEmail(accessToken string) (string, error) {
-	req, _ := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("Authorization", "token "+accessToken)
-
-	client := &http.Client{}
-	response, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer response.Body.Close()
-
-	var emails []struct {
-		Email    string `json:"email"`
-		Primary  bool   `json:"primary"`
-		Verified bool   `json:"verified"`
-	}
-
-	body, _ := io.ReadAll(response.Body)
-	if err := json.Unmarshal(body, &emails); err != nil {
-		return "", err
-	}
-
-	for _, email := range emails {
-		if email.Primary {
-			return email.Email, nil
-		}
-	}
-
-	return "", fmt.Errorf("no primary email found")
-}
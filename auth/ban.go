@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"database/sql"
+	"forum/DB"
+)
+
+// BanError is returned instead of logging in a banned user. Its message tells the user why and
+// for how long they are banned.
+type BanError struct {
+	Ban DB.Sanction
+}
+
+func (e *BanError) Error() string {
+	return "This account is banned " + e.Ban.Until() + ". Reason: " + e.Ban.Reason
+}
+
+// checkBan returns a *BanError if userID is banned.
+func (a *Authenticator) checkBan(userID int) error {
+	ban, err := a.stores.Sanctions.ActiveBan(userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &BanError{Ban: ban}
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// endpoints are the addresses of a provider's authorization, token and user info endpoints.
+type endpoints struct {
+	auth, token, userInfo string
+}
+
+// oauth2Provider is a Provider speaking the authorization code flow. The provider types only
+// differ in their endpoints, default scopes and how they describe the user, see newOAuth2Provider.
+type oauth2Provider struct {
+	name         string
+	displayName  string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+
+	// endpoints are fixed unless discovery is set, in which case the endpoints it finds are
+	// used wherever endpoints has none.
+	endpoints endpoints
+	discovery *oidcDiscovery
+
+	// profile turns the user info endpoint's answer into an ExternalUser.
+	profile func(ctx context.Context, p *oauth2Provider, ep endpoints, accessToken string) (ExternalUser, error)
+}
+
+func (p *oauth2Provider) Name() string {
+	return p.name
+}
+
+func (p *oauth2Provider) DisplayName() string {
+	return p.displayName
+}
+
+func (p *oauth2Provider) AuthCodeURL(ctx context.Context, state, codeChallenge string) (string, error) {
+	ep, err := p.resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("client_id", p.clientID)
+	params.Set("redirect_uri", p.redirectURL)
+	params.Set("response_type", "code")
+	params.Set("scope", strings.Join(p.scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(ep.auth, "?") {
+		sep = "&"
+	}
+	return ep.auth + sep + params.Encode(), nil
+}
+
+func (p *oauth2Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	ep, err := p.resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", p.redirectURL)
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.token, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("error building token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := doJSON(p.client, req, &result); err != nil && result.Error == "" {
+		return "", fmt.Errorf("error exchanging code with %s: %v", p.name, err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("%s refused the code: %s %s", p.name, result.Error, result.ErrorDescription)
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("%s returned no access token", p.name)
+	}
+	return result.AccessToken, nil
+}
+
+func (p *oauth2Provider) UserInfo(ctx context.Context, accessToken string) (ExternalUser, error) {
+	ep, err := p.resolve(ctx)
+	if err != nil {
+		return ExternalUser{}, err
+	}
+	user, err := p.profile(ctx, p, ep, accessToken)
+	if err != nil {
+		return ExternalUser{}, fmt.Errorf("error getting %s user info: %v", p.name, err)
+	}
+	if user.Subject == "" {
+		return ExternalUser{}, fmt.Errorf("%s user info has no subject", p.name)
+	}
+	return user, nil
+}
+
+// resolve returns the endpoints to use, discovering them first if needed.
+func (p *oauth2Provider) resolve(ctx context.Context) (endpoints, error) {
+	if p.discovery == nil {
+		return p.endpoints, nil
+	}
+	found, err := p.discovery.endpoints(ctx)
+	if err != nil {
+		return endpoints{}, err
+	}
+	ep := p.endpoints
+	if ep.auth == "" {
+		ep.auth = found.auth
+	}
+	if ep.token == "" {
+		ep.token = found.token
+	}
+	if ep.userInfo == "" {
+		ep.userInfo = found.userInfo
+	}
+	return ep, nil
+}
+
+// getJSON sends an authenticated GET to rawURL and decodes the JSON answer into v.
+func (p *oauth2Provider) getJSON(ctx context.Context, rawURL, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	return doJSON(p.client, req, v)
+}
+
+// doJSON sends req and decodes the JSON answer into v. Error statuses are reported as errors, but
+// their body is still decoded so OAuth error fields can be read from it.
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(body, v)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return decodeErr
+}
+
+// oidcDiscovery looks up the endpoints of an OpenID Connect issuer the first time they are needed
+// and remembers them. A failed lookup is retried on the next login.
+type oidcDiscovery struct {
+	issuer string
+	client *http.Client
+
+	mu    sync.Mutex
+	found *endpoints
+}
+
+func (d *oidcDiscovery) endpoints(ctx context.Context) (endpoints, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.found != nil {
+		return *d.found, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return endpoints{}, fmt.Errorf("error building discovery request: %v", err)
+	}
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	if err := doJSON(d.client, req, &doc); err != nil {
+		return endpoints{}, fmt.Errorf("error discovering %s: %v", d.issuer, err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != d.issuer {
+		return endpoints{}, fmt.Errorf("discovery document of %s names issuer %q", d.issuer, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserInfoEndpoint == "" {
+		return endpoints{}, fmt.Errorf("discovery document of %s is missing endpoints", d.issuer)
+	}
+
+	d.found = &endpoints{auth: doc.AuthorizationEndpoint, token: doc.TokenEndpoint, userInfo: doc.UserInfoEndpoint}
+	return *d.found, nil
+}
+
+// oidcProfile reads a standard OpenID Connect user info response.
+// Providers that leave out email_verified are treated as not vouching for the address.
+func oidcProfile(ctx context.Context, p *oauth2Provider, ep endpoints, accessToken string) (ExternalUser, error) {
+	var info struct {
+		Sub           string      `json:"sub"`
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"`
+		Name          string      `json:"name"`
+		GivenName     string      `json:"given_name"`
+		FamilyName    string      `json:"family_name"`
+	}
+	if err := p.getJSON(ctx, ep.userInfo, accessToken, &info); err != nil {
+		return ExternalUser{}, err
+	}
+
+	name := info.Name
+	if name == "" {
+		name = strings.TrimSpace(info.GivenName + " " + info.FamilyName)
+	}
+	// Some providers send the flag as the string "true".
+	verified := info.EmailVerified == true || info.EmailVerified == "true"
+	return ExternalUser{Subject: info.Sub, Email: info.Email, EmailVerified: verified, Name: name}, nil
+}
+
+// githubProfile reads GitHub's user endpoint, and its email list for the primary verified address,
+// which the user endpoint leaves out when the user keeps it private.
+func githubProfile(ctx context.Context, p *oauth2Provider, ep endpoints, accessToken string) (ExternalUser, error) {
+	var info struct {
+		ID    json.Number `json:"id"`
+		Login string      `json:"login"`
+		Name  string      `json:"name"`
+	}
+	if err := p.getJSON(ctx, ep.userInfo, accessToken, &info); err != nil {
+		return ExternalUser{}, err
+	}
+	user := ExternalUser{Subject: info.ID.String(), Name: info.Name}
+	if user.Name == "" {
+		user.Name = info.Login
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.getJSON(ctx, strings.TrimSuffix(ep.userInfo, "/")+"/emails", accessToken, &emails); err != nil {
+		return ExternalUser{}, err
+	}
+	for _, e := range emails {
+		if e.Primary {
+			user.Email, user.EmailVerified = e.Email, e.Verified
+			break
+		}
+	}
+	return user, nil
+}
+
+// discordProfile reads Discord's current user endpoint.
+func discordProfile(ctx context.Context, p *oauth2Provider, ep endpoints, accessToken string) (ExternalUser, error) {
+	var info struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+		Email      string `json:"email"`
+		Verified   bool   `json:"verified"`
+	}
+	if err := p.getJSON(ctx, ep.userInfo, accessToken, &info); err != nil {
+		return ExternalUser{}, err
+	}
+	name := info.GlobalName
+	if name == "" {
+		name = info.Username
+	}
+	return ExternalUser{Subject: info.ID, Email: info.Email, EmailVerified: info.Verified, Name: name}, nil
+}
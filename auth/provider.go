@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"forum/config"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Provider is an external login service the forum speaks OAuth 2.0 with.
+type Provider interface {
+	// Name is the name the provider was configured under; it appears in the provider's URLs.
+	Name() string
+	// DisplayName is what the login button calls the provider.
+	DisplayName() string
+	// AuthCodeURL returns the address the browser is sent to so the user can sign in. The provider
+	// echoes state back to the callback, and binds the code it issues to the PKCE codeChallenge.
+	AuthCodeURL(ctx context.Context, state, codeChallenge string) (string, error)
+	// Exchange trades the authorization code from the callback, and the PKCE code verifier the
+	// challenge was derived from, for an access token.
+	Exchange(ctx context.Context, code, codeVerifier string) (string, error)
+	// UserInfo fetches the account the access token belongs to.
+	UserInfo(ctx context.Context, accessToken string) (ExternalUser, error)
+}
+
+// ExternalUser is an account at an external login provider.
+// Subject identifies the account at the provider and never changes, unlike Email.
+type ExternalUser struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Registry holds the enabled login providers by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry builds a provider for every enabled entry of c. Redirect URLs that are not
+// configured default to /auth/<name>/callback under publicURL. client is used for every request
+// to the providers; nil means a client with a short timeout.
+func NewRegistry(c config.OAuthConfig, publicURL string, client *http.Client) (*Registry, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	reg := &Registry{providers: map[string]Provider{}}
+	for name, pc := range c {
+		if !pc.Enabled() {
+			continue
+		}
+		if pc.RedirectURL == "" {
+			pc.RedirectURL = strings.TrimSuffix(publicURL, "/") + "/auth/" + name + "/callback"
+		}
+		p, err := newOAuth2Provider(name, pc, client)
+		if err != nil {
+			return nil, err
+		}
+		reg.providers[name] = p
+	}
+	return reg, nil
+}
+
+// Get returns the enabled provider called name.
+func (reg *Registry) Get(name string) (Provider, bool) {
+	if reg == nil {
+		return nil, false
+	}
+	p, ok := reg.providers[name]
+	return p, ok
+}
+
+// List returns the enabled providers ordered by name.
+func (reg *Registry) List() []Provider {
+	if reg == nil {
+		return nil
+	}
+	list := make([]Provider, 0, len(reg.providers))
+	for _, p := range reg.providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// newOAuth2Provider sets up a provider of the type pc asks for.
+func newOAuth2Provider(name string, pc config.OAuthProviderConfig, client *http.Client) (*oauth2Provider, error) {
+	p := &oauth2Provider{
+		name:         name,
+		displayName:  pc.DisplayName,
+		clientID:     pc.ClientID,
+		clientSecret: pc.ClientSecret,
+		redirectURL:  pc.RedirectURL,
+		scopes:       pc.Scopes,
+		client:       client,
+		profile:      oidcProfile,
+	}
+
+	var ep endpoints
+	var defaultScopes []string
+	var defaultName string
+	switch typ := pc.ProviderType(name); typ {
+	case config.OAuthGoogle:
+		defaultName = "Google"
+		ep = endpoints{
+			auth:     "https://accounts.google.com/o/oauth2/v2/auth",
+			token:    "https://oauth2.googleapis.com/token",
+			userInfo: "https://openidconnect.googleapis.com/v1/userinfo",
+		}
+		defaultScopes = []string{"openid", "email", "profile"}
+	case config.OAuthGitHub:
+		defaultName = "GitHub"
+		ep = endpoints{
+			auth:     "https://github.com/login/oauth/authorize",
+			token:    "https://github.com/login/oauth/access_token",
+			userInfo: "https://api.github.com/user",
+		}
+		defaultScopes = []string{"read:user", "user:email"}
+		p.profile = githubProfile
+	case config.OAuthGitLab:
+		defaultName = "GitLab"
+		base := strings.TrimSuffix(pc.Issuer, "/")
+		if base == "" {
+			base = "https://gitlab.com"
+		}
+		ep = endpoints{
+			auth:     base + "/oauth/authorize",
+			token:    base + "/oauth/token",
+			userInfo: base + "/oauth/userinfo",
+		}
+		defaultScopes = []string{"openid", "email", "profile"}
+	case config.OAuthDiscord:
+		defaultName = "Discord"
+		ep = endpoints{
+			auth:     "https://discord.com/oauth2/authorize",
+			token:    "https://discord.com/api/oauth2/token",
+			userInfo: "https://discord.com/api/users/@me",
+		}
+		defaultScopes = []string{"identify", "email"}
+		p.profile = discordProfile
+	case config.OAuthMicrosoft:
+		defaultName = "Microsoft"
+		tenant := pc.Tenant
+		if tenant == "" {
+			tenant = "common"
+		}
+		ep = endpoints{
+			auth:     "https://login.microsoftonline.com/" + tenant + "/oauth2/v2.0/authorize",
+			token:    "https://login.microsoftonline.com/" + tenant + "/oauth2/v2.0/token",
+			userInfo: "https://graph.microsoft.com/oidc/userinfo",
+		}
+		defaultScopes = []string{"openid", "email", "profile"}
+	case config.OAuthOIDC:
+		defaultName = name
+		defaultScopes = []string{"openid", "email", "profile"}
+		if pc.AuthURL == "" || pc.TokenURL == "" || pc.UserInfoURL == "" {
+			p.discovery = &oidcDiscovery{issuer: strings.TrimSuffix(pc.Issuer, "/"), client: client}
+		}
+	default:
+		return nil, fmt.Errorf("OAuth provider %s has unknown type %q", name, typ)
+	}
+
+	if pc.AuthURL != "" {
+		ep.auth = pc.AuthURL
+	}
+	if pc.TokenURL != "" {
+		ep.token = pc.TokenURL
+	}
+	if pc.UserInfoURL != "" {
+		ep.userInfo = pc.UserInfoURL
+	}
+	p.endpoints = ep
+	if p.displayName == "" {
+		p.displayName = defaultName
+	}
+	if len(p.scopes) == 0 {
+		p.scopes = defaultScopes
+	}
+	return p, nil
+}
@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"forum/config"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeProvider is an OAuth 2.0 provider with OpenID Connect discovery and PKCE, serving one user.
+type fakeProvider struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu          sync.Mutex
+	discoveries int
+	// challenges maps the codes handed out to the PKCE challenge they were issued for.
+	challenges map[string]string
+}
+
+const (
+	fakeClientID     = "forum-client"
+	fakeClientSecret = "forum-secret"
+	fakeAccessToken  = "access-token-1"
+)
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	f := &fakeProvider{t: t, challenges: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", f.discovery)
+	mux.HandleFunc("/authorize", f.authorize)
+	mux.HandleFunc("/token", f.token)
+	mux.HandleFunc("/userinfo", f.userInfo)
+	mux.HandleFunc("/user", f.githubUser)
+	mux.HandleFunc("/user/emails", f.githubEmails)
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.discoveries++
+	f.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 f.server.URL,
+		"authorization_endpoint": f.server.URL + "/authorize",
+		"token_endpoint":         f.server.URL + "/token",
+		"userinfo_endpoint":      f.server.URL + "/userinfo",
+	})
+}
+
+// authorize signs the user in straight away and sends the browser back with a code.
+func (f *fakeProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != fakeClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	code := "code-" + q.Get("state")
+	f.challenges[code] = q.Get("code_challenge")
+	f.mu.Unlock()
+
+	back := url.Values{"code": {code}, "state": {q.Get("state")}}
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+back.Encode(), http.StatusFound)
+}
+
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != fakeClientID || r.PostForm.Get("client_secret") != fakeClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	f.mu.Lock()
+	challenge, ok := f.challenges[r.PostForm.Get("code")]
+	delete(f.challenges, r.PostForm.Get("code"))
+	f.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "code or verifier does not match"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": fakeAccessToken, "token_type": "Bearer"})
+}
+
+// authorized reports whether r carries the access token, answering 401 if it does not.
+func (f *fakeProvider) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "Bearer "+fakeAccessToken {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (f *fakeProvider) userInfo(w http.ResponseWriter, r *http.Request) {
+	if f.authorized(w, r) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":            "user-42",
+			"email":          "ada@example.com",
+			"email_verified": "true",
+			"given_name":     "Ada",
+			"family_name":    "Lovelace",
+		})
+	}
+}
+
+func (f *fakeProvider) githubUser(w http.ResponseWriter, r *http.Request) {
+	if f.authorized(w, r) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "login": "ada"})
+	}
+}
+
+func (f *fakeProvider) githubEmails(w http.ResponseWriter, r *http.Request) {
+	if f.authorized(w, r) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"email": "old@example.com", "primary": false, "verified": true},
+			{"email": "ada@example.com", "primary": true, "verified": true},
+		})
+	}
+}
+
+// login runs the browser's part of the flow: it follows the authorization URL of p and returns the
+// code the provider sends back to the forum's callback.
+func (f *fakeProvider) login(t *testing.T, p Provider, state, verifier string) string {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, pkceChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := browser.Get(authURL)
+	if err != nil {
+		t.Fatalf("following %s: %v", authURL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("provider answered %s to %s", resp.Status, authURL)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parsing callback: %v", err)
+	}
+	if got := callback.Query().Get("state"); got != state {
+		t.Fatalf("callback has state %q, want %q", got, state)
+	}
+	return callback.Query().Get("code")
+}
+
+func TestOIDCProviderFlow(t *testing.T) {
+	f := newFakeProvider(t)
+	reg, err := NewRegistry(config.OAuthConfig{
+		"corp": {Type: config.OAuthOIDC, ClientID: fakeClientID, ClientSecret: fakeClientSecret, Issuer: f.server.URL + "/"},
+	}, "https://forum.example/", f.server.Client())
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	p, ok := reg.Get("corp")
+	if !ok {
+		t.Fatal("provider corp is not registered")
+	}
+	if p.DisplayName() != "corp" {
+		t.Errorf("DisplayName = %q, want corp", p.DisplayName())
+	}
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", pkceChallenge("verifier-1"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("redirect_uri") != "https://forum.example/auth/corp/callback" || q.Get("scope") != "openid email profile" {
+		t.Errorf("AuthCodeURL = %s", authURL)
+	}
+
+	verifier := "verifier-2-long-enough-to-be-a-real-pkce-verifier"
+	code := f.login(t, p, "state-2", verifier)
+	token, err := p.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if token != fakeAccessToken {
+		t.Errorf("Exchange returned token %q, want %q", token, fakeAccessToken)
+	}
+
+	user, err := p.UserInfo(context.Background(), token)
+	if err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+	want := ExternalUser{Subject: "user-42", Email: "ada@example.com", EmailVerified: true, Name: "Ada Lovelace"}
+	if user != want {
+		t.Errorf("UserInfo = %+v, want %+v", user, want)
+	}
+
+	if f.discoveries != 1 {
+		t.Errorf("discovery document fetched %d times, want once", f.discoveries)
+	}
+}
+
+func TestExchangeChecksVerifier(t *testing.T) {
+	f := newFakeProvider(t)
+	reg, err := NewRegistry(config.OAuthConfig{
+		"corp": {Type: config.OAuthOIDC, ClientID: fakeClientID, ClientSecret: fakeClientSecret, Issuer: f.server.URL},
+	}, "https://forum.example", f.server.Client())
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	p, _ := reg.Get("corp")
+
+	code := f.login(t, p, "state", "the-right-verifier")
+	_, err = p.Exchange(context.Background(), code, "a-wrong-verifier")
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Exchange with the wrong verifier returned %v, want an invalid_grant error", err)
+	}
+	if _, err := p.UserInfo(context.Background(), "stolen-token"); err == nil {
+		t.Error("UserInfo accepted a token the provider never issued")
+	}
+}
+
+func TestOIDCDiscoveryChecksIssuer(t *testing.T) {
+	f := newFakeProvider(t)
+	reg, err := NewRegistry(config.OAuthConfig{
+		"corp": {Type: config.OAuthOIDC, ClientID: fakeClientID, ClientSecret: fakeClientSecret, Issuer: f.server.URL + "/other"},
+	}, "https://forum.example", f.server.Client())
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	p, _ := reg.Get("corp")
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", pkceChallenge("verifier")); err == nil {
+		t.Error("AuthCodeURL succeeded with a discovery document for another issuer")
+	}
+}
+
+func TestOverriddenEndpoints(t *testing.T) {
+	f := newFakeProvider(t)
+	reg, err := NewRegistry(config.OAuthConfig{
+		"github": {
+			ClientID:     fakeClientID,
+			ClientSecret: fakeClientSecret,
+			AuthURL:      f.server.URL + "/authorize",
+			TokenURL:     f.server.URL + "/token",
+			UserInfoURL:  f.server.URL + "/user",
+		},
+	}, "https://forum.example", f.server.Client())
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	p, _ := reg.Get("github")
+
+	verifier := "github-verifier"
+	token, err := p.Exchange(context.Background(), f.login(t, p, "state", verifier), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	user, err := p.UserInfo(context.Background(), token)
+	if err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+	want := ExternalUser{Subject: "42", Email: "ada@example.com", EmailVerified: true, Name: "ada"}
+	if user != want {
+		t.Errorf("UserInfo = %+v, want %+v", user, want)
+	}
+	if f.discoveries != 0 {
+		t.Errorf("discovery document fetched %d times for a provider with fixed endpoints", f.discoveries)
+	}
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The SHA-1 vectors of RFC 6238 Appendix B. The RFC lists eight digits; a six-digit code is the
+// same value modulo 10^6, so it is the last six of them.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestHOTPMatchesRFC6238(t *testing.T) {
+	key, err := base32NoPadding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+	for _, v := range rfc6238Vectors {
+		if got := hotp(key, v.unix/totpPeriod); got != v.code {
+			t.Errorf("hotp at %d = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		at := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, at)
+		if !ok || step != v.unix/totpPeriod {
+			t.Errorf("ValidateTOTP at %d = %d, %v; want %d, true", v.unix, step, ok, v.unix/totpPeriod)
+		}
+	}
+
+	// 1111111109 and 1111111111 fall in consecutive steps, so each code is accepted one step
+	// either side of its own, returning the step it belongs to, but not two steps away.
+	own := int64(1111111111) / totpPeriod
+	for _, offset := range []int64{-totpSkew, totpSkew} {
+		at := time.Unix((own+offset)*totpPeriod, 0)
+		if step, ok := ValidateTOTP(rfc6238Secret, "050471", at); !ok || step != own {
+			t.Errorf("ValidateTOTP %d steps off = %d, %v; want %d, true", offset, step, ok, own)
+		}
+	}
+	for _, offset := range []int64{-totpSkew - 1, totpSkew + 1} {
+		at := time.Unix((own+offset)*totpPeriod, 0)
+		if _, ok := ValidateTOTP(rfc6238Secret, "050471", at); ok {
+			t.Errorf("ValidateTOTP accepted a code %d steps off", offset)
+		}
+	}
+
+	at := time.Unix(59, 0)
+	// lower case and padded secrets are what some apps show
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret)+"====", "287082", at); !ok {
+		t.Error("ValidateTOTP rejected a lower case, padded secret")
+	}
+	for _, code := range []string{"287083", "28708", "2870820", ""} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at); ok {
+			t.Errorf("ValidateTOTP accepted %q", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "287082", at); ok {
+		t.Error("ValidateTOTP accepted a malformed secret")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, %v; want 20", secret, len(key), err)
+	}
+	other, _ := GenerateTOTPSecret()
+	if other == secret {
+		t.Error("two secrets are the same")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' || code != strings.ToLower(code) {
+			t.Errorf("code %q is not formatted as xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q handed out twice", code)
+		}
+		seen[code] = true
+		if hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("hash %d does not match code %q", i, code)
+		}
+		if hashes[i] == code || strings.Contains(hashes[i], strings.Replace(code, "-", "", 1)) {
+			t.Errorf("hash %d stores the code in the clear", i)
+		}
+	}
+
+	// however a code is typed back, it hashes the same
+	code := codes[0]
+	for _, typed := range []string{strings.ToUpper(code), strings.Replace(code, "-", "", 1), " " + strings.Replace(code, "-", " ", 1) + " "} {
+		if HashRecoveryCode(typed) != hashes[0] {
+			t.Errorf("HashRecoveryCode(%q) differs from the hash of %q", typed, code)
+		}
+	}
+	if HashRecoveryCode(codes[1]) == hashes[0] {
+		t.Error("two codes hash the same")
+	}
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	mdlware "forum/middleware"
+	"forum/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+// TwoFactorPath is the page users are sent to when their login needs a second factor.
+const TwoFactorPath = "/twofactor"
+
+// TwoFactorRequired reports whether userID must use two-factor authentication,
+// which is the case for moderators and administrators.
+func (a *Authenticator) TwoFactorRequired(userID int) (bool, error) {
+	privilege, err := a.stores.Users.Privilege(userID)
+	if err != nil {
+		return false, err
+	}
+	return privilege >= 2, nil
+}
+
+// PrivilegeChanged secures the sessions of userID once their privilege level has changed. Their
+// session IDs are replaced on their next request, unless the user now has to use two-factor
+// authentication without having enabled it: their sessions never passed a second factor, so
+// they are ended and the next login goes through enrollment.
+func (a *Authenticator) PrivilegeChanged(userID int) error {
+	required, err := a.TwoFactorRequired(userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		enabled, err := a.stores.TwoFactor.Enabled(userID)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			return a.stores.Sessions.DeleteForUser(userID)
+		}
+	}
+	return a.stores.Sessions.MarkForRotation(userID)
+}
+
+// CompleteLogin finishes the first login step, once userID has proven who they are with their
+// password or through an OAuth provider.
+//
+// Banned users get a *BanError and go no further. If the account has two-factor authentication
+// enabled, or is required to have it, no session is created yet: a login challenge is started and
+// its cookie set, and the caller must send the user to TwoFactorPath. Otherwise the session is
+// started right away.
+//
+// Parameters:
+//   - w: The http.ResponseWriter the cookies are set on.
+//   - r: The login request.
+//   - userID: The user who passed the first step.
+//
+// Returns:
+//   - bool: true if the user still has to pass the second step.
+//   - error: A *BanError if the user is banned, or an error if the database could not be reached.
+func (a *Authenticator) CompleteLogin(w http.ResponseWriter, r *http.Request, userID int) (bool, error) {
+	if err := a.checkBan(userID); err != nil {
+		return false, err
+	}
+
+	enabled, err := a.stores.TwoFactor.Enabled(userID)
+	if err != nil {
+		return false, err
+	}
+	required, err := a.TwoFactorRequired(userID)
+	if err != nil {
+		return false, err
+	}
+
+	if !enabled && !required {
+		return false, a.StartSession(w, r, userID)
+	}
+
+	lifetime := a.cfg.Account.LoginChallengeLifetime.Duration
+	token, err := a.stores.TwoFactor.CreateChallenge(userID, lifetime)
+	if err != nil {
+		return false, err
+	}
+	utils.SetLoginChallengeCookie(w, token, time.Now().Add(lifetime))
+	return true, nil
+}
+
+// StartSession logs userID in: it throws away the session ID the browser presented, if any, so a
+// session ID planted before login is never promoted, then creates a new session and sets its cookie.
+// Banned users are refused here too, so a ban issued during the two-factor step still holds.
+//
+// Parameters:
+//   - w: The http.ResponseWriter the session cookie is set on.
+//   - r: The login request, whose IP address and user agent are recorded with the session.
+//   - userID: The user to log in.
+//
+// Returns:
+//   - error: A *BanError if the user is banned, or an error if the session could not be created.
+func (a *Authenticator) StartSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	if err := a.checkBan(userID); err != nil {
+		return err
+	}
+
+	if oldCookie, err := r.Cookie(utils.SessionCookieName); err == nil {
+		if err := a.stores.Sessions.Delete(oldCookie.Value); err != nil {
+			log.Printf("error deleting the previous session: %v\n", err)
+		}
+	}
+
+	sessionToken, err := utils.GenerateSessionToken()
+	if err != nil {
+		return err
+	}
+	expiryDate := time.Now().Add(a.cfg.Session.Lifetime.Duration)
+
+	err = a.stores.Sessions.Create(sessionToken, userID, expiryDate, mdlware.ClientIP(r, a.trustedProxies), r.UserAgent())
+	if err != nil {
+		return err
+	}
+
+	utils.SetSessionCookie(w, sessionToken, expiryDate)
+	return nil
+}
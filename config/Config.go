@@ -0,0 +1,628 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is prepended to every environment variable the configuration reads.
+// A flag such as -db-path is read from FORUM_DB_PATH.
+const EnvPrefix = "FORUM_"
+
+// oauthNamePattern is what an OAuth provider name may look like; it becomes part of URLs.
+var oauthNamePattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Config holds every setting the forum can be tuned with.
+//
+// Settings are resolved in this order, later sources overriding earlier ones:
+//  1. the defaults returned by Default;
+//  2. a JSON file named by -config or FORUM_CONFIG;
+//  3. FORUM_* environment variables;
+//  4. command-line flags.
+type Config struct {
+	Server    ServerConfig    `json:"server"`
+	Database  DatabaseConfig  `json:"database"`
+	Session   SessionConfig   `json:"session"`
+	RateLimit RateLimitConfig `json:"rateLimit"`
+	Uploads   UploadsConfig   `json:"uploads"`
+	OAuth     OAuthConfig     `json:"oauth"`
+	Account   AccountConfig   `json:"account"`
+	Mail      MailConfig      `json:"mail"`
+}
+
+// ServerConfig is where and how the HTTPS server listens.
+// PublicURL is the address users reach the forum at; links in emails are built from it.
+// SecretKey signs the short-lived cookies of OAuth logins. If it is empty a random key is made at
+// startup, which only means OAuth logins in progress during a restart have to start over.
+// TrustedProxies are the IP addresses or CIDR ranges of the reverse proxies in front of the forum.
+// The X-Forwarded-For and X-Real-IP headers are only believed when they come from one of them;
+// otherwise clients are identified by the address they connect from.
+type ServerConfig struct {
+	Addr           string   `json:"addr"`
+	CertFile       string   `json:"certFile"`
+	KeyFile        string   `json:"keyFile"`
+	PublicURL      string   `json:"publicUrl"`
+	SecretKey      string   `json:"secretKey"`
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+// TrustedProxyNets returns TrustedProxies as networks, a single address becoming a network of
+// one. Entries that are neither are skipped; Validate reports them.
+func (c ServerConfig) TrustedProxyNets() []*net.IPNet {
+	nets := []*net.IPNet{}
+	for _, proxy := range c.TrustedProxies {
+		if n, ok := parseProxy(proxy); ok {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+// parseProxy parses an IP address or CIDR range.
+func parseProxy(proxy string) (*net.IPNet, bool) {
+	if _, n, err := net.ParseCIDR(proxy); err == nil {
+		return n, true
+	}
+	ip := net.ParseIP(proxy)
+	if ip == nil {
+		return nil, false
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, true
+}
+
+// DatabaseConfig mirrors DB.StoreConfig.
+type DatabaseConfig struct {
+	Path            string   `json:"path"`
+	BusyTimeout     Duration `json:"busyTimeout"`
+	MaxOpenConns    int      `json:"maxOpenConns"`
+	MaxIdleConns    int      `json:"maxIdleConns"`
+	ConnMaxLifetime Duration `json:"connMaxLifetime"`
+}
+
+// SessionConfig controls login sessions. Sessions slide: activity in the second half of
+// Lifetime extends them by another Lifetime. JanitorInterval is how often expired sessions (and
+// spent account tokens) are purged.
+type SessionConfig struct {
+	Lifetime        Duration `json:"lifetime"`
+	JanitorInterval Duration `json:"janitorInterval"`
+}
+
+// Names of the rate limit policies the routes are attached to.
+const (
+	PolicyDefault = "default"
+	PolicyAuth    = "auth"
+	PolicyPost    = "post"
+	PolicyComment = "comment"
+	PolicyStatic  = "static"
+)
+
+// RateLimitConfig holds the named rate limit policies and how long idle clients are remembered.
+// Every policy listed above must be present; a policy given in the config file replaces the
+// default one as a whole.
+type RateLimitConfig struct {
+	Policies        map[string]RateLimitPolicy `json:"policies"`
+	ClientTimeout   Duration                   `json:"clientTimeout"`
+	CleanupInterval Duration                   `json:"cleanupInterval"`
+}
+
+// RateLimitPolicy is a token bucket: a client may send Burst requests at once, regains Requests
+// every Period, and is blocked for BlockDuration once the bucket runs dry.
+type RateLimitPolicy struct {
+	Requests      int      `json:"requests"`
+	Period        Duration `json:"period"`
+	Burst         int      `json:"burst"`
+	BlockDuration Duration `json:"blockDuration"`
+}
+
+// Rate returns the number of requests the policy refills per second.
+func (p RateLimitPolicy) Rate() float64 {
+	return float64(p.Requests) / p.Period.Seconds()
+}
+
+// Upload storage drivers.
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// UploadsConfig limits what users may upload and how uploaded images are stored.
+// A post may carry up to MaxImagesPerPost images. Images are shrunk to fit within MaxDimension
+// pixels on their longest side, and get a thumbnail that fits within ThumbnailSize. Images with
+// more than MaxPixels pixels, counting every frame of an animated GIF, are refused before they
+// are decoded. JPEGQuality (1-100) applies to
+// every JPEG the forum writes.
+// Storage selects where the files go: into Dir on the local disk, served by the forum itself, or
+// into an S3-compatible bucket.
+type UploadsConfig struct {
+	Storage          string   `json:"storage"`
+	Dir              string   `json:"dir"`
+	S3               S3Config `json:"s3"`
+	MaxFileSize      int64    `json:"maxFileSize"`
+	MaxImagesPerPost int      `json:"maxImagesPerPost"`
+	MaxPixels        int64    `json:"maxPixels"`
+	MaxDimension     int      `json:"maxDimension"`
+	ThumbnailSize    int      `json:"thumbnailSize"`
+	JPEGQuality      int      `json:"jpegQuality"`
+}
+
+// S3Config is the bucket the s3 storage driver keeps uploads in. Endpoint is the base URL of the
+// service, e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000 for a local MinIO.
+// PathStyle puts the bucket in the path (endpoint/bucket/key) instead of the host name, which
+// MinIO and most other S3-compatible services need.
+// Browsers get a presigned URL for every file that expires after URLExpiry, unless PublicURL is
+// set, e.g. to a CDN or a public bucket, in which case they get PublicURL/key instead.
+type S3Config struct {
+	Endpoint        string   `json:"endpoint"`
+	Region          string   `json:"region"`
+	Bucket          string   `json:"bucket"`
+	AccessKeyID     string   `json:"accessKeyId"`
+	SecretAccessKey string   `json:"secretAccessKey"`
+	PathStyle       bool     `json:"pathStyle"`
+	PublicURL       string   `json:"publicUrl"`
+	URLExpiry       Duration `json:"urlExpiry"`
+}
+
+// OAuth provider types.
+const (
+	OAuthGoogle    = "google"
+	OAuthGitHub    = "github"
+	OAuthGitLab    = "gitlab"
+	OAuthDiscord   = "discord"
+	OAuthMicrosoft = "microsoft"
+	OAuthOIDC      = "oidc"
+)
+
+// oauthFlagProviders are the providers that get -<name>-client-id style flags (and so FORUM_*
+// environment variables). Any other provider can only be set up in the config file.
+var oauthFlagProviders = []string{OAuthGoogle, OAuthGitHub, OAuthGitLab, OAuthDiscord, OAuthMicrosoft}
+
+// OAuthConfig holds the external login providers, keyed by the name used in their URLs:
+// /auth/<name>/login and /auth/<name>/callback. A provider given in the config file replaces
+// the default one as a whole.
+type OAuthConfig map[string]OAuthProviderConfig
+
+// OAuthProviderConfig is one OAuth application. A provider without a client ID is disabled.
+//
+// Type is one of the OAuth* provider types and defaults to the provider's name, so a provider
+// called "github" needs no type. Issuer is the discovery URL of an oidc provider, or the base URL
+// of a self-hosted GitLab; Tenant narrows a microsoft provider to one directory. RedirectURL
+// defaults to /auth/<name>/callback under the server's public URL. AuthURL, TokenURL and
+// UserInfoURL override the endpoints of any type, e.g. to point it at a local test server.
+type OAuthProviderConfig struct {
+	Type         string   `json:"type,omitempty"`
+	DisplayName  string   `json:"displayName,omitempty"`
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectURL  string   `json:"redirectUrl"`
+	Issuer       string   `json:"issuer,omitempty"`
+	Tenant       string   `json:"tenant,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+	AuthURL      string   `json:"authUrl,omitempty"`
+	TokenURL     string   `json:"tokenUrl,omitempty"`
+	UserInfoURL  string   `json:"userInfoUrl,omitempty"`
+}
+
+// Enabled reports whether the provider has been configured.
+func (p OAuthProviderConfig) Enabled() bool {
+	return p.ClientID != ""
+}
+
+// ProviderType returns the type of the provider called name.
+func (p OAuthProviderConfig) ProviderType(name string) string {
+	if p.Type != "" {
+		return p.Type
+	}
+	return name
+}
+
+// listFlag sets a list of strings from a comma-separated value.
+type listFlag struct {
+	list *[]string
+}
+
+func (f listFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	return strings.Join(*f.list, ",")
+}
+
+func (f listFlag) Set(value string) error {
+	*f.list = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*f.list = append(*f.list, item)
+		}
+	}
+	return nil
+}
+
+// oauthFlag sets one field of a provider in an OAuthConfig, creating the provider if needed.
+type oauthFlag struct {
+	providers OAuthConfig
+	name      string
+	field     func(*OAuthProviderConfig) *string
+}
+
+func (f oauthFlag) String() string {
+	if f.providers == nil {
+		return ""
+	}
+	p := f.providers[f.name]
+	return *f.field(&p)
+}
+
+func (f oauthFlag) Set(value string) error {
+	p := f.providers[f.name]
+	*f.field(&p) = value
+	f.providers[f.name] = p
+	return nil
+}
+
+// AccountConfig controls the single-use links emailed for password resets and email verification,
+// and two-factor logins: TwoFactorIssuer is the name authenticator apps show for the forum, and
+// LoginChallengeLifetime is how long a user has to enter their code after their password.
+type AccountConfig struct {
+	PasswordResetLifetime     Duration `json:"passwordResetLifetime"`
+	EmailVerificationLifetime Duration `json:"emailVerificationLifetime"`
+	TwoFactorIssuer           string   `json:"twoFactorIssuer"`
+	LoginChallengeLifetime    Duration `json:"loginChallengeLifetime"`
+}
+
+// Mail drivers.
+const (
+	MailDriverSMTP = "smtp"
+	MailDriverFile = "file"
+	MailDriverLog  = "log"
+)
+
+// MailConfig selects how outgoing email is delivered: through an SMTP server, written as .eml
+// files to Dir, or printed to the server log. The last two are meant for local development.
+type MailConfig struct {
+	Driver string     `json:"driver"`
+	From   string     `json:"from"`
+	Dir    string     `json:"dir"`
+	SMTP   SMTPConfig `json:"smtp"`
+}
+
+// SMTPConfig is the server the smtp mail driver sends through. Username may be empty for servers
+// that do not require authentication.
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Duration is a time.Duration that reads and writes as a string such as "72h" in JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"90s\" or \"72h\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Default returns the settings the forum runs with when nothing is overridden.
+// It holds no secrets: OAuth providers stay disabled until they are configured.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:      ":443",
+			CertFile:  "./cert/cert.pem",
+			KeyFile:   "./cert/key.pem",
+			PublicURL: "https://localhost",
+		},
+		Database: DatabaseConfig{
+			Path:            "./meow.db",
+			BusyTimeout:     Duration{5 * time.Second},
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration{time.Hour},
+		},
+		Session: SessionConfig{
+			Lifetime:        Duration{72 * time.Hour},
+			JanitorInterval: Duration{time.Hour},
+		},
+		RateLimit: RateLimitConfig{
+			Policies: map[string]RateLimitPolicy{
+				PolicyDefault: {Requests: 20, Period: Duration{time.Second}, Burst: 40, BlockDuration: Duration{time.Minute}},
+				PolicyAuth:    {Requests: 5, Period: Duration{time.Minute}, Burst: 5, BlockDuration: Duration{5 * time.Minute}},
+				PolicyPost:    {Requests: 5, Period: Duration{time.Minute}, Burst: 5, BlockDuration: Duration{time.Minute}},
+				PolicyComment: {Requests: 20, Period: Duration{time.Minute}, Burst: 10, BlockDuration: Duration{time.Minute}},
+				PolicyStatic:  {Requests: 100, Period: Duration{time.Second}, Burst: 200, BlockDuration: Duration{time.Minute}},
+			},
+			ClientTimeout:   Duration{10 * time.Minute},
+			CleanupInterval: Duration{time.Minute},
+		},
+		Uploads: UploadsConfig{
+			Storage: StorageLocal,
+			Dir:     "./static/uploads",
+			S3: S3Config{
+				Region:    "us-east-1",
+				PathStyle: true,
+				URLExpiry: Duration{time.Hour},
+			},
+			MaxFileSize:      10 << 20, // 10MB
+			MaxImagesPerPost: 10,
+			MaxPixels:        50_000_000,
+			MaxDimension:     2048,
+			ThumbnailSize:    400,
+			JPEGQuality:      85,
+		},
+		OAuth: OAuthConfig{},
+		Account: AccountConfig{
+			PasswordResetLifetime:     Duration{time.Hour},
+			EmailVerificationLifetime: Duration{48 * time.Hour},
+			TwoFactorIssuer:           "Forum",
+			LoginChallengeLifetime:    Duration{5 * time.Minute},
+		},
+		Mail: MailConfig{
+			Driver: MailDriverLog,
+			From:   "forum@localhost",
+			SMTP:   SMTPConfig{Port: 587},
+		},
+	}
+}
+
+// Load resolves the configuration from the defaults, the config file, the environment and args,
+// which should not include the program name. It returns the validated configuration and the
+// arguments left over after the flags, such as a subcommand.
+func Load(args []string) (Config, []string, error) {
+	// A first, silent pass only looks for -config; every other flag is parsed for real below,
+	// once the file and the environment have been applied underneath it.
+	path := os.Getenv(EnvPrefix + "CONFIG")
+	scratch := Default()
+	pre := newFlagSet(&scratch, &path)
+	pre.SetOutput(io.Discard)
+	pre.Usage = func() {}
+	pre.Parse(args)
+
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	fs := newFlagSet(&cfg, &path)
+	if err := applyEnv(fs); err != nil {
+		return cfg, nil, err
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// Validate checks that the settings are usable and reports every problem it finds at once.
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server address is empty")
+	check(c.Server.CertFile != "", "server certificate file is empty")
+	check(c.Server.KeyFile != "", "server key file is empty")
+	check(strings.HasPrefix(c.Server.PublicURL, "http://") || strings.HasPrefix(c.Server.PublicURL, "https://"), "server public URL must start with http:// or https://")
+	check(c.Server.SecretKey == "" || len(c.Server.SecretKey) >= 32, "server secret key must be at least 32 characters long")
+	for _, proxy := range c.Server.TrustedProxies {
+		_, ok := parseProxy(proxy)
+		check(ok, "trusted proxy %q is neither an IP address nor a CIDR range", proxy)
+	}
+
+	check(c.Database.Path != "", "database path is empty")
+	check(c.Database.BusyTimeout.Duration >= 0, "database busy timeout is negative")
+	check(c.Database.MaxOpenConns > 0, "database max open connections must be positive")
+	check(c.Database.MaxIdleConns >= 0, "database max idle connections is negative")
+
+	check(c.Session.Lifetime.Duration > 0, "session lifetime must be positive")
+	check(c.Session.JanitorInterval.Duration > 0, "session janitor interval must be positive")
+
+	for _, name := range []string{PolicyDefault, PolicyAuth, PolicyPost, PolicyComment, PolicyStatic} {
+		_, ok := c.RateLimit.Policies[name]
+		check(ok, "rate limit policy %q is missing", name)
+	}
+	for name, p := range c.RateLimit.Policies {
+		check(p.Requests > 0, "rate limit policy %q: requests must be positive", name)
+		check(p.Period.Duration > 0, "rate limit policy %q: period must be positive", name)
+		check(p.Burst > 0, "rate limit policy %q: burst must be positive", name)
+		check(p.BlockDuration.Duration >= 0, "rate limit policy %q: block duration is negative", name)
+	}
+	check(c.RateLimit.ClientTimeout.Duration > 0, "rate limit client timeout must be positive")
+	check(c.RateLimit.CleanupInterval.Duration > 0, "rate limit cleanup interval must be positive")
+
+	switch c.Uploads.Storage {
+	case StorageLocal:
+		check(c.Uploads.Dir != "", "upload directory is empty")
+	case StorageS3:
+		check(strings.HasPrefix(c.Uploads.S3.Endpoint, "http://") || strings.HasPrefix(c.Uploads.S3.Endpoint, "https://"), "S3 endpoint must start with http:// or https://")
+		check(c.Uploads.S3.Region != "", "S3 region is empty")
+		check(c.Uploads.S3.Bucket != "", "S3 bucket is empty")
+		check(c.Uploads.S3.AccessKeyID != "" && c.Uploads.S3.SecretAccessKey != "", "S3 access key ID and secret access key are required")
+		check(c.Uploads.S3.URLExpiry.Duration > 0 && c.Uploads.S3.URLExpiry.Duration <= 7*24*time.Hour, "S3 URL expiry must be positive and at most 7 days")
+	default:
+		check(false, "unknown upload storage %q (want %s or %s)", c.Uploads.Storage, StorageLocal, StorageS3)
+	}
+	check(c.Uploads.MaxFileSize > 0, "maximum upload size must be positive")
+	check(c.Uploads.MaxImagesPerPost > 0, "maximum number of images per post must be positive")
+	check(c.Uploads.MaxPixels > 0, "maximum upload pixel count must be positive")
+	check(c.Uploads.MaxDimension > 0, "maximum image dimension must be positive")
+	check(c.Uploads.ThumbnailSize > 0 && c.Uploads.ThumbnailSize <= c.Uploads.MaxDimension, "thumbnail size must be positive and at most the maximum image dimension")
+	check(c.Uploads.JPEGQuality >= 1 && c.Uploads.JPEGQuality <= 100, "JPEG quality must be between 1 and 100")
+
+	for name, p := range c.OAuth {
+		if !p.Enabled() {
+			continue
+		}
+		check(oauthNamePattern.MatchString(name), "OAuth provider name %q may only contain lowercase letters, digits and dashes", name)
+		check(p.ClientSecret != "", "%s OAuth client secret is empty", name)
+		switch p.ProviderType(name) {
+		case OAuthGoogle, OAuthGitHub, OAuthGitLab, OAuthDiscord, OAuthMicrosoft:
+		case OAuthOIDC:
+			discovered := p.AuthURL == "" || p.TokenURL == "" || p.UserInfoURL == ""
+			check(!discovered || p.Issuer != "", "%s OAuth issuer is empty", name)
+		default:
+			check(false, "%s OAuth provider has unknown type %q (want %s, %s, %s, %s, %s or %s)", name, p.ProviderType(name),
+				OAuthGoogle, OAuthGitHub, OAuthGitLab, OAuthDiscord, OAuthMicrosoft, OAuthOIDC)
+		}
+	}
+
+	check(c.Account.PasswordResetLifetime.Duration > 0, "password reset lifetime must be positive")
+	check(c.Account.EmailVerificationLifetime.Duration > 0, "email verification lifetime must be positive")
+	check(c.Account.TwoFactorIssuer != "", "two-factor issuer is empty")
+	check(c.Account.LoginChallengeLifetime.Duration > 0, "login challenge lifetime must be positive")
+
+	check(c.Mail.From != "", "mail sender address is empty")
+	switch c.Mail.Driver {
+	case MailDriverSMTP:
+		check(c.Mail.SMTP.Host != "", "SMTP host is empty")
+		check(c.Mail.SMTP.Port > 0, "SMTP port must be positive")
+	case MailDriverFile:
+		check(c.Mail.Dir != "", "mail directory is empty")
+	case MailDriverLog:
+	default:
+		check(false, "unknown mail driver %q (want %s, %s or %s)", c.Mail.Driver, MailDriverSMTP, MailDriverFile, MailDriverLog)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// loadFile overlays the JSON file at path on top of c. Fields missing from the file keep their value.
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening config file: %v", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// newFlagSet binds a flag to every setting of c, plus -config to path.
+// The flag names double as the environment variable names, see envName.
+func newFlagSet(c *Config, path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("forum", flag.ContinueOnError)
+
+	fs.StringVar(path, "config", *path, "path to a JSON config file")
+
+	fs.StringVar(&c.Server.Addr, "addr", c.Server.Addr, "address the HTTPS server listens on")
+	fs.StringVar(&c.Server.CertFile, "cert-file", c.Server.CertFile, "TLS certificate file")
+	fs.StringVar(&c.Server.KeyFile, "key-file", c.Server.KeyFile, "TLS private key file")
+	fs.StringVar(&c.Server.PublicURL, "public-url", c.Server.PublicURL, "address users reach the forum at, used in emailed links")
+	fs.StringVar(&c.Server.SecretKey, "secret-key", c.Server.SecretKey, "key that signs OAuth login cookies (random if empty)")
+	fs.Var(listFlag{&c.Server.TrustedProxies}, "trusted-proxies", "comma-separated IP addresses or CIDR ranges of the reverse proxies whose forwarded headers are believed")
+
+	fs.StringVar(&c.Database.Path, "db", c.Database.Path, "path to the SQLite database file")
+	fs.DurationVar(&c.Database.BusyTimeout.Duration, "db-busy-timeout", c.Database.BusyTimeout.Duration, "how long a connection waits on a locked database")
+	fs.IntVar(&c.Database.MaxOpenConns, "db-max-open", c.Database.MaxOpenConns, "maximum number of open database connections")
+	fs.IntVar(&c.Database.MaxIdleConns, "db-max-idle", c.Database.MaxIdleConns, "maximum number of idle database connections")
+	fs.DurationVar(&c.Database.ConnMaxLifetime.Duration, "db-conn-max-lifetime", c.Database.ConnMaxLifetime.Duration, "how long a database connection is reused")
+
+	fs.DurationVar(&c.Session.Lifetime.Duration, "session-lifetime", c.Session.Lifetime.Duration, "how long a login session lasts")
+	fs.DurationVar(&c.Session.JanitorInterval.Duration, "session-janitor-interval", c.Session.JanitorInterval.Duration, "how often expired sessions are purged")
+
+	fs.DurationVar(&c.RateLimit.ClientTimeout.Duration, "rate-client-timeout", c.RateLimit.ClientTimeout.Duration, "how long an idle client is remembered")
+	fs.DurationVar(&c.RateLimit.CleanupInterval.Duration, "rate-cleanup-interval", c.RateLimit.CleanupInterval.Duration, "how often idle clients are forgotten")
+
+	fs.StringVar(&c.Uploads.Storage, "upload-storage", c.Uploads.Storage, "where uploaded images are stored: local or s3")
+	fs.StringVar(&c.Uploads.Dir, "upload-dir", c.Uploads.Dir, "directory the local upload storage writes to")
+	fs.StringVar(&c.Uploads.S3.Endpoint, "s3-endpoint", c.Uploads.S3.Endpoint, "base URL of the S3-compatible service")
+	fs.StringVar(&c.Uploads.S3.Region, "s3-region", c.Uploads.S3.Region, "S3 region")
+	fs.StringVar(&c.Uploads.S3.Bucket, "s3-bucket", c.Uploads.S3.Bucket, "S3 bucket uploads are stored in")
+	fs.StringVar(&c.Uploads.S3.AccessKeyID, "s3-access-key-id", c.Uploads.S3.AccessKeyID, "S3 access key ID")
+	fs.StringVar(&c.Uploads.S3.SecretAccessKey, "s3-secret-access-key", c.Uploads.S3.SecretAccessKey, "S3 secret access key")
+	fs.BoolVar(&c.Uploads.S3.PathStyle, "s3-path-style", c.Uploads.S3.PathStyle, "put the S3 bucket in the URL path instead of the host name")
+	fs.StringVar(&c.Uploads.S3.PublicURL, "s3-public-url", c.Uploads.S3.PublicURL, "public base URL of the bucket; presigned URLs are used if empty")
+	fs.DurationVar(&c.Uploads.S3.URLExpiry.Duration, "s3-url-expiry", c.Uploads.S3.URLExpiry.Duration, "how long presigned S3 URLs stay valid")
+	fs.Int64Var(&c.Uploads.MaxFileSize, "upload-max-size", c.Uploads.MaxFileSize, "maximum size of an uploaded image in bytes")
+	fs.IntVar(&c.Uploads.MaxImagesPerPost, "upload-max-images", c.Uploads.MaxImagesPerPost, "maximum number of images per post")
+	fs.Int64Var(&c.Uploads.MaxPixels, "upload-max-pixels", c.Uploads.MaxPixels, "maximum number of pixels of an uploaded image")
+	fs.IntVar(&c.Uploads.MaxDimension, "upload-max-dimension", c.Uploads.MaxDimension, "longest side uploaded images are shrunk to, in pixels")
+	fs.IntVar(&c.Uploads.ThumbnailSize, "upload-thumbnail-size", c.Uploads.ThumbnailSize, "longest side of image thumbnails, in pixels")
+	fs.IntVar(&c.Uploads.JPEGQuality, "upload-jpeg-quality", c.Uploads.JPEGQuality, "quality of re-encoded JPEG images (1-100)")
+
+	if c.OAuth == nil {
+		c.OAuth = OAuthConfig{}
+	}
+	for _, name := range oauthFlagProviders {
+		fs.Var(oauthFlag{c.OAuth, name, func(p *OAuthProviderConfig) *string { return &p.ClientID }}, name+"-client-id", name+" OAuth client ID")
+		fs.Var(oauthFlag{c.OAuth, name, func(p *OAuthProviderConfig) *string { return &p.ClientSecret }}, name+"-client-secret", name+" OAuth client secret")
+		fs.Var(oauthFlag{c.OAuth, name, func(p *OAuthProviderConfig) *string { return &p.RedirectURL }}, name+"-redirect-url", name+" OAuth redirect URL")
+	}
+
+	fs.DurationVar(&c.Account.PasswordResetLifetime.Duration, "password-reset-lifetime", c.Account.PasswordResetLifetime.Duration, "how long a password reset link stays valid")
+	fs.DurationVar(&c.Account.EmailVerificationLifetime.Duration, "email-verification-lifetime", c.Account.EmailVerificationLifetime.Duration, "how long an email verification link stays valid")
+	fs.StringVar(&c.Account.TwoFactorIssuer, "two-factor-issuer", c.Account.TwoFactorIssuer, "name authenticator apps show for the forum")
+	fs.DurationVar(&c.Account.LoginChallengeLifetime.Duration, "login-challenge-lifetime", c.Account.LoginChallengeLifetime.Duration, "how long a user has to enter their two-factor code")
+
+	fs.StringVar(&c.Mail.Driver, "mail-driver", c.Mail.Driver, "how email is delivered: smtp, file or log")
+	fs.StringVar(&c.Mail.From, "mail-from", c.Mail.From, "sender address of outgoing email")
+	fs.StringVar(&c.Mail.Dir, "mail-dir", c.Mail.Dir, "directory the file mail driver writes to")
+	fs.StringVar(&c.Mail.SMTP.Host, "smtp-host", c.Mail.SMTP.Host, "SMTP server host")
+	fs.IntVar(&c.Mail.SMTP.Port, "smtp-port", c.Mail.SMTP.Port, "SMTP server port")
+	fs.StringVar(&c.Mail.SMTP.Username, "smtp-username", c.Mail.SMTP.Username, "SMTP username")
+	fs.StringVar(&c.Mail.SMTP.Password, "smtp-password", c.Mail.SMTP.Password, "SMTP password")
+
+	return fs
+}
+
+// applyEnv sets every flag of fs that has a matching environment variable.
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil || f.Name == "config" {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// envName maps a flag name to its environment variable, e.g. db-max-open to FORUM_DB_MAX_OPEN.
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"forum/DB"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// auditDateLayout is the layout of the from and to dates of AdminAuditLogHandler.
+const auditDateLayout = "2006-01-02"
+
+// AdminAuditLogHandler lists the audit log of privileged actions for admins, newest first, a page
+// at a time. The optional query parameters narrow it down: actor (a username), action, targetType,
+// targetId, and from and to, dates in YYYY-MM-DD form that are both included. before continues
+// from the nextBefore of the previous page.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) AdminAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if user is admin
+	if !h.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := DB.AuditFilter{
+		Actor:      query.Get("actor"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("targetType"),
+	}
+	if filter.Action != "" && !DB.ValidAuditAction(filter.Action) {
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if filter.TargetType != "" && !DB.ValidAuditTarget(filter.TargetType) {
+		http.Error(w, "Invalid target type", http.StatusBadRequest)
+		return
+	}
+
+	var ok bool
+	if filter.TargetID, ok = auditIDParam(query.Get("targetId")); !ok {
+		http.Error(w, "Invalid target ID", http.StatusBadRequest)
+		return
+	}
+	if filter.Before, ok = auditIDParam(query.Get("before")); !ok {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(auditDateLayout, from); err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(auditDateLayout, to); err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		// the whole day of to is included
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+
+	page, err := h.stores.Audit.List(filter)
+	if err != nil {
+		log.Printf("Error querying audit log: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// auditIDParam parses an optional ID query parameter, which is 0 when it is empty.
+func auditIDParam(value string) (int, bool) {
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(value)
+	return id, err == nil && id > 0
+}
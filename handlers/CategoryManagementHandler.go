@@ -3,10 +3,9 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"forum/DB"
 	"log"
 	"net/http"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 // CategoryRequest represents a request to add a new category
@@ -20,76 +19,39 @@ type CategoryDeleteRequest struct {
 	CategoryID int `json:"categoryId"`
 }
 
-// AdminCategory represents a category in the admin interface
-type AdminCategory struct {
-	CategoryID  int    `json:"CategoryID"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	UserID      int    `json:"UserID"`
-}
-
 // AdminCategoriesHandler returns all categories for admin management
-func AdminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Check if user is admin
-	if !isAdmin(r) {
+	if !h.isAdmin(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
+	categories, err := h.stores.Categories.List()
 	if err != nil {
-		log.Printf("Error opening database: %v", err)
+		log.Printf("Error listing categories: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	defer db.Close()
-
-	query := `
-		SELECT CategoryID, title, description, UserID
-		FROM Category
-		ORDER BY title
-	`
-
-	rows, err := db.Query(query)
-	if err != nil {
-		log.Printf("Error querying categories: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var categories []AdminCategory
-	for rows.Next() {
-		var category AdminCategory
-
-		err := rows.Scan(&category.CategoryID, &category.Title, &category.Description,
-			&category.UserID)
-		if err != nil {
-			log.Printf("Error scanning category: %v", err)
-			continue
-		}
-
-		categories = append(categories, category)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(categories)
 }
 
-// AdminAddCategoryHandler adds a new category
-func AdminAddCategoryHandler(w http.ResponseWriter, r *http.Request) {
+// AdminAddCategoryHandler adds a new category and records it in the audit log
+func (h *Handler) AdminAddCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Check if user is admin
-	if !isAdmin(r) {
+	if !h.isAdmin(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -111,41 +73,19 @@ func AdminAddCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
-	// Get admin user ID
-	adminUserID, err := getUserIDByCookie(r, db)
-	if err != nil {
-		log.Printf("Error getting admin user ID: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	// Check if category already exists
-	var existingCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM Category WHERE title = ?", req.Title).Scan(&existingCount)
-	if err != nil {
-		log.Printf("Error checking existing category: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	if existingCount > 0 {
+	_, err := h.stores.Categories.Add(req.Title, req.Description, current.UserID)
+	if err == DB.ErrCategoryExists {
 		http.Error(w, "Category with this title already exists", http.StatusBadRequest)
 		return
 	}
-
-	// Insert new category
-	_, err = db.Exec("INSERT INTO Category (title, description, UserID) VALUES (?, ?, ?)",
-		req.Title, req.Description, adminUserID)
 	if err != nil {
-		log.Printf("Error inserting category: %v", err)
+		log.Printf("Error creating category: %v", err)
 		http.Error(w, "Failed to create category", http.StatusInternalServerError)
 		return
 	}
@@ -157,15 +97,15 @@ func AdminAddCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// AdminDeleteCategoryHandler deletes a category
-func AdminDeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+// AdminDeleteCategoryHandler deletes a category and records it in the audit log
+func (h *Handler) AdminDeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Check if user is admin
-	if !isAdmin(r) {
+	if !h.isAdmin(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -181,59 +121,23 @@ func AdminDeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
-	// Start transaction
-	tx, err := db.Begin()
-	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	defer tx.Rollback()
 
-	// Delete PostCategory relationships first (foreign key constraint)
-	_, err = tx.Exec("DELETE FROM PostCategory WHERE CategoryID = ?", req.CategoryID)
-	if err != nil {
-		log.Printf("Error deleting post category relationships: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	err := h.stores.Categories.Delete(req.CategoryID, current.UserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
 		return
 	}
-
-	// Delete the category
-	result, err := tx.Exec("DELETE FROM Category WHERE CategoryID = ?", req.CategoryID)
 	if err != nil {
 		log.Printf("Error deleting category: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Check if category was actually deleted
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		log.Printf("Error checking rows affected: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	if rowsAffected == 0 {
-		http.Error(w, "Category not found", http.StatusNotFound)
-		return
-	}
-
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -242,56 +146,31 @@ func AdminDeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // PublicCategoriesHandler returns all categories for public use (no admin required)
-func PublicCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) PublicCategoriesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
-	query := `
-		SELECT CategoryID, title, description
-		FROM Category
-		ORDER BY title
-	`
-
-	rows, err := db.Query(query)
+	categories, err := h.stores.Categories.List()
 	if err != nil {
-		log.Printf("Error querying categories: %v", err)
+		log.Printf("Error listing categories: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var categories []struct {
+	// the public list leaves out which admin added each category
+	public := make([]struct {
 		CategoryID  int    `json:"CategoryID"`
 		Title       string `json:"title"`
 		Description string `json:"description"`
-	}
-
-	for rows.Next() {
-		var category struct {
-			CategoryID  int    `json:"CategoryID"`
-			Title       string `json:"title"`
-			Description string `json:"description"`
-		}
-
-		err := rows.Scan(&category.CategoryID, &category.Title, &category.Description)
-		if err != nil {
-			log.Printf("Error scanning category: %v", err)
-			continue
-		}
-
-		categories = append(categories, category)
+	}, len(categories))
+	for i, category := range categories {
+		public[i].CategoryID = category.CategoryID
+		public[i].Title = category.Title
+		public[i].Description = category.Description
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(categories)
+	json.NewEncoder(w).Encode(public)
 }
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"forum/DB"
+	"log"
+	"net/http"
+)
+
+// AdminFilterRulesHandler lists the rules of the content filter.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) AdminFilterRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if user is admin
+	if !h.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rules, err := h.stores.Filter.Rules()
+	if err != nil {
+		log.Printf("Error querying filter rules: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// AdminAddFilterRuleHandler lets admins add a blocked term or regular expression, a denied or
+// allowed link domain, or a cap on the links of new accounts to the content filter. Each rule
+// either rejects matching content or holds it for review.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a FilterRuleRequest; only POST is accepted.
+func (h *Handler) AdminAddFilterRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if user is admin
+	if !h.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req FilterRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ruleID, err := h.stores.Filter.AddRule(DB.FilterRule{
+		Kind:           req.Kind,
+		Pattern:        req.Pattern,
+		MaxLinks:       req.MaxLinks,
+		AccountAgeDays: req.AccountAgeDays,
+		Action:         req.Action,
+	}, current.UserID)
+	if err == DB.ErrInvalidFilterRule {
+		http.Error(w, "Invalid rule: check its kind, action and pattern", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error adding filter rule: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Rule added",
+		"ruleId":  ruleID,
+	})
+}
+
+// AdminDeleteFilterRuleHandler lets admins remove a rule from the content filter.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a DeleteFilterRuleRequest; only POST is accepted.
+func (h *Handler) AdminDeleteFilterRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if user is admin
+	if !h.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DeleteFilterRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RuleID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.stores.Filter.DeleteRule(req.RuleID, current.UserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting filter rule: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Rule deleted",
+	})
+}
+
+// ReviewQueueHandler lists the posts and comments the content filter holds for review, for
+// moderators and admins.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) ReviewQueueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.isModerator(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	held, err := h.stores.Filter.Queue()
+	if err != nil {
+		log.Printf("Error querying review queue: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(held)
+}
+
+// ReviewContentHandler lets moderators and admins publish content the filter held for review, or
+// reject it: rejected posts are soft-deleted and rejected comments deleted.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a ReviewContentRequest; only POST is accepted.
+func (h *Handler) ReviewContentHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReviewContentRequest
+	moderatorID, ok := h.decodeModeration(w, r, &req)
+	if !ok {
+		return
+	}
+	if req.HoldID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.stores.Filter.Review(req.HoldID, moderatorID, req.Approve)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Nothing is waiting for review there", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reviewing held content: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	message := "Content rejected"
+	if req.Approve {
+		message = "Content published"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": message,
+	})
+}
@@ -21,7 +21,7 @@ var (
 // 	}
 // 	defer db.Close()
 
-// 	userID, err := getUserIDByCookie(r, db)
+// 	userID, err := getUserIDByCookie(r)
 // 	if err != nil {
 // 		http.Error(w, `{"success": false, "message": "Error getting user ID"}`, http.StatusInternalServerError)
 // 		return
@@ -4,12 +4,15 @@ import (
 	"database/sql"
 	"encoding/json"
 	"forum/DB"
+	"forum/markdown"
 	"log"
 	"net/http"
 	"strconv"
 )
 
-func CreatCommentHandler(w http.ResponseWriter, r *http.Request) {
+// CreatCommentHandler posts a top-level comment on a post, once it has passed the content filter.
+// A comment the filter holds for review is saved but only shown after a moderator approves it.
+func (h *Handler) CreatCommentHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/", http.StatusMethodNotAllowed)
 		return
@@ -28,21 +31,13 @@ func CreatCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := getUserIDByCookie(r, db)
+	userID, err := h.getUserIDByCookie(r)
 	if err != nil {
 		log.Printf("The Error getting user ID %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusOK)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error getting user %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
-	}
-	defer db.Close()
-
 	intUserID, err := strconv.Atoi(userID)
 	if err != nil {
 		log.Printf("Error converting user ID to int %v\n", err)
@@ -57,64 +52,157 @@ func CreatCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cmntID, err := DB.InsertComment(intPostID, intUserID, comment)
-	if err != nil {
+	match, ok := h.filterComment(w, intUserID, comment)
+	if !ok {
+		return
+	}
+
+	cmntID, err := h.stores.Comments.Create(intPostID, intUserID, comment, match)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err == DB.ErrPostLocked {
+		http.Error(w, "This post is locked for comments", http.StatusForbidden)
+		return
+	} else if err != nil {
 		log.Printf("Error inserting comment %v\n", err)
 		http.Error(w, "Failed to post comment. Please try again.", http.StatusOK)
 		return
 	}
 
-	username, err := DB.GetCommentsUsername(db, userID)
+	username, err := h.stores.Users.Username(intUserID)
 	if err != nil {
 		log.Printf("Error getting username %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusOK)
 		return
 	}
 
-	// Create notification for post owner
-	insertCommentNotification(db, userID, postID)
+	// Notify the post owner once the comment is out
+	if match == nil {
+		if err := h.stores.Notifications.NotifyNewComment(int(cmntID)); err != nil {
+			log.Printf("Error inserting comment notification %v\n", err)
+		}
+	}
 
 	commnetObject := CommentedPost{
-		UserID:     intUserID,
-		UserName:   username,
-		CommentID:  int(cmntID),
-		PostID:     intPostID,
-		Comment:    comment,
-		CreateDate: "now",
-		Likes:      0,
-		Dislikes:   0,
+		UserID:      intUserID,
+		UserName:    username,
+		CommentID:   int(cmntID),
+		PostID:      intPostID,
+		Comment:     comment,
+		CommentHTML: markdown.Render(comment),
+		CreateDate:  "now",
+		Likes:       0,
+		Dislikes:    0,
+		Held:        match != nil,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(commnetObject)
 }
 
-// insertCommentNotification creates a notification for the post owner when someone comments
-func insertCommentNotification(db *sql.DB, userID, postID string) {
-	stmt, err := db.Prepare(`
-        INSERT INTO Notification (UserID, UserToNotify, PostID, NotificationType)
-        VALUES (?,?,?,?);
-    `)
+// CreatReplyHandler posts a reply to an existing comment.
+// The reply joins the parent's post, its author gets a "Reply" notification and the post owner
+// gets the usual "Comment" one, unless either of them is the one replying. Like comments, replies
+// go through the content filter, and no one is notified of a reply held for review.
+func (h *Handler) CreatReplyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Comment == "" {
+		http.Error(w, "Comment cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	parentID, err := strconv.Atoi(req.ParentCommentID)
 	if err != nil {
-		log.Printf("Error preparing comment notification statement: %v\n", err)
+		http.Error(w, "Invalid parent comment ID", http.StatusBadRequest)
 		return
 	}
-	defer stmt.Close()
 
-	postOwnerID, err := GetPostOwnerID(postID, db)
+	userID, err := h.getUserIDByCookie(r)
 	if err != nil {
-		log.Printf("Error getting post owner ID for comment notification: %v\n", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Don't create notification if user is commenting on their own post
-	if userID == postOwnerID {
+	intUserID, err := strconv.Atoi(userID)
+	if err != nil {
+		log.Printf("Error converting user ID to int %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	match, ok := h.filterComment(w, intUserID, req.Comment)
+	if !ok {
 		return
 	}
 
-	_, err = stmt.Exec(userID, postOwnerID, postID, "Comment")
+	replyID, postID, err := h.stores.Comments.Reply(parentID, intUserID, req.Comment, match)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err == DB.ErrPostLocked {
+		http.Error(w, "This post is locked for comments", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Printf("Error inserting reply %v\n", err)
+		http.Error(w, "Failed to post reply. Please try again.", http.StatusInternalServerError)
+		return
+	}
+
+	username, err := h.stores.Users.Username(intUserID)
 	if err != nil {
-		log.Printf("Error inserting comment notification: %v\n", err)
+		log.Printf("Error getting username %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+
+	if match == nil {
+		if err := h.stores.Notifications.NotifyNewComment(int(replyID)); err != nil {
+			log.Printf("Error inserting reply notifications %v\n", err)
+		}
+	}
+
+	replyObject := CommentedPost{
+		UserID:          intUserID,
+		UserName:        username,
+		CommentID:       int(replyID),
+		PostID:          postID,
+		ParentCommentID: parentID,
+		Comment:         req.Comment,
+		CommentHTML:     markdown.Render(req.Comment),
+		CreateDate:      "now",
+		Likes:           0,
+		Dislikes:        0,
+		Held:            match != nil,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replyObject)
+}
+
+// filterComment runs a comment of userID through the content filter. It returns the match to
+// hold the comment for review with, nil if it may be published, or false once it has answered the
+// request itself because the comment was rejected or the filter failed.
+func (h *Handler) filterComment(w http.ResponseWriter, userID int, comment string) (*DB.FilterMatch, bool) {
+	match, err := h.stores.Filter.Check(userID, comment)
+	if err != nil {
+		log.Printf("Error filtering comment %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if match.Rejected() {
+		http.Error(w, "Your comment was rejected: it "+match.Reason, http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	return match, true
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -12,39 +13,36 @@ import (
 // DeleteCommentHandler handles HTTP POST requests to delete a comment from the forum.
 // It expects a form value "commentId" representing the ID of the comment to be deleted.
 // Only admins (privilege level 3) can delete comments.
-// The function opens a connection to the SQLite database "meow.db", deletes the comment with the given ID,
-// and returns a success response.
+// The comment is deleted together with its replies and reactions, and the deletion is recorded
+// in the audit log.
 //
 // If the request method is not POST, it returns a "Method not allowed" error.
 // If the user is not an admin, it returns an "Unauthorized" error.
-// If there is an error opening the database connection or deleting the comment,
-// it returns an "Internal Server Error" response.
-func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+// If the comment does not exist, it returns a "Comment not found" error.
+// If there is an error deleting the comment, it returns an "Internal Server Error" response.
+func (h *Handler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Check if user is admin (only admins can delete comments)
-	cookie, err := r.Cookie("sessionID")
-	if err != nil || !isValidSession(cookie.Value) {
+	if !h.isValidSession(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	privilege, err := getPrivilege(cookie.Value)
+	privilege, err := h.getPrivilege(r)
 	if err != nil || privilege != 3 {
 		http.Error(w, "Unauthorized - Admin access required", http.StatusUnauthorized)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	defer db.Close()
 
 	r.ParseForm()
 	commentID := r.FormValue("commentId")
@@ -54,59 +52,23 @@ func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Start transaction to ensure atomicity
-	tx, err := db.Begin()
+	commentIDInt, err := strconv.Atoi(commentID)
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
 		return
 	}
-	defer tx.Rollback()
 
-	// Delete comment likes first (foreign key constraint)
-	_, err = tx.Exec("DELETE FROM CommentLike WHERE CommentID = ?", commentID)
-	if err != nil {
-		log.Printf("Error deleting comment likes: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	// Delete comment dislikes (foreign key constraint)
-	_, err = tx.Exec("DELETE FROM CommentDislike WHERE CommentID = ?", commentID)
-	if err != nil {
-		log.Printf("Error deleting comment dislikes: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	err = h.stores.Comments.Delete(commentIDInt, current.UserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment not found", http.StatusNotFound)
 		return
 	}
-
-	// Delete the comment itself
-	result, err := tx.Exec("DELETE FROM Comment WHERE CommentID = ?", commentID)
 	if err != nil {
 		log.Printf("Error deleting comment: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Check if comment was actually deleted
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		log.Printf("Error checking rows affected: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	if rowsAffected == 0 {
-		http.Error(w, "Comment not found", http.StatusNotFound)
-		return
-	}
-
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"success": true, "message": "Comment deleted successfully"}`)
 }
@@ -3,56 +3,67 @@ package handlers
 import (
 	"database/sql"
 	"fmt"
-	"forum/DB"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
-// DelPostHandler handles HTTP POST requests to delete a post from the forum.
-// It expects a form value "postId" representing the ID of the post to be deleted.
-// The function opens a connection to the SQLite database "meow.db", deletes the post with the given ID,
-// and redirects the client to the "/categories" page.
+// DelPostHandler handles HTTP POST requests from moderators and admins to delete a post from the forum.
+// It expects the form values "postId", the ID of the post to be deleted, and "reason", why it is deleted.
+// The post is soft-deleted: it disappears from the forum but is kept, with its comments, for the record,
+// and can be restored through PostVisibilityHandler. The deletion is recorded in the audit log.
 //
 // If the request method is not POST, it returns a "Method not allowed" error.
-// If there is an error opening the database connection or deleting the post,
-// it returns an "Internal Server Error" response.
-//
-// The function uses the HX-Redirect header to perform the client-side redirect.
-func DelPostHandler(w http.ResponseWriter, r *http.Request) {
+// If there is an error deleting the post, it returns an "Internal Server Error" response.
+func (h *Handler) DelPostHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Check if user is admin or moderator
-	cookie, err := r.Cookie("sessionID")
-	if err != nil || !isValidSession(cookie.Value) {
+	if !h.isValidSession(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	privilege, err := getPrivilege(cookie.Value)
+	privilege, err := h.getPrivilege(r)
 	if err != nil || privilege < 2 { // Must be moderator (2) or admin (3)
 		http.Error(w, "Unauthorized - Moderator or Admin access required", http.StatusUnauthorized)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	defer db.Close()
 
 	r.ParseForm()
 	postID := r.FormValue("postId")
+	reason := strings.TrimSpace(r.FormValue("reason"))
 
 	if postID == "" {
 		http.Error(w, "Post ID is required", http.StatusBadRequest)
 		return
 	}
+	if reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
 
-	err = DB.DelPost(db, postID)
+	postIDInt, err := strconv.Atoi(postID)
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.stores.Posts.Delete(postIDInt, current.UserID, reason)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Printf("Error deleting post: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -7,8 +7,6 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 type EditCommentRequest struct {
@@ -21,7 +19,9 @@ type EditCommentResponse struct {
 	Message string `json:"message"`
 }
 
-func EditCommentHandler(w http.ResponseWriter, r *http.Request) {
+// EditCommentHandler saves an edit of a comment by its author, once it has passed the content
+// filter. A comment whose edit is held for review is hidden until a moderator approves it.
+func (h *Handler) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -43,16 +43,8 @@ func EditCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
 	// Get user ID from session
-	userIDStr, err := getUserIDByCookie(r, db)
+	userIDStr, err := h.getUserIDByCookie(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -71,8 +63,7 @@ func EditCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user owns the comment
-	var commentOwnerID int
-	err = db.QueryRow("SELECT UserID FROM Comment WHERE CommentID = ?", commentID).Scan(&commentOwnerID)
+	commentOwnerID, err := h.stores.Comments.OwnerID(commentID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			w.Header().Set("Content-Type", "application/json")
@@ -96,24 +87,43 @@ func EditCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	content := strings.TrimSpace(req.Content)
+	match, err := h.stores.Filter.Check(userID, content)
+	if err != nil {
+		log.Printf("Error filtering comment edit: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if match.Rejected() {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EditCommentResponse{
+			Success: false,
+			Message: "Your edit was rejected: it " + match.Reason,
+		})
+		return
+	}
+
 	// Update the comment
-	_, err = db.Exec("UPDATE Comment SET content = ? WHERE CommentID = ?", 
-		strings.TrimSpace(req.Content), commentID)
+	err = h.stores.Comments.Update(commentID, userID, content, match)
 	if err != nil {
 		log.Printf("Error updating comment: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	message := "Comment updated successfully"
+	if match != nil {
+		message = "Comment updated. It is hidden until a moderator reviews your changes"
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(EditCommentResponse{
 		Success: true,
-		Message: "Comment updated successfully",
+		Message: message,
 	})
 }
 
 // GetCommentForEdit returns comment data for editing
-func GetCommentForEditHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetCommentForEditHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -125,16 +135,8 @@ func GetCommentForEditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
 	// Get user ID from session
-	userIDStr, err := getUserIDByCookie(r, db)
+	userIDStr, err := h.getUserIDByCookie(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -153,8 +155,12 @@ func GetCommentForEditHandler(w http.ResponseWriter, r *http.Request) {
 		UserID    int    `json:"user_id"`
 	}
 
-	err = db.QueryRow("SELECT CommentID, content, UserID FROM Comment WHERE CommentID = ?", commentID).
-		Scan(&comment.CommentID, &comment.Content, &comment.UserID)
+	comment.CommentID, err = strconv.Atoi(commentID)
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+	comment.Content, comment.UserID, err = h.stores.Comments.Source(comment.CommentID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Comment not found", http.StatusNotFound)
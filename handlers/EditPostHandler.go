@@ -3,18 +3,32 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"forum/DB"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
-
-	_ "github.com/mattn/go-sqlite3"
+	"unicode/utf8"
 )
 
+// EditPostRequest is an edit of a post. Images, when present, is the post's new gallery in order:
+// every existing image to keep, with its alt text. Images left out are removed. When it is absent
+// the gallery stays as it is.
+// Sent as multipart/form-data instead of JSON, the same fields are form values, with images holding
+// the JSON array, and every file sent as "image" is added to the end of the gallery, with the
+// "alt" value at the same position as its alt text.
 type EditPostRequest struct {
-	PostID  string `json:"post_id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	PostID  string          `json:"post_id"`
+	Title   string          `json:"title"`
+	Content string          `json:"content"`
+	Images  []EditPostImage `json:"images"`
+}
+
+// EditPostImage is an existing image kept by an edit.
+type EditPostImage struct {
+	ImageID int    `json:"image_id"`
+	AltText string `json:"alt_text"`
 }
 
 type EditPostResponse struct {
@@ -22,14 +36,33 @@ type EditPostResponse struct {
 	Message string `json:"message"`
 }
 
-func EditPostHandler(w http.ResponseWriter, r *http.Request) {
+// EditPostHandler saves an edit of a post by its author. The new title and content go through the
+// content filter first: the edit is refused if a rule rejects it, and the post is hidden until a
+// moderator reviews the edit if a rule holds it.
+func (h *Handler) EditPostHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req EditPostRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	multipart := strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+	if multipart {
+		r.Body = http.MaxBytesReader(w, r.Body, h.uploadRequestLimit())
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.PostID = r.FormValue("post_id")
+		req.Title = r.FormValue("title")
+		req.Content = r.FormValue("content")
+		if raw := r.FormValue("images"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Images); err != nil {
+				http.Error(w, "Invalid images", http.StatusBadRequest)
+				return
+			}
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -44,16 +77,8 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
 	// Get user ID from session
-	userIDStr, err := getUserIDByCookie(r, db)
+	userIDStr, err := h.getUserIDByCookie(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -72,8 +97,7 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user owns the post
-	var postOwnerID int
-	err = db.QueryRow("SELECT UserID FROM Post WHERE PostID = ?", postID).Scan(&postOwnerID)
+	postOwnerID, err := h.stores.Posts.OwnerID(postID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			w.Header().Set("Content-Type", "application/json")
@@ -97,24 +121,107 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update the post
-	_, err = db.Exec("UPDATE Post SET title = ?, content = ? WHERE PostID = ?", 
-		strings.TrimSpace(req.Title), strings.TrimSpace(req.Content), postID)
+	title, content := strings.TrimSpace(req.Title), strings.TrimSpace(req.Content)
+	match, err := h.stores.Filter.Check(userID, title+"\n"+content)
+	if err != nil {
+		log.Printf("Error filtering post edit: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if match.Rejected() {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EditPostResponse{
+			Success: false,
+			Message: "Your edit was rejected: it " + match.Reason,
+		})
+		return
+	}
+
+	current, err := h.stores.Posts.Images(postID)
+	if err != nil {
+		log.Printf("Error getting post images: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	gallery := current
+	if req.Images != nil {
+		var message string
+		gallery, message = keptImages(current, req.Images)
+		if message != "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(EditPostResponse{
+				Success: false,
+				Message: message,
+			})
+			return
+		}
+	}
+
+	var added []DB.PostImage
+	if multipart {
+		var message string
+		added, message, _ = h.saveUploadedImages(r, len(gallery))
+		if message != "" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(EditPostResponse{
+				Success: false,
+				Message: message,
+			})
+			return
+		}
+		gallery = append(gallery, added...)
+	}
+
+	// Update the post and its gallery
+	removed, err := h.stores.Posts.Update(postID, userID, title, content, gallery, match)
 	if err != nil {
 		log.Printf("Error updating post: %v", err)
+		h.removeUnusedImageFiles(added)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	h.removeUnusedImageFiles(removed)
 
+	message := "Post updated successfully"
+	if match != nil {
+		message = "Post updated. It is hidden until a moderator reviews your changes"
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(EditPostResponse{
 		Success: true,
-		Message: "Post updated successfully",
+		Message: message,
 	})
 }
 
+// keptImages builds the gallery an edit keeps from the post's current images, in the order the edit
+// lists them and with their new alt texts. It returns a message to show if the edit names an image
+// the post does not have, names one twice or gives one too long an alt text.
+func keptImages(current []DB.PostImage, kept []EditPostImage) ([]DB.PostImage, string) {
+	byID := make(map[int]DB.PostImage, len(current))
+	for _, image := range current {
+		byID[image.ImageID] = image
+	}
+
+	gallery := make([]DB.PostImage, 0, len(kept))
+	for _, k := range kept {
+		image, ok := byID[k.ImageID]
+		if !ok {
+			return nil, "Image not found"
+		}
+		delete(byID, k.ImageID)
+
+		image.AltText = strings.TrimSpace(k.AltText)
+		if utf8.RuneCountInString(image.AltText) > maxAltTextLength {
+			return nil, fmt.Sprintf("Alt text can be at most %d characters long.", maxAltTextLength)
+		}
+		gallery = append(gallery, image)
+	}
+	return gallery, ""
+}
+
 // GetPostForEdit returns post data for editing
-func GetPostForEditHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetPostForEditHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -126,16 +233,8 @@ func GetPostForEditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
 	// Get user ID from session
-	userIDStr, err := getUserIDByCookie(r, db)
+	userIDStr, err := h.getUserIDByCookie(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -149,14 +248,19 @@ func GetPostForEditHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get post data
 	var post struct {
-		PostID  int    `json:"post_id"`
-		Title   string `json:"title"`
-		Content string `json:"content"`
-		UserID  int    `json:"user_id"`
+		PostID  int            `json:"post_id"`
+		Title   string         `json:"title"`
+		Content string         `json:"content"`
+		UserID  int            `json:"user_id"`
+		Images  []DB.PostImage `json:"images"`
 	}
 
-	err = db.QueryRow("SELECT PostID, title, content, UserID FROM Post WHERE PostID = ?", postID).
-		Scan(&post.PostID, &post.Title, &post.Content, &post.UserID)
+	post.PostID, err = strconv.Atoi(postID)
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	post.Title, post.Content, post.UserID, err = h.stores.Posts.Source(post.PostID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Post not found", http.StatusNotFound)
@@ -173,6 +277,16 @@ func GetPostForEditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	post.Images, err = h.stores.Posts.Images(post.PostID)
+	if err != nil {
+		log.Printf("Error getting post images: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if post.Images == nil {
+		post.Images = []DB.PostImage{}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(post)
 }
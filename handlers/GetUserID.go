@@ -4,10 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
-)
-
-const (
-	getUserIDQuery = `SELECT user_id FROM Session WHERE session_id = ?`
+	"strconv"
 )
 
 // getUserIDByCookie retrieves the user ID associated with a session cookie.
@@ -15,66 +12,31 @@ const (
 // Parameters:
 //   - r: An http.Request object containing the client's request information,
 //     including cookies.
-//   - db: A pointer to sql.DB representing the database connection.
 //
 // Returns:
 //   - A string containing the user ID if successful.
-//   - An error if any step in the process fails (e.g., cookie retrieval,
-//     database query preparation, or query execution).
-func getUserIDByCookie(r *http.Request, db *sql.DB) (string, error) {
-	yummyCookie, err := r.Cookie("sessionID")
-	if err != nil {
-		return "", fmt.Errorf("error getting cookie: %v", err)
-	}
-
-	stmt, err := db.Prepare(getUserIDQuery)
-	if err != nil {
-		return "", fmt.Errorf("error preparing statement: %v", err)
-	}
-	defer stmt.Close()
-
-	var userID string
-
-	err = stmt.QueryRow(yummyCookie.Value).Scan(&userID)
-	if err != nil {
-		return "", fmt.Errorf("error getting user ID: %v", err)
-	}
-
-	return userID, err
-}
-
-func GetPostOwnerID(PostID string, db *sql.DB) (string, error) {
-	stmt, err := db.Prepare(`SELECT UserID FROM Post WHERE PostID =?;`)
-	if err != nil {
-		return "", fmt.Errorf("error preparing statement: %v", err)
-	}
-	defer stmt.Close()
-
-	var userID string
-	err = stmt.QueryRow(PostID).Scan(&userID)
-	if err == sql.ErrNoRows {
-		return "", fmt.Errorf("post not found")
-	} else if err != nil {
-		return "", fmt.Errorf("error getting user ID: %v", err)
+//   - An error if the request has no live session (see currentSession).
+func (h *Handler) getUserIDByCookie(r *http.Request) (string, error) {
+	current, ok := h.currentSession(r)
+	if !ok {
+		return "", fmt.Errorf("no live session")
 	}
 
-	return userID, nil
+	return strconv.Itoa(current.UserID), nil
 }
 
-func GetCommentOwnerID(CommentID string, db *sql.DB) (string, error) {
-	stmt, err := db.Prepare(`SELECT UserID FROM Comment WHERE CommentID =?;`)
+func (h *Handler) GetCommentOwnerID(CommentID string) (string, error) {
+	commentID, err := strconv.Atoi(CommentID)
 	if err != nil {
-		return "", fmt.Errorf("error preparing statement: %v", err)
+		return "", fmt.Errorf("invalid comment ID: %v", err)
 	}
-	defer stmt.Close()
 
-	var userID string
-	err = stmt.QueryRow(CommentID).Scan(&userID)
+	userID, err := h.stores.Comments.OwnerID(commentID)
 	if err == sql.ErrNoRows {
 		return "", fmt.Errorf("comment not found")
 	} else if err != nil {
 		return "", fmt.Errorf("error getting user ID: %v", err)
 	}
 
-	return userID, nil
+	return strconv.Itoa(userID), nil
 }
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// IdentitiesHandler lists the login providers with the accounts the logged in user has linked to them.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) IdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := h.stores.Identities.ListForUser(current.UserID)
+	if err != nil {
+		log.Printf("Error listing identities: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	infos := []IdentityInfo{}
+	linked := map[string]bool{}
+	for _, id := range identities {
+		info := IdentityInfo{
+			Provider:    id.Provider,
+			DisplayName: id.Provider,
+			Linked:      true,
+			Email:       id.Email,
+			LinkedAt:    &id.LinkedAt,
+			LastUsedAt:  &id.LastUsedAt,
+		}
+		if p, ok := h.providers.Get(id.Provider); ok {
+			info.DisplayName = p.DisplayName()
+		}
+		infos = append(infos, info)
+		linked[id.Provider] = true
+	}
+	for _, p := range h.providers.List() {
+		if !linked[p.Name()] {
+			infos = append(infos, IdentityInfo{
+				Provider:    p.Name(),
+				DisplayName: p.DisplayName(),
+				LinkURL:     "/auth/" + p.Name() + "/link",
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+// UnlinkIdentityHandler removes the link between the logged in user and their account at a login
+// provider. Every user has a password, so this never locks anyone out.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is an UnlinkIdentityRequest; only POST is accepted.
+func (h *Handler) UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req UnlinkIdentityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Provider == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	unlinked, err := h.stores.Identities.Unlink(current.UserID, req.Provider)
+	if err != nil {
+		log.Printf("Error unlinking identity: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !unlinked {
+		http.Error(w, "No linked account for this provider", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Account unlinked",
+	})
+}
@@ -2,31 +2,27 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"forum/utils"
+	"forum/auth"
 	"log"
 	"net/http"
-	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-const (
-	GetUserByEmailQuery = `SELECT password, UserID FROM User WHERE username = ? OR email = ?`
-	InsertSessionQuery  = `INSERT INTO Session (session_id, user_id, created_at, expiry_date, ip_address) VALUES (?,?,?,?,?)`
-	checkSessionQuery   = `SELECT session_id FROM Session WHERE user_id = ?`
-)
-
 // LoginHandler handles user login requests.
 // It authenticates the user using their username or email and password.
 // If the credentials are valid, it creates a new session token, stores it in the database,
 // and sets a cookie with the session token for subsequent requests.
-// If the user already has an active session, it deletes the previous session and creates a new one.
+// The session ID the browser presented before logging in, if any, is discarded; sessions on other devices are kept.
+// Accounts with two-factor authentication (mandatory for moderators and administrators) get no session yet:
+// they are sent to the two-factor page to enter their code first. Banned users are told why and until when.
 //
 // Parameters:
 //   - w: An http.ResponseWriter to write the response.
 //   - r: An *http.Request containing the incoming HTTP request.
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/", http.StatusMethodNotAllowed)
 		return
@@ -36,33 +32,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	password := r.FormValue("password")
 	username := r.FormValue("username")
 
-	var hashedPassword string
-	var usrID string
-
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error Opening the DB %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
-	}
-	defer db.Close()
-
-	err = db.Ping()
-	if err != nil {
-		log.Printf("Error Pinging the DB %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
-	}
-
-	stmt, err := db.Prepare(GetUserByEmailQuery)
-	if err != nil {
-		log.Printf("Error preparing the statement: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer stmt.Close()
-
-	err = stmt.QueryRow(username, username).Scan(&hashedPassword, &usrID)
+	usrID, hashedPassword, err := h.stores.Users.Credentials(username)
 	if err != nil {
 		log.Printf("Error Querying the DB %v\n", err)
 		if err == sql.ErrNoRows {
@@ -80,110 +50,29 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	insertSession := func() error {
-		sessionToken, err := utils.GenerateSessionToken()
-		if err != nil {
-			log.Printf("Error generating session token: %v\n", err)
-			http.Error(w, "Internal Server Error", http.StatusOK)
-			return fmt.Errorf(`error generating session token: %v\n`, err)
-		}
-		expiryDate := time.Now().Add(72 * time.Hour)
-		ipAddr := utils.GetIP(r)
-
-		stmt, err = db.Prepare(InsertSessionQuery)
-		if err != nil {
-			log.Printf("Error preparing the insertion statement: %v\n", err)
-			http.Error(w, "Internal Server Error", http.StatusOK)
-			return fmt.Errorf(`error preparing the insertion statement: %v\n`, err)
-		}
-		defer stmt.Close()
-
-		_, err = stmt.Exec(sessionToken, usrID, time.Now(), expiryDate, ipAddr)
-		if err != nil {
-			log.Printf("Error Inserting to the DB: %v\n", err)
-			http.Error(w, "Internal Server Error", http.StatusOK)
-			return fmt.Errorf(`error inserting to the DB: %v\n`, err)
-		}
-
-		yummyCookie := &http.Cookie{
-			Name:     "sessionID",
-			Value:    sessionToken,
-			Expires:  expiryDate,
-			Path:     "/",
-			Secure:   true, // Set to true if testing with HTTPS
-			HttpOnly: false,
-			SameSite: http.SameSiteNoneMode,
-		}
-
-		http.SetCookie(w, yummyCookie)
-		log.Printf("Attempting to set cookie: %s\n", yummyCookie.String())
-		return nil
-	}
-
-	// ! START: CHECK if user have another session
-	stmt, err = db.Prepare(checkSessionQuery)
-	if err != nil {
-		log.Printf("Error preparing the statement: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
+	// ! START: start a new session (or the two-factor step); sessions on other devices stay signed in
+	needsSecondFactor, err := h.auth.CompleteLogin(w, r, usrID)
+	var banErr *auth.BanError
+	if errors.As(err, &banErr) {
+		http.Error(w, banErr.Error(), http.StatusOK)
 		return
 	}
-	defer stmt.Close()
-
-	row := stmt.QueryRow(usrID)
-	err = row.Err()
 	if err != nil {
-		log.Printf("Error querying the DB: %v\n", err)
+		log.Printf("Error completing login: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusOK)
 		return
 	}
-
-	if row == nil {
-		err = insertSession()
-		if err != nil {
-			log.Printf("Error inserting to the DB after checking previous session: %v\n", err)
-			http.Error(w, "Internal Server Error", http.StatusOK)
-			return
-		}
-	} else {
-		// Delete old session and cookie
-		stmt, err := db.Prepare("DELETE FROM Session WHERE user_id =?")
-		if err != nil {
-			log.Printf("Error preparing the deletion statement: %v\n", err)
-			http.Error(w, "Internal Server Error", http.StatusOK)
-			return
-		}
-		defer stmt.Close()
-		_, err = stmt.Exec(usrID)
-		if err != nil {
-			log.Printf("Error deleting from the DB: %v\n", err)
-			http.Error(w, "Internal Server Error", http.StatusOK)
-			return
-		}
-
-		expiredCookie := &http.Cookie{
-			Name:     "sessionID",
-			Value:    "",
-			Expires:  time.Unix(0, 0),
-			Path:     "/",
-			Secure:   true,
-			HttpOnly: true,
-			SameSite: http.SameSiteNoneMode,
-		}
-		http.SetCookie(w, expiredCookie)
-
-		err = insertSession()
-		if err != nil {
-			log.Printf("Error inserting to the DB after deleting previous session: %v\n", err)
-			http.Error(w, "Internal Server Error", http.StatusOK)
-			return
-		}
+	if needsSecondFactor {
+		w.Header().Set("HX-Redirect", auth.TwoFactorPath)
+		w.Write([]byte("Enter your two-factor authentication code"))
+		return
 	}
+	// ! END: start a new session
 
 	// Redirect the user after login
 	w.Header().Set("HX-Redirect", "/home")
 	w.WriteHeader(http.StatusOK)
 
-	// ! END: CHECK if user have another session
 	//https://community.auth0.com/t/how-to-log-user-out-after-cookie-expiration-in-go/151913
 	w.Write([]byte("Login successful"))
 
@@ -1,9 +1,10 @@
 package handlers
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
+
+	"forum/utils"
 )
 
 // LogoutHandler handles the user logout process.
@@ -16,7 +17,7 @@ import (
 //
 // The function does not return any value, but it writes to the response writer
 // and sets headers to manage the logout process and redirection.
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/", http.StatusMethodNotAllowed)
@@ -24,7 +25,7 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// get the 🍪
-	yummyCookie, err := r.Cookie("sessionID")
+	yummyCookie, err := r.Cookie(utils.SessionCookieName)
 	if err != nil {
 		fmt.Printf("error getting cookie: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusOK)
@@ -34,7 +35,7 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sessionToken := yummyCookie.Value
-	err = deleteSession(sessionToken)
+	err = h.deleteSession(sessionToken)
 	if err != nil {
 		fmt.Printf("error getting cookie: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusOK)
@@ -43,13 +44,7 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:   "sessionID",
-		Value:  "",
-		Path:   "/",
-		Secure: true,
-		MaxAge: -1,
-	})
+	utils.ClearSessionCookie(w)
 
 	// w.Write([]byte("Logout successful"))
 
@@ -65,27 +60,9 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 //
 // Returns:
 //   - error: An error if any step in the process fails, nil otherwise.
-//     Possible errors include database connection issues, SQL query preparation problems,
-//     or failures in executing the delete operation.
-func deleteSession(session_id string) error {
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		return fmt.Errorf("error opening the DB %v", err)
-	}
-	defer db.Close()
-
-	err = db.Ping()
-	if err != nil {
-		return fmt.Errorf("error pinging the DB %v", err)
-	}
-
-	stmt, err := db.Prepare("DELETE FROM Session WHERE session_id =?")
-	if err != nil {
-		return fmt.Errorf("error preparing the statement %v", err)
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec(session_id)
+//     Possible errors include failures in executing the delete operation.
+func (h *Handler) deleteSession(session_id string) error {
+	err := h.stores.Sessions.Delete(session_id)
 	if err != nil {
 		return fmt.Errorf("error deleting from the DB %v", err)
 	}
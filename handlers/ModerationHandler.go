@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"forum/DB"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PostVisibilityHandler lets moderators and admins hide a post, soft-delete it with a reason, or
+// make a hidden or deleted post visible again.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a PostVisibilityRequest; only POST is accepted.
+func (h *Handler) PostVisibilityHandler(w http.ResponseWriter, r *http.Request) {
+	var req PostVisibilityRequest
+	moderatorID, ok := h.decodeModeration(w, r, &req)
+	if !ok {
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.PostID <= 0 || !DB.ValidVisibility(req.Visibility) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Visibility == DB.PostDeleted && req.Reason == "" {
+		http.Error(w, "A reason is required to delete a post", http.StatusBadRequest)
+		return
+	}
+
+	err := h.stores.Posts.SetVisibility(req.PostID, moderatorID, req.Visibility, req.Reason)
+	respondModeration(w, err, "Post is now "+req.Visibility)
+}
+
+// LockPostHandler lets moderators and admins lock a post against new comments, or unlock it.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a LockPostRequest; only POST is accepted.
+func (h *Handler) LockPostHandler(w http.ResponseWriter, r *http.Request) {
+	var req LockPostRequest
+	moderatorID, ok := h.decodeModeration(w, r, &req)
+	if !ok {
+		return
+	}
+	if req.PostID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.stores.Posts.SetLocked(req.PostID, moderatorID, req.Locked)
+	if req.Locked {
+		respondModeration(w, err, "Post locked")
+	} else {
+		respondModeration(w, err, "Post unlocked")
+	}
+}
+
+// PinPostHandler lets moderators and admins pin a post above the others, or unpin it.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a PinPostRequest; only POST is accepted.
+func (h *Handler) PinPostHandler(w http.ResponseWriter, r *http.Request) {
+	var req PinPostRequest
+	moderatorID, ok := h.decodeModeration(w, r, &req)
+	if !ok {
+		return
+	}
+	if req.PostID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.stores.Posts.SetPinned(req.PostID, moderatorID, req.Pinned)
+	if req.Pinned {
+		respondModeration(w, err, "Post pinned")
+	} else {
+		respondModeration(w, err, "Post unpinned")
+	}
+}
+
+// ModeratedPostsHandler lists the hidden and soft-deleted posts for moderators and admins, so
+// they can be reviewed and restored.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) ModeratedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.isModerator(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	posts, err := h.stores.Posts.ListModerated()
+	if err != nil {
+		log.Printf("Error listing moderated posts: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+// decodeModeration checks that a moderation request is a POST from a moderator or admin and
+// decodes its JSON body into req. It returns the ID of the moderator, or false once it has
+// answered the request itself.
+func (h *Handler) decodeModeration(w http.ResponseWriter, r *http.Request, req interface{}) (int, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+
+	if !h.isModerator(r) {
+		http.Error(w, "Unauthorized - Moderator or Admin access required", http.StatusUnauthorized)
+		return 0, false
+	}
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return 0, false
+	}
+	return current.UserID, true
+}
+
+// respondModeration answers a moderation request with the outcome err of the action taken.
+func respondModeration(w http.ResponseWriter, err error, message string) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error moderating post: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": message,
+	})
+}
+
+// isModerator checks if the user is a moderator or admin
+func (h *Handler) isModerator(r *http.Request) bool {
+	userIDStr, err := h.getUserIDByCookie(r)
+	if err != nil {
+		return false
+	}
+
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return false
+	}
+
+	privilege, err := h.stores.Users.Privilege(userID)
+	if err != nil {
+		return false
+	}
+
+	return privilege >= 2 // Moderator (2) or Admin (3)
+}
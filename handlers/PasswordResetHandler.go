@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/DB"
+	"forum/mail"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RequestPasswordResetHandler emails a single-use password reset link to the address in the
+// "email" form field. The reply is the same whether or not an account uses that address, so the
+// endpoint cannot be used to find out who is registered; the token is issued and the email sent
+// in the background so that neither does the time the reply takes.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the response message.
+//   - r: An *http.Request carrying the "email" form field; only POST is accepted.
+func (h *Handler) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	if email == "" {
+		http.Error(w, "Please enter your email address", http.StatusOK)
+		return
+	}
+
+	userID, err := h.stores.Users.IDByEmail(email)
+	if err == nil {
+		go func() {
+			if err := h.sendPasswordResetEmail(userID, email); err != nil {
+				log.Printf("Error sending password reset email: %v\n", err)
+			}
+		}()
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error looking up user by email: %v\n", err)
+	}
+
+	w.Write([]byte("If an account uses that email address, a password reset link is on its way."))
+}
+
+// ResetPasswordHandler sets a new password using a token from a password reset email, then logs
+// out every session of the account. The token is only spent once the new password is accepted,
+// and in the same transaction as the password is changed.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the response message.
+//   - r: An *http.Request carrying the "token", "newPassword" and "ConfirmNewPassword" form fields;
+//     only POST is accepted.
+func (h *Handler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.FormValue("token")
+	psswd := r.FormValue("newPassword")
+	cnfrmPswd := r.FormValue("ConfirmNewPassword")
+
+	if len(psswd) < 8 {
+		http.Error(w, "Password must be at least 8 characters long", http.StatusOK)
+		return
+	}
+	if psswd != cnfrmPswd {
+		http.Error(w, "Passwords do not match", http.StatusOK)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(psswd), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("error generating hash: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusOK)
+		return
+	}
+
+	userID, err := h.stores.Tokens.ResetPassword(token, string(hashedPassword))
+	if err == DB.ErrInvalidToken {
+		http.Error(w, "This reset link is invalid or has expired. Please request a new one.", http.StatusOK)
+		return
+	} else if err != nil {
+		log.Printf("Error resetting password: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusOK)
+		return
+	}
+	if err := h.stores.Sessions.DeleteForUser(userID); err != nil {
+		log.Printf("Error deleting sessions after password reset: %v\n", err)
+	}
+
+	w.Header().Set("HX-Redirect", "/login")
+	w.Write([]byte("Your password has been reset. You can now log in."))
+}
+
+// sendPasswordResetEmail issues a reset token for userID and emails the link to email.
+func (h *Handler) sendPasswordResetEmail(userID int, email string) error {
+	token, err := h.stores.Tokens.Issue(userID, DB.TokenPasswordReset, h.cfg.Account.PasswordResetLifetime.Duration)
+	if err != nil {
+		return err
+	}
+
+	link := h.publicURL("/resetpassword", url.Values{"token": {token}})
+	return h.mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Reset your forum password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your forum account.\n\n"+
+				"To choose a new password, open this link within %s:\n\n%s\n\n"+
+				"If this wasn't you, you can ignore this email; your password has not been changed.\n",
+			h.cfg.Account.PasswordResetLifetime.Duration, link,
+		),
+	})
+}
+
+// publicURL returns the absolute address of path on the forum, as users reach it.
+func (h *Handler) publicURL(path string, query url.Values) string {
+	link := strings.TrimRight(h.cfg.Server.PublicURL, "/") + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
@@ -1,113 +1,78 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"forum/DB"
+	"log"
 	"net/http"
-)
-
-var (
-	MultipostQuery = `
-        SELECT 
-            p.PostID, 
-            p.UserID,
-            p.PostDate,
-            p.title,
-            p.content,
-			p.ImagePath,
-            u.username,
-            COALESCE(pl.likes, 0) AS likes,
-            COALESCE(pdl.dislike, 0) AS dislikes,
-            COALESCE(cmt.comments, 0) AS comments
-        FROM 
-            Post p
-        JOIN 
-            User u ON p.UserID = u.UserID
-        LEFT JOIN (
-            SELECT PostID, COUNT(*) AS likes FROM PostLike GROUP BY PostID
-        ) AS pl ON p.PostID = pl.PostID
-        LEFT JOIN (
-            SELECT PostID, COUNT(*) AS dislike FROM PostDislike GROUP BY PostID
-        ) AS pdl ON p.PostID = pdl.PostID
-        LEFT JOIN (
-            SELECT PostID, COUNT(*) AS comments FROM Comment GROUP BY PostID
-        ) AS cmt ON p.PostID = cmt.PostID
-        ORDER BY 
-			p.PostDate DESC
-    `
-	categoryQuery = `
-        SELECT c.title
-        FROM Category c
-        JOIN PostCategory pc ON c.CategoryID = pc.CategoryID
-        WHERE pc.PostID = ?
-    `
+	"strconv"
 )
 
 // PostHandler handles HTTP requests for retrieving post information.
-// It can fetch either a single post or multiple posts based on the presence of a 'postid' query parameter.
+// It returns one page of the feed at a time, together with the categories of every post.
 //
 // Parameters:
 //   - w: http.ResponseWriter - Used to write the HTTP response.
-//   - r: *http.Request - The incoming HTTP request containing query parameters and other request details.
+//   - r: *http.Request - The incoming HTTP request. It may carry the following parameters:
+//   - sort: "new" (default), "top", "controversial" or "most-commented".
+//   - cursor: the nextCursor of the previous page; omitted for the first page.
+//   - limit: the page size, 20 by default and at most 100.
 //
 // The function does not return any value directly, but writes the response to the http.ResponseWriter:
-//   - For a single post (when 'postid' is provided): Responds with a JSON object containing details of the requested post.
-//   - For multiple posts (when 'postid' is not provided): Responds with a JSON array of post objects.
+//   - Responds with a JSON object holding the "posts" of the page and the "nextCursor" of the
+//     following one, which is empty once there are no more posts. The first page also holds the
+//     "pinned" posts, which are left out of the feed itself. Hidden and deleted posts are never listed.
 //
 // In case of errors, appropriate HTTP error statuses and messages are written to the response.
-func PostHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) PostHandler(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		http.Error(w, "Database connection error", http.StatusInternalServerError)
+	sortBy := r.FormValue("sort")
+	if sortBy == "" {
+		sortBy = DB.SortNew
+	}
+	if !DB.ValidSort(sortBy) {
+		http.Error(w, "Invalid sort order", http.StatusBadRequest)
 		return
 	}
-	defer db.Close()
 
-	postRows, err := db.Query(MultipostQuery)
+	limit := DB.DefaultPageSize
+	if limitParam := r.FormValue("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	posts, nextCursor, err := h.stores.Posts.ListPage(sortBy, r.FormValue("cursor"), limit)
+	if errors.Is(err, DB.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
+		log.Printf("Error listing posts: %v", err)
 		http.Error(w, "Error querying posts", http.StatusInternalServerError)
 		return
 	}
-	defer postRows.Close()
 
-	var posts []Post
-	for postRows.Next() {
-		var post Post
-		if err := postRows.Scan(
-			&post.PostID, &post.UserID, &post.PostDate, &post.Title, &post.Content, &post.ImagePath, &post.Username,
-			&post.Likes, &post.Dislikes, &post.CmtCount,
-		); err != nil {
-			http.Error(w, "Error scanning post details", http.StatusInternalServerError)
-			return
-		}
-
-		categoryRows, err := db.Query(categoryQuery, post.PostID)
+	page := DB.PostPage{Posts: posts, NextCursor: nextCursor}
+	if r.FormValue("cursor") == "" {
+		page.Pinned, err = h.stores.Posts.ListPinned()
 		if err != nil {
-			http.Error(w, "Error querying categories", http.StatusInternalServerError)
+			log.Printf("Error listing pinned posts: %v", err)
+			http.Error(w, "Error querying posts", http.StatusInternalServerError)
 			return
 		}
-		defer categoryRows.Close()
-
-		categories := []string{}
-		for categoryRows.Next() {
-			var category string
-			if err := categoryRows.Scan(&category); err != nil {
-				http.Error(w, "Error scanning category", http.StatusInternalServerError)
-				return
-			}
-			categories = append(categories, category)
-		}
-		post.Categories = categories
-		posts = append(posts, post)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+	json.NewEncoder(w).Encode(page)
 
 }
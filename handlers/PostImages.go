@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"forum/DB"
+	"forum/media"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAltTextLength is the longest alt text, in characters, an image may be given.
+const maxAltTextLength = 300
+
+// uploadRequestLimit caps the body of a request that may carry post images: a full gallery of
+// images at their maximum size, plus room for the other form fields.
+func (h *Handler) uploadRequestLimit() int64 {
+	return int64(h.cfg.Uploads.MaxImagesPerPost)*h.cfg.Uploads.MaxFileSize + 1<<20
+}
+
+// saveUploadedImages saves every file sent as "image" in the multipart form of r. The "alt" value
+// at the same position is the image's alt text. kept is the number of images the post already has,
+// which count towards the limit on images per post.
+// If an upload is refused it returns the message and status to answer with; the files saved
+// before it are removed again.
+func (h *Handler) saveUploadedImages(r *http.Request, kept int) ([]DB.PostImage, string, int) {
+	if r.MultipartForm == nil {
+		return nil, "", 0
+	}
+	files := r.MultipartForm.File["image"]
+	altTexts := r.MultipartForm.Value["alt"]
+
+	if kept+len(files) > h.cfg.Uploads.MaxImagesPerPost {
+		return nil, fmt.Sprintf("A post can have at most %d images.", h.cfg.Uploads.MaxImagesPerPost), http.StatusBadRequest
+	}
+
+	var saved []DB.PostImage
+	fail := func(message string, status int) ([]DB.PostImage, string, int) {
+		h.removeUnusedImageFiles(saved)
+		return nil, message, status
+	}
+
+	for i, fileHead := range files {
+		altText := ""
+		if i < len(altTexts) {
+			altText = strings.TrimSpace(altTexts[i])
+		}
+		if utf8.RuneCountInString(altText) > maxAltTextLength {
+			return fail(fmt.Sprintf("Alt text can be at most %d characters long.", maxAltTextLength), http.StatusBadRequest)
+		}
+		if fileHead.Size > h.cfg.Uploads.MaxFileSize {
+			return fail(fmt.Sprintf("Image file too large. Maximum size is %dMB.", h.cfg.Uploads.MaxFileSize>>20), http.StatusBadRequest)
+		}
+
+		file, err := fileHead.Open()
+		if err != nil {
+			log.Printf("Error opening uploaded image: %v\n", err)
+			return fail("Error reading image file", http.StatusInternalServerError)
+		}
+		// The image is re-encoded, stripped of its metadata and shrunk, and gets a thumbnail.
+		image, err := h.images.Save(file)
+		file.Close()
+		if errors.Is(err, media.ErrUnsupportedFormat) {
+			return fail("Invalid file type. Only JPEG, PNG, GIF and WebP images are allowed.", http.StatusBadRequest)
+		}
+		if errors.Is(err, media.ErrTooLarge) {
+			return fail("Image is too large.", http.StatusBadRequest)
+		}
+		if err != nil {
+			log.Printf("Error saving image: %v\n", err)
+			return fail("Error saving image", http.StatusInternalServerError)
+		}
+
+		saved = append(saved, DB.PostImage{
+			Filename:          image.Name,
+			ThumbnailFilename: image.ThumbnailName,
+			MIMEType:          image.MIMEType,
+			Width:             image.Width,
+			Height:            image.Height,
+			AltText:           altText,
+		})
+	}
+	return saved, "", 0
+}
+
+// removeUnusedImageFiles deletes the files of postImages that no post uses anymore. It is called
+// once images have been removed from their post, or were saved for a post that was never created.
+// Failures are only logged: a leftover file does no harm beyond the space it takes.
+func (h *Handler) removeUnusedImageFiles(postImages []DB.PostImage) {
+	var names []string
+	for _, image := range postImages {
+		names = append(names, image.Filename, image.ThumbnailFilename)
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	inUse, err := h.stores.Posts.FilesInUse(names)
+	if err != nil {
+		log.Printf("Error checking image files: %v\n", err)
+		return
+	}
+	for _, name := range names {
+		if inUse[name] {
+			continue
+		}
+		if err := h.images.Remove(name); err != nil {
+			log.Printf("Error removing image file: %v\n", err)
+		}
+	}
+}
@@ -3,22 +3,14 @@ package handlers
 import (
 	"database/sql"
 	"fmt"
-	"forum/utils"
+	"forum/DB"
 	"log"
 	"net/http"
 	"regexp"
-	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-const (
-	GetUserByUnameQuery     = `SELECT UserID FROM User WHERE username = ?;`
-	GetUserByUserEmailQuery = `SELECT UserID FROM User WHERE email = ?;`
-	InsertNewUserQuery      = `INSERT INTO User (username, firstname, lastname, email, password, gender) VALUES (?,?,?,?,?,?);`
-	insertNewSessionQuery   = `INSERT INTO Session (session_id, user_id, created_at, expiry_date, ip_address) VALUES (?,?,?,?,?)`
-)
-
 // RegisterHandler handles the user registration process.
 // It validates the registration form data, checks for existing users,
 // creates a new user account, and sets up a session for the newly registered user.
@@ -30,28 +22,13 @@ const (
 // This function does not return any values, but it writes to the http.ResponseWriter:
 //   - On success: Sets a session cookie and redirects to the home page.
 //   - On failure: Sends an appropriate error message back to the client.
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/", http.StatusMethodNotAllowed)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		http.Error(w, "Database connection error", http.StatusOK)
-		log.Printf("error connecting to the database: %s\n", err)
-		return
-	}
-	defer db.Close()
-
-	err = db.Ping()
-	if err != nil {
-		http.Error(w, "Database connection error", http.StatusOK)
-		log.Printf("error pinging the database: %s\n", err)
-		return
-	}
-
 	r.ParseForm()
 	username := r.FormValue("newUsername")
 	firstNmae := r.FormValue("fistName")
@@ -62,16 +39,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	gender := r.FormValue("gender")
 
 	// ! STSRT: to check if the user already exists in the database.
-	// prep the stmt to get the user by their username.
-	stmt, err := db.Prepare(GetUserByUnameQuery)
-	if err != nil {
-		log.Printf("error preparing statement: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
-	}
-	defer stmt.Close()
-	var existingUser int
-	err = stmt.QueryRow(username).Scan(&existingUser)
+	_, err := h.stores.Users.IDByUsername(username)
 	if err != nil {
 		log.Printf("error querying the DB: %v\n", err)
 		if err != sql.ErrNoRows {
@@ -85,17 +53,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// prep the stmt to get the user by the userEmail.
-	stmt, err = db.Prepare(GetUserByUserEmailQuery)
-	if err != nil {
-		log.Printf("error preparing statement: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
-	}
-	defer stmt.Close()
-
-	var existingEmail string
-	err = stmt.QueryRow(email).Scan(&existingEmail)
+	_, err = h.stores.Users.IDByEmail(email)
 	if err != nil {
 		log.Printf("error querying the DB: %v\n", err)
 		if err != sql.ErrNoRows {
@@ -149,14 +107,6 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	// ! END
 
 	// ! START: insert the user into the database.
-	stmt, err = db.Prepare(InsertNewUserQuery)
-	if err != nil {
-		log.Printf("error preparing statement: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
-	}
-	defer stmt.Close()
-
 	if gender == "" {
 		log.Printf("Invalid gender\n")
 		http.Error(w, "Select a gender!", http.StatusOK)
@@ -170,7 +120,14 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = stmt.Exec(username, firstNmae, lastName, email, hashedPassword, gender)
+	userID, err := h.stores.Users.Create(DB.NewUser{
+		Username:     username,
+		FirstName:    firstNmae,
+		LastName:     lastName,
+		Email:        email,
+		PasswordHash: string(hashedPassword),
+		Gender:       gender,
+	})
 	if err != nil {
 		log.Printf("error executing statement: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusOK)
@@ -180,58 +137,31 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("User %s registered successfully\n", username)
 
-	// *** create the 🍪 and redirect the user to the homepage. *** \\
-
-	stmt, err = db.Prepare(GetUserByUnameQuery)
+	// users coming from an OAuth provider get that account linked; if the provider already
+	// verified the address they registered with, there is nothing left to confirm.
+	verified, err := h.auth.ClaimPendingSignup(w, r, userID, email)
 	if err != nil {
-		log.Printf("error preparing statement: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
+		log.Printf("error linking OAuth account: %v\n", err)
 	}
-	defer stmt.Close()
-
-	var userID int
-
-	err = stmt.QueryRow(username).Scan(&userID)
-	if err != nil {
-		log.Printf("error getting user ID: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
+	if verified {
+		if err := h.stores.Users.MarkEmailVerified(userID); err != nil {
+			log.Printf("error verifying email: %v\n", err)
+		}
+	} else {
+		// the account works right away; the verification link only confirms the address.
+		if err := h.sendVerificationEmail(userID, email); err != nil {
+			log.Printf("error sending verification email: %v\n", err)
+		}
 	}
 
-	sessionToken, err := utils.GenerateSessionToken()
-	if err != nil {
-		log.Printf("error generating session token: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
-	}
-	expiryDate := time.Now().Add(72 * time.Hour)
-	yummyCookie := &http.Cookie{
-		Name:     "sessionID",
-		Value:    sessionToken,
-		Path:     "/",
-		Expires:  expiryDate,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-	}
-	stmt, err = db.Prepare(insertNewSessionQuery)
-	if err != nil {
-		log.Printf("error preparing statement: %v\n", err)
-		http.Error(w, "Internal Server Error", http.StatusOK)
-		return
-	}
-	defer stmt.Close()
+	// *** create the 🍪 and redirect the user to the homepage. *** \\
 
-	ipAddr := utils.GetIP(r)
-	_, err = stmt.Exec(sessionToken, userID, time.Now(), expiryDate, ipAddr)
-	if err != nil {
-		log.Printf("error inserting session into the database: %v\n", err)
+	if err := h.auth.StartSession(w, r, userID); err != nil {
+		log.Printf("error creating session: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusOK)
 		return
 	}
 
-	http.SetCookie(w, yummyCookie)
 	w.Write([]byte("Registration successful"))
 	w.Header().Set("HX-Redirect", "/")
 	fmt.Fprintf(w, `<html><head><meta http-equiv="refresh" content="0;url=/home"></head></html>`)
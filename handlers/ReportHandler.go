@@ -3,288 +3,207 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"forum/DB"
 	"log"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
+	"unicode/utf8"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// PostReport represents a post report
-type PostReport struct {
-	ReportID      int     `json:"ReportID"`
-	PostID        int     `json:"PostID"`
-	PostTitle     string  `json:"PostTitle"`
-	PostContent   string  `json:"PostContent"`
-	PostAuthor    string  `json:"PostAuthor"`
-	ModeratorID   int     `json:"ModeratorID"`
-	ModeratorName string  `json:"ModeratorName"`
-	ReportDate    string  `json:"ReportDate"`
-	Reason        string  `json:"Reason"`
-	Status        string  `json:"Status"`
-	AdminResponse string  `json:"AdminResponse"`
-	AdminID       *int    `json:"AdminID"`
-	ResponseDate  *string `json:"ResponseDate"`
-}
+// maxReportNoteLength caps the free-text note of a report, in characters.
+const maxReportNoteLength = 1000
 
-// ReportPostHandler handles moderator reports of posts
-func ReportPostHandler(w http.ResponseWriter, r *http.Request) {
+// ReportHandler lets any logged-in user report a post, a comment or another user. Reports of a
+// target that is already waiting for review are added to its pending report.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a ReportRequest; only POST is accepted.
+func (h *Handler) ReportHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Check if user is moderator or admin
-	if !isModerator(r) {
+	current, ok := h.currentSession(r)
+	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	var req ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TargetID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	defer db.Close()
-
-	// Get moderator ID
-	moderatorIDStr, err := getUserIDByCookie(r, db)
-	if err != nil {
-		log.Printf("Error getting moderator ID: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	req.Note = strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(req.Note) > maxReportNoteLength {
+		http.Error(w, "Note is too long", http.StatusBadRequest)
 		return
 	}
 
-	moderatorID, err := strconv.Atoi(moderatorIDStr)
-	if err != nil {
-		log.Printf("Error converting moderator ID: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	_, err := h.stores.Reports.File(current.UserID, req.TargetType, req.TargetID, req.Reason, req.Note)
+	switch err {
+	case nil:
+	case DB.ErrInvalidReport:
+		http.Error(w, "Invalid report type or reason", http.StatusBadRequest)
 		return
-	}
-
-	// Parse form data
-	r.ParseForm()
-	postIDStr := r.FormValue("postId")
-	reason := r.FormValue("reason")
-
-	if postIDStr == "" || reason == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
-		return
-	}
-
-	postID, err := strconv.Atoi(postIDStr)
-	if err != nil {
-		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+	case sql.ErrNoRows:
+		http.Error(w, "Reported "+req.TargetType+" not found", http.StatusNotFound)
 		return
-	}
-
-	// Check if post exists
-	var exists bool
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM Post WHERE PostID = ?)", postID).Scan(&exists)
-	if err != nil {
-		log.Printf("Error checking post existence: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	case DB.ErrSelfReport:
+		http.Error(w, "You cannot report yourself or your own content", http.StatusBadRequest)
 		return
-	}
-
-	if !exists {
-		http.Error(w, "Post not found", http.StatusNotFound)
+	case DB.ErrAlreadyReported:
+		http.Error(w, "You already reported this", http.StatusConflict)
 		return
-	}
-
-	// Check if already reported by this moderator
-	var reportExists bool
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM PostReport WHERE PostID = ? AND ModeratorID = ? AND Status = 'pending')", postID, moderatorID).Scan(&reportExists)
-	if err != nil {
-		log.Printf("Error checking existing report: %v", err)
+	default:
+		log.Printf("Error filing report: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	if reportExists {
-		http.Error(w, "Post already reported by you", http.StatusConflict)
-		return
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Report submitted, thank you",
+	})
+}
 
-	// Insert report
-	_, err = db.Exec("INSERT INTO PostReport (PostID, ModeratorID, Reason) VALUES (?, ?, ?)", postID, moderatorID, reason)
-	if err != nil {
-		log.Printf("Error inserting report: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+// ReportReasonsHandler lists the categories a report can be filed under.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func ReportReasonsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Post reported successfully",
-	})
+	json.NewEncoder(w).Encode(DB.ReportReasons)
 }
 
-// AdminReportsHandler returns all post reports for admin dashboard
-func AdminReportsHandler(w http.ResponseWriter, r *http.Request) {
+// AdminReportsHandler returns the moderation queue: reports of posts, comments and users, with
+// everyone who filed them, a page at a time. The optional status and type query parameters narrow
+// it down; offset is the nextOffset of the previous page.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) AdminReportsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Check if user is admin
-	if !isAdmin(r) {
+	if !h.isAdmin(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	status := r.URL.Query().Get("status")
+	if status != "" && status != DB.ReportPending && status != DB.ReportApproved && status != DB.ReportRejected {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
 		return
 	}
-	defer db.Close()
-
-	query := `
-		SELECT
-			pr.ReportID, pr.PostID,
-			COALESCE(p.title, '[Post Deleted]') as title,
-			COALESCE(p.content, '[Post content no longer available]') as content,
-			COALESCE(u1.username, '[Unknown User]') as post_author,
-			pr.ModeratorID, u2.username as moderator_name, pr.ReportDate, pr.Reason,
-			pr.Status, pr.AdminResponse, pr.AdminID, pr.ResponseDate
-		FROM PostReport pr
-		LEFT JOIN Post p ON pr.PostID = p.PostID
-		LEFT JOIN User u1 ON p.UserID = u1.UserID
-		JOIN User u2 ON pr.ModeratorID = u2.UserID
-		ORDER BY pr.ReportDate DESC
-	`
-
-	rows, err := db.Query(query)
-	if err != nil {
-		log.Printf("Error querying reports: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	targetType := r.URL.Query().Get("type")
+	if targetType != "" && !DB.ValidReportTarget(targetType) {
+		http.Error(w, "Invalid report type", http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	var reports []PostReport
-	for rows.Next() {
-		var report PostReport
-		var responseDate sql.NullString
-		var adminID sql.NullInt64
-		var adminResponse sql.NullString
-
-		err := rows.Scan(
-			&report.ReportID, &report.PostID, &report.PostTitle, &report.PostContent, &report.PostAuthor,
-			&report.ModeratorID, &report.ModeratorName, &report.ReportDate, &report.Reason,
-			&report.Status, &adminResponse, &adminID, &responseDate,
-		)
-		if err != nil {
-			log.Printf("Error scanning report: %v", err)
-			continue
-		}
-
-		// Handle nullable fields
-		if adminResponse.Valid {
-			report.AdminResponse = adminResponse.String
-		} else {
-			report.AdminResponse = ""
-		}
-
-		if adminID.Valid {
-			adminIDInt := int(adminID.Int64)
-			report.AdminID = &adminIDInt
-		}
-		if responseDate.Valid {
-			report.ResponseDate = &responseDate.String
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		var err error
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
 		}
+	}
 
-		reports = append(reports, report)
+	page, err := h.stores.Reports.Queue(status, targetType, offset)
+	if err != nil {
+		log.Printf("Error querying reports: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(reports)
+	json.NewEncoder(w).Encode(page)
 }
 
-// AdminRespondReportHandler handles admin responses to post reports
-func AdminRespondReportHandler(w http.ResponseWriter, r *http.Request) {
+// AdminRespondReportHandler records an admin's decision on a pending report. Approving a report
+// of a post soft-deletes it and approving one of a comment deletes it; approving a report of a
+// user only upholds the report.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a RespondReportRequest; only POST is accepted.
+func (h *Handler) AdminRespondReportHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Check if user is admin
-	if !isAdmin(r) {
+	if !h.isAdmin(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	defer db.Close()
 
-	// Get admin ID
-	adminIDStr, err := getUserIDByCookie(r, db)
-	if err != nil {
-		log.Printf("Error getting admin ID: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	var req RespondReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	adminID, err := strconv.Atoi(adminIDStr)
-	if err != nil {
-		log.Printf("Error converting admin ID: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	if req.Status != DB.ReportApproved && req.Status != DB.ReportRejected {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
 		return
 	}
 
-	var requestData struct {
-		ReportID int    `json:"reportId"`
-		Status   string `json:"status"`
-		Response string `json:"response"`
+	report, err := h.stores.Reports.Get(req.ReportID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if err != nil {
+		log.Printf("Error getting report: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-
-	if requestData.Status != "approved" && requestData.Status != "rejected" {
-		http.Error(w, "Invalid status", http.StatusBadRequest)
+	if report.Status != DB.ReportPending {
+		http.Error(w, "Report was already resolved", http.StatusConflict)
 		return
 	}
 
-	// If approved, delete the post
-	if requestData.Status == "approved" {
-		// Get the post ID from the report
-		var postID int
-		err = db.QueryRow("SELECT PostID FROM PostReport WHERE ReportID = ?", requestData.ReportID).Scan(&postID)
-		if err != nil {
-			log.Printf("Error getting post ID from report: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		// Delete the post (this will cascade to comments, likes, etc.)
-		_, err = db.Exec("DELETE FROM Post WHERE PostID = ?", postID)
-		if err != nil {
-			log.Printf("Error deleting post: %v", err)
+	if req.Status == DB.ReportApproved && report.Target.Exists {
+		if err := h.removeReportedContent(report, current.UserID, req.Response); err != nil {
+			log.Printf("Error removing reported %s: %v\n", report.TargetType, err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	}
 
-	// Update the report status
-	_, err = db.Exec(
-		"UPDATE PostReport SET Status = ?, AdminResponse = ?, AdminID = ?, ResponseDate = ? WHERE ReportID = ?",
-		requestData.Status, requestData.Response, adminID, time.Now(), requestData.ReportID,
-	)
+	err = h.stores.Reports.Resolve(report.ReportID, current.UserID, req.Status, req.Response)
+	if err == DB.ErrReportResolved {
+		http.Error(w, "Report was already resolved", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		log.Printf("Error updating report: %v", err)
+		log.Printf("Error updating report: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -296,127 +215,51 @@ func AdminRespondReportHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// isModerator checks if the user is a moderator or admin
-func isModerator(r *http.Request) bool {
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		return false
-	}
-	defer db.Close()
-
-	userIDStr, err := getUserIDByCookie(r, db)
-	if err != nil {
-		return false
-	}
-
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		return false
-	}
-
-	var privilege int
-	err = db.QueryRow("SELECT privilege FROM User WHERE UserID = ?", userID).Scan(&privilege)
-	if err != nil {
-		return false
+// removeReportedContent deletes the post or comment an approved report is about on behalf of
+// adminID. Posts are soft-deleted, giving the admin's response as the reason. Reported users are
+// left alone.
+func (h *Handler) removeReportedContent(report DB.Report, adminID int, response string) error {
+	switch report.TargetType {
+	case DB.ReportTargetPost:
+		reason := strings.TrimSpace(response)
+		if reason == "" {
+			reason = fmt.Sprintf("Removed after report #%d", report.ReportID)
+		}
+		if err := h.stores.Posts.Delete(report.TargetID, adminID, reason); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	case DB.ReportTargetComment:
+		if err := h.stores.Comments.Delete(report.TargetID, adminID); err != nil && err != sql.ErrNoRows {
+			return err
+		}
 	}
-
-	return privilege >= 2 // Moderator (2) or Admin (3)
+	return nil
 }
 
-// UserReportsHandler returns reports made by the current user
-func UserReportsHandler(w http.ResponseWriter, r *http.Request) {
+// UserReportsHandler returns the reports the current user has filed, with how they were handled.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) UserReportsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
-	// Get user ID
-	userIDStr, err := getUserIDByCookie(r, db)
-	if err != nil {
-		log.Printf("Error getting user ID: %v", err)
+	current, ok := h.currentSession(r)
+	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	userID, err := strconv.Atoi(userIDStr)
+	reports, err := h.stores.Reports.FiledBy(current.UserID)
 	if err != nil {
-		log.Printf("Error converting user ID: %v", err)
+		log.Printf("Error querying user reports: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	query := `
-		SELECT
-			pr.ReportID, pr.PostID,
-			COALESCE(p.title, '[Post Deleted]') as title,
-			COALESCE(p.content, '[Post content no longer available]') as content,
-			COALESCE(u1.username, '[Unknown User]') as post_author,
-			pr.ReportDate, pr.Reason, pr.Status, pr.AdminResponse, pr.ResponseDate
-		FROM PostReport pr
-		LEFT JOIN Post p ON pr.PostID = p.PostID
-		LEFT JOIN User u1 ON p.UserID = u1.UserID
-		WHERE pr.ModeratorID = ?
-		ORDER BY pr.ReportDate DESC
-	`
-
-	rows, err := db.Query(query, userID)
-	if err != nil {
-		log.Printf("Error querying user reports: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	type UserReport struct {
-		ReportID      int     `json:"ReportID"`
-		PostID        int     `json:"PostID"`
-		PostTitle     string  `json:"PostTitle"`
-		PostContent   string  `json:"PostContent"`
-		PostAuthor    string  `json:"PostAuthor"`
-		ReportDate    string  `json:"ReportDate"`
-		Reason        string  `json:"Reason"`
-		Status        string  `json:"Status"`
-		AdminResponse string  `json:"AdminResponse"`
-		ResponseDate  *string `json:"ResponseDate"`
-	}
-
-	var reports []UserReport
-	for rows.Next() {
-		var report UserReport
-		var responseDate sql.NullString
-		var adminResponse sql.NullString
-
-		err := rows.Scan(
-			&report.ReportID, &report.PostID, &report.PostTitle, &report.PostContent, &report.PostAuthor,
-			&report.ReportDate, &report.Reason, &report.Status, &adminResponse, &responseDate,
-		)
-		if err != nil {
-			log.Printf("Error scanning user report: %v", err)
-			continue
-		}
-
-		// Handle nullable fields
-		if adminResponse.Valid {
-			report.AdminResponse = adminResponse.String
-		} else {
-			report.AdminResponse = ""
-		}
-
-		if responseDate.Valid {
-			report.ResponseDate = &responseDate.String
-		}
-
-		reports = append(reports, report)
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(reports)
 }
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"forum/DB"
+	"forum/utils"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// PostRevisionsHandler lists the revisions of the post given by the postId query parameter,
+// oldest first. A post that was never edited has none. The revisions of a hidden, deleted or held
+// post are only shown to its author and moderators.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) PostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	h.listRevisions(w, r, "postId", h.postAccess, h.stores.Posts.Revisions)
+}
+
+// PostRevisionDiffHandler compares the revisions from and to of the post given by postId,
+// all three being query parameters. See RevisionDiff.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) PostRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	h.diffRevisions(w, r, "postId", h.postAccess, h.stores.Posts.Revision)
+}
+
+// RestorePostRevisionHandler lets an admin make an older revision of a post its current title and
+// content again. The restore becomes a new revision itself.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a RestoreRevisionRequest with the post ID; only POST is accepted.
+func (h *Handler) RestorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	h.restoreRevision(w, r, h.stores.Posts.RestoreRevision)
+}
+
+// CommentRevisionsHandler is PostRevisionsHandler for the comment given by commentId. A comment
+// held for review, or on a post that is not visible, counts as hidden.
+func (h *Handler) CommentRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	h.listRevisions(w, r, "commentId", h.commentAccess, h.stores.Comments.Revisions)
+}
+
+// CommentRevisionDiffHandler is PostRevisionDiffHandler for the comment given by commentId.
+func (h *Handler) CommentRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	h.diffRevisions(w, r, "commentId", h.commentAccess, h.stores.Comments.Revision)
+}
+
+// RestoreCommentRevisionHandler is RestorePostRevisionHandler for comments.
+func (h *Handler) RestoreCommentRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	h.restoreRevision(w, r, h.stores.Comments.RestoreRevision)
+}
+
+// revisionAccess reports whether the post or comment with an ID is shown to everyone and, if it
+// is not, who wrote it. It returns sql.ErrNoRows if there is no such post or comment.
+type revisionAccess func(id int) (public bool, ownerID int, err error)
+
+// postAccess is the revisionAccess of posts.
+func (h *Handler) postAccess(postID int) (bool, int, error) {
+	state, err := h.stores.Posts.State(postID)
+	if err != nil || state.Visibility == DB.PostVisible {
+		return err == nil, 0, err
+	}
+	ownerID, err := h.stores.Posts.OwnerID(postID)
+	return false, ownerID, err
+}
+
+// commentAccess is the revisionAccess of comments.
+func (h *Handler) commentAccess(commentID int) (bool, int, error) {
+	visible, err := h.stores.Comments.Visible(commentID)
+	if err != nil || visible {
+		return visible, 0, err
+	}
+	ownerID, err := h.stores.Comments.OwnerID(commentID)
+	return false, ownerID, err
+}
+
+// canReadRevisions reports whether the caller may read the revisions of id: anyone may if access
+// says it is public, otherwise only its author and moderators. When the caller may not, it has
+// already answered 404, so hidden content cannot be told apart from missing content.
+func (h *Handler) canReadRevisions(w http.ResponseWriter, r *http.Request, id int, access revisionAccess) bool {
+	public, ownerID, err := access(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		log.Printf("Error checking revision access: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if public || h.isModerator(r) {
+		return true
+	}
+	if current, ok := h.currentSession(r); ok && current.UserID == ownerID {
+		return true
+	}
+	http.Error(w, "Not found", http.StatusNotFound)
+	return false
+}
+
+// listRevisions answers with the revisions list returns for the ID in the query parameter idParam,
+// if access lets the caller see them.
+func (h *Handler) listRevisions(w http.ResponseWriter, r *http.Request, idParam string, access revisionAccess, list func(int) ([]DB.Revision, error)) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get(idParam))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	if !h.canReadRevisions(w, r, id, access) {
+		return
+	}
+
+	revisions, err := list(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error listing revisions: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// diffRevisions answers with the RevisionDiff between the revisions in the from and to query
+// parameters of the ID in idParam, looked up with find, if access lets the caller see them.
+func (h *Handler) diffRevisions(w http.ResponseWriter, r *http.Request, idParam string, access revisionAccess, find func(id, number int) (DB.Revision, error)) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	id, err := strconv.Atoi(query.Get(idParam))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	from, errFrom := strconv.Atoi(query.Get("from"))
+	to, errTo := strconv.Atoi(query.Get("to"))
+	if errFrom != nil || errTo != nil {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return
+	}
+	if !h.canReadRevisions(w, r, id, access) {
+		return
+	}
+
+	var revisions [2]DB.Revision
+	for i, number := range []int{from, to} {
+		revisions[i], err = find(id, number)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error getting revision: %v\n", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	diff := RevisionDiff{
+		From:    revisions[0],
+		To:      revisions[1],
+		Content: utils.DiffLines(revisions[0].Content, revisions[1].Content),
+	}
+	if revisions[0].Title != "" || revisions[1].Title != "" {
+		diff.Title = utils.DiffLines(revisions[0].Title, revisions[1].Title)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// restoreRevision lets an admin bring back the revision named in the RestoreRevisionRequest body
+// through restore.
+func (h *Handler) restoreRevision(w http.ResponseWriter, r *http.Request, restore func(id, number, editorID int) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RestoreRevisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 || req.Revision <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := restore(req.ID, req.Revision, current.UserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error restoring revision: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Revision restored",
+	})
+}
@@ -1,100 +1,225 @@
 package handlers
 
 import (
+	"database/sql"
+	"forum/DB"
 	"forum/auth"
+	"forum/config"
+	"forum/mail"
+	"forum/media"
 	mdlware "forum/middleware"
+	"forum/storage"
+	"forum/utils"
+	"log"
+	"net"
 	"net/http"
 )
 
-func Routes() http.Handler {
-
-	router := http.NewServeMux()
-
-	router.HandleFunc("/", HomePage)
-
-	router.HandleFunc("/auth/status", CheckAuthHandler)
-
-	router.HandleFunc("/Data-userLogin", LoginHandler)
-	router.HandleFunc("/Data-userLogout", LogoutHandler)
-	router.HandleFunc("/Data-userRegister", RegisterHandler)
-
-	// ! START Google and Github auth
-	router.HandleFunc("/auth/google/login", auth.HandleGoogleLogin)
-	router.HandleFunc("/auth/github/login", auth.HandleGitHubLogin)
-	router.HandleFunc("/auth/google/callback", func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query()
-		q.Add("provider", "google")
-		r.URL.RawQuery = q.Encode()
-		auth.HandleOAuthCallback(w, r)
-	})
-
-	router.HandleFunc("/auth/github/callback", func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query()
-		q.Add("provider", "github")
-		r.URL.RawQuery = q.Encode()
-		auth.HandleOAuthCallback(w, r)
-	})
-	// ! END Google and Github auth
-
-	router.HandleFunc("/Data-Post", PostHandler)
-	router.HandleFunc("/Data-PostLike", PostLikeHandler)
-	router.HandleFunc("/Data-PostDisLike", PostDisLikeHandler)
+// Handler holds what the HTTP handlers work with. Routes builds one per router, so two routers
+// can each have their own database and configuration.
+type Handler struct {
+	// db is the shared, pooled database handle, opened once in main.
+	db *sql.DB
+	// stores are the typed repositories built on top of db.
+	stores *DB.Stores
+	// cfg is the configuration the server was started with.
+	cfg config.Config
+	// mailer sends the password reset and email verification emails.
+	mailer mail.Mailer
+	// providers are the enabled OAuth login providers.
+	providers *auth.Registry
+	// auth logs users in and runs the OAuth handlers.
+	auth *auth.Authenticator
+	// images processes and stores uploaded post images.
+	images *media.Processor
+	// trustedProxies are the reverse proxies whose forwarded headers are believed.
+	trustedProxies []*net.IPNet
+}
 
-	router.HandleFunc("/Data-Comment", CommentHandler)
-	router.HandleFunc("/Data-CommentLike", CommentLikeHandler)
-	router.HandleFunc("/Data-CommentDisLike", CommentDislikeHandler)
+func Routes(store *sql.DB, c config.Config, m mail.Mailer, reg *auth.Registry, img *media.Processor) http.Handler {
+	stores := DB.NewStores(store)
+	stores.SetImageURL(img.URL)
+	h := &Handler{
+		db:        store,
+		stores:    stores,
+		cfg:       c,
+		mailer:    m,
+		providers: reg,
+		auth:      auth.NewAuthenticator(stores, c, reg),
+		images:    img,
+
+		trustedProxies: c.Server.TrustedProxyNets(),
+	}
 
-	router.HandleFunc("/Data-CreatPost", CreatePostHandler)
-	router.HandleFunc("/Data-CreatComment", CreatCommentHandler)
+	router := http.NewServeMux()
 
-	router.HandleFunc("/Data-Profile", ProfileHandler)
-	router.HandleFunc("/Data-Activity", ActivityHandler)
-	router.HandleFunc("/Data-Categories", CategoriesHandler)
-	router.HandleFunc("/Data-PublicCategories", PublicCategoriesHandler)
+	// Every route goes through one of the named rate limit policies.
+	limiter := mdlware.NewRateLimiter(c.RateLimit, h.rateLimitKey)
+	handle := func(pattern, policy string, handler http.Handler) {
+		router.Handle(pattern, limiter.Limit(policy, handler))
+	}
+	handleFunc := func(pattern, policy string, handler http.HandlerFunc) {
+		handle(pattern, policy, handler)
+	}
+
+	handleFunc("/", config.PolicyDefault, HomePage)
+
+	handleFunc("/auth/status", config.PolicyDefault, h.CheckAuthHandler)
+
+	handleFunc("/Data-userLogin", config.PolicyAuth, h.LoginHandler)
+	handleFunc("/Data-userLogout", config.PolicyDefault, h.LogoutHandler)
+	handleFunc("/Data-userRegister", config.PolicyAuth, h.RegisterHandler)
+
+	// OAuth login, one pair of routes per configured provider
+	handleFunc("/auth/providers", config.PolicyDefault, h.auth.HandleOAuthProviders)
+	handleFunc("/auth/{provider}/login", config.PolicyAuth, h.auth.HandleOAuthLogin)
+	handleFunc("/auth/{provider}/callback", config.PolicyAuth, h.auth.HandleOAuthCallback)
+	handleFunc("/auth/{provider}/link", config.PolicyAuth, h.auth.HandleOAuthLink)
+	handleFunc("/auth/signup", config.PolicyDefault, h.auth.HandlePendingSignup)
+
+	handleFunc("/Data-Post", config.PolicyDefault, h.PostHandler)
+	handleFunc("/Data-Search", config.PolicyDefault, h.SearchHandler)
+	handleFunc("/Data-PostLike", config.PolicyDefault, h.notMuted(h.PostLikeHandler))
+	handleFunc("/Data-PostDisLike", config.PolicyDefault, h.notMuted(h.PostDisLikeHandler))
+
+	handleFunc("/Data-Comment", config.PolicyDefault, h.CommentHandler)
+	handleFunc("/Data-CommentLike", config.PolicyDefault, h.notMuted(h.CommentLikeHandler))
+	handleFunc("/Data-CommentDisLike", config.PolicyDefault, h.notMuted(h.CommentDislikeHandler))
+
+	// Muted and banned users cannot post, comment or react
+	handleFunc("/Data-CreatPost", config.PolicyPost, h.notMuted(h.CreatePostHandler))
+	handleFunc("/Data-CreatComment", config.PolicyComment, h.notMuted(h.CreatCommentHandler))
+	handleFunc("/Data-CreatReply", config.PolicyComment, h.notMuted(h.CreatReplyHandler))
+
+	handleFunc("/Data-Profile", config.PolicyDefault, h.ProfileHandler)
+	handleFunc("/Data-Activity", config.PolicyDefault, h.ActivityHandler)
+	handleFunc("/Data-Categories", config.PolicyDefault, h.CategoriesHandler)
+	handleFunc("/Data-PublicCategories", config.PolicyDefault, h.PublicCategoriesHandler)
 
 	// Admin routes
-	router.HandleFunc("/Data-AdminStats", AdminStatsHandler)
-	router.HandleFunc("/Data-AdminUsers", AdminUsersHandler)
-	router.HandleFunc("/Data-AdminPromoteUser", AdminPromoteUserHandler)
-	router.HandleFunc("/Data-AdminDemoteUser", AdminDemoteUserHandler)
-	router.HandleFunc("/Data-AdminModerationRequests", AdminModerationRequestsHandler)
-	router.HandleFunc("/Data-AdminRespondRequest", AdminRespondRequestHandler)
+	handleFunc("/Data-AdminStats", config.PolicyDefault, h.AdminStatsHandler)
+	handleFunc("/Data-AdminUsers", config.PolicyDefault, h.AdminUsersHandler)
+	handleFunc("/Data-AdminPromoteUser", config.PolicyDefault, h.AdminPromoteUserHandler)
+	handleFunc("/Data-AdminDemoteUser", config.PolicyDefault, h.AdminDemoteUserHandler)
+	handleFunc("/Data-AdminModerationRequests", config.PolicyDefault, h.AdminModerationRequestsHandler)
+	handleFunc("/Data-AdminRespondRequest", config.PolicyDefault, h.AdminRespondRequestHandler)
 
 	// Report routes
-	router.HandleFunc("/Data-ReportPost", ReportPostHandler)
-	router.HandleFunc("/Data-AdminReports", AdminReportsHandler)
-	router.HandleFunc("/Data-AdminRespondReport", AdminRespondReportHandler)
-	router.HandleFunc("/Data-UserReports", UserReportsHandler)
-	router.HandleFunc("/Data-CreateModerationRequest", CreateModerationRequestHandler)
-	router.HandleFunc("/Data-AdminCategories", AdminCategoriesHandler)
-	router.HandleFunc("/Data-AdminAddCategory", AdminAddCategoryHandler)
-	router.HandleFunc("/Data-AdminDeleteCategory", AdminDeleteCategoryHandler)
+	handleFunc("/Data-Report", config.PolicyDefault, h.ReportHandler)
+	handleFunc("/Data-ReportReasons", config.PolicyDefault, ReportReasonsHandler)
+	handleFunc("/Data-AdminReports", config.PolicyDefault, h.AdminReportsHandler)
+	handleFunc("/Data-AdminRespondReport", config.PolicyDefault, h.AdminRespondReportHandler)
+	handleFunc("/Data-UserReports", config.PolicyDefault, h.UserReportsHandler)
+	handleFunc("/Data-CreateModerationRequest", config.PolicyDefault, h.CreateModerationRequestHandler)
+	handleFunc("/Data-AdminCategories", config.PolicyDefault, h.AdminCategoriesHandler)
+	handleFunc("/Data-AdminAddCategory", config.PolicyDefault, h.AdminAddCategoryHandler)
+	handleFunc("/Data-AdminDeleteCategory", config.PolicyDefault, h.AdminDeleteCategoryHandler)
+
+	// Sanction routes (admin)
+	handleFunc("/Data-AdminSanction", config.PolicyDefault, h.AdminSanctionHandler)
+	handleFunc("/Data-AdminLiftSanction", config.PolicyDefault, h.AdminLiftSanctionHandler)
+	handleFunc("/Data-AdminSanctions", config.PolicyDefault, h.AdminSanctionsHandler)
+
+	// Audit log routes (admin)
+	handleFunc("/Data-AdminAuditLog", config.PolicyDefault, h.AdminAuditLogHandler)
+
+	// Content filter routes (admin)
+	handleFunc("/Data-AdminFilterRules", config.PolicyDefault, h.AdminFilterRulesHandler)
+	handleFunc("/Data-AdminAddFilterRule", config.PolicyDefault, h.AdminAddFilterRuleHandler)
+	handleFunc("/Data-AdminDeleteFilterRule", config.PolicyDefault, h.AdminDeleteFilterRuleHandler)
 
 	// Edit routes
-	router.HandleFunc("/Data-EditPost", EditPostHandler)
-	router.HandleFunc("/Data-GetPostForEdit", GetPostForEditHandler)
-	router.HandleFunc("/Data-EditComment", EditCommentHandler)
-	router.HandleFunc("/Data-GetCommentForEdit", GetCommentForEditHandler)
+	handleFunc("/Data-EditPost", config.PolicyDefault, h.notMuted(h.EditPostHandler))
+	handleFunc("/Data-GetPostForEdit", config.PolicyDefault, h.GetPostForEditHandler)
+	handleFunc("/Data-EditComment", config.PolicyDefault, h.notMuted(h.EditCommentHandler))
+	handleFunc("/Data-GetCommentForEdit", config.PolicyDefault, h.GetCommentForEditHandler)
+
+	// Revision routes
+	handleFunc("/Data-PostRevisions", config.PolicyDefault, h.PostRevisionsHandler)
+	handleFunc("/Data-PostRevisionDiff", config.PolicyDefault, h.PostRevisionDiffHandler)
+	handleFunc("/Data-RestorePostRevision", config.PolicyDefault, h.RestorePostRevisionHandler)
+	handleFunc("/Data-CommentRevisions", config.PolicyDefault, h.CommentRevisionsHandler)
+	handleFunc("/Data-CommentRevisionDiff", config.PolicyDefault, h.CommentRevisionDiffHandler)
+	handleFunc("/Data-RestoreCommentRevision", config.PolicyDefault, h.RestoreCommentRevisionHandler)
 
 	// Delete routes (admin/moderator)
-	router.HandleFunc("/Data-DeletePost", DelPostHandler)
-	router.HandleFunc("/Data-DeleteComment", DeleteCommentHandler)
+	handleFunc("/Data-DeletePost", config.PolicyDefault, h.DelPostHandler)
+	handleFunc("/Data-DeleteComment", config.PolicyDefault, h.DeleteCommentHandler)
+
+	// Post moderation routes (admin/moderator)
+	handleFunc("/Data-PostVisibility", config.PolicyDefault, h.PostVisibilityHandler)
+	handleFunc("/Data-LockPost", config.PolicyDefault, h.LockPostHandler)
+	handleFunc("/Data-PinPost", config.PolicyDefault, h.PinPostHandler)
+	handleFunc("/Data-ModeratedPosts", config.PolicyDefault, h.ModeratedPostsHandler)
+	handleFunc("/Data-ReviewQueue", config.PolicyDefault, h.ReviewQueueHandler)
+	handleFunc("/Data-ReviewContent", config.PolicyDefault, h.ReviewContentHandler)
 
 	// User delete routes (own content only)
-	router.HandleFunc("/Data-UserDeletePost", UserDeletePostHandler)
-	router.HandleFunc("/Data-UserDeleteComment", UserDeleteCommentHandler)
+	handleFunc("/Data-UserDeletePost", config.PolicyDefault, h.UserDeletePostHandler)
+	handleFunc("/Data-UserDeleteComment", config.PolicyDefault, h.UserDeleteCommentHandler)
+
+	// Account routes
+	handleFunc("/Data-Sessions", config.PolicyDefault, h.SessionsHandler)
+	handleFunc("/Data-RevokeSession", config.PolicyDefault, h.RevokeSessionHandler)
+	handleFunc("/Data-RevokeOtherSessions", config.PolicyDefault, h.RevokeOtherSessionsHandler)
+	handleFunc("/Data-ChangePassword", config.PolicyAuth, h.ChangePasswordHandler)
+	handleFunc("/Data-RequestPasswordReset", config.PolicyAuth, h.RequestPasswordResetHandler)
+	handleFunc("/Data-ResetPassword", config.PolicyAuth, h.ResetPasswordHandler)
+	handleFunc("/Data-VerifyEmail", config.PolicyAuth, h.VerifyEmailHandler)
+	handleFunc("/Data-RequestEmailVerification", config.PolicyAuth, h.RequestEmailVerificationHandler)
+	handleFunc("/Data-Identities", config.PolicyDefault, h.IdentitiesHandler)
+	handleFunc("/Data-UnlinkIdentity", config.PolicyDefault, h.UnlinkIdentityHandler)
+
+	// Two-factor routes
+	handleFunc("/Data-TwoFactorChallenge", config.PolicyAuth, h.TwoFactorChallengeHandler)
+	handleFunc("/Data-TwoFactorVerify", config.PolicyAuth, h.TwoFactorVerifyHandler)
+	handleFunc("/Data-TwoFactorStatus", config.PolicyDefault, h.TwoFactorStatusHandler)
+	handleFunc("/Data-TwoFactorSetup", config.PolicyAuth, h.TwoFactorSetupHandler)
+	handleFunc("/Data-TwoFactorEnable", config.PolicyAuth, h.TwoFactorEnableHandler)
+	handleFunc("/Data-TwoFactorDisable", config.PolicyAuth, h.TwoFactorDisableHandler)
+	handleFunc("/Data-TwoFactorRecoveryCodes", config.PolicyAuth, h.TwoFactorRecoveryCodesHandler)
 
 	// Notification routes
-	router.HandleFunc("/Data-Notifications", NotificaionHandler)
-	router.HandleFunc("/Data-NotificationCount", NotificationCountHandler)
-	router.HandleFunc("/Data-MarkAsRead", MarkAsReadHandler)
-
-	router.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./static/uploads"))))
-	router.Handle("/scripts/", http.StripPrefix("/scripts/", http.FileServer(http.Dir("./static/scripts"))))
-	router.Handle("/styles/", http.StripPrefix("/styles/", http.FileServer(http.Dir("./static/styles"))))
-	router.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir("./static/images"))))
+	handleFunc("/Data-Notifications", config.PolicyDefault, h.NotificaionHandler)
+	handleFunc("/Data-NotificationCount", config.PolicyDefault, h.NotificationCountHandler)
+	handleFunc("/Data-MarkAsRead", config.PolicyDefault, h.MarkAsReadHandler)
+
+	// Uploads kept in S3 are loaded straight from the bucket.
+	if c.Uploads.Storage == config.StorageLocal {
+		handle(storage.LocalURLPrefix, config.PolicyStatic, http.StripPrefix(storage.LocalURLPrefix, http.FileServer(http.Dir(c.Uploads.Dir))))
+	}
+	handle("/scripts/", config.PolicyStatic, http.StripPrefix("/scripts/", http.FileServer(http.Dir("./static/scripts"))))
+	handle("/styles/", config.PolicyStatic, http.StripPrefix("/styles/", http.FileServer(http.Dir("./static/styles"))))
+	handle("/images/", config.PolicyStatic, http.StripPrefix("/images/", http.FileServer(http.Dir("./static/images"))))
 
 	//// router.Handle("/Data-creatPost", middleware.AuthenticateUser(http.HandlerFunc(CreatePostHandler)))
-	return mdlware.RateLimiter(router)
-	// return router
+	return mdlware.Sessions(h.stores.Sessions, h.cfg.Session.Lifetime.Duration)(mdlware.CSRF(h.csrfTokenFor)(router))
+}
+
+// rateLimitKey identifies the client behind a request for rate limiting: logged in users by their
+// ID, so they keep their own budget across networks, and everyone else by IP address.
+func (h *Handler) rateLimitKey(r *http.Request) string {
+	if userID, err := h.getUserIDByCookie(r); err == nil {
+		return "user:" + userID
+	}
+	if ip := mdlware.ClientIP(r, h.trustedProxies); ip != "" {
+		return "ip:" + ip
+	}
+	return ""
+}
+
+// csrfTokenFor returns the CSRF token of the session behind a request, if it has a live one.
+func (h *Handler) csrfTokenFor(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(utils.SessionCookieName)
+	if err != nil {
+		return "", false
+	}
+	token, err := h.stores.Sessions.CSRFToken(cookie.Value)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error getting CSRF token: %v\n", err)
+		}
+		return "", false
+	}
+	return token, true
 }
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"forum/DB"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notMuted wraps a handler through which users post, comment, edit or react, so that muted and banned
+// users are refused with a message telling them why and until when. Anonymous requests are left
+// for the handler to refuse.
+func (h *Handler) notMuted(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if current, ok := h.currentSession(r); ok {
+			mute, err := h.stores.Sanctions.ActiveMute(current.UserID)
+			if err == nil {
+				http.Error(w, "You are muted "+mute.Until()+". Reason: "+mute.Reason, http.StatusForbidden)
+				return
+			}
+			if err != sql.ErrNoRows {
+				log.Printf("Error checking sanctions: %v\n", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// AdminSanctionHandler lets admins ban a user, for a while or permanently, or mute them for a
+// while. Banned users are signed out everywhere and cannot log in; muted users cannot post,
+// comment, edit or react. Either way the user is notified with the reason. Admins cannot be sanctioned.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a SanctionRequest; only POST is accepted.
+func (h *Handler) AdminSanctionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if user is admin
+	if !h.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req SanctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 || req.DurationHours < 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == current.UserID {
+		http.Error(w, "You cannot sanction yourself", http.StatusBadRequest)
+		return
+	}
+
+	privilege, err := h.stores.Users.Privilege(req.UserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user privilege: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if privilege == 3 {
+		http.Error(w, "Admins cannot be sanctioned", http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.DurationHours > 0 {
+		expiry := time.Now().Add(time.Duration(req.DurationHours) * time.Hour)
+		expiresAt = &expiry
+	}
+
+	_, err = h.stores.Sanctions.Issue(req.UserID, current.UserID, req.Kind, req.Reason, expiresAt)
+	switch err {
+	case nil:
+	case DB.ErrInvalidSanction:
+		http.Error(w, "Invalid sanction: mutes need a duration", http.StatusBadRequest)
+		return
+	case sql.ErrNoRows:
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	default:
+		log.Printf("Error issuing sanction: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	message := "User muted"
+	if req.Kind == DB.SanctionBan {
+		message = "User banned"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": message,
+	})
+}
+
+// AdminLiftSanctionHandler lets admins end a ban or mute before it expires.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a LiftSanctionRequest; only POST is accepted.
+func (h *Handler) AdminLiftSanctionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if user is admin
+	if !h.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req LiftSanctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SanctionID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.stores.Sanctions.Lift(req.SanctionID, current.UserID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Sanction not found or already lifted", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error lifting sanction: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Sanction lifted",
+	})
+}
+
+// AdminSanctionsHandler lists bans and mutes for admins, newest first. The optional userId query
+// parameter narrows it down to one user, and active=1 to the sanctions still in force.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) AdminSanctionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if user is admin
+	if !h.isAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID := 0
+	if value := r.URL.Query().Get("userId"); value != "" {
+		var err error
+		if userID, err = strconv.Atoi(value); err != nil || userID <= 0 {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	}
+	activeOnly := r.URL.Query().Get("active") == "1"
+
+	sanctions, err := h.stores.Sanctions.List(userID, activeOnly)
+	if err != nil {
+		log.Printf("Error querying sanctions: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sanctions)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"forum/DB"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SearchHandler handles full-text searches over posts and their comments.
+//
+// Parameters:
+//   - w: http.ResponseWriter - Used to write the HTTP response.
+//   - r: *http.Request - The incoming HTTP request. It accepts the following query parameters:
+//   - q: the search terms (required).
+//   - category: only return posts in this category.
+//   - author: only return posts written by this username.
+//   - from, to: only return posts created between these dates (YYYY-MM-DD, both inclusive).
+//   - limit, offset: the page size (20 by default, at most 100) and how many results to skip.
+//
+// The function does not return any value directly, but writes the response to the http.ResponseWriter:
+//   - Responds with a JSON array of posts, best match first. Each post has the same shape as in
+//     /Data-Post plus a "snippet" field holding an HTML excerpt with the matches in <mark> tags.
+//
+// In case of errors, appropriate HTTP error statuses and messages are written to the response.
+func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := DB.SearchFilter{
+		Query:    query.Get("q"),
+		Category: query.Get("category"),
+		Author:   query.Get("author"),
+	}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.DateOnly, from); err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.DateOnly, to); err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		// The store treats To as exclusive, so move it to the start of the next day.
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := h.stores.Search.Posts(filter)
+	if errors.Is(err, DB.ErrEmptySearch) {
+		http.Error(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error searching posts: %v", err)
+		http.Error(w, "Error searching posts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"forum/DB"
+	"forum/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionsHandler lists the active sessions of the logged in user, most recently used first.
+// Each entry carries the session's IP address, user agent, creation, last-seen and expiry times,
+// and whether it is the session making the request.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.stores.Sessions.ListForUser(current.UserID)
+	if err != nil {
+		log.Printf("Error listing sessions: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, SessionInfo{
+			ID:        s.Handle(),
+			IPAddress: s.IPAddress,
+			UserAgent: s.UserAgent,
+			CreatedAt: s.CreatedAt,
+			LastSeen:  s.LastSeen,
+			ExpiresAt: s.Expiry,
+			Current:   s.ID == current.ID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+// RevokeSessionHandler logs out one of the user's sessions, identified by the id SessionsHandler
+// reported for it. Revoking the current session is the same as logging out.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a RevokeSessionRequest; only POST is accepted.
+func (h *Handler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RevokeSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SessionID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	revokedID, err := h.stores.Sessions.DeleteByHandle(current.UserID, req.SessionID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error revoking session: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if revokedID == current.ID {
+		utils.ClearSessionCookie(w)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Session revoked",
+	})
+}
+
+// RevokeOtherSessionsHandler logs the user out everywhere except the session making the request.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response, which reports how many sessions were revoked.
+//   - r: An *http.Request; only POST is accepted.
+func (h *Handler) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	revoked, err := h.stores.Sessions.DeleteOthers(current.UserID, current.ID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"revoked": revoked,
+		"message": "Logged out of all other sessions",
+	})
+}
+
+// ChangePasswordHandler replaces the user's password after checking the current one, then logs out
+// every other session so a stolen session cannot outlive the password it was opened with.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a ChangePasswordRequest; only POST is accepted.
+func (h *Handler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := h.stores.Users.PasswordHash(current.UserID)
+	if err != nil {
+		log.Printf("Error getting password hash: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.CurrentPassword)) != nil {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	if len(req.NewPassword) < 8 {
+		http.Error(w, "Password must be at least 8 characters long", http.StatusBadRequest)
+		return
+	}
+	if req.NewPassword != req.ConfirmPassword {
+		http.Error(w, "Passwords do not match", http.StatusBadRequest)
+		return
+	}
+
+	newHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error generating hash: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.stores.Users.SetPasswordHash(current.UserID, string(newHash)); err != nil {
+		log.Printf("Error changing password: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	revoked, err := h.stores.Sessions.DeleteOthers(current.UserID, current.ID)
+	if err != nil {
+		log.Printf("Error revoking sessions after password change: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"revoked": revoked,
+		"message": "Password changed",
+	})
+}
+
+// currentSession returns the live session behind a request, if there is one.
+func (h *Handler) currentSession(r *http.Request) (DB.Session, bool) {
+	cookie, err := r.Cookie(utils.SessionCookieName)
+	if err != nil {
+		return DB.Session{}, false
+	}
+
+	session, err := h.stores.Sessions.Get(cookie.Value)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error looking up session: %v\n", err)
+		}
+		return DB.Session{}, false
+	}
+	if time.Now().After(session.Expiry) {
+		return DB.Session{}, false
+	}
+	return session, true
+}
@@ -1,40 +1,20 @@
 package handlers
 
+import (
+	"forum/DB"
+	"forum/utils"
+	"time"
+)
+
 type Err struct {
 	ErrorMessage string `json:"errorMessage"`
 	Statuscode   int    `json:"statuscode"`
 }
 
-type Comment struct {
-	CmtID    int    `json:"CmtID"`
-	UserID   int    `json:"CmtUserID"`
-	Content  string `json:"CmtContent"`
-	CmtDate  string `json:"CmtDate"`
-	Username string `json:"CmtUsername"`
-	Likes    int    `json:"CmtLikes"`
-	Dislikes int    `json:"CmtDislikes"`
-}
-
-type Post struct {
-	PostID     int      `json:"PostID"`
-	UserID     int      `json:"UserID"`
-	PostDate   string   `json:"PostDate"`
-	Title      string   `json:"title"`
-	Content    string   `json:"content"`
-	ImagePath  *string  `json:"imagePath"`
-	Username   string   `json:"username"`
-	Likes      int      `json:"Likes"`
-	Dislikes   int      `json:"Dislikes"`
-	CmtCount   int      `json:"CmtCount"`
-	Categories []string `json:"Categories"`
-}
-
-type categories struct {
-	CategoryName string `json:"CategoryName"`
-	Posts        []Post `json:"Posts"`
-}
+// Comment and Post are defined next to the queries that fill them in the DB package.
+type Comment = DB.Comment
 
-var Action action
+type Post = DB.Post
 
 type action struct {
 	Message      string `json:"Message"`
@@ -43,17 +23,154 @@ type action struct {
 }
 
 type CommentedPost struct {
-	UserID     int    `json:"UserID"`
-	UserName   string `json:"UserName"`
-	CommentID  int    `json:"CommentID"`
-	PostID     int    `json:"PostID"`
-	Comment    string `json:"Comment"`
-	CreateDate string `json:"CreateDate"`
-	Likes      int    `json:"Likes"`
-	Dislikes   int    `json:"Dislikes"`
+	UserID          int    `json:"UserID"`
+	UserName        string `json:"UserName"`
+	CommentID       int    `json:"CommentID"`
+	PostID          int    `json:"PostID"`
+	ParentCommentID int    `json:"ParentCommentID,omitempty"`
+	Comment         string `json:"Comment"`
+	CommentHTML     string `json:"CommentHTML"`
+	CreateDate      string `json:"CreateDate"`
+	Likes           int    `json:"Likes"`
+	Dislikes        int    `json:"Dislikes"`
+	Held            bool   `json:"Held,omitempty"`
 }
 
 type CommentRequest struct {
 	PostID  string `json:"postId"`
 	Comment string `json:"comment"`
 }
+
+type ReplyRequest struct {
+	ParentCommentID string `json:"parentCommentId"`
+	Comment         string `json:"comment"`
+}
+
+// SessionInfo describes one of the user's active sessions. ID is the session's public handle,
+// never the session ID itself.
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	IPAddress string    `json:"ipAddress"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Current   bool      `json:"current"`
+}
+
+type RevokeSessionRequest struct {
+	SessionID string `json:"sessionId"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+	ConfirmPassword string `json:"confirmPassword"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// IdentityInfo describes one login provider on the user's profile: whether an account there is
+// linked, and if so which address it reported. Providers that are no longer configured still show
+// up while an account of theirs is linked, so it can be unlinked.
+type IdentityInfo struct {
+	Provider    string     `json:"provider"`
+	DisplayName string     `json:"displayName"`
+	Linked      bool       `json:"linked"`
+	Email       string     `json:"email,omitempty"`
+	LinkedAt    *time.Time `json:"linkedAt,omitempty"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	LinkURL     string     `json:"linkUrl,omitempty"`
+}
+
+type UnlinkIdentityRequest struct {
+	Provider string `json:"provider"`
+}
+
+// RevisionDiff compares two revisions of a post or comment line by line. Title is left out for comments.
+type RevisionDiff struct {
+	From    DB.Revision      `json:"from"`
+	To      DB.Revision      `json:"to"`
+	Title   []utils.DiffLine `json:"title,omitempty"`
+	Content []utils.DiffLine `json:"content"`
+}
+
+// RestoreRevisionRequest names the revision of a post or comment an admin brings back.
+type RestoreRevisionRequest struct {
+	ID       int `json:"id"`
+	Revision int `json:"revision"`
+}
+
+// ReportRequest is a user's report of a post, comment or user. Reason is the ID of one of the
+// DB.ReportReasons; Note is optional.
+type ReportRequest struct {
+	TargetType string `json:"targetType"`
+	TargetID   int    `json:"targetId"`
+	Reason     string `json:"reason"`
+	Note       string `json:"note"`
+}
+
+// RespondReportRequest is an admin's decision on a report: approved or rejected, with a response
+// shown to the users who filed it.
+type RespondReportRequest struct {
+	ReportID int    `json:"reportId"`
+	Status   string `json:"status"`
+	Response string `json:"response"`
+}
+
+// PostVisibilityRequest shows, hides or soft-deletes a post. Visibility is one of the DB post
+// visibilities; a reason is required to delete a post.
+type PostVisibilityRequest struct {
+	PostID     int    `json:"postId"`
+	Visibility string `json:"visibility"`
+	Reason     string `json:"reason"`
+}
+
+// LockPostRequest locks a post against new comments or unlocks it.
+type LockPostRequest struct {
+	PostID int  `json:"postId"`
+	Locked bool `json:"locked"`
+}
+
+// PinPostRequest pins a post above the others or unpins it.
+type PinPostRequest struct {
+	PostID int  `json:"postId"`
+	Pinned bool `json:"pinned"`
+}
+
+// SanctionRequest bans or mutes a user, giving a reason, for DurationHours hours. A ban with no
+// duration is permanent; mutes always need one.
+type SanctionRequest struct {
+	UserID        int    `json:"userId"`
+	Kind          string `json:"kind"`
+	Reason        string `json:"reason"`
+	DurationHours int    `json:"durationHours"`
+}
+
+// LiftSanctionRequest ends a ban or mute early.
+type LiftSanctionRequest struct {
+	SanctionID int `json:"sanctionId"`
+}
+
+// FilterRuleRequest adds a rule to the content filter. Pattern is the term, regular expression or
+// domain to look for; link caps use MaxLinks and AccountAgeDays instead.
+type FilterRuleRequest struct {
+	Kind           string `json:"kind"`
+	Pattern        string `json:"pattern"`
+	MaxLinks       int    `json:"maxLinks"`
+	AccountAgeDays int    `json:"accountAgeDays"`
+	Action         string `json:"action"`
+}
+
+// DeleteFilterRuleRequest removes a rule from the content filter.
+type DeleteFilterRuleRequest struct {
+	RuleID int `json:"ruleId"`
+}
+
+// ReviewContentRequest approves or rejects content the filter held for review.
+type ReviewContentRequest struct {
+	HoldID  int  `json:"holdId"`
+	Approve bool `json:"approve"`
+}
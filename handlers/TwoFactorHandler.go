@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"forum/DB"
+	"forum/auth"
+	"forum/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+// TwoFactorChallengeHandler describes the second login step of the pending login in the
+// loginChallenge cookie. For an account that already uses two-factor authentication it only
+// reports {"enroll": false}. For a moderator or administrator who has not enrolled yet it starts
+// the enrollment and returns the TOTP secret and its otpauth:// provisioning URI to scan.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request carrying the loginChallenge cookie; only GET is accepted.
+func (h *Handler) TwoFactorChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _, ok := h.pendingLogin(w, r)
+	if !ok {
+		return
+	}
+
+	enabled, err := h.stores.TwoFactor.Enabled(userID)
+	if err != nil {
+		log.Printf("Error getting two-factor status: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{"enroll": !enabled}
+	if !enabled {
+		secret, uri, err := h.pendingEnrollment(userID)
+		if err != nil {
+			log.Printf("Error starting two-factor enrollment: %v\n", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		response["secret"] = secret
+		response["uri"] = uri
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// TwoFactorVerifyHandler completes the second login step with a TOTP code or a recovery code,
+// then starts the session. During a forced enrollment the code confirms the new secret, and the
+// response carries the account's recovery codes, which are shown only this once.
+// Every wrong code counts against the challenge; after DB.MaxChallengeAttempts the user has to
+// log in again.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request carrying the loginChallenge cookie and a TwoFactorCodeRequest body;
+//     only POST is accepted.
+func (h *Handler) TwoFactorVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, challenge, ok := h.pendingLogin(w, r)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tf, err := h.stores.TwoFactor.Get(userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Two-factor enrollment has not been started", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error getting two-factor enrollment: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var recoveryCodes []string
+	if tf.Enabled {
+		ok, err = h.verifySecondFactor(tf, req.Code)
+	} else {
+		recoveryCodes, ok, err = h.confirmEnrollment(tf, req.Code)
+	}
+	if err != nil {
+		log.Printf("Error verifying two-factor code: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		if err := h.stores.TwoFactor.FailChallenge(challenge); err != nil {
+			log.Printf("Error counting failed two-factor attempt: %v\n", err)
+		}
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.stores.TwoFactor.DeleteChallenge(challenge); err != nil {
+		log.Printf("Error deleting login challenge: %v\n", err)
+	}
+	utils.ClearLoginChallengeCookie(w)
+
+	err = h.auth.StartSession(w, r, userID)
+	var banErr *auth.BanError
+	if errors.As(err, &banErr) {
+		http.Error(w, banErr.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating session: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// TwoFactorStatusHandler reports whether the logged in user has two-factor authentication enabled,
+// whether their role requires it, and how many unused recovery codes they have left.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only GET is accepted.
+func (h *Handler) TwoFactorStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := h.stores.TwoFactor.Enabled(current.UserID)
+	if err != nil {
+		log.Printf("Error getting two-factor status: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	required, err := h.auth.TwoFactorRequired(current.UserID)
+	if err != nil {
+		log.Printf("Error getting privilege: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	left, err := h.stores.TwoFactor.RecoveryCodesLeft(current.UserID)
+	if err != nil {
+		log.Printf("Error counting recovery codes: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":           enabled,
+		"required":          required,
+		"recoveryCodesLeft": left,
+	})
+}
+
+// TwoFactorSetupHandler starts a two-factor enrollment for the logged in user and returns the TOTP
+// secret and its provisioning URI. The enrollment only takes effect once TwoFactorEnableHandler
+// confirms it with a code.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only POST is accepted.
+func (h *Handler) TwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := h.stores.TwoFactor.Enabled(current.UserID)
+	if err != nil {
+		log.Printf("Error getting two-factor status: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, uri, err := h.pendingEnrollment(current.UserID)
+	if err != nil {
+		log.Printf("Error starting two-factor enrollment: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"secret": secret,
+		"uri":    uri,
+	})
+}
+
+// TwoFactorEnableHandler confirms the logged in user's pending enrollment with a code from their
+// authenticator app and returns their recovery codes, which are shown only this once.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a TwoFactorCodeRequest; only POST is accepted.
+func (h *Handler) TwoFactorEnableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tf, err := h.stores.TwoFactor.Get(current.UserID)
+	if err == sql.ErrNoRows || (err == nil && tf.Enabled) {
+		http.Error(w, "There is no pending two-factor enrollment", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error getting two-factor enrollment: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	recoveryCodes, ok, err := h.confirmEnrollment(tf, req.Code)
+	if err != nil {
+		log.Printf("Error enabling two-factor authentication: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// TwoFactorDisableHandler turns two-factor authentication off for the logged in user, after
+// checking a current TOTP or recovery code. Moderators and administrators cannot turn it off.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a TwoFactorCodeRequest; only POST is accepted.
+func (h *Handler) TwoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, tf, req, ok := h.enabledTwoFactorRequest(w, r)
+	if !ok {
+		return
+	}
+
+	required, err := h.auth.TwoFactorRequired(current.UserID)
+	if err != nil {
+		log.Printf("Error getting privilege: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if required {
+		http.Error(w, "Two-factor authentication is mandatory for moderators and administrators", http.StatusForbidden)
+		return
+	}
+
+	ok, err = h.verifySecondFactor(tf, req.Code)
+	if err != nil {
+		log.Printf("Error verifying two-factor code: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.stores.TwoFactor.Disable(current.UserID); err != nil {
+		log.Printf("Error disabling two-factor authentication: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// TwoFactorRecoveryCodesHandler replaces the logged in user's recovery codes with a new set, after
+// checking a current TOTP code, and returns them. The old codes stop working.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request whose JSON body is a TwoFactorCodeRequest; only POST is accepted.
+func (h *Handler) TwoFactorRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, tf, req, ok := h.enabledTwoFactorRequest(w, r)
+	if !ok {
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(tf.Secret, req.Code, time.Now())
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	fresh, err := h.stores.TwoFactor.UseStep(current.UserID, step)
+	if err != nil {
+		log.Printf("Error recording two-factor code: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !fresh {
+		http.Error(w, "This code has already been used", http.StatusUnauthorized)
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.stores.TwoFactor.ReplaceRecoveryCodes(current.UserID, hashes); err != nil {
+		log.Printf("Error replacing recovery codes: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"recoveryCodes": codes,
+	})
+}
+
+// pendingLogin returns the user and token of the live login challenge behind a request.
+// If there is none it clears the cookie, writes a 401 and reports false.
+func (h *Handler) pendingLogin(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	cookie, err := r.Cookie(utils.LoginChallengeCookieName)
+	if err != nil {
+		http.Error(w, "Your login has expired. Please log in again.", http.StatusUnauthorized)
+		return 0, "", false
+	}
+
+	userID, err := h.stores.TwoFactor.Challenge(cookie.Value)
+	if err == DB.ErrInvalidChallenge {
+		utils.ClearLoginChallengeCookie(w)
+		http.Error(w, "Your login has expired. Please log in again.", http.StatusUnauthorized)
+		return 0, "", false
+	} else if err != nil {
+		log.Printf("Error getting login challenge: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return 0, "", false
+	}
+	return userID, cookie.Value, true
+}
+
+// enabledTwoFactorRequest reads the session, enrollment and code of a request made by a logged in
+// user who has two-factor authentication enabled. It writes the error response and reports false
+// if any of them is missing.
+func (h *Handler) enabledTwoFactorRequest(w http.ResponseWriter, r *http.Request) (DB.Session, DB.TwoFactor, TwoFactorCodeRequest, bool) {
+	var req TwoFactorCodeRequest
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return current, DB.TwoFactor{}, req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return current, DB.TwoFactor{}, req, false
+	}
+
+	tf, err := h.stores.TwoFactor.Get(current.UserID)
+	if err == sql.ErrNoRows || (err == nil && !tf.Enabled) {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return current, tf, req, false
+	} else if err != nil {
+		log.Printf("Error getting two-factor enrollment: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return current, tf, req, false
+	}
+	return current, tf, req, true
+}
+
+// pendingEnrollment returns the secret and provisioning URI of userID's unconfirmed enrollment,
+// starting one if there is none yet. Reloading the page therefore shows the same secret.
+func (h *Handler) pendingEnrollment(userID int) (string, string, error) {
+	tf, err := h.stores.TwoFactor.Get(userID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", "", err
+	}
+
+	secret := tf.Secret
+	if err == sql.ErrNoRows {
+		if secret, err = auth.GenerateTOTPSecret(); err != nil {
+			return "", "", err
+		}
+		if err := h.stores.TwoFactor.SetPendingSecret(userID, secret); err != nil {
+			return "", "", err
+		}
+	}
+
+	username, err := h.stores.Users.Username(userID)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, auth.TOTPProvisioningURI(h.cfg.Account.TwoFactorIssuer, username, secret), nil
+}
+
+// confirmEnrollment enables a pending enrollment if code is valid for its secret, and returns the
+// new recovery codes.
+func (h *Handler) confirmEnrollment(tf DB.TwoFactor, code string) ([]string, bool, error) {
+	step, ok := auth.ValidateTOTP(tf.Secret, code, time.Now())
+	if !ok {
+		return nil, false, nil
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := h.stores.TwoFactor.Enable(tf.UserID, step, hashes); err != nil {
+		return nil, false, err
+	}
+	return codes, true, nil
+}
+
+// verifySecondFactor checks code against an enabled enrollment. Six digits are taken as a TOTP
+// code, which must not have been used before; anything else as a recovery code, which is spent.
+func (h *Handler) verifySecondFactor(tf DB.TwoFactor, code string) (bool, error) {
+	if step, ok := auth.ValidateTOTP(tf.Secret, code, time.Now()); ok {
+		return h.stores.TwoFactor.UseStep(tf.UserID, step)
+	}
+	if isDigits(code) {
+		return false, nil
+	}
+	return h.stores.TwoFactor.UseRecoveryCode(tf.UserID, auth.HashRecoveryCode(code))
+}
+
+// isDigits reports whether s is made of ASCII digits only.
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -6,8 +6,6 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 type DeleteResponse struct {
@@ -16,7 +14,7 @@ type DeleteResponse struct {
 }
 
 // UserDeletePostHandler allows users to delete their own posts
-func UserDeletePostHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UserDeletePostHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -37,16 +35,8 @@ func UserDeletePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
 	// Get user ID from session
-	userIDStr, err := getUserIDByCookie(r, db)
+	userIDStr, err := h.getUserIDByCookie(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -65,8 +55,7 @@ func UserDeletePostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user owns the post
-	var postOwnerID int
-	err = db.QueryRow("SELECT UserID FROM Post WHERE PostID = ?", postIDInt).Scan(&postOwnerID)
+	postOwnerID, err := h.stores.Posts.OwnerID(postIDInt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			w.Header().Set("Content-Type", "application/json")
@@ -90,41 +79,20 @@ func UserDeletePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete the post using transaction
-	tx, err := db.Begin()
+	// Remember the post's images, their files are removed once the post is gone
+	postImages, err := h.stores.Posts.Images(postIDInt)
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
+		log.Printf("Error getting post images: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	defer tx.Rollback()
-
-	// Delete related data first (foreign key constraints)
-	queries := []string{
-		"DELETE FROM CommentLike WHERE CommentID IN (SELECT CommentID FROM Comment WHERE PostID = ?)",
-		"DELETE FROM CommentDislike WHERE CommentID IN (SELECT CommentID FROM Comment WHERE PostID = ?)",
-		"DELETE FROM Comment WHERE PostID = ?",
-		"DELETE FROM PostLike WHERE PostID = ?",
-		"DELETE FROM PostDislike WHERE PostID = ?",
-		"DELETE FROM PostCategory WHERE PostID = ?",
-		"DELETE FROM Notification WHERE PostID = ?",
-		"DELETE FROM Post WHERE PostID = ?",
-	}
 
-	for _, query := range queries {
-		_, err = tx.Exec(query, postIDInt)
-		if err != nil {
-			log.Printf("Error executing query %s: %v", query, err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err = tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
+	if err := h.stores.Posts.Remove(postIDInt); err != nil {
+		log.Printf("Error deleting post: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	h.removeUnusedImageFiles(postImages)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(DeleteResponse{
@@ -134,7 +102,7 @@ func UserDeletePostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // UserDeleteCommentHandler allows users to delete their own comments
-func UserDeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UserDeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -155,16 +123,8 @@ func UserDeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "meow.db")
-	if err != nil {
-		log.Printf("Error opening database: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
 	// Get user ID from session
-	userIDStr, err := getUserIDByCookie(r, db)
+	userIDStr, err := h.getUserIDByCookie(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -183,8 +143,7 @@ func UserDeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user owns the comment
-	var commentOwnerID int
-	err = db.QueryRow("SELECT UserID FROM Comment WHERE CommentID = ?", commentIDInt).Scan(&commentOwnerID)
+	commentOwnerID, err := h.stores.Comments.OwnerID(commentIDInt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			w.Header().Set("Content-Type", "application/json")
@@ -208,34 +167,8 @@ func UserDeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete the comment using transaction
-	tx, err := db.Begin()
-	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	defer tx.Rollback()
-
-	// Delete related data first (foreign key constraints)
-	queries := []string{
-		"DELETE FROM CommentLike WHERE CommentID = ?",
-		"DELETE FROM CommentDislike WHERE CommentID = ?",
-		"DELETE FROM Notification WHERE CommentID = ?",
-		"DELETE FROM Comment WHERE CommentID = ?",
-	}
-
-	for _, query := range queries {
-		_, err = tx.Exec(query, commentIDInt)
-		if err != nil {
-			log.Printf("Error executing query %s: %v", query, err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if err = tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
+	if err := h.stores.Comments.Remove(commentIDInt); err != nil {
+		log.Printf("Error deleting comment: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"forum/DB"
+	"forum/mail"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// VerifyEmailHandler redeems the token from an email verification link and marks the address
+// as verified, then sends the browser to the home page.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the response.
+//   - r: An *http.Request carrying the "token" query parameter; only GET is accepted, since the
+//     request comes from a link in an email.
+func (h *Handler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := h.stores.Tokens.Consume(r.URL.Query().Get("token"), DB.TokenEmailVerification)
+	if err == DB.ErrInvalidToken {
+		http.Error(w, "This verification link is invalid or has expired.", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error consuming verification token: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.stores.Users.MarkEmailVerified(userID); err != nil {
+		log.Printf("Error marking email verified: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// RequestEmailVerificationHandler sends the logged in user a new email verification link.
+//
+// Parameters:
+//   - w: An http.ResponseWriter to write the JSON response.
+//   - r: An *http.Request; only POST is accepted.
+func (h *Handler) RequestEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	current, ok := h.currentSession(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	email, verified, err := h.stores.Users.Email(current.UserID)
+	if err != nil {
+		log.Printf("Error getting email: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if verified {
+		http.Error(w, "Your email address is already verified", http.StatusConflict)
+		return
+	}
+
+	if err := h.sendVerificationEmail(current.UserID, email); err != nil {
+		log.Printf("Error sending verification email: %v\n", err)
+		http.Error(w, "Failed to send the verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Verification email sent",
+	})
+}
+
+// sendVerificationEmail issues an email verification token for userID and emails the link to email.
+func (h *Handler) sendVerificationEmail(userID int, email string) error {
+	token, err := h.stores.Tokens.Issue(userID, DB.TokenEmailVerification, h.cfg.Account.EmailVerificationLifetime.Duration)
+	if err != nil {
+		return err
+	}
+
+	link := h.publicURL("/Data-VerifyEmail", url.Values{"token": {token}})
+	return h.mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Verify your forum email address",
+		Body: fmt.Sprintf(
+			"Welcome to the forum!\n\n"+
+				"To confirm that this is your email address, open this link within %s:\n\n%s\n\n"+
+				"If you didn't create an account, you can ignore this email.\n",
+			h.cfg.Account.EmailVerificationLifetime.Duration, link,
+		),
+	})
+}
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// unsafeFileChars matches everything that should not end up in a file name.
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._@-]+`)
+
+// FileMailer writes every message to its own .eml file instead of sending it, so links can be
+// followed during local development and tests without a mail server.
+type FileMailer struct {
+	dir  string
+	from string
+	seq  atomic.Int64
+}
+
+// NewFileMailer returns a Mailer that writes messages from from into dir, creating it if needed.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating mail directory: %v", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes msg to a file named after the time, a sequence number and the recipient.
+func (m *FileMailer) Send(msg Message) error {
+	if err := validateHeaders(msg); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%04d-%s.eml", now.Format("20060102T150405"), m.seq.Add(1), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg, now.Format(time.RFC1123Z)), 0o600); err != nil {
+		return fmt.Errorf("error writing email: %v", err)
+	}
+	log.Printf("mail: wrote message to %s into %s\n", msg.To, path)
+	return nil
+}
+
+// LogMailer prints every message to the server log instead of sending it.
+type LogMailer struct {
+	from string
+}
+
+// NewLogMailer returns a Mailer that logs messages from from.
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+// Send logs msg.
+func (m *LogMailer) Send(msg Message) error {
+	if err := validateHeaders(msg); err != nil {
+		return err
+	}
+	log.Printf("mail: from %s to %s\nSubject: %s\n\n%s\n", m.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"fmt"
+	"forum/config"
+	"strings"
+)
+
+// Message is a plain-text email to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the Mailer selected by c.Driver.
+func New(c config.MailConfig) (Mailer, error) {
+	switch c.Driver {
+	case config.MailDriverSMTP:
+		return NewSMTPMailer(c.SMTP, c.From), nil
+	case config.MailDriverFile:
+		return NewFileMailer(c.Dir, c.From)
+	case config.MailDriverLog:
+		return NewLogMailer(c.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", c.Driver)
+	}
+}
+
+// validateHeaders rejects recipients and subjects that would smuggle extra headers into a message.
+func validateHeaders(msg Message) error {
+	if msg.To == "" {
+		return fmt.Errorf("message has no recipient")
+	}
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("message headers must not contain line breaks")
+	}
+	return nil
+}
+
+// format renders msg as an RFC 5322 message with CRLF line endings, ready to be sent or saved.
+func format(from string, msg Message, date string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
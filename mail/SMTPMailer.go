@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"fmt"
+	"forum/config"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer sends email through an SMTP server. net/smtp upgrades the connection with STARTTLS
+// whenever the server offers it, and PLAIN authentication is only used over TLS or to localhost.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer returns a Mailer that sends through the server in c, as from.
+// Authentication is skipped when c.Username is empty.
+func NewSMTPMailer(c config.SMTPConfig, from string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		from: from,
+	}
+	if c.Username != "" {
+		m.auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	return m
+}
+
+// Send delivers msg.
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := validateHeaders(msg); err != nil {
+		return err
+	}
+	data := format(m.from, msg, time.Now().Format(time.RFC1123Z))
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("error sending email to %s: %v", msg.To, err)
+	}
+	return nil
+}
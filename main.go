@@ -1,23 +1,76 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"forum/DB"
+	"forum/auth"
+	"forum/config"
 	"forum/handlers"
+	"forum/mail"
+	"forum/media"
+	"forum/storage"
 	"log"
 	"net/http"
+	"os"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("error loading configuration: %v", err)
+	}
+
+	store, err := DB.OpenStore(DB.StoreConfig{
+		Path:            cfg.Database.Path,
+		BusyTimeout:     cfg.Database.BusyTimeout.Duration,
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime.Duration,
+	})
+	if err != nil {
+		log.Fatalf("error opening database: %v", err)
+	}
+	defer store.Close()
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(store, args[1:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	DB.InitDB(store)
+	go DB.NewStores(store).RunJanitor(cfg.Session.JanitorInterval.Duration)
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("error setting up mail: %v", err)
+	}
+
+	blobs, err := storage.New(cfg.Uploads)
+	if err != nil {
+		log.Fatalf("error setting up uploads: %v", err)
+	}
+	images := media.NewProcessor(cfg.Uploads, blobs)
+
+	providers, err := auth.NewRegistry(cfg.OAuth, cfg.Server.PublicURL, nil)
+	if err != nil {
+		log.Fatalf("error setting up login providers: %v", err)
+	}
+
 	srvr := http.Server{
-		Addr:    ":443",
-		Handler: handlers.Routes(),
+		Addr:    cfg.Server.Addr,
+		Handler: handlers.Routes(store, cfg, mailer, providers, images),
 	}
 
-	DB.InitDB()
-	log.Println("starting server on https://localhost/")
-	err := srvr.ListenAndServeTLS("./cert/cert.pem", "./cert/key.pem")
+	log.Printf("starting server on %s\n", cfg.Server.Addr)
+	err = srvr.ListenAndServeTLS(cfg.Server.CertFile, cfg.Server.KeyFile)
 	if err != nil {
 		log.Fatalf("error starting server:%v", err)
 	}
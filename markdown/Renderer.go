@@ -0,0 +1,53 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// converter turns CommonMark into HTML. Raw HTML in the source is left out rather than passed
+// through, and single line breaks are kept, since forum users write line by line and older posts
+// are plain text.
+var converter = goldmark.New(goldmark.WithRendererOptions(gmhtml.WithHardWraps()))
+
+// policy is the allow-list every rendered body goes through: text formatting, headings, links,
+// code blocks, lists and quotes. Anything else, including images, scripts, styles and event
+// handlers, is dropped. Links may only point to http, https and mailto URLs or to pages of the
+// forum itself; links elsewhere get rel="nofollow noopener" and open in a new tab.
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements(
+		"p", "br", "hr", "em", "strong", "del",
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"blockquote", "ul", "ol", "li", "pre", "code",
+	)
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	// Fenced code blocks name their language in a class, which syntax highlighters pick up.
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#.-]+$`)).OnElements("code")
+
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("title").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnFullyQualifiedLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// Render converts a CommonMark post or comment body into HTML that is safe to put into a page.
+func Render(source string) string {
+	var buf bytes.Buffer
+	if err := converter.Convert([]byte(source), &buf); err != nil {
+		// Converting into a buffer cannot fail; should it ever, the text is still shown.
+		return "<p>" + html.EscapeString(source) + "</p>"
+	}
+	return policy.Sanitize(buf.String())
+}
@@ -0,0 +1,94 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderDropsDangerousMarkup(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		absent []string
+	}{
+		{"javascript link", "[x](javascript:alert(1))", []string{"href", "javascript"}},
+		{"mixed case javascript link", "[x](JaVaScRiPt:alert(1))", []string{"href", "alert"}},
+		{"data link", "[x](data:text/html,<script>alert(1)</script>)", []string{"href", "data:", "<script"}},
+		{"script tag", "<script>alert(1)</script>", []string{"<script", "alert"}},
+		{"image with onerror", `<img src=x onerror="alert(1)">`, []string{"<img", "onerror"}},
+		{"inline event handler", `<p onclick="alert(1)">hi</p>`, []string{"onclick"}},
+		{"markdown image", "![x](https://example.com/x.png)", []string{"<img"}},
+		{"quote in link title", `[x](https://example.com "t\" onclick=\"alert(1)")`, []string{`" onclick`}},
+		{"quote in code language", "```go\" onclick=\"alert(1)\nx\n```", []string{"onclick", "class="}},
+	}
+	for _, tt := range tests {
+		got := Render(tt.source)
+		for _, s := range tt.absent {
+			if strings.Contains(got, s) {
+				t.Errorf("%s: Render(%q) = %q, contains %q", tt.name, tt.source, got, s)
+			}
+		}
+	}
+}
+
+// The converter already leaves raw HTML out; the policy must hold on its own should that change.
+func TestPolicyOnRawHTML(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{`<a href="javascript:alert(1)">x</a>`, `x`},
+		{`<a href="data:text/html,hi">x</a>`, `x`},
+		{`<a href="/post/1" onclick="alert(1)">x</a>`, `<a href="/post/1">x</a>`},
+		{`<script>alert(1)</script>ok`, `ok`},
+		{`<img src="x" onerror="alert(1)">ok`, `ok`},
+		{`<p style="color:red">x</p>`, `<p>x</p>`},
+		{`<code class="language-go">x</code>`, `<code class="language-go">x</code>`},
+		{`<code class="language-c++">x</code>`, `<code class="language-c++">x</code>`},
+		{`<code class="language-go evil">x</code>`, `<code>x</code>`},
+		{`<code class="evil">x</code>`, `<code>x</code>`},
+		{`<pre class="language-go">x</pre>`, `<pre>x</pre>`},
+		{`<ol start="3"><li>x</li></ol>`, `<ol start="3"><li>x</li></ol>`},
+		{`<ol start="3x"><li>x</li></ol>`, `<ol><li>x</li></ol>`},
+	}
+	for _, tt := range tests {
+		if got := policy.Sanitize(tt.html); got != tt.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tt.html, got, tt.want)
+		}
+	}
+}
+
+func TestRenderLinks(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"[x](https://example.com)", `<a href="https://example.com" rel="nofollow noopener" target="_blank">x</a>`},
+		{"[x](http://example.com)", `<a href="http://example.com" rel="nofollow noopener" target="_blank">x</a>`},
+		{"[x](mailto:a@example.com)", `<a href="mailto:a@example.com">x</a>`},
+		// links within the forum stay in the tab and are followed
+		{"[x](/post/1)", `<a href="/post/1">x</a>`},
+	}
+	for _, tt := range tests {
+		if got := Render(tt.source); !strings.Contains(got, tt.want) {
+			t.Errorf("Render(%q) = %q, want it to contain %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestRenderFormatting(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"**bold** and *em*", "<p><strong>bold</strong> and <em>em</em></p>\n"},
+		{"line one\nline two", "<p>line one<br>\nline two</p>\n"},
+		{"```go\nx := 1\n```", "<pre><code class=\"language-go\">x := 1\n</code></pre>\n"},
+		{"1 < 2 & 3 > 2", "<p>1 &lt; 2 &amp; 3 &gt; 2</p>\n"},
+	}
+	for _, tt := range tests {
+		if got := Render(tt.source); got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
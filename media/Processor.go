@@ -0,0 +1,347 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/config"
+	"forum/storage"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Errors returned by Processor.Save for uploads that are not acceptable images.
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image is too large")
+)
+
+// Image is an upload as it was saved: the re-encoded image and its thumbnail, named after their content.
+type Image struct {
+	Name          string
+	ThumbnailName string
+	MIMEType      string
+	Width         int
+	Height        int
+}
+
+// Processor turns uploaded images into files that are safe to serve. Every upload is decoded and
+// encoded again, which drops EXIF (including GPS positions) and any other metadata it carried;
+// it is shrunk to fit within MaxDimension and gets a thumbnail that fits within ThumbnailSize.
+// JPEG, PNG, GIF and WebP are accepted. WebP is stored as JPEG, or as PNG if it has transparency,
+// since there is no WebP encoder in the standard library; animated GIFs keep their animation.
+// The files go to a storage.BlobStore.
+type Processor struct {
+	store storage.BlobStore
+	cfg   config.UploadsConfig
+}
+
+// NewProcessor returns a Processor that saves into store.
+func NewProcessor(c config.UploadsConfig, store storage.BlobStore) *Processor {
+	return &Processor{store: store, cfg: c}
+}
+
+// Save reads an uploaded image from r, re-encodes it and writes it and its thumbnail to the store.
+// Files are named after a SHA-256 digest of their content, so uploading the same image twice
+// stores it once. It returns ErrUnsupportedFormat for anything that is not a JPEG, PNG, GIF
+// or WebP image and ErrTooLarge for images with more pixels than MaxPixels, counting the pixels
+// of every frame of an animated GIF.
+func (p *Processor) Save(r io.Reader) (Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, p.cfg.MaxFileSize+1))
+	if err != nil {
+		return Image{}, fmt.Errorf("error reading image: %v", err)
+	}
+	if int64(len(data)) > p.cfg.MaxFileSize {
+		return Image{}, ErrTooLarge
+	}
+
+	// The header is checked before decoding, so a small file claiming huge dimensions is never
+	// decoded into memory.
+	header, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupportedFormat
+	}
+	if header.Width <= 0 || header.Height <= 0 {
+		return Image{}, ErrUnsupportedFormat
+	}
+	if int64(header.Width)*int64(header.Height) > p.cfg.MaxPixels {
+		return Image{}, ErrTooLarge
+	}
+
+	var full, thumb encoded
+	switch format {
+	case "gif":
+		full, thumb, err = p.processGIF(data)
+	case "jpeg", "png", "webp":
+		full, thumb, err = p.processStill(data, format)
+	default:
+		return Image{}, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return Image{}, err
+	}
+
+	sum := sha256.Sum256(full.data)
+	hash := hex.EncodeToString(sum[:16])
+	saved := Image{
+		Name:          hash + full.ext,
+		ThumbnailName: hash + "_thumb" + thumb.ext,
+		MIMEType:      full.mimeType,
+		Width:         full.width,
+		Height:        full.height,
+	}
+	if err := p.write(saved.Name, full); err != nil {
+		return Image{}, err
+	}
+	if err := p.write(saved.ThumbnailName, thumb); err != nil {
+		return Image{}, err
+	}
+	return saved, nil
+}
+
+// Remove deletes a file saved by Save. Removing a file that is already gone is not an error.
+// Callers must make sure no post uses the file anymore: identical uploads share their files.
+func (p *Processor) Remove(name string) error {
+	return p.store.Delete(name)
+}
+
+// URL returns the address a browser can load a file saved by Save from. It may expire, so it has
+// to be asked for every time it is handed out.
+func (p *Processor) URL(name string) string {
+	return p.store.URL(name)
+}
+
+// encoded is an image ready to be written to the store.
+type encoded struct {
+	data          []byte
+	ext           string
+	mimeType      string
+	width, height int
+}
+
+// processStill decodes a JPEG, PNG or WebP image and encodes it and its thumbnail.
+// JPEG photos are turned upright first, since their EXIF orientation is about to be dropped.
+func (p *Processor) processStill(data []byte, format string) (encoded, encoded, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return encoded{}, encoded{}, ErrUnsupportedFormat
+	}
+
+	// PNG keeps its format. JPEG and opaque WebP images become JPEG, WebP with transparency PNG.
+	asPNG := format == "png"
+	if format == "webp" {
+		asPNG = !isOpaque(src)
+	}
+
+	fullImg := resize(src, p.cfg.MaxDimension)
+	thumbImg := resize(fullImg, p.cfg.ThumbnailSize)
+	if format == "jpeg" {
+		orientation := jpegOrientation(data)
+		fullImg = orient(fullImg, orientation)
+		thumbImg = orient(thumbImg, orientation)
+	}
+
+	full, err := p.encodeStill(fullImg, asPNG)
+	if err != nil {
+		return encoded{}, encoded{}, err
+	}
+	thumb, err := p.encodeStill(thumbImg, asPNG)
+	if err != nil {
+		return encoded{}, encoded{}, err
+	}
+	return full, thumb, nil
+}
+
+// processGIF decodes a possibly animated GIF and shrinks every frame of it. The thumbnail is a
+// still PNG of the first frame. Every frame is decoded into memory of its own, so a small file
+// of many well compressed frames could take gigabytes; the frames are counted up first and
+// their pixels together may not exceed MaxPixels.
+func (p *Processor) processGIF(data []byte) (encoded, encoded, error) {
+	pixels, err := gifPixels(data, p.cfg.MaxPixels)
+	if err != nil {
+		return encoded{}, encoded{}, err
+	}
+	if pixels > p.cfg.MaxPixels {
+		return encoded{}, encoded{}, ErrTooLarge
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(g.Image) == 0 {
+		return encoded{}, encoded{}, ErrUnsupportedFormat
+	}
+
+	width, height := fit(g.Config.Width, g.Config.Height, p.cfg.MaxDimension)
+	if width != g.Config.Width || height != g.Config.Height {
+		sx := float64(width) / float64(g.Config.Width)
+		sy := float64(height) / float64(g.Config.Height)
+		for i, frame := range g.Image {
+			b := frame.Bounds()
+			rect := image.Rect(
+				int(float64(b.Min.X)*sx), int(float64(b.Min.Y)*sy),
+				max(int(float64(b.Max.X)*sx), int(float64(b.Min.X)*sx)+1),
+				max(int(float64(b.Max.Y)*sy), int(float64(b.Min.Y)*sy)+1),
+			)
+			scaled := image.NewPaletted(rect, frame.Palette)
+			draw.NearestNeighbor.Scale(scaled, rect, frame, b, draw.Src, nil)
+			g.Image[i] = scaled
+		}
+		g.Config.Width, g.Config.Height = width, height
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return encoded{}, encoded{}, fmt.Errorf("error encoding GIF: %v", err)
+	}
+	full := encoded{data: buf.Bytes(), ext: ".gif", mimeType: "image/gif", width: width, height: height}
+
+	// The first frame may cover only part of the canvas, so it is drawn onto a blank one.
+	first := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(first, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Src)
+	thumb, err := p.encodeStill(resize(first, p.cfg.ThumbnailSize), true)
+	if err != nil {
+		return encoded{}, encoded{}, err
+	}
+	return full, thumb, nil
+}
+
+// gifPixels adds up the pixels of the frames of a GIF by walking its blocks, without
+// decompressing any of them. It stops as soon as the count goes over limit, and returns
+// ErrUnsupportedFormat if the file is cut short or malformed.
+func gifPixels(data []byte, limit int64) (int64, error) {
+	const (
+		headerLen        = 6 + 7 // signature and version, logical screen descriptor
+		imageDescLen     = 1 + 9 // separator, position, size and flags
+		colorTableFlag   = 0x80
+		extensionIntro   = 0x21
+		imageSeparator   = 0x2C
+		trailer          = 0x3B
+		colorTableSizeOf = 0x07
+	)
+	if len(data) < headerLen {
+		return 0, ErrUnsupportedFormat
+	}
+	// colorTable returns the length of the color table announced by flags.
+	colorTable := func(flags byte) int {
+		if flags&colorTableFlag == 0 {
+			return 0
+		}
+		return 3 << (flags&colorTableSizeOf + 1)
+	}
+	// subBlocks returns the position right after the data sub-blocks starting at i.
+	subBlocks := func(i int) (int, error) {
+		for {
+			if i >= len(data) {
+				return 0, ErrUnsupportedFormat
+			}
+			size := int(data[i])
+			i++
+			if size == 0 {
+				return i, nil
+			}
+			i += size
+		}
+	}
+
+	var pixels int64
+	i := headerLen + colorTable(data[10])
+	for {
+		if i >= len(data) {
+			return 0, ErrUnsupportedFormat
+		}
+		var err error
+		switch data[i] {
+		case trailer:
+			return pixels, nil
+		case extensionIntro:
+			i, err = subBlocks(i + 2)
+		case imageSeparator:
+			if i+imageDescLen >= len(data) {
+				return 0, ErrUnsupportedFormat
+			}
+			width := int64(data[i+5]) | int64(data[i+6])<<8
+			height := int64(data[i+7]) | int64(data[i+8])<<8
+			pixels += width * height
+			if pixels > limit {
+				return pixels, nil
+			}
+			// skip the local color table and the LZW minimum code size
+			i, err = subBlocks(i + imageDescLen + colorTable(data[i+9]) + 1)
+		default:
+			return 0, ErrUnsupportedFormat
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// encodeStill encodes img as PNG or as JPEG with the configured quality.
+func (p *Processor) encodeStill(img image.Image, asPNG bool) (encoded, error) {
+	var buf bytes.Buffer
+	size := img.Bounds().Size()
+	if asPNG {
+		if err := png.Encode(&buf, img); err != nil {
+			return encoded{}, fmt.Errorf("error encoding PNG: %v", err)
+		}
+		return encoded{data: buf.Bytes(), ext: ".png", mimeType: "image/png", width: size.X, height: size.Y}, nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.cfg.JPEGQuality}); err != nil {
+		return encoded{}, fmt.Errorf("error encoding JPEG: %v", err)
+	}
+	return encoded{data: buf.Bytes(), ext: ".jpg", mimeType: "image/jpeg", width: size.X, height: size.Y}, nil
+}
+
+// write saves img as name in the store. A file that already exists has the same content, since
+// names are content hashes, and is left alone.
+func (p *Processor) write(name string, img encoded) error {
+	exists, err := p.store.Exists(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return p.store.Put(name, img.data, img.mimeType)
+}
+
+// resize returns a copy of img shrunk to fit within a square of maxSide pixels. Images that
+// already fit are copied unchanged; either way the result holds no reference to img.
+func resize(img image.Image, maxSide int) *image.NRGBA {
+	b := img.Bounds()
+	width, height := fit(b.Dx(), b.Dy(), maxSide)
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if width == b.Dx() && height == b.Dy() {
+		draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+		return dst
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// fit scales width and height down, keeping their ratio, so neither is larger than maxSide.
+func fit(width, height, maxSide int) (int, int) {
+	if width <= maxSide && height <= maxSide {
+		return width, height
+	}
+	if width >= height {
+		return maxSide, max(1, height*maxSide/width)
+	}
+	return max(1, width*maxSide/height), maxSide
+}
+
+// isOpaque reports whether img has no transparent pixels. Images that cannot tell are assumed
+// to have some.
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
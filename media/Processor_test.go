@@ -0,0 +1,74 @@
+package media
+
+import (
+	"bytes"
+	"forum/config"
+	"forum/storage"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// animatedGIF encodes a GIF of frames full-canvas frames of size by size pixels.
+func animatedGIF(t *testing.T, size, frames int) []byte {
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{Config: image.Config{ColorModel: palette, Width: size, Height: size}}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, size, size), palette))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("encoding GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newTestProcessor(t *testing.T, maxPixels int64) *Processor {
+	t.Helper()
+
+	store, err := storage.NewFileStore(t.TempDir(), "/uploads/")
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	c := config.Default().Uploads
+	c.MaxPixels = maxPixels
+	return NewProcessor(c, store)
+}
+
+func TestGIFPixels(t *testing.T) {
+	data := animatedGIF(t, 100, 30)
+
+	if got, err := gifPixels(data, 1<<40); err != nil || got != 30*100*100 {
+		t.Errorf("gifPixels = %d, %v; want %d", got, err, 30*100*100)
+	}
+	if got, err := gifPixels(data, 50_000); err != nil || got <= 50_000 {
+		t.Errorf("gifPixels with a limit of 50000 = %d, %v; want it over the limit", got, err)
+	}
+	if _, err := gifPixels(data[:len(data)/2], 1<<40); err != ErrUnsupportedFormat {
+		t.Errorf("gifPixels of a truncated GIF returned %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestSaveRefusesGIFBombs(t *testing.T) {
+	// A few kilobytes of blank frames: the canvas is small, but the frames add up to 4M pixels.
+	bomb := animatedGIF(t, 200, 100)
+	if len(bomb) > 64<<10 {
+		t.Fatalf("the test GIF is %d bytes; it should compress far better", len(bomb))
+	}
+
+	if _, err := newTestProcessor(t, 1_000_000).Save(bytes.NewReader(bomb)); err != ErrTooLarge {
+		t.Errorf("Save of %d frames of 200x200 with a budget of 1M pixels returned %v, want ErrTooLarge", 100, err)
+	}
+
+	img, err := newTestProcessor(t, 5_000_000).Save(bytes.NewReader(bomb))
+	if err != nil {
+		t.Fatalf("Save within the budget: %v", err)
+	}
+	if img.MIMEType != "image/gif" || img.Width != 200 || img.Height != 200 {
+		t.Errorf("Save = %+v, want a 200x200 GIF", img)
+	}
+}
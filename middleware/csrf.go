@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+
+	"forum/utils"
+)
+
+const (
+	// CSRFHeader is the request header scripts send the CSRF token in.
+	CSRFHeader = "X-CSRF-Token"
+	// CSRFFormField is the form field plain HTML forms can send the CSRF token in instead.
+	CSRFFormField = "csrf_token"
+)
+
+// CSRF rejects state-changing requests that do not carry the CSRF token of their session.
+//
+// Every session has its own token, which the client reads from /auth/status and sends back in
+// the X-CSRF-Token header of every request that is not a GET, HEAD or OPTIONS. Plain HTML forms
+// may send it in a csrf_token field instead, but only URL-encoded ones: the body of any other
+// request is left alone for its handler to read under its own size limit. A cross-site page can
+// make the browser send the session cookie, but it cannot read the token, so its requests are
+// refused with a 403 JSON error.
+//
+// tokenFor returns the token of the session behind a request and whether there is a live session
+// at all. Requests without a session cookie carry no credentials worth forging and are passed
+// through; the handlers themselves decide whether they need a logged in user. Requests with a
+// session cookie but no live session are refused, since the handlers might still make something
+// of the cookie. Sessions, which runs first, drops dead session cookies, so only requests that
+// got past it with one end up here.
+func CSRF(tokenFor func(*http.Request) (string, bool)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if _, err := r.Cookie(utils.SessionCookieName); err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			expected, ok := tokenFor(r)
+			if !ok {
+				csrfError(w, "csrf_session_invalid", "Your session has expired. Log in again and retry.")
+				return
+			}
+
+			sent := r.Header.Get(CSRFHeader)
+			if sent == "" && isURLEncodedForm(r) {
+				// ParseForm keeps URL-encoded bodies in memory and caps them at 10MB.
+				sent = r.PostFormValue(CSRFFormField)
+			}
+
+			if sent == "" {
+				csrfError(w, "csrf_token_missing", "This request is missing its CSRF token. Reload the page and try again.")
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) != 1 {
+				csrfError(w, "csrf_token_invalid", "This request carries an invalid CSRF token. Reload the page and try again.")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isURLEncodedForm reports whether the body of r is an application/x-www-form-urlencoded form.
+func isURLEncodedForm(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// csrfError writes a 403 JSON response describing why the CSRF check failed.
+func csrfError(w http.ResponseWriter, code, body string) {
+	message := Message{
+		Status: "error",
+		Code:   code,
+		Body:   body,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	if err := json.NewEncoder(w).Encode(&message); err != nil {
+		log.Printf("Failed to encode JSON response: %v", err)
+	}
+}
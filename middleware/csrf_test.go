@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"forum/utils"
+)
+
+// countingReader counts the bytes read from the body it wraps.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestCSRF(t *testing.T) {
+	// The session "live" has the token "secret"; every other session is dead.
+	tokenFor := func(r *http.Request) (string, bool) {
+		if c, err := r.Cookie(utils.SessionCookieName); err == nil && c.Value == "live" {
+			return "secret", true
+		}
+		return "", false
+	}
+	handler := CSRF(tokenFor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	form := url.Values{CSRFFormField: {"secret"}}.Encode()
+	tests := []struct {
+		name        string
+		method      string
+		session     string
+		header      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"reads pass", http.MethodGet, "live", "", "", "", http.StatusNoContent},
+		{"anonymous", http.MethodPost, "", "", "", "", http.StatusNoContent},
+		{"token in header", http.MethodPost, "live", "secret", "", "", http.StatusNoContent},
+		{"missing token", http.MethodPost, "live", "", "", "", http.StatusForbidden},
+		{"wrong token", http.MethodPost, "live", "guess", "", "", http.StatusForbidden},
+		{"dead session", http.MethodPost, "expired", "", "", "", http.StatusForbidden},
+		{"dead session with a token", http.MethodPost, "expired", "secret", "", "", http.StatusForbidden},
+		{"token in a form", http.MethodPost, "live", "", "application/x-www-form-urlencoded", form, http.StatusNoContent},
+		{"token in a form with a charset", http.MethodPost, "live", "", "application/x-www-form-urlencoded; charset=utf-8", form, http.StatusNoContent},
+		{"token in a multipart form", http.MethodPost, "live", "", "multipart/form-data; boundary=b",
+			"--b\r\nContent-Disposition: form-data; name=\"csrf_token\"\r\n\r\nsecret\r\n--b--\r\n", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		body := &countingReader{r: strings.NewReader(tt.body)}
+		req := httptest.NewRequest(tt.method, "/", body)
+		if tt.session != "" {
+			req.AddCookie(&http.Cookie{Name: utils.SessionCookieName, Value: tt.session})
+		}
+		if tt.header != "" {
+			req.Header.Set(CSRFHeader, tt.header)
+		}
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if !strings.HasPrefix(tt.contentType, "application/x-www-form-urlencoded") && body.read != 0 {
+			t.Errorf("%s: the check read %d bytes of the body", tt.name, body.read)
+		}
+	}
+}
@@ -2,140 +2,242 @@ package middleware
 
 import (
 	"encoding/json"
+	"fmt"
+	"forum/config"
 	"log"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 type Message struct {
 	Status string `json:"status"`
+	Code   string `json:"code,omitempty"`
 	Body   string `json:"body"`
 }
 
-// RateLimiter is a middleware function that implements a rate limiter for HTTP requests.
-// It limits the number of requests from a single client within a specified time frame.
-// If a client exceeds the rate limit, they will be temporarily blocked from making further requests.
+// RateLimiter limits how many requests a single client can make to a route within a time frame.
+// If a client exceeds the rate limit, they will be temporarily blocked from making further requests
+// to the routes sharing that policy.
 //
 // The rate limiter uses a token bucket algorithm, where tokens are generated at a constant rate.
 // Clients are assigned a burst limit of tokens, and they can only make requests when they have tokens available.
 // If a client exceeds the burst limit, they will be temporarily blocked.
 //
-// The rate limiter maintains a map of clients, where each client's IP address is used as the key.
-// The map is protected by a mutex to ensure thread safety.
+// Every route is attached to a named policy (see config.RateLimitPolicy), so a login attempt can be
+// far more expensive than an image download. Each policy keeps its own bucket per client, where the
+// client is identified by the key function given to NewRateLimiter, e.g. the logged in user's ID
+// with the IP address as a fallback.
 //
-// The rate limiter has the following configurable constants:
-// - rateLimit: The maximum number of requests allowed per second.
-// - burstLimit: The maximum number of requests allowed within a single time frame.
-// - cleanupInterval: The interval at which the rate limiter cleans up expired clients from the map.
-// - clientTimeout: The maximum duration of time a client can be inactive before being removed from the map.
-// - blockDuration: The duration of time a client will be temporarily blocked if they exceed the rate limit.
+// The buckets are protected by a mutex to ensure thread safety, and clients that have been idle
+// for longer than ClientTimeout are forgotten every CleanupInterval.
 //
-// The middleware function returns an http.Handler that can be used as a middleware in an HTTP server.
-func RateLimiter(next http.Handler) http.Handler {
-	type Client struct {
-		tokens        float64
-		lastTimestamp time.Time
-		blockUntil    time.Time
-	}
+// Every response carries the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers,
+// and a blocked client additionally gets a Retry-After header with a 429 status.
+type RateLimiter struct {
+	cfg     config.RateLimitConfig
+	keyFunc func(*http.Request) string
+
+	mtx     sync.Mutex
+	clients map[string]*client
+}
 
-	var (
-		mtx     sync.Mutex
-		clients = make(map[string]*Client)
-	)
-
-	const (
-		rateLimit       = 100
-		burstLimit      = 100
-		cleanupInterval = time.Minute
-		clientTimeout   = 2 * time.Minute
-		blockDuration   = 1 * time.Minute
-	)
-
-	go func() {
-		for {
-			time.Sleep(cleanupInterval)
-			mtx.Lock()
-			for ip, client := range clients {
-				if time.Since(client.lastTimestamp) > clientTimeout {
-					delete(clients, ip)
-				}
-			}
-			mtx.Unlock()
-		}
-	}()
+type client struct {
+	tokens        float64
+	lastTimestamp time.Time
+	blockUntil    time.Time
+}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var ip string
+// NewRateLimiter builds a RateLimiter from cfg. keyFunc identifies the client behind a request;
+// when it is nil clients are identified by the IP address they connect from.
+func NewRateLimiter(cfg config.RateLimitConfig, keyFunc func(*http.Request) string) *RateLimiter {
+	if keyFunc == nil {
+		keyFunc = func(r *http.Request) string { return ClientIP(r, nil) }
+	}
+	rl := &RateLimiter{
+		cfg:     cfg,
+		keyFunc: keyFunc,
+		clients: make(map[string]*client),
+	}
+	go rl.cleanup()
+	return rl
+}
 
-		if ip = r.Header.Get("X-Real-IP"); ip == "" {
-			if ip = r.Header.Get("X-Forwarded-For"); ip == "" {
-				ip, _, _ = net.SplitHostPort(r.RemoteAddr)
-			}
-		}
+// Limit wraps next in the named policy. It panics if the policy does not exist, which
+// config.Validate rules out for the policies the routes use.
+func (rl *RateLimiter) Limit(policyName string, next http.Handler) http.Handler {
+	policy, ok := rl.cfg.Policies[policyName]
+	if !ok {
+		panic(fmt.Sprintf("middleware: unknown rate limit policy %q", policyName))
+	}
+	rate := policy.Rate()
+	burst := float64(policy.Burst)
 
-		if net.ParseIP(ip) == nil {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := rl.keyFunc(r)
+		if key == "" {
 			http.Error(w, "Invalid IP address", http.StatusBadRequest)
 			return
 		}
+		key = policyName + "|" + key
 
 		now := time.Now()
 
-		mtx.Lock()
-		client, exists := clients[ip]
+		rl.mtx.Lock()
+		c, exists := rl.clients[key]
 		if !exists {
-			client = &Client{
-				tokens:        burstLimit,
+			c = &client{
+				tokens:        burst,
 				lastTimestamp: now,
 			}
-			clients[ip] = client
+			rl.clients[key] = c
 		} else {
-			if client.blockUntil.After(now) {
-				mtx.Unlock()
-				message := Message{
-					Status: "error",
-					Body:   "You are temporarily blocked due to excessive requests.",
-				}
-
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-				if err := json.NewEncoder(w).Encode(&message); err != nil {
-					log.Printf("Failed to encode JSON response: %v", err)
-				}
+			if c.blockUntil.After(now) {
+				retryAfter := c.blockUntil.Sub(now)
+				rl.mtx.Unlock()
+				setRateLimitHeaders(w, policy.Burst, 0, retryAfter+fullAfter(0, burst, rate))
+				tooManyRequests(w, retryAfter, "You are temporarily blocked due to excessive requests.")
 				return
 			}
 
-			elapsed := now.Sub(client.lastTimestamp).Seconds()
-			client.tokens += elapsed * rateLimit
-			if client.tokens > burstLimit {
-				client.tokens = burstLimit
+			elapsed := now.Sub(c.lastTimestamp).Seconds()
+			c.tokens += elapsed * rate
+			if c.tokens > burst {
+				c.tokens = burst
 			}
-			client.lastTimestamp = now
+			c.lastTimestamp = now
 		}
 
-		if client.tokens >= 1.0 {
-			client.tokens -= 1.0
-			mtx.Unlock()
+		if c.tokens >= 1.0 {
+			c.tokens -= 1.0
+			tokens := c.tokens
+			rl.mtx.Unlock()
+			setRateLimitHeaders(w, policy.Burst, int(tokens), fullAfter(tokens, burst, rate))
 			next.ServeHTTP(w, r)
 			return
-		} else {
-			client.blockUntil = now.Add(blockDuration)
-			mtx.Unlock()
+		}
 
-			message := Message{
-				Status: "error",
-				Body:   "You have exceeded the rate limit and are temporarily blocked.",
-			}
+		// Without a block duration the client only has to wait for the next token.
+		retryAfter := time.Duration((1.0 - c.tokens) / rate * float64(time.Second))
+		if policy.BlockDuration.Duration > 0 {
+			c.blockUntil = now.Add(policy.BlockDuration.Duration)
+			retryAfter = policy.BlockDuration.Duration
+		}
+		tokens := c.tokens
+		rl.mtx.Unlock()
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusTooManyRequests)
-			if err := json.NewEncoder(w).Encode(&message); err != nil {
-				log.Printf("Failed to encode JSON response: %v", err)
+		setRateLimitHeaders(w, policy.Burst, 0, retryAfter+fullAfter(tokens, burst, rate))
+		tooManyRequests(w, retryAfter, "You have exceeded the rate limit and are temporarily blocked.")
+	})
+}
+
+// cleanup forgets clients that have been idle for longer than ClientTimeout and are not blocked.
+func (rl *RateLimiter) cleanup() {
+	for {
+		time.Sleep(rl.cfg.CleanupInterval.Duration)
+		now := time.Now()
+		rl.mtx.Lock()
+		for key, c := range rl.clients {
+			if now.Sub(c.lastTimestamp) > rl.cfg.ClientTimeout.Duration && now.After(c.blockUntil) {
+				delete(rl.clients, key)
 			}
-			return
 		}
-	})
+		rl.mtx.Unlock()
+	}
+}
+
+// ClientIP returns the IP address of the client behind r, or an empty string if it is not valid.
+//
+// It is the address r comes from, unless that is one of the trusted proxies. Then the client is
+// the right-most address of X-Forwarded-For that is not a trusted proxy itself: every address to
+// its left was written by the client or by proxies nobody vouches for, so a client cannot pick
+// its own address by sending the header. X-Real-IP is used when a trusted proxy sends no
+// X-Forwarded-For.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil {
+		return ""
+	}
+	if !isTrusted(peer, trusted) {
+		return peer.String()
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+			return realIP.String()
+		}
+		return peer.String()
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// Whatever wrote this garbled entry is not to be believed; the last trusted proxy
+			// received the request from it.
+			break
+		}
+		client = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// isTrusted reports whether ip belongs to one of the trusted networks.
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// fullAfter returns how long a bucket holding tokens takes to refill completely.
+func fullAfter(tokens, burst, rate float64) time.Duration {
+	return time.Duration((burst - tokens) / rate * float64(time.Second))
+}
+
+// setRateLimitHeaders reports the state of the client's bucket. X-RateLimit-Reset is the number of
+// seconds until the bucket is full again.
+func setRateLimitHeaders(w http.ResponseWriter, limit, remaining int, reset time.Duration) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+}
+
+// tooManyRequests writes the 429 JSON response together with its Retry-After header.
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, body string) {
+	message := Message{
+		Status: "error",
+		Body:   body,
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	if err := json.NewEncoder(w).Encode(&message); err != nil {
+		log.Printf("Failed to encode JSON response: %v", err)
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, as the rate limit headers only carry integers.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
 
 // package middleware
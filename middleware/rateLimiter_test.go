@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		trusted    []*net.IPNet
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4242", nil, "", trusted, "203.0.113.7"},
+		{"headers of an untrusted peer are ignored", "203.0.113.7:4242", []string{"198.51.100.1"}, "198.51.100.2", trusted, "203.0.113.7"},
+		{"headers are ignored without trusted proxies", "10.0.0.1:4242", []string{"198.51.100.1"}, "", nil, "10.0.0.1"},
+		{"trusted proxy", "10.0.0.1:4242", []string{"198.51.100.1"}, "", trusted, "198.51.100.1"},
+		{"spoofed entries left of the client", "10.0.0.1:4242", []string{"1.2.3.4, 198.51.100.1"}, "", trusted, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.1:4242", []string{"198.51.100.1, 10.0.0.2", "10.0.0.3"}, "", trusted, "198.51.100.1"},
+		{"garbled entry", "10.0.0.1:4242", []string{"198.51.100.1, bogus, 10.0.0.2"}, "", trusted, "10.0.0.2"},
+		{"only trusted proxies", "10.0.0.1:4242", []string{"10.0.0.2"}, "", trusted, "10.0.0.2"},
+		{"real IP from a trusted proxy", "10.0.0.1:4242", nil, "198.51.100.1", trusted, "198.51.100.1"},
+		{"invalid remote address", "bogus", nil, "", trusted, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, header := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", header)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := ClientIP(r, tt.trusted); got != tt.want {
+			t.Errorf("%s: ClientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
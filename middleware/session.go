@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"forum/DB"
+	"forum/utils"
+)
+
+// sessionTouchInterval is how stale a session's last-seen time may get before a request refreshes it,
+// so an active user costs one write per interval rather than one per request.
+const sessionTouchInterval = time.Minute
+
+// Sessions keeps the session cookie of every request fresh.
+//
+// A session flagged for rotation (its user's privilege changed) gets a brand new ID before the
+// request is handled, so an ID captured under the old privileges stops working. A session that
+// has used up more than half of its lifetime is renewed, which makes the expiry slide forward for
+// as long as the user stays active, and any other request refreshes its last-seen time once a minute.
+// Rotation and renewal reissue the cookie, and after a rotation the request is rewritten to
+// carry the new ID, so the handlers further down never see a stale one.
+//
+// Unknown or expired session IDs get their cookie cleared, and the request is passed on without
+// it, so the handlers and the CSRF check further down see an anonymous request. So is a request
+// whose session cannot be looked up at all, though its cookie is kept for the next try.
+func Sessions(store *DB.SessionStore, lifetime time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(utils.SessionCookieName)
+			if err != nil || cookie.Value == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			session, err := store.Get(cookie.Value)
+			if err != nil {
+				if err != sql.ErrNoRows {
+					log.Printf("Error looking up session: %v\n", err)
+				} else {
+					utils.ClearSessionCookie(w)
+				}
+				next.ServeHTTP(w, withSessionCookie(r, ""))
+				return
+			}
+
+			now := time.Now()
+			if now.After(session.Expiry) {
+				utils.ClearSessionCookie(w)
+				next.ServeHTTP(w, withSessionCookie(r, ""))
+				return
+			}
+
+			expiry := now.Add(lifetime)
+			switch {
+			case session.Rotate:
+				newID, err := store.Rotate(session.ID, expiry)
+				if err != nil {
+					log.Printf("Error rotating session: %v\n", err)
+					break
+				}
+				utils.SetSessionCookie(w, newID, expiry)
+				r = withSessionCookie(r, newID)
+
+			case session.Expiry.Sub(now) < lifetime/2:
+				if err := store.Renew(session.ID, expiry); err != nil {
+					log.Printf("Error renewing session: %v\n", err)
+					break
+				}
+				utils.SetSessionCookie(w, session.ID, expiry)
+
+			case now.Sub(session.LastSeen) > sessionTouchInterval:
+				if err := store.Touch(session.ID); err != nil {
+					log.Printf("Error updating session last seen: %v\n", err)
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// withSessionCookie returns a copy of r whose Cookie header carries sessionID as the session cookie,
+// or no session cookie at all if sessionID is empty.
+func withSessionCookie(r *http.Request, sessionID string) *http.Request {
+	cookies := r.Cookies()
+	pairs := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		if c.Name == utils.SessionCookieName {
+			if sessionID == "" {
+				continue
+			}
+			c.Value = sessionID
+		}
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+
+	r = r.Clone(r.Context())
+	if len(pairs) == 0 {
+		r.Header.Del("Cookie")
+	} else {
+		r.Header.Set("Cookie", strings.Join(pairs, "; "))
+	}
+	return r
+}
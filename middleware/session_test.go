@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"forum/DB"
+	"forum/utils"
+)
+
+func TestMain(m *testing.M) {
+	// Every store test migrates a database of its own; the progress lines only bury the failures.
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// openSessionStore opens a fresh, fully migrated in-memory database with a user holding a live
+// and an expired session, called "live" and "expired".
+func openSessionStore(t *testing.T) *DB.Stores {
+	t.Helper()
+
+	cfg := DB.DefaultStoreConfig()
+	cfg.Path = ":memory:"
+	db, err := DB.OpenStore(cfg)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := DB.MigrateUp(db, 0); err == DB.ErrNoFTS5 {
+		t.Skip("SQLite lacks FTS5; run the tests with -tags sqlite_fts5")
+	} else if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	stores := DB.NewStores(db)
+	userID, err := stores.Users.Create(DB.NewUser{
+		Username: "alice", FirstName: "Alice", LastName: "Test", Email: "alice@example.com",
+		PasswordHash: "not a hash", Gender: "F",
+	})
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := stores.Sessions.Create("live", userID, time.Now().Add(time.Hour), "", ""); err != nil {
+		t.Fatalf("creating session: %v", err)
+	}
+	if err := stores.Sessions.Create("expired", userID, time.Now().Add(-time.Minute), "", ""); err != nil {
+		t.Fatalf("creating session: %v", err)
+	}
+	return stores
+}
+
+func TestSessionsDropsDeadSessionCookies(t *testing.T) {
+	stores := openSessionStore(t)
+
+	tests := []struct {
+		session     string
+		wantSession string
+		cleared     bool
+	}{
+		{"live", "live", false},
+		{"expired", "", true},
+		{"unknown", "", true},
+	}
+	for _, tt := range tests {
+		var seen *http.Request
+		handler := Sessions(stores.Sessions, 24*time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = r
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+		req.AddCookie(&http.Cookie{Name: utils.SessionCookieName, Value: tt.session})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := ""
+		if c, err := seen.Cookie(utils.SessionCookieName); err == nil {
+			got = c.Value
+		}
+		if got != tt.wantSession {
+			t.Errorf("%s: handler saw session cookie %q, want %q", tt.session, got, tt.wantSession)
+		}
+		if c, err := seen.Cookie("theme"); err != nil || c.Value != "dark" {
+			t.Errorf("%s: other cookies were lost: %v", tt.session, err)
+		}
+		cleared := false
+		for _, c := range rec.Result().Cookies() {
+			cleared = cleared || (c.Name == utils.SessionCookieName && c.MaxAge < 0)
+		}
+		if cleared != tt.cleared {
+			t.Errorf("%s: response clears the session cookie: %v, want %v", tt.session, cleared, tt.cleared)
+		}
+	}
+}
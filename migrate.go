@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/DB"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage: forum [flags] migrate <command> [steps]
+
+commands:
+  status       list every migration and whether it has been applied
+  up [steps]   apply pending migrations (all of them when steps is omitted)
+  down [steps] roll back applied migrations, newest first (one when steps is omitted)`
+
+// runMigrate implements the "forum migrate status|up|down" subcommand against the given store.
+func runMigrate(store *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", migrateUsage)
+	}
+
+	steps := 0
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid steps %q\n%s", args[1], migrateUsage)
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "status":
+		states, err := DB.MigrationStatus(store)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range states {
+			status, appliedAt := "pending", "-"
+			if s.Applied {
+				status, appliedAt = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+		}
+		return tw.Flush()
+	case "up":
+		n, err := DB.MigrateUp(store, steps)
+		fmt.Printf("%d migration(s) applied\n", n)
+		return err
+	case "down":
+		n, err := DB.MigrateDown(store, steps)
+		fmt.Printf("%d migration(s) rolled back\n", n)
+		return err
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], migrateUsage)
+	}
+}
@@ -8,7 +8,10 @@ async function loadAdminDashboard() {
             loadUsers(),
             loadCategories(),
             loadModerationRequests(),
-            loadPostReports()
+            loadReports(),
+            loadSanctions(),
+            loadFilterRules(),
+            loadAuditLog()
         ]);
     } catch (error) {
         console.error('Error loading admin dashboard:', error);
@@ -91,7 +94,14 @@ function displayUsers(users) {
         } else if (user.Privilege === 2) {
             // Moderator - can only demote to user
             actionsHTML = `<button class="btn-demote" onclick="demoteUser(${user.UserID}, 1)">Demote to User</button>`;
-        } else if (user.Privilege === 3) {
+        }
+        if (user.Privilege < 3) {
+            // Users and moderators can be banned or muted
+            actionsHTML += `
+                <button class="btn-mute" data-username="${escapeHtml(user.Username)}" onclick="openSanctionModal(${user.UserID}, this.dataset.username, 'mute')">Mute</button>
+                <button class="btn-ban" data-username="${escapeHtml(user.Username)}" onclick="openSanctionModal(${user.UserID}, this.dataset.username, 'ban')">Ban</button>
+            `;
+        } else {
             // Admin - no actions allowed (admins cannot demote other admins)
             actionsHTML = '<span style="color: #666; font-size: 12px;">Admin</span>';
         }
@@ -432,11 +442,22 @@ window.respondToRequest = respondToRequest;
 window.addCategory = addCategory;
 window.deleteCategory = deleteCategory;
 window.respondToReport = respondToReport;
+window.loadReports = loadReports;
+
+// Where the next page of the moderation queue starts, 0 once it is all shown
+let reportsNextOffset = 0;
+
+// Load the moderation queue, narrowed down by the status and type filters, or the next page of it
+async function loadReports(loadMore = false) {
+    const params = new URLSearchParams();
+    const status = document.getElementById('report-status-filter');
+    const type = document.getElementById('report-type-filter');
+    if (status && status.value) params.set('status', status.value);
+    if (type && type.value) params.set('type', type.value);
+    if (loadMore && reportsNextOffset) params.set('offset', reportsNextOffset);
 
-// Load post reports
-async function loadPostReports() {
     try {
-        const response = await fetch('/Data-AdminReports', {
+        const response = await fetch(`/Data-AdminReports?${params}`, {
             method: 'GET',
             headers: {
                 'Content-Type': 'application/json',
@@ -445,34 +466,65 @@ async function loadPostReports() {
         });
 
         if (!response.ok) {
-            throw new Error('Failed to load post reports');
+            throw new Error('Failed to load reports');
         }
 
-        const reports = await response.json();
-        displayPostReports(reports);
+        const page = await response.json();
+        reportsNextOffset = page.nextOffset || 0;
+        // Reason labels are nice to have; IDs are shown if they cannot be loaded
+        await loadReportReasons().catch(() => null);
+        displayReports(page.reports, loadMore);
     } catch (error) {
-        console.error('Error loading post reports:', error);
-        document.getElementById('post-reports').innerHTML = '<div class="empty-message">Error loading reports</div>';
+        console.error('Error loading reports:', error);
+        document.getElementById('reports').innerHTML = '<div class="empty-message">Error loading reports</div>';
+        reportsNextOffset = 0;
+    }
+
+    const loadMoreButton = document.getElementById('reports-load-more');
+    if (loadMoreButton) {
+        loadMoreButton.style.display = reportsNextOffset ? 'block' : 'none';
+    }
+}
+
+// Describe what a report is about
+function reportTargetHTML(report) {
+    const target = report.Target;
+    const typeName = report.TargetType.charAt(0).toUpperCase() + report.TargetType.slice(1);
+    if (!target.Exists) {
+        return `<div class="report-post-title"><strong>[${typeName} deleted]</strong></div>`;
+    }
+    if (report.TargetType === 'user') {
+        return `<div class="report-post-title"><strong>User @${escapeHtml(target.Author)}</strong></div>`;
     }
+    const title = report.TargetType === 'comment'
+        ? `Comment on "${escapeHtml(target.Title)}"`
+        : escapeHtml(target.Title);
+    return `
+        <div class="report-post-title"><strong>${title}</strong></div>
+        <div class="report-post-author">by @${escapeHtml(target.Author)}</div>
+    `;
 }
 
-// Display post reports
-function displayPostReports(reports) {
-    const container = document.getElementById('post-reports');
+// Display the moderation queue, after the reports shown already when loading more
+function displayReports(reports, append) {
+    const container = document.getElementById('reports');
 
-    if (!reports || !Array.isArray(reports) || reports.length === 0) {
-        container.innerHTML = '<div class="empty-message">No post reports found</div>';
+    if (!append && (!reports || !Array.isArray(reports) || reports.length === 0)) {
+        container.innerHTML = '<div class="empty-message">No reports found</div>';
         return;
     }
 
-    const reportsHTML = reports.map(report => {
+    const reportsHTML = (reports || []).map(report => {
         let actionsHTML = '';
         if (report.Status === 'pending') {
+            const approveLabel = !report.Target.Exists || report.TargetType === 'user'
+                ? 'Uphold'
+                : `Approve & Delete ${report.TargetType === 'post' ? 'Post' : 'Comment'}`;
             actionsHTML = `
                 <div class="report-actions">
                     <textarea id="response-${report.ReportID}" placeholder="Admin response (optional)..." rows="2"></textarea>
                     <div class="action-buttons">
-                        <button class="btn-approve" onclick="respondToReport(${report.ReportID}, 'approved')">Approve & Delete Post</button>
+                        <button class="btn-approve" onclick="respondToReport(${report.ReportID}, 'approved', '${report.TargetType}', ${report.Target.Exists})">${approveLabel}</button>
                         <button class="btn-reject" onclick="respondToReport(${report.ReportID}, 'rejected')">Reject</button>
                     </div>
                 </div>
@@ -480,42 +532,62 @@ function displayPostReports(reports) {
         }
 
         // Truncate content if too long
-        const truncatedContent = report.PostContent.length > 100
-            ? report.PostContent.substring(0, 100) + '...'
-            : report.PostContent;
+        const content = report.Target.Content;
+        const truncatedContent = content.length > 100
+            ? content.substring(0, 100) + '...'
+            : content;
+
+        const filingsHTML = report.Filings.map(filing => `
+            <div class="report-filing">
+                <div class="report-moderator">@${escapeHtml(filing.Reporter)} · ${formatDate(filing.CreatedAt)}</div>
+                <div class="report-reason"><strong>Reason:</strong> ${escapeHtml(reportReasonLabel(filing.Reason))}</div>
+                ${filing.Note ? `<div class="report-note">${escapeHtml(filing.Note)}</div>` : ''}
+            </div>
+        `).join('');
 
         return `
             <div class="report-item">
                 <div class="report-header">
                     <div class="report-info">
-                        <div class="report-post-title"><strong>${report.PostTitle}</strong></div>
-                        <div class="report-post-author">by @${report.PostAuthor}</div>
+                        <span class="report-type">${report.TargetType}</span>
+                        ${reportTargetHTML(report)}
                     </div>
-                    <div class="report-date">${formatDate(report.ReportDate)}</div>
+                    <div class="report-date">${formatDate(report.CreatedAt)}</div>
                 </div>
-                <div class="report-content">${truncatedContent}</div>
+                ${truncatedContent ? `<div class="report-content">${escapeHtml(truncatedContent)}</div>` : ''}
                 <div class="report-details">
-                    <div class="report-moderator">Reported by: @${report.ModeratorName}</div>
-                    <div class="report-reason"><strong>Reason:</strong> ${report.Reason}</div>
+                    <div class="report-count">Reported by ${report.ReporterCount} user${report.ReporterCount === 1 ? '' : 's'}</div>
+                    ${filingsHTML}
                 </div>
                 <div class="report-status ${report.Status}">${report.Status}</div>
-                ${report.AdminResponse ? `<div class="admin-response"><strong>Admin Response:</strong> ${report.AdminResponse}</div>` : ''}
+                ${report.AdminResponse ? `<div class="admin-response"><strong>Admin Response:</strong> ${escapeHtml(report.AdminResponse)}${report.AdminName ? ` (@${escapeHtml(report.AdminName)})` : ''}</div>` : ''}
                 ${actionsHTML}
             </div>
         `;
     }).join('');
 
-    container.innerHTML = reportsHTML;
+    if (append) {
+        container.insertAdjacentHTML('beforeend', reportsHTML);
+    } else {
+        container.innerHTML = reportsHTML;
+    }
 }
 
-// Respond to post report
-async function respondToReport(reportId, status) {
+// Respond to a report
+async function respondToReport(reportId, status, targetType, targetExists) {
     const responseTextarea = document.getElementById(`response-${reportId}`);
     const response = responseTextarea ? responseTextarea.value.trim() : '';
 
-    let confirmMessage = status === 'approved'
-        ? 'Are you sure you want to approve this report? This will DELETE the post permanently.'
-        : 'Are you sure you want to reject this report?';
+    let confirmMessage = 'Are you sure you want to reject this report?';
+    if (status === 'approved') {
+        if (targetExists && targetType === 'post') {
+            confirmMessage = 'Are you sure you want to approve this report? The post will be removed from the forum; moderators can still restore it.';
+        } else if (targetExists && targetType === 'comment') {
+            confirmMessage = 'Are you sure you want to approve this report? This will DELETE the comment permanently.';
+        } else {
+            confirmMessage = 'Are you sure you want to uphold this report?';
+        }
+    }
 
     if (!confirm(confirmMessage)) {
         return;
@@ -542,11 +614,11 @@ async function respondToReport(reportId, status) {
         const result = await apiResponse.json();
         if (result.success) {
             // Reload reports and statistics
-            await loadPostReports();
+            await loadReports();
             await loadStatistics();
 
             if (status === 'approved') {
-                alert('Report approved and post deleted successfully.');
+                alert('Report approved successfully.');
             } else {
                 alert('Report rejected successfully.');
             }
@@ -558,3 +630,403 @@ async function respondToReport(reportId, status) {
         alert('Error responding to report. Please try again.');
     }
 }
+
+// Where the next page of the audit log starts, 0 once it is all shown
+let auditNextBefore = 0;
+
+// Load the audit log with the chosen filters, or the next page of it
+async function loadAuditLog(loadMore = false) {
+    const params = new URLSearchParams();
+    const filters = {
+        actor: 'audit-actor-filter',
+        action: 'audit-action-filter',
+        targetType: 'audit-target-filter',
+        targetId: 'audit-target-id-filter',
+        from: 'audit-from-filter',
+        to: 'audit-to-filter'
+    };
+    for (const [param, id] of Object.entries(filters)) {
+        const input = document.getElementById(id);
+        if (input && input.value.trim()) params.set(param, input.value.trim());
+    }
+    if (loadMore && auditNextBefore) params.set('before', auditNextBefore);
+
+    const container = document.getElementById('audit-log');
+    try {
+        const response = await fetch(`/Data-AdminAuditLog?${params}`, {
+            method: 'GET',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            }
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || 'Failed to load audit log');
+        }
+
+        const page = await response.json();
+        auditNextBefore = page.nextBefore || 0;
+        displayAuditEntries(page.entries, loadMore);
+    } catch (error) {
+        console.error('Error loading audit log:', error);
+        container.innerHTML = `<div class="empty-message">${escapeHtml(error.message || 'Error loading audit log')}</div>`;
+        auditNextBefore = 0;
+    }
+
+    const loadMoreButton = document.getElementById('audit-load-more');
+    if (loadMoreButton) {
+        loadMoreButton.style.display = auditNextBefore ? 'block' : 'none';
+    }
+}
+
+// Display audit log entries, after the ones shown already when loading more
+function displayAuditEntries(entries, append) {
+    const container = document.getElementById('audit-log');
+
+    if (!append && (!entries || entries.length === 0)) {
+        container.innerHTML = '<div class="empty-message">No audit log entries</div>';
+        return;
+    }
+
+    const entriesHTML = (entries || []).map(entry => `
+        <div class="audit-entry">
+            <div class="audit-date">${formatDate(entry.createdAt)}</div>
+            <div class="audit-actor">${entry.actor ? `@${escapeHtml(entry.actor)}` : `user #${entry.actorId}`}</div>
+            <div class="audit-action">${escapeHtml(entry.action)}</div>
+            <div class="audit-target">${escapeHtml(entry.targetType)} #${entry.targetId}</div>
+            <div class="audit-details">${escapeHtml(entry.details)}</div>
+        </div>
+    `).join('');
+
+    if (append) {
+        container.insertAdjacentHTML('beforeend', entriesHTML);
+    } else {
+        container.innerHTML = entriesHTML;
+    }
+}
+
+// Durations a sanction can be given for, in hours; 0 is a permanent ban
+const sanctionDurations = [
+    { hours: 1, label: '1 hour' },
+    { hours: 24, label: '1 day' },
+    { hours: 168, label: '1 week' },
+    { hours: 720, label: '30 days' },
+    { hours: 0, label: 'Permanent', banOnly: true }
+];
+
+// Show the form to ban or mute a user
+function openSanctionModal(userId, username, kind) {
+    const durations = sanctionDurations.filter(d => kind === 'ban' || !d.banOnly);
+
+    const modal = document.createElement('div');
+    modal.className = 'edit-modal-overlay';
+    modal.innerHTML = `
+        <div class="edit-modal">
+            <div class="edit-modal-header">
+                <h3>${kind === 'ban' ? 'Ban' : 'Mute'} @${escapeHtml(username)}</h3>
+                <button class="close-modal" onclick="closeEditModal()">&times;</button>
+            </div>
+            <div class="edit-modal-body">
+                <p class="sanction-help">${kind === 'ban'
+                    ? 'A banned user is signed out and cannot log in.'
+                    : 'A muted user cannot post, comment or react.'}</p>
+                <form id="sanction-form">
+                    <div class="form-group">
+                        <label for="sanction-duration">Duration:</label>
+                        <select id="sanction-duration">
+                            ${durations.map(d => `<option value="${d.hours}">${d.label}</option>`).join('')}
+                        </select>
+                    </div>
+                    <div class="form-group">
+                        <label for="sanction-reason">Reason:</label>
+                        <textarea id="sanction-reason" rows="3" maxlength="500" required placeholder="Shown to the user"></textarea>
+                    </div>
+                    <div class="form-actions">
+                        <button type="button" onclick="closeEditModal()">Cancel</button>
+                        <button type="submit">${kind === 'ban' ? 'Ban User' : 'Mute User'}</button>
+                    </div>
+                </form>
+            </div>
+        </div>
+    `;
+
+    document.body.appendChild(modal);
+
+    document.getElementById('sanction-form').addEventListener('submit', async (e) => {
+        e.preventDefault();
+        await sanctionUser({
+            userId: userId,
+            kind: kind,
+            reason: document.getElementById('sanction-reason').value.trim(),
+            durationHours: parseInt(document.getElementById('sanction-duration').value, 10)
+        });
+    });
+}
+
+// Ban or mute a user
+async function sanctionUser(sanction) {
+    try {
+        const response = await fetch('/Data-AdminSanction', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify(sanction)
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || 'Failed to sanction user');
+        }
+
+        const result = await response.json();
+        closeEditModal();
+        alert(result.message);
+        await loadSanctions();
+        await loadAuditLog();
+    } catch (error) {
+        console.error('Error sanctioning user:', error);
+        alert(error.message || 'Error sanctioning user. Please try again.');
+    }
+}
+
+// Load the bans and mutes, only those in force unless the filter says otherwise
+async function loadSanctions() {
+    const container = document.getElementById('sanctions');
+    const activeOnly = document.getElementById('sanction-active-filter');
+    const query = !activeOnly || activeOnly.checked ? '?active=1' : '';
+
+    try {
+        const response = await fetch(`/Data-AdminSanctions${query}`, {
+            method: 'GET',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            }
+        });
+
+        if (!response.ok) {
+            throw new Error('Failed to load sanctions');
+        }
+
+        const sanctions = await response.json();
+        displaySanctions(sanctions);
+    } catch (error) {
+        console.error('Error loading sanctions:', error);
+        container.innerHTML = '<div class="empty-message">Error loading sanctions</div>';
+    }
+}
+
+// Display bans and mutes, with a button to lift the active ones
+function displaySanctions(sanctions) {
+    const container = document.getElementById('sanctions');
+
+    if (!sanctions || sanctions.length === 0) {
+        container.innerHTML = '<div class="empty-message">No sanctions</div>';
+        return;
+    }
+
+    container.innerHTML = sanctions.map(sanction => {
+        const until = sanction.expiresAt ? `until ${new Date(sanction.expiresAt).toLocaleString()}` : 'permanently';
+        let status = 'expired';
+        if (sanction.liftedAt) {
+            status = 'lifted';
+        } else if (sanction.active) {
+            status = 'active';
+        }
+
+        return `
+            <div class="sanction-item">
+                <div class="report-header">
+                    <div class="report-info">
+                        <div class="report-post-title"><strong>@${escapeHtml(sanction.username)}</strong> ${sanction.kind === 'ban' ? 'banned' : 'muted'} ${until}</div>
+                        <div class="report-post-author">by ${sanction.issuer ? `@${escapeHtml(sanction.issuer)}` : 'a former admin'}</div>
+                    </div>
+                    <div class="report-date">${formatDate(sanction.createdAt)}</div>
+                </div>
+                <div class="report-reason"><strong>Reason:</strong> ${escapeHtml(sanction.reason)}</div>
+                <div class="sanction-status ${status}">${status}</div>
+                ${sanction.active ? `<button class="btn-approve" onclick="liftSanction(${sanction.sanctionId})">Lift</button>` : ''}
+            </div>
+        `;
+    }).join('');
+}
+
+// Lift a ban or mute before it expires
+async function liftSanction(sanctionId) {
+    if (!confirm('Lift this sanction now?')) {
+        return;
+    }
+
+    try {
+        const response = await fetch('/Data-AdminLiftSanction', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify({ sanctionId: sanctionId })
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || 'Failed to lift sanction');
+        }
+
+        await loadSanctions();
+        await loadAuditLog();
+    } catch (error) {
+        console.error('Error lifting sanction:', error);
+        alert(error.message || 'Error lifting sanction. Please try again.');
+    }
+}
+
+// What each kind of content filter rule is called, and what its pattern is
+const filterRuleKinds = {
+    term: { label: 'Blocked term', placeholder: 'Term' },
+    regex: { label: 'Blocked pattern', placeholder: 'Regular expression, e.g. (?i)buy\\s+now' },
+    deny_domain: { label: 'Denied domain', placeholder: 'Domain, e.g. example.com' },
+    allow_domain: { label: 'Allowed domain', placeholder: 'Domain, e.g. example.com' },
+    link_cap: { label: 'Link cap' }
+};
+
+// Show the inputs the chosen kind of rule needs
+function updateFilterRuleForm() {
+    const kind = document.getElementById('filter-kind').value;
+    const isLinkCap = kind === 'link_cap';
+    const pattern = document.getElementById('filter-pattern');
+
+    pattern.style.display = isLinkCap ? 'none' : '';
+    pattern.placeholder = filterRuleKinds[kind].placeholder || '';
+    document.getElementById('filter-max-links').style.display = isLinkCap ? '' : 'none';
+    document.getElementById('filter-account-age').style.display = isLinkCap ? '' : 'none';
+}
+
+// Load the rules of the content filter
+async function loadFilterRules() {
+    const container = document.getElementById('filter-rules');
+    try {
+        const response = await fetch('/Data-AdminFilterRules', {
+            method: 'GET',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            }
+        });
+
+        if (!response.ok) {
+            throw new Error('Failed to load filter rules');
+        }
+
+        const rules = await response.json();
+        displayFilterRules(rules);
+    } catch (error) {
+        console.error('Error loading filter rules:', error);
+        container.innerHTML = '<div class="empty-message">Error loading filter rules</div>';
+    }
+}
+
+// Display the rules of the content filter
+function displayFilterRules(rules) {
+    const container = document.getElementById('filter-rules');
+
+    if (!rules || rules.length === 0) {
+        container.innerHTML = '<div class="empty-message">No filter rules</div>';
+        return;
+    }
+
+    container.innerHTML = rules.map(rule => {
+        const pattern = rule.kind === 'link_cap'
+            ? `At most ${rule.maxLinks} links for accounts younger than ${rule.accountAgeDays} days`
+            : escapeHtml(rule.pattern);
+
+        return `
+            <div class="filter-rule">
+                <div class="filter-rule-kind">${filterRuleKinds[rule.kind] ? filterRuleKinds[rule.kind].label : escapeHtml(rule.kind)}</div>
+                <div class="filter-rule-pattern">${pattern}</div>
+                <div class="filter-rule-action ${rule.action}">${rule.action === 'reject' ? 'Reject' : 'Hold for review'}</div>
+                <button class="btn-reject" onclick="deleteFilterRule(${rule.ruleId})">Delete</button>
+            </div>
+        `;
+    }).join('');
+}
+
+// Add a rule to the content filter
+async function addFilterRule() {
+    const kind = document.getElementById('filter-kind').value;
+    const rule = {
+        kind: kind,
+        action: document.getElementById('filter-action').value
+    };
+    if (kind === 'link_cap') {
+        rule.maxLinks = parseInt(document.getElementById('filter-max-links').value, 10);
+        rule.accountAgeDays = parseInt(document.getElementById('filter-account-age').value, 10);
+        if (isNaN(rule.maxLinks) || isNaN(rule.accountAgeDays)) {
+            alert('Please enter the number of links and the account age');
+            return;
+        }
+    } else {
+        rule.pattern = document.getElementById('filter-pattern').value.trim();
+        if (!rule.pattern) {
+            alert('Please enter what the rule looks for');
+            return;
+        }
+    }
+
+    try {
+        const response = await fetch('/Data-AdminAddFilterRule', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify(rule)
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || 'Failed to add rule');
+        }
+
+        document.getElementById('filter-pattern').value = '';
+        document.getElementById('filter-max-links').value = '';
+        document.getElementById('filter-account-age').value = '';
+        await loadFilterRules();
+        await loadAuditLog();
+    } catch (error) {
+        console.error('Error adding filter rule:', error);
+        alert(error.message || 'Error adding rule. Please try again.');
+    }
+}
+
+// Remove a rule from the content filter
+async function deleteFilterRule(ruleId) {
+    if (!confirm('Delete this rule? Content it already holds stays in the review queue.')) {
+        return;
+    }
+
+    try {
+        const response = await fetch('/Data-AdminDeleteFilterRule', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify({ ruleId: ruleId })
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || 'Failed to delete rule');
+        }
+
+        await loadFilterRules();
+        await loadAuditLog();
+    } catch (error) {
+        console.error('Error deleting filter rule:', error);
+        alert(error.message || 'Error deleting rule. Please try again.');
+    }
+}
@@ -15,6 +15,12 @@ function setupPostFormHandler(form) {
     const submitButton = form.querySelector('button[type="submit"]');
     const originalButtonText = submitButton.textContent;
 
+    // One alt text field per selected image, sent as "alt" in the same order as the files
+    const fileInput = form.querySelector('input[name="image"]');
+    if (fileInput) {
+        fileInput.addEventListener('change', () => renderAltFields(fileInput));
+    }
+
     // Add event listener to prevent duplicate submissions
     form.addEventListener('submit', function(e) {
         // Check if already submitting
@@ -78,6 +84,31 @@ function setupPostFormHandler(form) {
     // Handle HTMX errors
     form.addEventListener('htmx:responseError', function(e) {
         resetSubmissionState(submitButton, originalButtonText);
+        // Muted users and posts the content filter rejects are told why
+        const status = e.detail.xhr.status;
+        if (status === 403 || status === 422) {
+            let message = e.detail.xhr.responseText;
+            try {
+                message = JSON.parse(message).message || message;
+            } catch (_) {
+                // Plain text error
+            }
+            showError(escapeHtml(message));
+        }
+    });
+}
+
+function renderAltFields(fileInput) {
+    const altFields = document.getElementById('image-alt-fields');
+    if (!altFields) return;
+    altFields.innerHTML = '';
+    Array.from(fileInput.files).forEach(file => {
+        const altInput = document.createElement('input');
+        altInput.type = 'text';
+        altInput.name = 'alt';
+        altInput.maxLength = 300;
+        altInput.placeholder = `Describe ${file.name} (alt text)`;
+        altFields.appendChild(altInput);
     });
 }
 
@@ -146,6 +177,8 @@ function clearPostForm(form) {
     if (titleInput) titleInput.value = '';
     if (contentTextarea) contentTextarea.value = '';
     if (fileInput) fileInput.value = '';
+    const altFields = document.getElementById('image-alt-fields');
+    if (altFields) altFields.innerHTML = '';
 
     // Clear category checkboxes
     const categoryCheckboxes = form.querySelectorAll('input[name="categories"]');
@@ -78,6 +78,10 @@ function createNotificationHTML(notification) {
             message = `${notification.username} commented on your post "${notification.post_title}"`;
             icon = 'comment';
             break;
+        case 'Reply':
+            message = `${notification.username} replied to your comment on "${notification.post_title}"`;
+            icon = 'reply';
+            break;
         case 'CommentLike':
             message = `${notification.username} liked your comment`;
             icon = 'thumb_up';
@@ -86,6 +90,11 @@ function createNotificationHTML(notification) {
             message = `${notification.username} disliked your comment`;
             icon = 'thumb_down';
             break;
+        case 'Ban':
+        case 'Mute':
+            message = sanctionMessage(notification);
+            icon = notification.notification_type === 'Ban' ? 'block' : 'volume_off';
+            break;
         default:
             message = `${notification.username} interacted with your content`;
             icon = 'notifications';
@@ -112,6 +121,18 @@ function createNotificationHTML(notification) {
     `;
 }
 
+// Explain a ban or mute to the sanctioned user
+function sanctionMessage(notification) {
+    const sanction = notification.notification_type === 'Ban' ? 'banned' : 'muted';
+    const until = notification.sanction_expires_at
+        ? `until ${new Date(notification.sanction_expires_at).toLocaleString()}`
+        : 'permanently';
+    const restriction = notification.notification_type === 'Ban'
+        ? 'You cannot log in while the ban lasts.'
+        : 'You cannot post, comment or react while the mute lasts.';
+    return `You have been ${sanction} ${until}. Reason: ${escapeHtml(notification.sanction_reason)}. ${restriction}`;
+}
+
 // Mark notification as read
 async function markAsRead(notificationId) {
     console.log('Marking notification as read:', notificationId);
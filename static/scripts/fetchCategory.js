@@ -125,7 +125,7 @@ function loadCategories() {
 
                 const postMeta = document.createElement('div');
                 postMeta.classList.add('post-meta');
-                postMeta.textContent = formatDate(post.PostDate);
+                postMeta.textContent = formatDate(post.PostDate) + (post.editedAt ? ' · edited' : '');
 
                 postHeader.appendChild(postTitle);
                 postHeader.appendChild(postMeta);
@@ -133,7 +133,7 @@ function loadCategories() {
                 // Post Content
                 const postContent = document.createElement('div');
                 postContent.classList.add('post-content');
-                postContent.textContent = post.content;
+                postContent.innerHTML = post.contentHtml;
 
                 // Post Footer
                 const postFooter = document.createElement('div');
@@ -237,18 +237,10 @@ function loadCategories() {
                 // Append all components to the main post element
                 postElement.appendChild(postHeader);
                 postElement.appendChild(postContent);
-                // Post Image (if exists)
-                if (post.imagePath) {
-                    const postImage = document.createElement('img');
-                    postImage.src = post.imagePath;
-                    postImage.alt = "Post Image";
-                    postImage.classList.add('image-size');
-
-                    const postImageContainer = document.createElement('div');
-                    postImageContainer.classList.add('post-image');
-                    postImageContainer.appendChild(postImage);
-
-                    postElement.appendChild(postImageContainer);
+                // Post Images (if any)
+                const postGallery = renderPostGallery(post);
+                if (postGallery) {
+                    postElement.appendChild(postGallery);
                 }
                 postElement.appendChild(postFooter);
 
@@ -61,6 +61,11 @@ async function loadComments(destination, postId) {
                 // Create Comment Card
                 const commentCard = document.createElement('div');
                 commentCard.classList.add('comment-card');
+                // Indent replies under their parent, capped so deep threads stay readable
+                if (comment.CmtDepth > 0) {
+                    commentCard.classList.add('comment-reply');
+                    commentCard.style.marginLeft = `${Math.min(comment.CmtDepth, 5) * 1.5}rem`;
+                }
 
                 // Create Comment Header
                 const commentHeader = document.createElement('div');
@@ -72,7 +77,7 @@ async function loadComments(destination, postId) {
 
                 const dateSpan = document.createElement('span');
                 dateSpan.classList.add('comment-date');
-                dateSpan.textContent = formatDate(comment.CmtDate);
+                dateSpan.textContent = formatDate(comment.CmtDate) + (comment.CmtEditedAt ? ' · edited' : '');
 
                 commentHeader.appendChild(usernameSpan);
                 commentHeader.appendChild(dateSpan);
@@ -80,7 +85,7 @@ async function loadComments(destination, postId) {
                 // Create Comment Content
                 const commentContent = document.createElement('div');
                 commentContent.classList.add('comment-content');
-                commentContent.textContent = comment.CmtContent;
+                commentContent.innerHTML = comment.CmtContentHTML;
 
                 // Create Comment Footer
                 const commentFooter = document.createElement('div');
@@ -147,6 +152,25 @@ async function loadComments(destination, postId) {
                 commentFooter.appendChild(likeForm);
                 commentFooter.appendChild(dislikeForm);
 
+                // Reply button for logged in users
+                if (currentUserId) {
+                    const replyButton = document.createElement('button');
+                    replyButton.classList.add('footer-buttons', 'comment-button', 'reply-button');
+                    replyButton.title = 'Reply';
+                    replyButton.onclick = () => replyToComment(destination, postId, comment.CmtID);
+
+                    const replyIcon = document.createElement('i');
+                    replyIcon.classList.add('material-icons');
+                    replyIcon.textContent = 'reply';
+                    replyButton.appendChild(replyIcon);
+                    commentFooter.appendChild(replyButton);
+                }
+
+                // Report button for logged in users other than the author
+                if (currentUserId && currentUserId !== comment.CmtUserID) {
+                    commentFooter.appendChild(createReportButton('comment', comment.CmtID, { id: comment.CmtUserID, username: comment.CmtUsername }));
+                }
+
                 // Edit/Delete buttons for comment owner
                 if (currentUserId === comment.CmtUserID) {
                     // Edit button
@@ -214,7 +238,7 @@ async function loadComments(destination, postId) {
         const commentTextarea = document.createElement('textarea');
         commentTextarea.name = 'comment';
         commentTextarea.classList.add('comment-input');
-        commentTextarea.placeholder = 'Add your comment...';
+        commentTextarea.placeholder = 'Add your comment (Markdown supported)...';
         commentTextarea.required = true;
 
         const commentActions = document.createElement('div');
@@ -258,6 +282,51 @@ async function loadComments(destination, postId) {
     }
 }
 
+// Reply to a comment, then reload the thread so the reply shows up under its parent
+async function replyToComment(destination, postId, parentCommentId) {
+    const reply = prompt('Write your reply:');
+    if (!reply || reply.trim() === '') {
+        return;
+    }
+
+    try {
+        const response = await fetch('/Data-CreatReply', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify({
+                parentCommentId: String(parentCommentId),
+                comment: reply.trim()
+            })
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || 'Failed to post reply');
+        }
+
+        const data = await response.json();
+        if (data.Held) {
+            alert('Your reply was submitted and will be published once a moderator reviews it.');
+            return;
+        }
+
+        const commentCount = document.getElementById(`comment-count-${postId}`);
+        if (commentCount) {
+            commentCount.textContent = parseInt(commentCount.textContent || '0') + 1;
+        }
+
+        const commentsContainer = document.getElementById(`${destination}-comments-${postId}`);
+        commentsContainer.innerHTML = '';
+        await loadComments(destination, postId);
+    } catch (error) {
+        console.error('Error posting reply:', error);
+        alert(error.message || 'Failed to post reply. Please try again.');
+    }
+}
+
 async function handleCommentInteraction(event) {
     event.preventDefault(); 
     
@@ -276,6 +345,11 @@ async function handleCommentInteraction(event) {
             }
         });
         
+        // Muted and banned users may not react
+        if (response.status === 403) {
+            alert(await response.text());
+            return;
+        }
         if (!response.ok) {
             throw new Error('Network response was not ok');
         }
@@ -324,10 +398,21 @@ async function handleCommentSubmission(event) {
         });
 
         if (!response.ok) {
-            throw new Error('Network response was not ok');
+            const error = new Error('Network response was not ok');
+            // Locked posts and the content filter refuse comments; tell the user why
+            if (response.status === 403 || response.status === 422) {
+                error.userMessage = (await response.text()).trim();
+            }
+            throw error;
         }
 
         const data = await response.json();
+        // Comments held by the content filter only show up once a moderator approves them
+        if (data.Held) {
+            form.reset();
+            alert('Your comment was submitted and will be published once a moderator reviews it.');
+            return;
+        }
         if (parentDiv) {
             // Create Comment Card
             const commentCard = document.createElement('div');
@@ -351,7 +436,7 @@ async function handleCommentSubmission(event) {
             // Create Comment Content
             const commentContent = document.createElement('div');
             commentContent.classList.add('comment-content');
-            commentContent.textContent = data.Comment;
+            commentContent.innerHTML = data.CommentHTML;
 
             // Create Comment Footer
             const commentFooter = document.createElement('div');
@@ -472,6 +557,7 @@ async function handleCommentSubmission(event) {
         console.error('Error:', error);
         const errorElement = form.querySelector('.comment-error');
         if (errorElement) {
+            errorElement.textContent = error.userMessage || 'Failed to post comment. Please try again.';
             errorElement.style.display = 'block';
             setTimeout(() => {
                 errorElement.style.display = 'none';
@@ -1,8 +1,32 @@
-function loadPosts() {
+// Feed state: the sort order picked by the user and the cursor of the next page.
+let postsSort = 'new';
+let postsNextCursor = '';
+
+function changePostsSort(sort) {
+    postsSort = sort;
+    loadPosts();
+}
+
+// loadPosts renders the first page of the feed, or appends the next one when loadMore is true.
+function loadPosts(loadMore = false) {
     const postsContainers = document.querySelectorAll('#posts-container');
 
+    if (!loadMore) {
+        postsNextCursor = '';
+    }
+    const params = new URLSearchParams({ sort: postsSort });
+    if (loadMore && postsNextCursor) {
+        params.set('cursor', postsNextCursor);
+    }
+
     postsContainers.forEach(container => {
-        container.innerHTML = '<p style="text-align: center">Loading posts...</p>';
+        const oldLoadMore = container.querySelector('.load-more-posts');
+        if (oldLoadMore) {
+            oldLoadMore.remove();
+        }
+        if (!loadMore) {
+            container.innerHTML = '<p style="text-align: center">Loading posts...</p>';
+        }
 
         // First get user privilege level
         fetch("/auth/status", {
@@ -12,7 +36,7 @@ function loadPosts() {
         .then(response => response.json())
         .then(authData => {
             // Then fetch posts
-            return fetch('/Data-Post', {
+            return fetch(`/Data-Post?${params}`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -36,8 +60,11 @@ function loadPosts() {
                     throw new Error(`${response.status}: ${statusText}`);
                 }
                 return response.json();
-            }).then(posts => {
-                return { posts, userPrivilege: authData.privilege || 0, currentUserId: authData.user_id || 0 };
+            }).then(page => {
+                postsNextCursor = page.nextCursor || '';
+                // Pinned posts come with the first page only and go above the feed
+                const posts = (page.pinned || []).concat(page.posts || []);
+                return { posts: posts, userPrivilege: authData.privilege || 0, currentUserId: authData.user_id || 0 };
             });
         })
         .then(data => {
@@ -45,7 +72,7 @@ function loadPosts() {
             const fragment = document.createDocumentFragment();
 
             // Handle case when posts is null, undefined, or empty
-            if (!posts || !Array.isArray(posts) || posts.length === 0) {
+            if (!loadMore && (!posts || !Array.isArray(posts) || posts.length === 0)) {
                 container.innerHTML = '<div class="empty-message" style="text-align: center; padding: 40px; color: #666; font-style: italic;">No posts available</div>';
                 return;
             }
@@ -82,7 +109,11 @@ function loadPosts() {
 
                 const postMeta = document.createElement('div');
                 postMeta.classList.add('post-meta');
-                postMeta.textContent = formatDate(post.PostDate);
+                postMeta.textContent = formatDate(post.PostDate) + (post.editedAt ? ' · edited' : '')
+                    + (post.pinned ? ' · pinned' : '') + (post.locked ? ' · locked' : '');
+                if (post.pinned) {
+                    postElement.classList.add('pinned-post');
+                }
 
                 postHeader.appendChild(postTitle);
                 postHeader.appendChild(postMeta);
@@ -90,7 +121,7 @@ function loadPosts() {
                 // Post Content
                 const postContent = document.createElement('div');
                 postContent.classList.add('post-content');
-                postContent.textContent = post.content;
+                postContent.innerHTML = post.contentHtml;
 
                 // Post Footer
                 const postFooter = document.createElement('div');
@@ -222,19 +253,13 @@ function loadPosts() {
                     adminDeleteButton.appendChild(deleteIcon);
                 }
 
-                // Report Button (for moderators only)
-                let reportButton = null;
-                if (userPrivilege === 2) { // Moderators only (not admins)
-                    reportButton = document.createElement('button');
-                    reportButton.classList.add('footer-buttons', 'post-button', 'report-button');
-                    reportButton.title = 'Report Post';
-                    reportButton.onclick = () => reportPost(post.PostID);
-
-                    const reportIcon = document.createElement('i');
-                    reportIcon.classList.add('material-icons');
-                    reportIcon.textContent = 'report';
+                // Pin, lock and hide buttons (for moderators and admins)
+                const moderationButtons = userPrivilege >= 2 ? createModerationButtons(post) : [];
 
-                    reportButton.appendChild(reportIcon);
+                // Report Button (for logged in users other than the author)
+                let reportButton = null;
+                if (currentUserId && currentUserId !== post.UserID) {
+                    reportButton = createReportButton('post', post.PostID, { id: post.UserID, username: post.username });
                 }
 
                 // User Info
@@ -254,6 +279,7 @@ function loadPosts() {
                 if (adminDeleteButton) {
                     buttonsContainer.appendChild(adminDeleteButton);
                 }
+                moderationButtons.forEach(button => buttonsContainer.appendChild(button));
                 if (reportButton) {
                     buttonsContainer.appendChild(reportButton);
                 }
@@ -264,18 +290,10 @@ function loadPosts() {
                 // Append all components to the main post element
                 postElement.appendChild(postHeader);
                 postElement.appendChild(postContent);
-                // Post Image (if exists)
-                if (post.imagePath) {
-                    const postImage = document.createElement('img');
-                    postImage.src = post.imagePath;
-                    postImage.alt = "Post Image";
-                    postImage.classList.add('image-size');
-
-                    const postImageContainer = document.createElement('div');
-                    postImageContainer.classList.add('post-image');
-                    postImageContainer.appendChild(postImage);
-
-                    postElement.appendChild(postImageContainer);
+                // Post Images (if any)
+                const postGallery = renderPostGallery(post);
+                if (postGallery) {
+                    postElement.appendChild(postGallery);
                 }
                 postElement.appendChild(postFooter);
 
@@ -288,7 +306,17 @@ function loadPosts() {
 
             });
             
-            container.innerHTML = '';
+            if (postsNextCursor) {
+                const loadMoreButton = document.createElement('button');
+                loadMoreButton.className = 'load-more-posts';
+                loadMoreButton.textContent = 'Load more';
+                loadMoreButton.onclick = () => loadPosts(true);
+                fragment.appendChild(loadMoreButton);
+            }
+
+            if (!loadMore) {
+                container.innerHTML = '';
+            }
             container.appendChild(fragment);
         })
         .catch(error => {
@@ -336,7 +364,8 @@ async function deletePost(postId) {
 
 // Admin delete post function (for admins and moderators)
 async function adminDeletePost(postId) {
-    if (!confirm('Are you sure you want to delete this post? This action cannot be undone.')) {
+    const reason = prompt('Why is this post being deleted? It will be hidden from everyone but moderators, who can restore it.');
+    if (!reason || reason.trim() === '') {
         return;
     }
 
@@ -347,7 +376,7 @@ async function adminDeletePost(postId) {
                 'Content-Type': 'application/x-www-form-urlencoded',
                 'X-Requested-With': 'XMLHttpRequest'
             },
-            body: `postId=${postId}`
+            body: `postId=${postId}&reason=${encodeURIComponent(reason.trim())}`
         });
 
         if (!response.ok) {
@@ -368,42 +397,3 @@ async function adminDeletePost(postId) {
         alert('Failed to delete post. Please try again.');
     }
 }
-
-// Report post function (for moderators only)
-async function reportPost(postId) {
-    const reason = prompt('Please provide a reason for reporting this post:');
-    if (!reason || reason.trim() === '') {
-        return;
-    }
-
-    try {
-        const response = await fetch('/Data-ReportPost', {
-            method: 'POST',
-            headers: {
-                'Content-Type': 'application/x-www-form-urlencoded',
-                'X-Requested-With': 'XMLHttpRequest'
-            },
-            body: `postId=${postId}&reason=${encodeURIComponent(reason.trim())}`
-        });
-
-        if (!response.ok) {
-            const errorText = await response.text();
-            throw new Error(errorText || 'Failed to report post');
-        }
-
-        const result = await response.json();
-        if (result.success) {
-            alert('Post reported successfully. An admin will review it.');
-        } else {
-            alert('Failed to report post: ' + (result.message || 'Unknown error'));
-        }
-
-    } catch (error) {
-        console.error('Error reporting post:', error);
-        if (error.message.includes('already reported')) {
-            alert('You have already reported this post.');
-        } else {
-            alert('Failed to report post. Please try again.');
-        }
-    }
-}
@@ -4,8 +4,11 @@ function loadProfileData() {
     const dislikedPostsContainer = document.getElementById('Disliked');
     const commentsContainer = document.getElementById('Profile');
 
-    // Load user reports for moderators
+    // Load the reports the user has filed
     loadUserReports();
+    // and, for moderators, the content awaiting review and the posts taken out of the forum
+    loadReviewQueue();
+    loadModeratedPosts();
 
     // Validate containers
     if (!createdPostsContainer || !likedPostsContainer || !dislikedPostsContainer || !commentsContainer) {
@@ -16,6 +19,18 @@ function loadProfileData() {
     // Load moderation request section for normal users
     loadModerationRequestSection();
 
+    // Load the user's active sessions
+    loadSessions();
+
+    // Load the login providers the user has linked
+    loadIdentities();
+
+    // Offer to resend the verification email if the address is not verified yet
+    loadEmailVerificationSection();
+
+    // Show the two-factor authentication settings
+    loadTwoFactorSection();
+
     // Show loading messages
     [createdPostsContainer, likedPostsContainer, dislikedPostsContainer].forEach(container => {
         container.innerHTML = '<p style="text-align: center">Loading posts...</p>';
@@ -109,7 +124,7 @@ function loadProfileData() {
     
                 const postMeta = document.createElement('div');
                 postMeta.classList.add('post-meta');
-                postMeta.textContent = formatDate(post.PostDate);
+                postMeta.textContent = formatDate(post.PostDate) + (post.editedAt ? ' · edited' : '');
     
                 postHeader.appendChild(postTitle);
                 postHeader.appendChild(postMeta);
@@ -117,7 +132,7 @@ function loadProfileData() {
                 // Post Content
                 const postContent = document.createElement('div');
                 postContent.classList.add('post-content');
-                postContent.textContent = post.content;
+                postContent.innerHTML = post.contentHtml;
     
                 // Post Footer
                 const postFooter = document.createElement('div');
@@ -249,16 +264,10 @@ function loadProfileData() {
                 postElement.appendChild(postHeader);
                 postElement.appendChild(postContent);
     
-                // Post Image (if exists)
-                if (post.imagePath) {
-                    const postImageContainer = document.createElement('div');
-                    postImageContainer.classList.add('post-image');
-                    const postImage = document.createElement('img');
-                    postImage.src = post.imagePath;
-                    postImage.alt = 'Post Image';
-                    postImage.classList.add('image-size');
-                    postImageContainer.appendChild(postImage);
-                    postElement.appendChild(postImageContainer);
+                // Post Images (if any)
+                const postGallery = renderPostGallery(post);
+                if (postGallery) {
+                    postElement.appendChild(postGallery);
                 }
     
                 postElement.appendChild(postFooter);
@@ -383,7 +392,7 @@ async function requestModeration() {
     }
 }
 
-// Load user reports (for moderators)
+// Load the reports the user has filed
 async function loadUserReports() {
     try {
         const response = await fetch('/Data-UserReports', {
@@ -395,7 +404,7 @@ async function loadUserReports() {
         });
 
         if (!response.ok) {
-            // If unauthorized, user is not a moderator, so hide the section
+            // If unauthorized, user is not logged in, so leave the section empty
             if (response.status === 401) {
                 return;
             }
@@ -403,6 +412,8 @@ async function loadUserReports() {
         }
 
         const reports = await response.json();
+        // Reason labels are nice to have; IDs are shown if they cannot be loaded
+        await loadReportReasons().catch(() => null);
         displayUserReports(reports);
     } catch (error) {
         console.error('Error loading user reports:', error);
@@ -424,10 +435,23 @@ function displayUserReports(reports) {
     }
 
     const reportsHTML = reports.map(report => {
-        // Truncate content if too long
-        const truncatedContent = report.PostContent.length > 100
-            ? report.PostContent.substring(0, 100) + '...'
-            : report.PostContent;
+        const target = report.Target;
+        const filing = report.Filings[0] || {};
+
+        // Describe what was reported, truncating content if too long
+        let targetTitle;
+        if (!target.Exists) {
+            targetTitle = `[${report.TargetType.charAt(0).toUpperCase() + report.TargetType.slice(1)} deleted]`;
+        } else if (report.TargetType === 'user') {
+            targetTitle = `User @${escapeHtml(target.Author)}`;
+        } else if (report.TargetType === 'comment') {
+            targetTitle = `Comment on "${escapeHtml(target.Title)}"`;
+        } else {
+            targetTitle = escapeHtml(target.Title);
+        }
+        const truncatedContent = target.Content.length > 100
+            ? target.Content.substring(0, 100) + '...'
+            : target.Content;
 
         let statusClass = report.Status;
         let statusText = report.Status.charAt(0).toUpperCase() + report.Status.slice(1);
@@ -436,7 +460,7 @@ function displayUserReports(reports) {
         if (report.AdminResponse && report.AdminResponse.trim() !== '') {
             adminResponseHTML = `
                 <div class="admin-response">
-                    <strong>Admin Response:</strong> ${report.AdminResponse}
+                    <strong>Admin Response:</strong> ${escapeHtml(report.AdminResponse)}
                     ${report.ResponseDate ? `<div class="response-date">Responded on: ${formatDate(report.ResponseDate)}</div>` : ''}
                 </div>
             `;
@@ -446,13 +470,14 @@ function displayUserReports(reports) {
             <div class="user-report-item">
                 <div class="report-header">
                     <div class="report-info">
-                        <div class="report-post-title"><strong>${report.PostTitle}</strong></div>
-                        <div class="report-post-author">by @${report.PostAuthor}</div>
+                        <div class="report-post-title"><strong>${targetTitle}</strong></div>
+                        ${target.Exists && report.TargetType !== 'user' ? `<div class="report-post-author">by @${escapeHtml(target.Author)}</div>` : ''}
                     </div>
-                    <div class="report-date">${formatDate(report.ReportDate)}</div>
+                    <div class="report-date">${formatDate(filing.CreatedAt)}</div>
                 </div>
-                <div class="report-content">${truncatedContent}</div>
-                <div class="report-reason"><strong>Reason:</strong> ${report.Reason}</div>
+                ${truncatedContent ? `<div class="report-content">${escapeHtml(truncatedContent)}</div>` : ''}
+                <div class="report-reason"><strong>Reason:</strong> ${escapeHtml(reportReasonLabel(filing.Reason))}</div>
+                ${filing.Note ? `<div class="report-note">${escapeHtml(filing.Note)}</div>` : ''}
                 <div class="report-status ${statusClass}">${statusText}</div>
                 ${adminResponseHTML}
             </div>
@@ -469,5 +494,237 @@ function formatDate(dateString) {
     return date.toLocaleDateString() + ' ' + date.toLocaleTimeString([], {hour: '2-digit', minute:'2-digit'});
 }
 
+// Show the email verification section while the user's address is unverified
+async function loadEmailVerificationSection() {
+    const section = document.getElementById('email-verification-section');
+    if (!section) return;
+
+    try {
+        const response = await fetch('/auth/status', { method: 'GET', credentials: 'same-origin' });
+        const authData = await response.json();
+        section.style.display = authData.authenticated && !authData.email_verified ? 'block' : 'none';
+    } catch (error) {
+        console.error('Error loading email verification status:', error);
+    }
+}
+
+// Ask the server to send a new verification email
+async function requestEmailVerification() {
+    const status = document.getElementById('email-verification-status');
+    try {
+        const response = await fetch('/Data-RequestEmailVerification', {
+            method: 'POST',
+            headers: { 'X-Requested-With': 'XMLHttpRequest' }
+        });
+        status.textContent = response.ok
+            ? 'Verification email sent. Check your inbox.'
+            : await response.text();
+    } catch (error) {
+        console.error('Error requesting verification email:', error);
+    }
+}
+
+// Load the user's active sessions into the Active Sessions section
+async function loadSessions() {
+    const container = document.getElementById('sessions-list');
+    if (!container) return;
+
+    try {
+        const response = await fetch('/Data-Sessions', {
+            method: 'GET',
+            headers: { 'X-Requested-With': 'XMLHttpRequest' }
+        });
+        if (!response.ok) {
+            container.textContent = 'Could not load sessions.';
+            return;
+        }
+
+        const sessions = await response.json();
+        container.innerHTML = '';
+        sessions.forEach(session => {
+            const row = document.createElement('div');
+            row.className = 'session-row';
+
+            const details = document.createElement('div');
+            details.className = 'session-details';
+            const agent = document.createElement('div');
+            agent.className = 'session-agent';
+            agent.textContent = (session.userAgent || 'Unknown browser') + (session.current ? ' (this device)' : '');
+            const meta = document.createElement('div');
+            meta.className = 'session-meta';
+            meta.textContent = `${session.ipAddress || 'unknown IP'} · last seen ${formatDate(session.lastSeen)} · signed in ${formatDate(session.createdAt)}`;
+            details.append(agent, meta);
+            row.appendChild(details);
+
+            const revokeBtn = document.createElement('button');
+            revokeBtn.className = 'session-revoke-btn';
+            revokeBtn.textContent = session.current ? 'Log out' : 'Revoke';
+            revokeBtn.addEventListener('click', () => revokeSession(session.id, session.current));
+            row.appendChild(revokeBtn);
+
+            container.appendChild(row);
+        });
+    } catch (error) {
+        console.error('Error loading sessions:', error);
+        container.textContent = 'Could not load sessions.';
+    }
+}
+
+// Revoke one session; revoking the current one logs this browser out
+async function revokeSession(sessionId, isCurrent) {
+    try {
+        const response = await fetch('/Data-RevokeSession', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify({ sessionId })
+        });
+        if (!response.ok) {
+            alert('Failed to revoke session: ' + await response.text());
+            return;
+        }
+        if (isCurrent) {
+            window.location.href = '/';
+            return;
+        }
+        loadSessions();
+    } catch (error) {
+        console.error('Error revoking session:', error);
+    }
+}
+
+// Log out every session except this one
+async function revokeOtherSessions() {
+    try {
+        const response = await fetch('/Data-RevokeOtherSessions', {
+            method: 'POST',
+            headers: { 'X-Requested-With': 'XMLHttpRequest' }
+        });
+        if (!response.ok) {
+            alert('Failed to log out other sessions: ' + await response.text());
+            return;
+        }
+        loadSessions();
+    } catch (error) {
+        console.error('Error revoking sessions:', error);
+    }
+}
+
+// Change the password; the server logs out every other session on success
+async function changePassword(event) {
+    event.preventDefault();
+    const form = event.target;
+    const status = document.getElementById('change-password-status');
+
+    try {
+        const response = await fetch('/Data-ChangePassword', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify({
+                currentPassword: form.currentPassword.value,
+                newPassword: form.newPassword.value,
+                confirmPassword: form.confirmPassword.value
+            })
+        });
+        if (!response.ok) {
+            status.style.color = 'red';
+            status.textContent = await response.text();
+            return;
+        }
+        form.reset();
+        status.style.color = 'green';
+        status.textContent = 'Password changed. You have been logged out everywhere else.';
+        loadSessions();
+    } catch (error) {
+        console.error('Error changing password:', error);
+    }
+}
+
+// List the login providers, with a link or unlink button for each
+async function loadIdentities() {
+    const container = document.getElementById('identities-list');
+    if (!container) return;
+
+    try {
+        const response = await fetch('/Data-Identities', {
+            method: 'GET',
+            headers: { 'X-Requested-With': 'XMLHttpRequest' }
+        });
+        if (!response.ok) {
+            container.textContent = 'Could not load linked accounts.';
+            return;
+        }
+
+        const identities = await response.json();
+        container.innerHTML = '';
+        if (identities.length === 0) {
+            container.textContent = 'No login providers are set up.';
+            return;
+        }
+        identities.forEach(identity => {
+            const row = document.createElement('div');
+            row.className = 'session-row';
+
+            const details = document.createElement('div');
+            details.className = 'session-details';
+            const name = document.createElement('div');
+            name.className = 'session-agent';
+            name.textContent = identity.displayName;
+            const meta = document.createElement('div');
+            meta.className = 'session-meta';
+            meta.textContent = identity.linked
+                ? `${identity.email || 'linked'} · last used ${formatDate(identity.lastUsedAt)}`
+                : 'Not linked';
+            details.append(name, meta);
+            row.appendChild(details);
+
+            const button = document.createElement('button');
+            button.className = identity.linked ? 'session-revoke-btn' : 'identity-link-btn';
+            button.textContent = identity.linked ? 'Unlink' : 'Link';
+            button.addEventListener('click', () => {
+                if (identity.linked) {
+                    unlinkIdentity(identity.provider);
+                } else {
+                    window.location.href = identity.linkUrl;
+                }
+            });
+            row.appendChild(button);
+
+            container.appendChild(row);
+        });
+    } catch (error) {
+        console.error('Error loading linked accounts:', error);
+        container.textContent = 'Could not load linked accounts.';
+    }
+}
+
+async function unlinkIdentity(provider) {
+    try {
+        const response = await fetch('/Data-UnlinkIdentity', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify({ provider })
+        });
+        if (!response.ok) {
+            alert('Failed to unlink account: ' + await response.text());
+            return;
+        }
+        loadIdentities();
+    } catch (error) {
+        console.error('Error unlinking account:', error);
+    }
+}
+
 // Make function globally available
-window.requestModeration = requestModeration;
\ No newline at end of file
+window.requestModeration = requestModeration;
+window.revokeOtherSessions = revokeOtherSessions;
+window.changePassword = changePassword;
+window.requestEmailVerification = requestEmailVerification;
\ No newline at end of file
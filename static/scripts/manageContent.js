@@ -46,6 +46,19 @@ function showEditPostModal(postData) {
                         <label for="edit-post-content">Content:</label>
                         <textarea id="edit-post-content" rows="6" required>${escapeHtml(postData.content)}</textarea>
                     </div>
+                    <div class="form-group">
+                        <label>Images:</label>
+                        <div id="edit-post-images">
+                            ${(postData.images || []).map(image => `
+                                <div class="edit-post-image" data-image-id="${image.imageId}">
+                                    <img src="${image.imagePath.thumbnail}" alt="${escapeHtml(image.altText)}" class="image-size">
+                                    <input type="text" class="edit-image-alt" maxlength="300" placeholder="Alt text" value="${escapeHtml(image.altText)}">
+                                    <label><input type="checkbox" class="edit-image-remove"> Remove</label>
+                                </div>
+                            `).join('')}
+                        </div>
+                        <input type="file" id="edit-post-new-images" accept=".jpg,.jpeg,.png,.gif,.webp" multiple>
+                    </div>
                     <div class="form-actions">
                         <button type="button" onclick="closeEditModal()">Cancel</button>
                         <button type="submit">Save Changes</button>
@@ -75,24 +88,37 @@ async function savePostEdit() {
         return;
     }
 
+    // The gallery is sent as the images to keep, in order, followed by the new uploads
+    const keptImages = Array.from(document.querySelectorAll('#edit-post-images .edit-post-image'))
+        .filter(row => !row.querySelector('.edit-image-remove').checked)
+        .map(row => ({
+            image_id: Number(row.dataset.imageId),
+            alt_text: row.querySelector('.edit-image-alt').value.trim()
+        }));
+
+    const formData = new FormData();
+    formData.append('post_id', postId);
+    formData.append('title', title);
+    formData.append('content', content);
+    formData.append('images', JSON.stringify(keptImages));
+    Array.from(document.getElementById('edit-post-new-images').files).forEach(file => {
+        formData.append('image', file);
+        formData.append('alt', '');
+    });
+
     try {
         const response = await fetch('/Data-EditPost', {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json',
                 'X-Requested-With': 'XMLHttpRequest'
             },
-            body: JSON.stringify({
-                post_id: postId,
-                title: title,
-                content: content
-            })
+            body: formData
         });
 
         const result = await response.json();
 
         if (result.success) {
-            alert('Post updated successfully');
+            alert(result.message || 'Post updated successfully');
             closeEditModal();
             // Refresh the current page to show updated content
             location.reload();
@@ -192,7 +218,7 @@ async function saveCommentEdit() {
         const result = await response.json();
 
         if (result.success) {
-            alert('Comment updated successfully');
+            alert(result.message || 'Comment updated successfully');
             closeEditModal();
             // Refresh the current page to show updated content
             location.reload();
@@ -0,0 +1,239 @@
+// Post moderation for moderators and admins: pinning, locking, hiding and restoring posts, and
+// reviewing what the content filter held back
+
+// Create the pin, lock and hide buttons for the footer of a post
+function createModerationButtons(post) {
+    const buttons = [
+        {
+            title: post.pinned ? 'Unpin Post' : 'Pin Post',
+            icon: 'push_pin',
+            onclick: () => setPostPinned(post.PostID, !post.pinned)
+        },
+        {
+            title: post.locked ? 'Unlock Comments' : 'Lock Comments',
+            icon: post.locked ? 'lock_open' : 'lock',
+            onclick: () => setPostLocked(post.PostID, !post.locked)
+        },
+        {
+            title: 'Hide Post',
+            icon: 'visibility_off',
+            onclick: () => hidePost(post.PostID)
+        }
+    ];
+
+    return buttons.map(({ title, icon, onclick }) => {
+        const button = document.createElement('button');
+        button.classList.add('footer-buttons', 'post-button', 'moderation-button');
+        button.title = title;
+        button.onclick = onclick;
+
+        const buttonIcon = document.createElement('i');
+        buttonIcon.classList.add('material-icons');
+        buttonIcon.textContent = icon;
+        button.appendChild(buttonIcon);
+        return button;
+    });
+}
+
+// Send a moderation request and report its outcome
+async function moderatePost(url, body) {
+    try {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify(body)
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || 'Failed to update post');
+        }
+
+        return true;
+    } catch (error) {
+        console.error('Error moderating post:', error);
+        alert(error.message || 'Failed to update post. Please try again.');
+        return false;
+    }
+}
+
+async function setPostPinned(postId, pinned) {
+    if (await moderatePost('/Data-PinPost', { postId: postId, pinned: pinned })) {
+        location.reload();
+    }
+}
+
+async function setPostLocked(postId, locked) {
+    if (await moderatePost('/Data-LockPost', { postId: postId, locked: locked })) {
+        location.reload();
+    }
+}
+
+async function hidePost(postId) {
+    const reason = prompt('Why is this post being hidden? (optional)');
+    if (reason === null) {
+        return;
+    }
+
+    if (await moderatePost('/Data-PostVisibility', { postId: postId, visibility: 'hidden', reason: reason.trim() })) {
+        const postElement = document.getElementById(`post-${postId}`);
+        if (postElement) {
+            postElement.remove();
+        }
+    }
+}
+
+async function restorePost(postId) {
+    if (!confirm('Make this post visible to everyone again?')) {
+        return;
+    }
+
+    if (await moderatePost('/Data-PostVisibility', { postId: postId, visibility: 'visible' })) {
+        loadModeratedPosts();
+    }
+}
+
+// Load the hidden and deleted posts into the moderator section of the profile
+async function loadModeratedPosts() {
+    const container = document.getElementById('moderated-posts');
+    if (!container) return;
+
+    try {
+        const response = await fetch('/Data-ModeratedPosts', {
+            method: 'GET',
+            headers: {
+                'X-Requested-With': 'XMLHttpRequest'
+            }
+        });
+
+        if (!response.ok) {
+            // Only moderators and admins may see these
+            if (response.status === 401) {
+                return;
+            }
+            throw new Error('Failed to load moderated posts');
+        }
+
+        const posts = await response.json();
+        if (posts.length === 0) {
+            container.innerHTML = '<div class="empty-message">No hidden or deleted posts</div>';
+            return;
+        }
+
+        container.innerHTML = posts.map(post => {
+            const state = post.state;
+            const truncatedContent = post.content.length > 100
+                ? post.content.substring(0, 100) + '...'
+                : post.content;
+
+            return `
+                <div class="user-report-item">
+                    <div class="report-header">
+                        <div class="report-info">
+                            <div class="report-post-title"><strong>${escapeHtml(post.title)}</strong></div>
+                            <div class="report-post-author">by @${escapeHtml(post.username)}</div>
+                        </div>
+                        <div class="report-date">${formatDate(state.moderatedAt)}</div>
+                    </div>
+                    <div class="report-content">${escapeHtml(truncatedContent)}</div>
+                    <div class="report-status ${state.visibility === 'deleted' ? 'rejected' : 'pending'}">${state.visibility}</div>
+                    ${state.reason ? `<div class="report-reason"><strong>Reason:</strong> ${escapeHtml(state.reason)}</div>` : ''}
+                    ${state.moderator ? `<div class="report-moderator">By @${escapeHtml(state.moderator)}</div>` : ''}
+                    <button class="btn-approve" onclick="restorePost(${post.PostID})">Restore</button>
+                </div>
+            `;
+        }).join('');
+    } catch (error) {
+        console.error('Error loading moderated posts:', error);
+        container.innerHTML = '<div class="empty-message">Error loading moderated posts</div>';
+    }
+}
+
+// Load the posts and comments the content filter holds for review into the moderator section of the profile
+async function loadReviewQueue() {
+    const container = document.getElementById('review-queue');
+    if (!container) return;
+
+    try {
+        const response = await fetch('/Data-ReviewQueue', {
+            method: 'GET',
+            headers: {
+                'X-Requested-With': 'XMLHttpRequest'
+            }
+        });
+
+        if (!response.ok) {
+            // Only moderators and admins may see these
+            if (response.status === 401) {
+                return;
+            }
+            throw new Error('Failed to load review queue');
+        }
+
+        const held = await response.json();
+        if (held.length === 0) {
+            container.innerHTML = '<div class="empty-message">Nothing is awaiting review</div>';
+            return;
+        }
+
+        container.innerHTML = held.map(item => {
+            const truncatedContent = item.content.length > 300
+                ? item.content.substring(0, 300) + '...'
+                : item.content;
+            const title = item.targetType === 'comment'
+                ? `Comment on "${escapeHtml(item.title)}"`
+                : escapeHtml(item.title);
+
+            return `
+                <div class="user-report-item">
+                    <div class="report-header">
+                        <div class="report-info">
+                            <div class="report-post-title"><strong>${title}</strong></div>
+                            <div class="report-post-author">by @${escapeHtml(item.username)}</div>
+                        </div>
+                        <div class="report-date">${formatDate(item.createdAt)}</div>
+                    </div>
+                    <div class="report-content">${escapeHtml(truncatedContent)}</div>
+                    <div class="report-reason"><strong>Held because it</strong> ${escapeHtml(item.reason)}</div>
+                    <button class="btn-approve" onclick="reviewContent(${item.holdId}, true)">Publish</button>
+                    <button class="btn-reject" onclick="reviewContent(${item.holdId}, false)">Reject</button>
+                </div>
+            `;
+        }).join('');
+    } catch (error) {
+        console.error('Error loading review queue:', error);
+        container.innerHTML = '<div class="empty-message">Error loading review queue</div>';
+    }
+}
+
+// Publish or reject content held for review
+async function reviewContent(holdId, approve) {
+    if (!approve && !confirm('Reject this content? Posts are deleted, comments removed with their replies.')) {
+        return;
+    }
+
+    try {
+        const response = await fetch('/Data-ReviewContent', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify({ holdId: holdId, approve: approve })
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || 'Failed to review content');
+        }
+
+        loadReviewQueue();
+        loadModeratedPosts();
+    } catch (error) {
+        console.error('Error reviewing content:', error);
+        alert(error.message || 'Failed to review content. Please try again.');
+    }
+}
@@ -58,7 +58,7 @@ document.addEventListener('DOMContentLoaded', () => {
                 adminOnly.forEach(section => section.style.display = 'none');
                 moderatorOnly.forEach(section => section.style.display = 'none');
                 if (!validPages.includes('Login','Register')) {
-                    validPages.push('Login','Register');
+                    validPages.push('Login','Register','Forgotpassword','Resetpassword','Twofactor');
                 }
             }
             setupNavigationListeners();
@@ -138,6 +138,17 @@ document.addEventListener('DOMContentLoaded', () => {
         } else if (page === 'AdminDashboard') {
             loadAdminDashboard();
             console.log("Admin dashboard loaded, applying handlers...");
+        } else if (page === 'Login') {
+            loadLoginProviders();
+        } else if (page === 'Register') {
+            loadPendingSignup();
+        } else if (page === 'Twofactor') {
+            loadTwoFactorChallenge();
+        } else if (page === 'Resetpassword') {
+            const resetToken = document.getElementById('resetToken');
+            if (resetToken) {
+                resetToken.value = new URLSearchParams(window.location.search).get('token') || '';
+            }
         } else if (page === 'Createpost') {
             if (typeof loadCategoriesForForm === 'function') {
                 loadCategoriesForForm();
@@ -0,0 +1,130 @@
+// Reporting posts, comments and users
+
+// Report categories, fetched once from the server
+let reportReasons = null;
+
+async function loadReportReasons() {
+    if (reportReasons) {
+        return reportReasons;
+    }
+
+    const response = await fetch('/Data-ReportReasons', {
+        method: 'GET',
+        headers: {
+            'X-Requested-With': 'XMLHttpRequest'
+        }
+    });
+    if (!response.ok) {
+        throw new Error(`${response.status}: ${response.statusText}`);
+    }
+    reportReasons = await response.json();
+    return reportReasons;
+}
+
+// The label of a report category, or its ID if the categories are not loaded
+function reportReasonLabel(id) {
+    const reason = (reportReasons || []).find(reason => reason.id === id);
+    return reason ? reason.label : id || '';
+}
+
+// Create a report button for the footer of a post or comment
+function createReportButton(targetType, targetId, author) {
+    const reportButton = document.createElement('button');
+    reportButton.classList.add('footer-buttons', `${targetType}-button`, 'report-button');
+    reportButton.title = targetType === 'post' ? 'Report Post' : 'Report Comment';
+    reportButton.onclick = () => reportContent(targetType, targetId, author);
+
+    const reportIcon = document.createElement('i');
+    reportIcon.classList.add('material-icons');
+    reportIcon.textContent = 'flag';
+
+    reportButton.appendChild(reportIcon);
+    return reportButton;
+}
+
+// Show the report modal for a post or comment. The author, if given, may be reported instead.
+async function reportContent(targetType, targetId, author) {
+    let reasons;
+    try {
+        reasons = await loadReportReasons();
+    } catch (error) {
+        console.error('Error loading report reasons:', error);
+        alert('Failed to open the report form. Please try again.');
+        return;
+    }
+
+    const modal = document.createElement('div');
+    modal.className = 'edit-modal-overlay';
+    modal.innerHTML = `
+        <div class="edit-modal">
+            <div class="edit-modal-header">
+                <h3>Report ${targetType === 'post' ? 'Post' : targetType === 'comment' ? 'Comment' : 'User'}</h3>
+                <button class="close-modal" onclick="closeEditModal()">&times;</button>
+            </div>
+            <div class="edit-modal-body">
+                <form id="report-form">
+                    ${author ? `
+                    <div class="form-group">
+                        <label for="report-target">What are you reporting?</label>
+                        <select id="report-target">
+                            <option value="${targetType}">This ${targetType}</option>
+                            <option value="user">The user @${escapeHtml(author.username)}</option>
+                        </select>
+                    </div>` : ''}
+                    <div class="form-group">
+                        <label for="report-reason">Reason:</label>
+                        <select id="report-reason" required>
+                            ${reasons.map(reason => `<option value="${reason.id}">${escapeHtml(reason.label)}</option>`).join('')}
+                        </select>
+                    </div>
+                    <div class="form-group">
+                        <label for="report-note">Details (optional):</label>
+                        <textarea id="report-note" rows="4" maxlength="1000" placeholder="Anything the moderators should know"></textarea>
+                    </div>
+                    <div class="form-actions">
+                        <button type="button" onclick="closeEditModal()">Cancel</button>
+                        <button type="submit">Submit Report</button>
+                    </div>
+                </form>
+            </div>
+        </div>
+    `;
+
+    document.body.appendChild(modal);
+
+    document.getElementById('report-form').addEventListener('submit', async (e) => {
+        e.preventDefault();
+        const reportedType = author ? document.getElementById('report-target').value : targetType;
+        await submitReport({
+            targetType: reportedType,
+            targetId: reportedType === 'user' && author ? author.id : targetId,
+            reason: document.getElementById('report-reason').value,
+            note: document.getElementById('report-note').value.trim()
+        });
+    });
+}
+
+// Send a report to the server
+async function submitReport(report) {
+    try {
+        const response = await fetch('/Data-Report', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-Requested-With': 'XMLHttpRequest'
+            },
+            body: JSON.stringify(report)
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(errorText || 'Failed to submit report');
+        }
+
+        closeEditModal();
+        alert('Report submitted. A moderator will review it.');
+    } catch (error) {
+        console.error('Error submitting report:', error);
+        alert(error.message || 'Failed to submit report. Please try again.');
+    }
+}
@@ -0,0 +1,150 @@
+// Second login step: show the enrollment details if the account still has to set up
+// two-factor authentication, otherwise just ask for the code.
+async function loadTwoFactorChallenge() {
+    const errField = document.getElementById('twofactor_err_field');
+    try {
+        const response = await fetch('/Data-TwoFactorChallenge', { method: 'GET', credentials: 'same-origin' });
+        if (!response.ok) {
+            errField.textContent = await response.text();
+            return;
+        }
+        const challenge = await response.json();
+        const enroll = document.getElementById('twofactor-enroll');
+        enroll.style.display = challenge.enroll ? 'block' : 'none';
+        if (challenge.enroll) {
+            document.getElementById('twofactor-uri').href = challenge.uri;
+            document.getElementById('twofactor-secret').textContent = challenge.secret;
+        }
+    } catch (error) {
+        console.error('Error loading two-factor challenge:', error);
+    }
+}
+
+// Send the code of the second login step; a first-time enrollment answers with recovery codes
+async function submitTwoFactorCode(event) {
+    event.preventDefault();
+    const form = event.target;
+    const errField = document.getElementById('twofactor_err_field');
+
+    try {
+        const response = await fetch('/Data-TwoFactorVerify', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ code: form.code.value.trim() })
+        });
+        if (!response.ok) {
+            errField.textContent = await response.text();
+            return;
+        }
+
+        const result = await response.json();
+        if (result.recoveryCodes && result.recoveryCodes.length > 0) {
+            form.style.display = 'none';
+            showRecoveryCodes(document.getElementById('twofactor-recovery-list'), result.recoveryCodes);
+            document.getElementById('twofactor-recovery').style.display = 'block';
+            return;
+        }
+        window.location.href = '/home';
+    } catch (error) {
+        console.error('Error verifying two-factor code:', error);
+    }
+}
+
+// Profile section: reflect whether two-factor authentication is on and which actions apply
+async function loadTwoFactorSection() {
+    const status = document.getElementById('twofactor-status');
+    if (!status) return;
+
+    try {
+        const response = await fetch('/Data-TwoFactorStatus', { method: 'GET', credentials: 'same-origin' });
+        if (!response.ok) return;
+        const tf = await response.json();
+
+        if (tf.enabled) {
+            status.textContent = `Two-factor authentication is on. You have ${tf.recoveryCodesLeft} unused recovery codes.`;
+        } else {
+            status.textContent = 'Two-factor authentication is off.';
+        }
+        document.getElementById('twofactor-setup-btn').style.display = tf.enabled ? 'none' : 'inline-block';
+        document.getElementById('twofactor-enable-btn').style.display = 'none';
+        document.getElementById('twofactor-codes-btn').style.display = tf.enabled ? 'inline-block' : 'none';
+        document.getElementById('twofactor-disable-btn').style.display = tf.enabled && !tf.required ? 'inline-block' : 'none';
+        document.getElementById('twofactor-setup').style.display = 'none';
+    } catch (error) {
+        console.error('Error loading two-factor status:', error);
+    }
+}
+
+async function setupTwoFactor() {
+    const response = await fetch('/Data-TwoFactorSetup', { method: 'POST' });
+    if (!response.ok) {
+        alert(await response.text());
+        return;
+    }
+    const setup = await response.json();
+    document.getElementById('twofactor-setup-uri').href = setup.uri;
+    document.getElementById('twofactor-setup-secret').textContent = setup.secret;
+    document.getElementById('twofactor-setup').style.display = 'block';
+    document.getElementById('twofactor-setup-btn').style.display = 'none';
+    document.getElementById('twofactor-enable-btn').style.display = 'inline-block';
+}
+
+async function enableTwoFactor() {
+    const result = await postTwoFactorCode('/Data-TwoFactorEnable');
+    if (result) {
+        await loadTwoFactorSection();
+        showRecoveryCodes(document.getElementById('twofactor-profile-codes'), result.recoveryCodes);
+    }
+}
+
+async function regenerateRecoveryCodes() {
+    const result = await postTwoFactorCode('/Data-TwoFactorRecoveryCodes');
+    if (result) {
+        await loadTwoFactorSection();
+        showRecoveryCodes(document.getElementById('twofactor-profile-codes'), result.recoveryCodes);
+    }
+}
+
+async function disableTwoFactor() {
+    const result = await postTwoFactorCode('/Data-TwoFactorDisable');
+    if (result) {
+        document.getElementById('twofactor-profile-codes').innerHTML = '';
+        loadTwoFactorSection();
+    }
+}
+
+// POST the code typed into the profile section to url and return the JSON reply, or null on failure
+async function postTwoFactorCode(url) {
+    const input = document.getElementById('twofactor-code');
+    try {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ code: input.value.trim() })
+        });
+        if (!response.ok) {
+            alert(await response.text());
+            return null;
+        }
+        input.value = '';
+        return await response.json();
+    } catch (error) {
+        console.error('Error sending two-factor code:', error);
+        return null;
+    }
+}
+
+function showRecoveryCodes(list, codes) {
+    list.innerHTML = '';
+    (codes || []).forEach(code => {
+        const item = document.createElement('li');
+        item.textContent = code;
+        list.appendChild(item);
+    });
+}
+
+window.submitTwoFactorCode = submitTwoFactorCode;
+window.setupTwoFactor = setupTwoFactor;
+window.enableTwoFactor = enableTwoFactor;
+window.regenerateRecoveryCodes = regenerateRecoveryCodes;
+window.disableTwoFactor = disableTwoFactor;
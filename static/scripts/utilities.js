@@ -1,3 +1,56 @@
+// CSRF protection: every state-changing request has to carry the session's token,
+// which /auth/status hands out. Wrapping fetch (and hooking htmx) keeps the call sites unchanged.
+let csrfToken = '';
+const nativeFetch = window.fetch.bind(window);
+
+async function refreshCsrfToken() {
+    try {
+        const response = await nativeFetch('/auth/status', { method: 'GET', credentials: 'same-origin' });
+        const data = await response.json();
+        csrfToken = data.csrf_token || '';
+    } catch (error) {
+        console.error('Error fetching CSRF token:', error);
+    }
+    return csrfToken;
+}
+
+window.fetch = async (input, init = {}) => {
+    const method = (init.method || 'GET').toUpperCase();
+    if (method === 'GET' || method === 'HEAD') {
+        const response = await nativeFetch(input, init);
+        if (String(input).startsWith('/auth/status')) {
+            response.clone().json().then(data => { csrfToken = data.csrf_token || ''; }).catch(() => {});
+        }
+        return response;
+    }
+
+    if (!csrfToken) {
+        await refreshCsrfToken();
+    }
+    const send = () => {
+        const headers = new Headers(init.headers || {});
+        headers.set('X-CSRF-Token', csrfToken);
+        return nativeFetch(input, { ...init, headers });
+    };
+
+    let response = await send();
+    // The session may have changed since the token was fetched (login, logout): retry once.
+    if (response.status === 403) {
+        const error = await response.clone().json().catch(() => ({}));
+        if (error.code && error.code.startsWith('csrf_')) {
+            await refreshCsrfToken();
+            response = await send();
+        }
+    }
+    return response;
+};
+
+document.addEventListener('htmx:configRequest', event => {
+    event.detail.headers['X-CSRF-Token'] = csrfToken;
+});
+
+refreshCsrfToken();
+
 function formatDate(dateString) {
     const seconds = Math.floor((new Date() - new Date(dateString)) / 1000);
 
@@ -18,6 +71,25 @@ function formatDate(dateString) {
     
     return Math.floor(seconds) + " seconds ago";
 }
+
+// Builds the image gallery of a post: a thumbnail per image, opening the full image when clicked.
+// Returns null for posts without images.
+function renderPostGallery(post) {
+    if (!post.images || post.images.length === 0) {
+        return null;
+    }
+    const postImageContainer = document.createElement('div');
+    postImageContainer.classList.add('post-image');
+    post.images.forEach(image => {
+        const postImage = document.createElement('img');
+        postImage.src = image.imagePath.thumbnail;
+        postImage.alt = image.altText || 'Post Image';
+        postImage.classList.add('image-size');
+        postImage.addEventListener('click', () => window.open(image.imagePath.full, '_blank'));
+        postImageContainer.appendChild(postImage);
+    });
+    return postImageContainer;
+}
   
 async function handlePostInteraction(event,distination) {
     event.preventDefault(); 
@@ -35,6 +107,12 @@ async function handlePostInteraction(event,distination) {
             }
         });
 
+        // Muted and banned users may not react
+        if (response.status === 403) {
+            alert(await response.text());
+            return;
+        }
+
         const data = await response.json();
         if (data.error && data.error === 'no userid') {
             return; // Do nothing if the error is "no userid"
@@ -56,3 +134,55 @@ async function handlePostInteraction(event,distination) {
     }   
 }
 
+
+// Show a login button for every OAuth provider the server has configured
+const oauthIcons = { google: '../images/google-icon.png', github: '../images/github-icon.png' };
+
+async function loadLoginProviders() {
+    const container = document.getElementById('oauth-buttons');
+    if (!container || container.dataset.loaded) return;
+
+    try {
+        const response = await fetch('/auth/providers', { method: 'GET', credentials: 'same-origin' });
+        if (!response.ok) return;
+        const providers = await response.json();
+
+        providers.forEach(provider => {
+            const button = document.createElement('a');
+            button.className = `submit-button oauth-btn ${provider.name}-btn`;
+            button.href = provider.loginUrl;
+            if (oauthIcons[provider.name]) {
+                const icon = document.createElement('img');
+                icon.src = oauthIcons[provider.name];
+                icon.alt = provider.displayName;
+                button.appendChild(icon);
+            }
+            button.appendChild(document.createTextNode(`Sign in with ${provider.displayName}`));
+            container.appendChild(button);
+        });
+        container.dataset.loaded = 'true';
+        container.style.display = providers.length > 0 ? 'flex' : 'none';
+    } catch (error) {
+        console.error('Error loading login providers:', error);
+    }
+}
+
+// Fill in the registration form from the OAuth account a new user signed in with, if any
+async function loadPendingSignup() {
+    const note = document.getElementById('oauth-signup-note');
+    if (!note) return;
+
+    try {
+        const response = await fetch('/auth/signup', { method: 'GET', credentials: 'same-origin' });
+        if (response.status !== 200) return;
+        const pending = await response.json();
+
+        document.getElementById('fistName').value = pending.firstname || '';
+        document.getElementById('lastName').value = pending.lastname || '';
+        document.getElementById('Email').value = pending.email || '';
+        note.textContent = `Finish creating your account to sign in with ${pending.displayName}.`;
+        note.style.display = 'block';
+    } catch (error) {
+        console.error('Error loading pending signup:', error);
+    }
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"forum/config"
+	"strings"
+)
+
+// LocalURLPrefix is where the forum serves the files of the local store from.
+const LocalURLPrefix = "/uploads/"
+
+// ErrInvalidKey is returned for keys that could escape the store, such as ones holding a path.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore keeps uploaded files. Keys are plain file names such as "3f9a….jpg"; a key is written
+// once and never changes content. Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// Put stores data under key with the given content type.
+	Put(key string, data []byte, contentType string) error
+	// Exists reports whether something is stored under key.
+	Exists(key string) (bool, error)
+	// Delete removes key. Deleting a key that does not exist is not an error.
+	Delete(key string) error
+	// URL returns the address a browser can load key from. It may be signed and stop working
+	// after a while, so it has to be asked for every time it is handed out.
+	URL(key string) string
+}
+
+// New returns the BlobStore selected by c.Storage.
+func New(c config.UploadsConfig) (BlobStore, error) {
+	switch c.Storage {
+	case config.StorageLocal:
+		return NewFileStore(c.Dir, LocalURLPrefix)
+	case config.StorageS3:
+		return NewS3Store(c.S3), nil
+	default:
+		return nil, fmt.Errorf("unknown upload storage %q", c.Storage)
+	}
+}
+
+// validateKey rejects keys that are empty or could address something outside the store.
+func validateKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) || strings.ContainsRune(key, 0) {
+		return fmt.Errorf("%w %q", ErrInvalidKey, key)
+	}
+	return nil
+}
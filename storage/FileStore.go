@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps blobs as files in a directory on the local disk. The forum serves them itself
+// under its URL prefix, so the URLs it hands out never expire.
+type FileStore struct {
+	dir       string
+	urlPrefix string
+}
+
+// NewFileStore returns a BlobStore writing into dir, creating it if needed, whose files are served
+// under urlPrefix.
+func NewFileStore(dir, urlPrefix string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating upload directory: %v", err)
+	}
+	return &FileStore{dir: dir, urlPrefix: urlPrefix}, nil
+}
+
+// Put writes data to the file key. It goes to a temporary file first, so a half-written file is
+// never served.
+func (s *FileStore) Put(key string, data []byte, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("error creating file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, key)); err != nil {
+		return fmt.Errorf("error saving file: %v", err)
+	}
+	return nil
+}
+
+// Exists reports whether the file key exists.
+func (s *FileStore) Exists(key string) (bool, error) {
+	if err := validateKey(key); err != nil {
+		return false, err
+	}
+	_, err := os.Stat(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error checking file: %v", err)
+	}
+	return true, nil
+}
+
+// Delete removes the file key.
+func (s *FileStore) Delete(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.dir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing file: %v", err)
+	}
+	return nil
+}
+
+// URL returns the path the forum serves key under.
+func (s *FileStore) URL(key string) string {
+	return s.urlPrefix + url.PathEscape(key)
+}
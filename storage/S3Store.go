@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"forum/config"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3Service        = "s3"
+	s3DateLayout     = "20060102"
+	s3DateTimeLayout = "20060102T150405Z"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	// s3CacheControl is sent with every upload: keys never change content, so caches may keep them.
+	s3CacheControl = "public, max-age=31536000, immutable"
+)
+
+// S3Store keeps blobs in a bucket of Amazon S3 or any service speaking its API, such as MinIO.
+// Requests are signed with AWS Signature Version 4. Browsers load files through presigned URLs,
+// or straight from the bucket's public URL if one is configured.
+type S3Store struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	publicURL string
+	expiry    time.Duration
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3Store returns a BlobStore for the bucket in c. c must have passed config validation.
+func NewS3Store(c config.S3Config) *S3Store {
+	endpoint, _ := url.Parse(strings.TrimSuffix(c.Endpoint, "/"))
+	return &S3Store{
+		endpoint:  endpoint,
+		region:    c.Region,
+		bucket:    c.Bucket,
+		accessKey: c.AccessKeyID,
+		secretKey: c.SecretAccessKey,
+		pathStyle: c.PathStyle,
+		publicURL: strings.TrimSuffix(c.PublicURL, "/"),
+		expiry:    c.URLExpiry.Duration,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		now:       time.Now,
+	}
+}
+
+// Put uploads data as the object key.
+func (s *S3Store) Put(key string, data []byte, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error building S3 request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Cache-Control", s3CacheControl)
+
+	resp, err := s.do(req, data)
+	if err != nil {
+		return fmt.Errorf("error uploading %s to S3: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error uploading %s to S3: %s", key, s3Error(resp))
+	}
+	return nil
+}
+
+// Exists reports whether the object key exists.
+func (s *S3Store) Exists(key string) (bool, error) {
+	if err := validateKey(key); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodHead, s.objectURL(key).String(), nil)
+	if err != nil {
+		return false, fmt.Errorf("error building S3 request: %v", err)
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return false, fmt.Errorf("error checking %s in S3: %v", key, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("error checking %s in S3: %s", key, resp.Status)
+	}
+}
+
+// Delete removes the object key. S3 answers deletes of missing objects with success as well.
+func (s *S3Store) Delete(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return fmt.Errorf("error building S3 request: %v", err)
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return fmt.Errorf("error deleting %s from S3: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("error deleting %s from S3: %s", key, s3Error(resp))
+	}
+	return nil
+}
+
+// URL returns a presigned GET URL for key, or its public URL if the bucket has one.
+// Presigned URLs are signed as of the start of the current half expiry period, so every URL handed
+// out stays valid for at least half of the expiry, and URLs stay the same, and cacheable, within
+// one period.
+func (s *S3Store) URL(key string) string {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + url.PathEscape(key)
+	}
+
+	signedAt := s.now().UTC().Truncate(s.expiry / 2)
+	u := s.objectURL(key)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(signedAt))
+	query.Set("X-Amz-Date", signedAt.Format(s3DateTimeLayout))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(s.expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	u.RawQuery = canonicalQuery(query)
+
+	headers := http.Header{}
+	headers.Set("Host", u.Host)
+	signature := s.signature(http.MethodGet, u, headers, []string{"host"}, s3UnsignedBody, signedAt)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String()
+}
+
+// objectURL returns the URL of the object key, with the bucket in the path or in the host name.
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = u.Path + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	u.RawPath = ""
+	return &u
+}
+
+// do signs req, whose body is payload, and sends it.
+func (s *S3Store) do(req *http.Request, payload []byte) (*http.Response, error) {
+	now := s.now().UTC()
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", now.Format(s3DateTimeLayout))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		signed = append(signed, strings.ToLower(name))
+	}
+	sort.Strings(signed)
+
+	signature := s.signature(req.Method, req.URL, req.Header, signed, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, s.scope(now), strings.Join(signed, ";"), signature))
+	// net/http sends the Host header from req.Host, not from the header map.
+	req.Header.Del("Host")
+	return s.client.Do(req)
+}
+
+// signature computes the Signature Version 4 signature of a request.
+func (s *S3Store) signature(method string, u *url.URL, headers http.Header, signed []string, payloadHash string, at time.Time) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers.Get(name)) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI(u.Path),
+		u.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		at.Format(s3DateTimeLayout),
+		s.scope(at),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), at.Format(s3DateLayout))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// scope is the credential scope of a signature made at at.
+func (s *S3Store) scope(at time.Time) string {
+	return at.Format(s3DateLayout) + "/" + s.region + "/" + s3Service + "/aws4_request"
+}
+
+// canonicalURI encodes path the way SigV4 wants: every byte but the unreserved characters and the
+// slashes is percent-encoded, including the ones net/url leaves alone in paths, such as $ and @.
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery encodes query sorted by key, with spaces as %20 rather than +, as SigV4 wants.
+func canonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Error describes a failed S3 response, including the start of the XML error it carries.
+func s3Error(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if len(body) == 0 {
+		return resp.Status
+	}
+	return resp.Status + ": " + strings.TrimSpace(string(body))
+}
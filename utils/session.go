@@ -1,13 +1,111 @@
 package utils
 
 import (
-	"net"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
 )
 
+const (
+	// SessionCookieName is the name of the cookie that carries the session ID.
+	SessionCookieName = "sessionID"
+	// LoginChallengeCookieName is the name of the cookie that carries a pending two-factor login.
+	LoginChallengeCookieName = "loginChallenge"
+	// OAuthStateCookieName is the name of the cookie that ties an OAuth callback to the browser that started the login.
+	OAuthStateCookieName = "oauthState"
+	// OAuthSignupCookieName is the name of the cookie that carries an OAuth account waiting to be registered.
+	OAuthSignupCookieName = "oauthSignup"
+)
+
+// SetSessionCookie issues the session cookie for token, valid until expiry.
+//
+// The cookie is HttpOnly so scripts cannot read it, Secure so it only travels over HTTPS,
+// and SameSite=Lax so it is not sent on cross-site subrequests while still surviving
+// top-level navigations such as the OAuth callback redirects.
+//
+// Parameters:
+//   - w: The http.ResponseWriter the Set-Cookie header is written to.
+//   - token: The session ID.
+//   - expiry: When the cookie (and the session) expire.
+func SetSessionCookie(w http.ResponseWriter, token string, expiry time.Time) {
+	setHardenedCookie(w, SessionCookieName, token, expiry)
+}
+
+// ClearSessionCookie tells the browser to drop the session cookie.
+//
+// Parameters:
+//   - w: The http.ResponseWriter the Set-Cookie header is written to.
+func ClearSessionCookie(w http.ResponseWriter) {
+	clearHardenedCookie(w, SessionCookieName)
+}
+
+// SetLoginChallengeCookie issues the cookie that remembers a login waiting for its second factor.
+// It has the same attributes as the session cookie.
+//
+// Parameters:
+//   - w: The http.ResponseWriter the Set-Cookie header is written to.
+//   - token: The login challenge token.
+//   - expiry: When the challenge expires.
+func SetLoginChallengeCookie(w http.ResponseWriter, token string, expiry time.Time) {
+	setHardenedCookie(w, LoginChallengeCookieName, token, expiry)
+}
+
+// ClearLoginChallengeCookie tells the browser to drop the login challenge cookie.
+//
+// Parameters:
+//   - w: The http.ResponseWriter the Set-Cookie header is written to.
+func ClearLoginChallengeCookie(w http.ResponseWriter) {
+	clearHardenedCookie(w, LoginChallengeCookieName)
+}
+
+// SetOAuthCookie issues one of the OAuth cookies (OAuthStateCookieName or OAuthSignupCookieName).
+// It has the same attributes as the session cookie; SameSite=Lax still lets it through on the
+// provider's redirect back to the callback, which is a top-level navigation.
+//
+// Parameters:
+//   - w: The http.ResponseWriter the Set-Cookie header is written to.
+//   - name: The cookie name.
+//   - value: The signed cookie value.
+//   - expiry: When the cookie expires.
+func SetOAuthCookie(w http.ResponseWriter, name, value string, expiry time.Time) {
+	setHardenedCookie(w, name, value, expiry)
+}
+
+// ClearOAuthCookie tells the browser to drop one of the OAuth cookies.
+//
+// Parameters:
+//   - w: The http.ResponseWriter the Set-Cookie header is written to.
+//   - name: The cookie name.
+func ClearOAuthCookie(w http.ResponseWriter, name string) {
+	clearHardenedCookie(w, name)
+}
+
+func setHardenedCookie(w http.ResponseWriter, name, value string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Expires:  expiry,
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearHardenedCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
 // generateSessionToken creates a new session token using a UUID version 4.
 //
 // This function generates a unique session token by creating a new UUID version 4.
@@ -23,38 +121,3 @@ func GenerateSessionToken() (string, error) {
 	}
 	return u.String(), nil
 }
-
-// getIP extracts the client's IP address from an HTTP request.
-//
-// This function attempts to determine the client's IP address by checking various
-// HTTP headers and the request's remote address. It prioritizes the following
-// sources in order:
-//  1. X-Forwarded-For header
-//  2. X-Real-IP header
-//  3. RemoteAddr from the request
-//
-// Parameters:
-//   - r: An *http.Request object representing the incoming HTTP request.
-//
-// Returns:
-//   - string: The extracted IP address as a string. If no valid IP address is
-//     found in the headers, it returns the remote address from the request.
-func GetIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		ip := strings.Split(forwarded, ",")[0]
-		return strings.TrimSpace(ip)
-	}
-
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
-	}
-
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-
-	return ip
-}